@@ -3,6 +3,7 @@ package btree
 import (
 	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"slices"
 
@@ -31,14 +32,24 @@ type nodeStore[K Key] interface {
 	Find(context.Context, NodeID) (*Node[K], bool, error)
 }
 
+// BTree is safe for concurrent use.
+//
+// Operations latch the nodes they go through, releasing a parent once the
+// child is latched. Writers first try latching the leaf they write to only,
+// and go through the tree again latching every node that may split if the leaf
+// is full. Scans keep their latches until they are done, so that they see the
+// tree as it was at a single point in time.
 type BTree[K Key] struct {
-	order  int
-	store  nodeStore[K]
-	rootID NodeID
+	order   int
+	store   nodeStore[K]
+	rootID  NodeID
+	latches latches
+	cow     *cow
 }
 
 type options struct {
 	order int
+	meta  metaStore
 }
 
 type Option func(*options)
@@ -62,6 +73,9 @@ func New[K Key](store nodeStore[K], opts ...Option) *BTree[K] {
 		order: opt.order,
 		store: store,
 	}
+	if opt.meta != nil {
+		btree.cow = newCow(opt.meta)
+	}
 
 	return &btree
 }
@@ -96,6 +110,18 @@ func (b *BTree[K]) root(ctx context.Context, nodeID NodeID) (*Node[K], bool, err
 	return root, true, nil
 }
 
+func (b *BTree[K]) load(ctx context.Context, id NodeID) (*Node[K], error) {
+	node, ok, err := b.store.Find(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("following node ref: %w", err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("node %s: %w", id, storage.ErrTableNotFound)
+	}
+
+	return node, nil
+}
+
 func (b *BTree[K]) updateRoot(ctx context.Context, curr *Node[K], refs []*Ref[K]) error {
 	rootID := curr.ID()
 	curr.id = newNodeID()
@@ -121,6 +147,32 @@ func (b *BTree[K]) Set(ctx context.Context, node string, key K, val []byte) erro
 }
 
 func (b *BTree[K]) set(ctx context.Context, node string, key K, val []byte, update bool) error {
+	kv := &KeyVal[K]{
+		Key: key,
+		Val: val,
+	}
+
+	if b.cow != nil {
+		return b.setCopy(ctx, NodeID(node), kv, update)
+	}
+
+	if update {
+		// the tree is only written through below if it does not exist yet.
+		err := b.Update(ctx, node, key, func([]byte) ([]byte, bool) { return val, true })
+		if !errors.Is(err, storage.ErrTableNotFound) {
+			return err
+		}
+	} else {
+		done, err := b.setInLeaf(ctx, node, kv)
+		if err != nil || done {
+			return err
+		}
+	}
+
+	var h held
+	defer h.release()
+
+	h.push(b.latches.lock(NodeID(node)))
 	root, ok, err := b.root(ctx, NodeID(node))
 	if err != nil {
 		return fmt.Errorf("acquire root: %w", err)
@@ -130,10 +182,7 @@ func (b *BTree[K]) set(ctx context.Context, node string, key K, val []byte, upda
 		return b.createRoot(ctx, NodeID(node), key, val)
 	}
 
-	newRoot, err := b.insert(ctx, root, &KeyVal[K]{
-		Key: key,
-		Val: val,
-	}, update)
+	newRoot, err := b.insert(ctx, &h, root, kv, update)
 	if err != nil {
 		return err
 	}
@@ -143,155 +192,361 @@ func (b *BTree[K]) set(ctx context.Context, node string, key K, val []byte, upda
 	}
 
 	return nil
-
 }
 
-func (b *BTree[K]) Get(ctx context.Context, node string, key K) ([][]byte, error) {
-	root, ok, err := b.root(ctx, NodeID(node))
-	if err != nil {
-		return nil, fmt.Errorf("acquire root: %w", err)
+// setInLeaf adds kv latching only the leaf it is inserted in exclusively.
+// It gives up when the tree does not exist yet, or when the leaf would have to split.
+func (b *BTree[K]) setInLeaf(ctx context.Context, node string, kv *KeyVal[K]) (bool, error) {
+	n, unlock, ok, err := b.descend(ctx, NodeID(node), kv.Key, true)
+	if err != nil || !ok {
+		return false, err
 	}
-	if !ok {
-		return nil, storage.ErrTableNotFound
+	defer unlock()
+
+	if !b.safe(n, false) {
+		return false, nil
 	}
 
-	got, err := b.get(ctx, root, key)
-	if err != nil {
-		return nil, err
+	n.SetKeys(withKey(n.Keys(), kv, false))
+	if err := b.store.Save(ctx, n); err != nil {
+		return false, fmt.Errorf("save node: %w", err)
 	}
-	return got, nil
+	return true, nil
 }
 
-func (b *BTree[K]) Scan(ctx context.Context, node string) ([][]byte, error) {
-	root, ok, err := b.root(ctx, NodeID(node))
-	if err != nil {
-		return nil, fmt.Errorf("acquire root: %w", err)
-	}
-	if !ok {
-		return nil, storage.ErrTableNotFound
+// safe returns true if writing to n cannot make it split.
+func (b *BTree[K]) safe(n *Node[K], update bool) bool {
+	if n.Leaf() {
+		return update || len(n.Keys()) < b.order
 	}
-
-	return b.dump(ctx, root)
+	return len(n.Refs()) < b.order
 }
 
-func (b *BTree[K]) dump(ctx context.Context, n *Node[K]) ([][]byte, error) {
-	if !n.Leaf() {
-		out := make([][][]byte, 0, b.order)
-		// TODO parallel (needs benchmark)
-		for _, r := range n.Refs() {
-			c, ok, err := b.store.Find(ctx, r.N)
-			if err != nil {
-				return nil, err
-			}
-			if !ok {
-				return nil, storage.ErrTableNotFound
-			}
+// descend goes down to the leaf where key is inserted, crabbing shared latches
+// along the way. The leaf is returned latched, exclusively if asked to, along
+// with the function releasing its latch.
+func (b *BTree[K]) descend(ctx context.Context, id NodeID, key K, exclusive bool) (*Node[K], func(), bool, error) {
+	unlock := b.latches.rlock(id)
+	n, ok, err := b.root(ctx, id)
+	if err != nil || !ok {
+		unlock()
+		return nil, nil, false, err
+	}
 
-			b, err := b.dump(ctx, c)
-			if err != nil {
-				return nil, err
-			}
+	// the root may turn into an internal node while no latch is held on it,
+	// in which case it stays exclusively latched while going down.
+	if exclusive && n.Leaf() {
+		unlock()
+		unlock = b.latches.lock(id)
+		n, ok, err = b.root(ctx, id)
+		if err != nil || !ok {
+			unlock()
+			return nil, nil, false, err
+		}
+	}
+
+	for !n.Leaf() {
+		ref, err := n.child(key)
+		if err != nil {
+			unlock()
+			return nil, nil, false, err
+		}
 
-			out = append(out, b)
+		unlockChild := b.latches.rlock(ref.N)
+		c, err := b.load(ctx, ref.N)
+		// as the parent is latched, the child cannot split and is still a leaf once latched again.
+		if err == nil && exclusive && c.Leaf() {
+			unlockChild()
+			unlockChild = b.latches.lock(ref.N)
+			c, err = b.load(ctx, ref.N)
 		}
-		return slices.Concat(out...), nil
+		unlock()
+		unlock = unlockChild
+		if err != nil {
+			unlock()
+			return nil, nil, false, err
+		}
+		n = c
 	}
 
-	out := make([][]byte, 0, b.order)
-	for _, kv := range n.keys {
-		out = append(out, kv.Val)
+	return n, unlock, true, nil
+}
+
+func (b *BTree[K]) Get(ctx context.Context, node string, key K) ([][]byte, error) {
+	var found [][]byte
+	err := b.read(ctx, NodeID(node), func(root NodeID) error {
+		var err error
+		found, err = b.get(ctx, root, key)
+		return err
+	})
+	return found, err
+}
+
+// read calls fn with the root node of the tree, which is kept readable until fn returns.
+func (b *BTree[K]) read(ctx context.Context, tree NodeID, fn func(root NodeID) error) error {
+	if b.cow == nil {
+		return fn(tree)
 	}
-	return out, nil
+
+	root, gen, err := b.cow.pin(ctx, tree)
+	if err != nil {
+		return err
+	}
+	defer b.cow.unpin(ctx, gen)
+
+	return fn(root)
 }
 
-func (b *BTree[K]) get(ctx context.Context, n *Node[K], k K) ([][]byte, error) {
-	if n.Leaf() {
-		var found [][]byte
+func (b *BTree[K]) get(ctx context.Context, root NodeID, key K) ([][]byte, error) {
+	var found [][]byte
+	err := b.walk(ctx, root, &key, &key, false, func(n *Node[K]) error {
 		for _, kv := range n.Keys() {
-			if kv.Key == k {
+			if kv.Key == key {
 				found = append(found, kv.Val)
 			}
 		}
-		return found, nil
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return found, nil
+}
 
-	sub, err := b.findInNode(ctx, n, k)
+func (b *BTree[K]) Scan(ctx context.Context, node string) ([][]byte, error) {
+	kvs, err := b.Entries(ctx, node)
 	if err != nil {
 		return nil, err
 	}
 
-	return b.get(ctx, sub, k)
+	out := make([][]byte, 0, len(kvs))
+	for _, kv := range kvs {
+		out = append(out, kv.Val)
+	}
+	return out, nil
 }
 
-func (b *BTree[K]) findInNode(ctx context.Context, n *Node[K], k K) (*Node[K], error) {
-	var ref *Ref[K]
-	for _, r := range n.Refs() {
-		if r.To == nil || *r.To > k {
-			ref = r
-			break
+// Entries returns every key-value pair stored in the tree, in key order.
+func (b *BTree[K]) Entries(ctx context.Context, node string) ([]*KeyVal[K], error) {
+	var out []*KeyVal[K]
+	err := b.read(ctx, NodeID(node), func(root NodeID) error {
+		var err error
+		out, err = b.entries(ctx, root)
+		return err
+	})
+	return out, err
+}
+
+func (b *BTree[K]) entries(ctx context.Context, root NodeID) ([]*KeyVal[K], error) {
+	out := make([]*KeyVal[K], 0, b.order)
+	err := b.walk(ctx, root, nil, nil, false, func(n *Node[K]) error {
+		out = append(out, n.Keys()...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// errLimit stops a walk once it read enough pairs.
+var errLimit = errors.New("limit reached")
+
+// Range returns the key-value pairs stored in the tree from from, included, to
+// to, excluded, in key order. A nil bound leaves the range open on its side.
+// With a limit above 0, Range stops at the first key past the limit-th pair,
+// so that it returns either every pair of a key or none.
+func (b *BTree[K]) Range(ctx context.Context, node string, from, to *K, limit int) ([]*KeyVal[K], error) {
+	var out []*KeyVal[K]
+	err := b.read(ctx, NodeID(node), func(root NodeID) error {
+		return b.walk(ctx, root, from, to, false, func(n *Node[K]) error {
+			for _, kv := range n.Keys() {
+				if (from != nil && kv.Key < *from) || (to != nil && kv.Key >= *to) {
+					continue
+				}
+				if limit > 0 && len(out) >= limit && kv.Key != out[len(out)-1].Key {
+					return errLimit
+				}
+				out = append(out, kv)
+			}
+			return nil
+		})
+	})
+	if err != nil && !errors.Is(err, errLimit) {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Update calls fn with every value stored under key, and saves the ones fn reports as changed.
+func (b *BTree[K]) Update(ctx context.Context, node string, key K, fn func(val []byte) ([]byte, bool)) error {
+	if b.cow != nil {
+		return b.updateCopy(ctx, NodeID(node), key, fn)
+	}
+
+	return b.walk(ctx, NodeID(node), &key, &key, true, func(n *Node[K]) error {
+		var changed bool
+		for _, kv := range n.Keys() {
+			if kv.Key != key {
+				continue
+			}
+			if val, ok := fn(kv.Val); ok {
+				kv.Val = val
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
 		}
+
+		if err := b.store.Save(ctx, n); err != nil {
+			return fmt.Errorf("save updated node: %w", err)
+		}
+		return nil
+	})
+}
+
+// Prune removes every key-value pair for which fn returns true.
+// Leaves are left in place, even when they end up empty.
+func (b *BTree[K]) Prune(ctx context.Context, node string, fn func(key K, val []byte) bool) error {
+	if b.cow != nil {
+		return b.pruneCopy(ctx, NodeID(node), fn)
 	}
 
-	node, ok, err := b.store.Find(ctx, ref.N)
+	return b.walk(ctx, NodeID(node), nil, nil, true, func(n *Node[K]) error {
+		keys := slices.DeleteFunc(slices.Clone(n.Keys()), func(kv *KeyVal[K]) bool {
+			return fn(kv.Key, kv.Val)
+		})
+		if len(keys) == len(n.Keys()) {
+			return nil
+		}
+
+		n.SetKeys(keys)
+		if err := b.store.Save(ctx, n); err != nil {
+			return fmt.Errorf("save pruned node: %w", err)
+		}
+		return nil
+	})
+}
+
+// walk calls fn with every leaf of the tree which may hold keys from from to
+// to, both included, in key order. A nil bound leaves the walk open on its side.
+// Every node stays latched until the walk is done, leaves exclusively if asked to.
+func (b *BTree[K]) walk(ctx context.Context, id NodeID, from, to *K, exclusive bool, fn func(*Node[K]) error) error {
+	var h held
+	defer h.release()
+
+	h.push(b.latches.rlock(id))
+	root, ok, err := b.root(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("following node ref: %w", err)
+		return fmt.Errorf("acquire root: %w", err)
 	}
 	if !ok {
-		return nil, fmt.Errorf("%w: %w", storage.ErrTableNotFound, err)
+		return storage.ErrTableNotFound
+	}
+	if exclusive && root.Leaf() {
+		h.release()
+		h.push(b.latches.lock(id))
+		root, ok, err = b.root(ctx, id)
+		if err != nil {
+			return fmt.Errorf("acquire root: %w", err)
+		}
+		if !ok {
+			return storage.ErrTableNotFound
+		}
 	}
 
-	return node, nil
+	return b.walkNode(ctx, &h, root, from, to, exclusive, fn)
+}
+
+func (b *BTree[K]) walkNode(ctx context.Context, h *held, n *Node[K], from, to *K, exclusive bool, fn func(*Node[K]) error) error {
+	if n.Leaf() {
+		return fn(n)
+	}
+
+	// TODO parallel (needs benchmark)
+	for _, r := range n.Refs() {
+		if !r.overlaps(from, to) {
+			continue
+		}
+		unlock := b.latches.rlock(r.N)
+		c, err := b.load(ctx, r.N)
+		if err == nil && exclusive && c.Leaf() {
+			unlock()
+			unlock = b.latches.lock(r.N)
+			c, err = b.load(ctx, r.N)
+		}
+		h.push(unlock)
+		if err != nil {
+			return err
+		}
+
+		if err := b.walkNode(ctx, h, c, from, to, exclusive, fn); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (b *BTree[K]) insert(ctx context.Context, n *Node[K], kv *KeyVal[K], update bool) ([]*Ref[K], error) {
+// insert writes kv in the subtree of n, holding exclusive latches on every
+// node that may split. It returns the refs to the two halves of n if it split.
+func (b *BTree[K]) insert(ctx context.Context, h *held, n *Node[K], kv *KeyVal[K], update bool) ([]*Ref[K], error) {
 	var keys []*KeyVal[K] = n.Keys()
 	var refs []*Ref[K] = n.Refs()
 
-	var movingUp []*Ref[K]
 	if !n.Leaf() {
-		r, err := b.findInNode(ctx, n, kv.Key)
+		ref, err := n.child(kv.Key)
 		if err != nil {
 			return nil, fmt.Errorf("find node to insert value: %w", err)
 		}
 
-		movingUp, err = b.insert(ctx, r, kv, update)
+		h.push(b.latches.lock(ref.N))
+		r, err := b.load(ctx, ref.N)
+		if err != nil {
+			return nil, fmt.Errorf("find node to insert value: %w", err)
+		}
+		if b.safe(r, update) {
+			h.releaseAncestors()
+		}
+
+		movingUp, err := b.insert(ctx, h, r, kv, update)
 		if err != nil {
 			return nil, err
 		}
-		if movingUp != nil {
-			refs = insertRefs(n.Refs(), movingUp)
-			movingUp = nil
+		if movingUp == nil {
+			return nil, nil
 		}
+		refs = replaceRef(n.Refs(), ref, movingUp)
 	} else {
-		if update {
-			for i := range n.keys {
-				if n.keys[i].Key == kv.Key {
-					n.keys[i].Val = kv.Val
-				}
-			}
-		} else {
-			keys = append(n.Keys(), kv)
-		}
-		slices.SortFunc(keys, func(a, b *KeyVal[K]) int {
-			switch {
-			case a.Key < b.Key:
-				return -1
-			case a.Key > b.Key:
-				return 1
-			default:
-				return 0
-			}
+		keys = withKey(n.Keys(), kv, update)
+	}
+
+	if len(keys) > b.order || len(refs) > b.order {
+		return b.split(keys, refs, func(n *Node[K]) error {
+			return b.store.Save(ctx, n)
 		})
 	}
 
+	n.SetKeys(keys)
+	n.SetRefs(refs)
+	if err := b.store.Save(ctx, n); err != nil {
+		return nil, fmt.Errorf("save node: %w", err)
+	}
+	return nil, nil
+}
+
+// split saves the keys or refs of an overflowing node into two new nodes,
+// and returns the refs to them.
+func (b *BTree[K]) split(keys []*KeyVal[K], refs []*Ref[K], save func(*Node[K]) error) ([]*Ref[K], error) {
 	if len(keys) > b.order {
 		mid := (b.order + 1) / 2
 		left := leaf(keys[:mid])
-		if err := b.store.Save(ctx, left); err != nil {
+		if err := save(left); err != nil {
 			return nil, fmt.Errorf("split node: %w", err)
 		}
 		right := leaf(keys[mid:])
-		if err := b.store.Save(ctx, right); err != nil {
+		if err := save(right); err != nil {
 			return nil, fmt.Errorf("split node: %w", err)
 		}
 
@@ -309,57 +564,62 @@ func (b *BTree[K]) insert(ctx context.Context, n *Node[K], kv *KeyVal[K], update
 		}, nil
 	}
 
-	if len(refs) > b.order {
-		mid := (b.order + 1) / 2
-		left := nonLeaf(refs[:mid])
-		if err := b.store.Save(ctx, left); err != nil {
-			return nil, fmt.Errorf("split node: %w", err)
-		}
-
-		right := nonLeaf(refs[mid:])
-		if err := b.store.Save(ctx, right); err != nil {
-			return nil, fmt.Errorf("split node: %w", err)
-		}
+	mid := (b.order + 1) / 2
+	left := nonLeaf(refs[:mid])
+	if err := save(left); err != nil {
+		return nil, fmt.Errorf("split node: %w", err)
+	}
 
-		return []*Ref[K]{
-			{
-				From: nil,
-				To:   refs[mid].From,
-				N:    left.ID(),
-			},
-			{
-				From: refs[mid].From,
-				To:   nil,
-				N:    right.ID(),
-			},
-		}, nil
+	right := nonLeaf(refs[mid:])
+	if err := save(right); err != nil {
+		return nil, fmt.Errorf("split node: %w", err)
 	}
 
-	n.SetKeys(keys)
-	n.SetRefs(refs)
-	b.store.Save(ctx, n)
-	return movingUp, nil
-}
-
-func insertRefs[K Key](refs []*Ref[K], new []*Ref[K]) []*Ref[K] {
-	var merged []*Ref[K]
-
-	for _, curr := range refs {
-		if (curr.From == nil || *new[0].To > *curr.From) &&
-			(curr.To == nil || *new[0].To < *curr.To) {
-
-			merged = append(merged, &Ref[K]{
-				From: curr.From,
-				To:   new[0].To,
-				N:    new[0].N,
-			}, &Ref[K]{
-				From: new[0].To, // or new[1].from
-				To:   curr.To,
-				N:    new[1].N,
-			})
-		} else {
-			merged = append(merged, curr)
+	return []*Ref[K]{
+		{
+			From: nil,
+			To:   refs[mid].From,
+			N:    left.ID(),
+		},
+		{
+			From: refs[mid].From,
+			To:   nil,
+			N:    right.ID(),
+		},
+	}, nil
+}
+
+// withKey returns the keys of a leaf once kv is written to it, in key order.
+// Neither keys nor the pairs in it are modified.
+func withKey[K Key](keys []*KeyVal[K], kv *KeyVal[K], update bool) []*KeyVal[K] {
+	keys = slices.Clone(keys)
+	if update {
+		for i := range keys {
+			if keys[i].Key == kv.Key {
+				keys[i] = &KeyVal[K]{Key: kv.Key, Val: kv.Val}
+			}
 		}
+	} else {
+		keys = append(keys, kv)
 	}
-	return merged
+	slices.SortFunc(keys, func(a, b *KeyVal[K]) int {
+		switch {
+		case a.Key < b.Key:
+			return -1
+		case a.Key > b.Key:
+			return 1
+		default:
+			return 0
+		}
+	})
+	return keys
+}
+
+// replaceRef returns refs where old is replaced by the refs of its copy,
+// which span the same keys.
+func replaceRef[K Key](refs []*Ref[K], old *Ref[K], with []*Ref[K]) []*Ref[K] {
+	i := slices.Index(refs, old)
+	with[0].From = old.From
+	with[len(with)-1].To = old.To
+	return slices.Concat(refs[:i], with, refs[i+1:])
 }
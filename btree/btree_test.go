@@ -2,6 +2,8 @@ package btree
 
 import (
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 type treeFmt struct {
@@ -14,9 +16,10 @@ func ptr[T any](t T) *T {
 	return &t
 }
 
-func Test_insertRefs(t *testing.T) {
+func Test_replaceRef(t *testing.T) {
 	tests := map[string]struct {
 		given  []*Ref[int]
+		old    int
 		adding []*Ref[int]
 		want   []*Ref[int]
 	}{
@@ -37,20 +40,74 @@ func Test_insertRefs(t *testing.T) {
 				{
 					From: ptr(15),
 					To:   nil,
-					N:    "13",
+					N:    "14",
 				},
 			},
 			want: []*Ref[int]{
 				{
 					From: ptr(10),
 					To:   ptr(15),
-					N:    "12",
+					N:    "13",
 				},
 				{
 					From: ptr(15),
 					To:   ptr(20),
+					N:    "14",
+				},
+			},
+		},
+		"split at the lower bound": {
+			given: []*Ref[int]{
+				{
+					From: nil,
+					To:   ptr(10),
+					N:    "11",
+				},
+				{
+					From: ptr(10),
+					To:   ptr(20),
+					N:    "12",
+				},
+				{
+					From: ptr(20),
+					To:   nil,
+					N:    "15",
+				},
+			},
+			old: 1,
+			adding: []*Ref[int]{
+				{
+					From: nil,
+					To:   ptr(10),
 					N:    "13",
 				},
+				{
+					From: ptr(10),
+					To:   nil,
+					N:    "14",
+				},
+			},
+			want: []*Ref[int]{
+				{
+					From: nil,
+					To:   ptr(10),
+					N:    "11",
+				},
+				{
+					From: ptr(10),
+					To:   ptr(10),
+					N:    "13",
+				},
+				{
+					From: ptr(10),
+					To:   ptr(20),
+					N:    "14",
+				},
+				{
+					From: ptr(20),
+					To:   nil,
+					N:    "15",
+				},
 			},
 		},
 	}
@@ -58,15 +115,10 @@ func Test_insertRefs(t *testing.T) {
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
-			got := insertRefs(tc.given, tc.adding)
+			got := replaceRef(tc.given, tc.given[tc.old], tc.adding)
 
-			for i := range got {
-				if *got[i].From != *tc.want[i].From {
-					t.Errorf("index %d: got from=%d, want %d", i, *got[i].From, *tc.want[i].From)
-				}
-				if *got[i].To != *tc.want[i].To {
-					t.Errorf("index %d: got to=%d, want %d", i, *got[i].To, *tc.want[i].To)
-				}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("replaceRef() mismatch (-want,+got): %s", diff)
 			}
 		})
 	}
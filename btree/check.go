@@ -0,0 +1,102 @@
+package btree
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+)
+
+// Issue is an inconsistency found in a tree.
+type Issue struct {
+	Node NodeID
+	Desc string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("node %s: %s", i.Node, i.Desc)
+}
+
+// Check walks the tree, and reports its inconsistencies along with the ID of
+// every node reachable from its root.
+func (b *BTree[K]) Check(ctx context.Context, node string) ([]Issue, []NodeID, error) {
+	var c checker[K]
+	err := b.read(ctx, NodeID(node), func(root NodeID) error {
+		var h held
+		defer h.release()
+
+		h.push(b.latches.rlock(root))
+		n, ok, err := b.store.Find(ctx, root)
+		if err != nil {
+			c.reached = append(c.reached, root)
+			c.issue(root, fmt.Sprintf("unreadable: %v", err))
+			return nil
+		}
+		if !ok {
+			c.issue(root, "missing root")
+			return nil
+		}
+
+		b.checkNode(ctx, &h, &c, n, nil, nil)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c.issues, c.reached, nil
+}
+
+type checker[K Key] struct {
+	issues  []Issue
+	reached []NodeID
+}
+
+func (c *checker[K]) issue(id NodeID, desc string) {
+	c.issues = append(c.issues, Issue{Node: id, Desc: desc})
+}
+
+// checkNode checks the subtree of n, whose keys are expected between from and to.
+// Keys equal to to are let through, as duplicate keys may straddle a split.
+func (b *BTree[K]) checkNode(ctx context.Context, h *held, c *checker[K], n *Node[K], from, to *K) {
+	c.reached = append(c.reached, n.ID())
+
+	if n.Leaf() {
+		if !slices.IsSortedFunc(n.Keys(), func(a, b *KeyVal[K]) int { return cmp.Compare(a.Key, b.Key) }) {
+			c.issue(n.ID(), "keys out of order")
+		}
+		for _, kv := range n.Keys() {
+			if (from != nil && kv.Key < *from) || (to != nil && kv.Key > *to) {
+				c.issue(n.ID(), fmt.Sprintf("key %v out of range of its ref", kv.Key))
+			}
+		}
+		return
+	}
+
+	for i, r := range n.Refs() {
+		if i > 0 && !sameBound(n.Refs()[i-1].To, r.From) {
+			c.issue(n.ID(), fmt.Sprintf("refs out of order at %d", i))
+		}
+
+		h.push(b.latches.rlock(r.N))
+		child, ok, err := b.store.Find(ctx, r.N)
+		if err != nil {
+			c.reached = append(c.reached, r.N)
+			c.issue(r.N, fmt.Sprintf("unreadable: %v", err))
+			continue
+		}
+		if !ok {
+			c.issue(n.ID(), fmt.Sprintf("dangling ref to %s", r.N))
+			continue
+		}
+
+		b.checkNode(ctx, h, c, child, r.From, r.To)
+	}
+}
+
+func sameBound[K Key](a, b *K) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,375 @@
+package btree
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/aliphe/filadb/db/storage"
+)
+
+// metaStore persists the meta page of copy-on-write trees, mapping each tree to its root node.
+type metaStore interface {
+	Roots(context.Context) (map[NodeID]NodeID, error)
+	// SaveRoots replaces the meta page atomically.
+	SaveRoots(context.Context, map[NodeID]NodeID) error
+	Delete(context.Context, NodeID) error
+}
+
+// WithCopyOnWrite never modifies a saved node: writes save a copy of every
+// node on the path to the root, then swap the root of the tree in the meta page.
+func WithCopyOnWrite(meta metaStore) Option {
+	return func(o *options) {
+		o.meta = meta
+	}
+}
+
+// cow keeps track of the roots of copy-on-write trees.
+// Each swap of a root starts a new generation. Nodes made unreachable by a swap
+// are deleted once no reader is pinned to an earlier generation.
+type cow struct {
+	meta    metaStore
+	writers latches
+
+	mu    sync.Mutex
+	roots map[NodeID]NodeID
+	gen   uint64
+	pins  map[uint64]int
+	freed []freed
+}
+
+// freed lists the nodes which are unreachable from gen onwards.
+type freed struct {
+	gen uint64
+	ids []NodeID
+}
+
+func newCow(meta metaStore) *cow {
+	return &cow{
+		meta: meta,
+		pins: make(map[uint64]int),
+	}
+}
+
+// root returns the root node of the tree.
+// Trees missing from the meta page are looked up under their own ID, as written
+// before copy-on-write was enabled.
+func (c *cow) root(ctx context.Context, tree NodeID) (NodeID, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.rootLocked(ctx, tree)
+}
+
+func (c *cow) rootLocked(ctx context.Context, tree NodeID) (NodeID, error) {
+	if c.roots == nil {
+		roots, err := c.meta.Roots(ctx)
+		if err != nil {
+			return "", fmt.Errorf("load meta page: %w", err)
+		}
+		c.roots = roots
+		if c.roots == nil {
+			c.roots = make(map[NodeID]NodeID)
+		}
+	}
+
+	if root, ok := c.roots[tree]; ok {
+		return root, nil
+	}
+	return tree, nil
+}
+
+// pin returns the root node of the tree, whose nodes are kept until unpin is
+// called with the returned generation.
+func (c *cow) pin(ctx context.Context, tree NodeID) (NodeID, uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	root, err := c.rootLocked(ctx, tree)
+	if err != nil {
+		return "", 0, err
+	}
+	c.pins[c.gen]++
+	return root, c.gen, nil
+}
+
+func (c *cow) unpin(ctx context.Context, gen uint64) {
+	c.mu.Lock()
+	c.pins[gen]--
+	if c.pins[gen] == 0 {
+		delete(c.pins, gen)
+	}
+	ids := c.collect()
+	c.mu.Unlock()
+
+	c.free(ctx, ids)
+}
+
+// swap points the tree to its new root in the meta page, and frees the nodes
+// the previous root was the only one to reach.
+func (c *cow) swap(ctx context.Context, tree, root NodeID, obsolete []NodeID) error {
+	c.mu.Lock()
+	roots := maps.Clone(c.roots)
+	roots[tree] = root
+	if err := c.meta.SaveRoots(ctx, roots); err != nil {
+		c.mu.Unlock()
+		return fmt.Errorf("save meta page: %w", err)
+	}
+	c.roots = roots
+	c.gen++
+	c.freed = append(c.freed, freed{gen: c.gen, ids: obsolete})
+	ids := c.collect()
+	c.mu.Unlock()
+
+	c.free(ctx, ids)
+	return nil
+}
+
+// collect returns the nodes no pinned generation can reach anymore.
+func (c *cow) collect() []NodeID {
+	oldest := c.gen
+	for gen := range c.pins {
+		oldest = min(oldest, gen)
+	}
+
+	var ids []NodeID
+	i := 0
+	for ; i < len(c.freed) && c.freed[i].gen <= oldest; i++ {
+		ids = append(ids, c.freed[i].ids...)
+	}
+	c.freed = slices.Delete(c.freed, 0, i)
+	return ids
+}
+
+func (c *cow) free(ctx context.Context, ids []NodeID) {
+	for _, id := range ids {
+		if err := c.meta.Delete(ctx, id); err != nil {
+			slog.Warn("free node", slog.String("node", string(id)), slog.Any("err", err))
+		}
+	}
+}
+
+// cowWrite tracks the nodes saved and made obsolete by a write to a copy-on-write tree.
+type cowWrite struct {
+	saved    []NodeID
+	obsolete []NodeID
+}
+
+// writeCopy calls fn with the root of the tree, and swaps it for the root fn
+// returns. An empty root means fn left the tree unchanged.
+func (b *BTree[K]) writeCopy(ctx context.Context, tree NodeID, fn func(*cowWrite, *Node[K], bool) (NodeID, error)) error {
+	unlock := b.cow.writers.lock(tree)
+	defer unlock()
+
+	id, err := b.cow.root(ctx, tree)
+	if err != nil {
+		return err
+	}
+	root, ok, err := b.root(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	var w cowWrite
+	newRoot, err := fn(&w, root, ok)
+	if err == nil && newRoot != "" {
+		err = b.cow.swap(ctx, tree, newRoot, w.obsolete)
+	}
+	if err != nil {
+		b.cow.free(ctx, w.saved)
+		return err
+	}
+	return nil
+}
+
+func (b *BTree[K]) setCopy(ctx context.Context, tree NodeID, kv *KeyVal[K], update bool) error {
+	return b.writeCopy(ctx, tree, func(w *cowWrite, root *Node[K], ok bool) (NodeID, error) {
+		if !ok {
+			n := leaf([]*KeyVal[K]{kv})
+			if err := b.saveCopy(ctx, w, n); err != nil {
+				return "", fmt.Errorf("save root node: %w", err)
+			}
+			return n.ID(), nil
+		}
+
+		refs, err := b.copyPath(ctx, w, root, kv.Key, update, func(keys []*KeyVal[K]) ([]*KeyVal[K], bool) {
+			return withKey(keys, kv, update), true
+		})
+		if err != nil {
+			return "", err
+		}
+		return b.copyRoot(ctx, w, refs)
+	})
+}
+
+func (b *BTree[K]) updateCopy(ctx context.Context, tree NodeID, key K, fn func([]byte) ([]byte, bool)) error {
+	return b.writeCopy(ctx, tree, func(w *cowWrite, root *Node[K], ok bool) (NodeID, error) {
+		if !ok {
+			return "", storage.ErrTableNotFound
+		}
+
+		refs, err := b.copyPath(ctx, w, root, key, true, func(keys []*KeyVal[K]) ([]*KeyVal[K], bool) {
+			keys = slices.Clone(keys)
+			var changed bool
+			for i, kv := range keys {
+				if kv.Key != key {
+					continue
+				}
+				if val, ok := fn(kv.Val); ok {
+					keys[i] = &KeyVal[K]{Key: kv.Key, Val: val}
+					changed = true
+				}
+			}
+			return keys, changed
+		})
+		if err != nil {
+			return "", err
+		}
+		return b.copyRoot(ctx, w, refs)
+	})
+}
+
+func (b *BTree[K]) pruneCopy(ctx context.Context, tree NodeID, fn func(K, []byte) bool) error {
+	return b.writeCopy(ctx, tree, func(w *cowWrite, root *Node[K], ok bool) (NodeID, error) {
+		if !ok {
+			return "", storage.ErrTableNotFound
+		}
+
+		refs, err := b.copyPruned(ctx, w, root, fn)
+		if err != nil {
+			return "", err
+		}
+		return b.copyRoot(ctx, w, refs)
+	})
+}
+
+// copyPath copies the nodes on the paths to the leaves fn changed the keys of:
+// every leaf which may hold key if all is set, or the one key is inserted in.
+// It returns the refs replacing n in its parent, or nil if fn left the leaves
+// unchanged.
+func (b *BTree[K]) copyPath(ctx context.Context, w *cowWrite, n *Node[K], key K, all bool, fn func([]*KeyVal[K]) ([]*KeyVal[K], bool)) ([]*Ref[K], error) {
+	if n.Leaf() {
+		keys, changed := fn(n.Keys())
+		if !changed {
+			return nil, nil
+		}
+		return b.copyNode(ctx, w, n, keys, nil)
+	}
+
+	var path []*Ref[K]
+	if all {
+		for _, r := range n.Refs() {
+			if r.spans(key) {
+				path = append(path, r)
+			}
+		}
+	} else {
+		ref, err := n.child(key)
+		if err != nil {
+			return nil, err
+		}
+		path = append(path, ref)
+	}
+
+	refs := n.Refs()
+	var changed bool
+	for _, r := range path {
+		c, err := b.load(ctx, r.N)
+		if err != nil {
+			return nil, err
+		}
+		with, err := b.copyPath(ctx, w, c, key, all, fn)
+		if err != nil {
+			return nil, err
+		}
+		if with != nil {
+			refs = replaceRef(refs, r, with)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil, nil
+	}
+	return b.copyNode(ctx, w, n, nil, refs)
+}
+
+// copyPruned copies every node leading to a leaf with keys fn removes.
+func (b *BTree[K]) copyPruned(ctx context.Context, w *cowWrite, n *Node[K], fn func(K, []byte) bool) ([]*Ref[K], error) {
+	if n.Leaf() {
+		keys := slices.DeleteFunc(slices.Clone(n.Keys()), func(kv *KeyVal[K]) bool {
+			return fn(kv.Key, kv.Val)
+		})
+		if len(keys) == len(n.Keys()) {
+			return nil, nil
+		}
+		return b.copyNode(ctx, w, n, keys, nil)
+	}
+
+	refs := n.Refs()
+	var changed bool
+	for _, r := range n.Refs() {
+		c, err := b.load(ctx, r.N)
+		if err != nil {
+			return nil, err
+		}
+		with, err := b.copyPruned(ctx, w, c, fn)
+		if err != nil {
+			return nil, err
+		}
+		if with != nil {
+			refs = replaceRef(refs, r, with)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil, nil
+	}
+	return b.copyNode(ctx, w, n, nil, refs)
+}
+
+// copyNode saves a copy of n with the given keys and refs, split in two if
+// they overflow it.
+func (b *BTree[K]) copyNode(ctx context.Context, w *cowWrite, n *Node[K], keys []*KeyVal[K], refs []*Ref[K]) ([]*Ref[K], error) {
+	w.obsolete = append(w.obsolete, n.ID())
+
+	if len(keys) > b.order || len(refs) > b.order {
+		return b.split(keys, refs, func(n *Node[K]) error {
+			return b.saveCopy(ctx, w, n)
+		})
+	}
+
+	c := &Node[K]{
+		id:   newNodeID(),
+		keys: keys,
+		refs: refs,
+	}
+	if err := b.saveCopy(ctx, w, c); err != nil {
+		return nil, fmt.Errorf("save node copy: %w", err)
+	}
+	return []*Ref[K]{{N: c.ID()}}, nil
+}
+
+// copyRoot returns the root node made of the refs replacing the previous one.
+func (b *BTree[K]) copyRoot(ctx context.Context, w *cowWrite, refs []*Ref[K]) (NodeID, error) {
+	switch len(refs) {
+	case 0:
+		return "", nil
+	case 1:
+		return refs[0].N, nil
+	}
+
+	root := nonLeaf(refs)
+	if err := b.saveCopy(ctx, w, root); err != nil {
+		return "", fmt.Errorf("save root node: %w", err)
+	}
+	return root.ID(), nil
+}
+
+// saveCopy saves a node created by the write, which is deleted if the write fails.
+func (b *BTree[K]) saveCopy(ctx context.Context, w *cowWrite, n *Node[K]) error {
+	w.saved = append(w.saved, n.ID())
+	return b.store.Save(ctx, n)
+}
@@ -0,0 +1,5 @@
+package btree
+
+import "errors"
+
+var ErrNotCopyOnWrite = errors.New("btree is not copy-on-write")
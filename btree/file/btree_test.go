@@ -2,12 +2,16 @@ package file
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"slices"
 	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/aliphe/filadb/btree"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 func Test_Btree(t *testing.T) {
@@ -54,3 +58,398 @@ func Test_Btree(t *testing.T) {
 		})
 	}
 }
+
+func Test_Btree_concurrent(t *testing.T) {
+	tests := map[string]struct {
+		cow bool
+	}{
+		"in place":      {},
+		"copy on write": {cow: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			b, err := New[int](WithPath(t.TempDir()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.Close()
+			opts := []btree.Option{btree.WithOrder(4)}
+			if tc.cow {
+				opts = append(opts, btree.WithCopyOnWrite(b))
+			}
+
+			stress(t, btree.New(b, opts...))
+		})
+	}
+}
+
+// stress adds keys from many goroutines while others scan the tree, and checks none was lost.
+func stress(t *testing.T, bt *btree.BTree[int]) {
+	const (
+		workers = 8
+		perW    = 50
+	)
+	ctx := context.Background()
+
+	if err := bt.Add(ctx, "root", -1, []byte("-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*2)
+	for w := range workers {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := range perW {
+				k := w*perW + i
+				if err := bt.Add(ctx, "root", k, []byte(strconv.Itoa(k))); err != nil {
+					errs <- err
+					return
+				}
+				got, err := bt.Get(ctx, "root", k)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if len(got) != 1 {
+					errs <- fmt.Errorf("Get(%d) returned %d values, want 1", k, len(got))
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range perW {
+				kvs, err := bt.Entries(ctx, "root")
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !slices.IsSortedFunc(kvs, func(a, b *btree.KeyVal[int]) int { return a.Key - b.Key }) {
+					errs <- fmt.Errorf("Entries() out of order")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	kvs, err := bt.Entries(ctx, "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make([]int, 0, workers*perW+1)
+	for k := -1; k < workers*perW; k++ {
+		want = append(want, k)
+	}
+	got := make([]int, 0, len(kvs))
+	for _, kv := range kvs {
+		got = append(got, kv.Key)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("Entries() mismatch (-want,+got): %s", diff)
+	}
+}
+
+func Test_Btree_copyOnWrite(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	b, err := New[int](WithPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	bt := btree.New(b, btree.WithOrder(3), btree.WithCopyOnWrite(b))
+	ctx := context.Background()
+
+	for _, a := range []int{1, 2, 3} {
+		if err := bt.Add(ctx, "root", a, []byte(strconv.Itoa(a))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snap, err := bt.Snapshot(ctx, "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range []int{4, 5, 6} {
+		if err := bt.Add(ctx, "root", a, []byte(strconv.Itoa(a))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bt.Set(ctx, "root", 1, []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+
+	kvs, err := snap.Entries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, kv := range kvs {
+		got = append(got, string(kv.Val))
+	}
+	if diff := cmp.Diff([]string{"1", "2", "3"}, got); diff != "" {
+		t.Fatalf("Snapshot.Entries() mismatch (-want,+got): %s", diff)
+	}
+	snap.Release(ctx)
+
+	out, err := bt.Print(ctx, "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("]-∞;3[(one,2)[3;5[(3,4)[5;∞[(5,6)", out); diff != "" {
+		t.Fatalf("Print() mismatch (-want,+got): %s", diff)
+	}
+
+	// once the snapshot is released, only the meta page, the lock file and the nodes of the current tree are left.
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(6, len(files)); diff != "" {
+		t.Fatalf("files mismatch (-want,+got): %s", diff)
+	}
+
+	reopened := btree.New(b, btree.WithOrder(3), btree.WithCopyOnWrite(b))
+	vals, err := reopened.Get(ctx, "root", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([][]byte{[]byte("one")}, vals); diff != "" {
+		t.Fatalf("Get() mismatch (-want,+got): %s", diff)
+	}
+}
+
+func Test_Btree_Load(t *testing.T) {
+	tests := map[string]struct {
+		cow   bool
+		given []int
+		// existing are added before loading.
+		existing []int
+		want     string
+	}{
+		"in place": {
+			given: []int{6, 2, 4, 1, 3, 5, 7},
+			want:  "]-∞;4[(1,2,3)[4;7[(4,5,6)[7;∞[(7)",
+		},
+		"copy on write": {
+			cow:   true,
+			given: []int{6, 2, 4, 1, 3, 5, 7},
+			want:  "]-∞;4[(1,2,3)[4;7[(4,5,6)[7;∞[(7)",
+		},
+		"single leaf": {
+			given: []int{2, 1},
+			want:  "1,2",
+		},
+		"duplicate keys": {
+			given: []int{1, 2, 2, 2, 2, 3},
+			want:  "]-∞;2[(1)[2;3[(2,2,2,2)[3;∞[(3)",
+		},
+		"three layers": {
+			given: []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13},
+			want:  "]-∞;10[(]-∞;4[(1,2,3)[4;7[(4,5,6)[7;10[(7,8,9))[10;∞[([10;13[(10,11,12)[13;∞[(13))",
+		},
+		"existing keys": {
+			existing: []int{1},
+			given:    []int{3, 2},
+			want:     "1,2,3",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			b, err := New[int](WithPath(t.TempDir()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.Close()
+			opts := []btree.Option{btree.WithOrder(3)}
+			if tc.cow {
+				opts = append(opts, btree.WithCopyOnWrite(b))
+			}
+			bt := btree.New(b, opts...)
+			ctx := t.Context()
+
+			for _, k := range tc.existing {
+				if err := bt.Add(ctx, "root", k, []byte(strconv.Itoa(k))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var kvs []*btree.KeyVal[int]
+			for _, k := range tc.given {
+				kvs = append(kvs, &btree.KeyVal[int]{Key: k, Val: []byte(strconv.Itoa(k))})
+			}
+			if err := bt.Load(ctx, "root", kvs); err != nil {
+				t.Fatal(err)
+			}
+
+			out, err := bt.Print(ctx, "root")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, out); diff != "" {
+				t.Fatalf("Print() mismatch (-want,+got): %s", diff)
+			}
+			issues, _, err := bt.Check(ctx, "root")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(issues) > 0 {
+				t.Fatalf("Check() = %v, want no issue", issues)
+			}
+			for _, k := range tc.given {
+				vals, err := bt.Get(ctx, "root", k)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := strconv.Itoa(k); len(vals) == 0 || string(vals[0]) != want {
+					t.Fatalf("Get(%d) = %q, want %s", k, vals, want)
+				}
+			}
+		})
+	}
+}
+
+func Test_Btree_duplicates(t *testing.T) {
+	tests := map[string]struct {
+		cow bool
+	}{
+		"in place": {},
+		"copy on write": {
+			cow: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			b, err := New[string](WithPath(t.TempDir()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.Close()
+			opts := []btree.Option{btree.WithOrder(3)}
+			if tc.cow {
+				opts = append(opts, btree.WithCopyOnWrite(b))
+			}
+			bt := btree.New(b, opts...)
+			ctx := context.Background()
+
+			// duplicates of b fill several leaves, split at b itself.
+			for i, k := range []string{"a", "b", "b", "b", "b", "b", "b", "c"} {
+				if err := bt.Add(ctx, "root", k, []byte(strconv.Itoa(i))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			vals, err := bt.Get(ctx, "root", "b")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(vals) != 6 {
+				t.Fatalf("Get() returned %d values, want 6", len(vals))
+			}
+
+			err = bt.Update(ctx, "root", "b", func(val []byte) ([]byte, bool) {
+				return append([]byte("u"), val...), true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := bt.Set(ctx, "root", "a", []byte("A")); err != nil {
+				t.Fatal(err)
+			}
+			kvs, err := bt.Entries(ctx, "root")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string][]string)
+			for _, kv := range kvs {
+				got[kv.Key] = append(got[kv.Key], string(kv.Val))
+			}
+			want := map[string][]string{
+				"a": {"A"},
+				"b": {"u1", "u2", "u3", "u4", "u5", "u6"},
+				"c": {"7"},
+			}
+			if diff := cmp.Diff(want, got, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+				t.Fatalf("Entries() mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
+
+func Test_Btree_Range(t *testing.T) {
+	from, to := 3, 7
+
+	tests := map[string]struct {
+		from, to *int
+		limit    int
+		want     []int
+	}{
+		"bounded": {
+			from: &from,
+			to:   &to,
+			want: []int{3, 3, 4, 5, 6},
+		},
+		"open start": {
+			to:   &from,
+			want: []int{0, 1, 2},
+		},
+		"open end": {
+			from: &to,
+			want: []int{7, 8, 9},
+		},
+		"empty": {
+			from: &to,
+			to:   &from,
+		},
+		"limit past duplicates": {
+			limit: 4,
+			want:  []int{0, 1, 2, 3, 3},
+		},
+		"limited range": {
+			from:  &from,
+			limit: 2,
+			want:  []int{3, 3},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			b, err := New[int](WithPath(t.TempDir()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.Close()
+			bt := btree.New(b, btree.WithOrder(3))
+			ctx := context.Background()
+
+			for _, k := range []int{5, 0, 9, 3, 7, 1, 3, 8, 2, 6, 4} {
+				if err := bt.Add(ctx, "root", k, []byte(strconv.Itoa(k))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			kvs, err := bt.Range(ctx, "root", tc.from, tc.to, tc.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, kv := range kvs {
+				got = append(got, kv.Key)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("Range() mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
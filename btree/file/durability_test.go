@@ -0,0 +1,178 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aliphe/filadb/btree"
+	"github.com/aliphe/filadb/btree/file/vfs"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_Durability(t *testing.T) {
+	tests := map[string]struct {
+		durability Durability
+		sync       bool
+		want       bool
+	}{
+		"always": {
+			durability: DurabilityAlways,
+			want:       true,
+		},
+		"interval before sync": {
+			durability: DurabilityInterval,
+			want:       false,
+		},
+		"interval after sync": {
+			durability: DurabilityInterval,
+			sync:       true,
+			want:       true,
+		},
+		"none": {
+			durability: DurabilityNone,
+			sync:       true,
+			want:       false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			fs := vfs.NewMem()
+			ctx := context.Background()
+			opts := []Option{WithPath("db"), WithFS(fs), WithDurability(tc.durability), WithSyncInterval(time.Hour)}
+
+			s, err := New[int](opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			n := btree.NewNode[int]("root", []*btree.KeyVal[int]{{Key: 1, Val: []byte("one")}}, nil)
+			if err := s.Save(ctx, n); err != nil {
+				t.Fatal(err)
+			}
+			if tc.sync {
+				if err := s.Sync(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			fs.Crash()
+
+			s, err = New[int](opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			_, ok, err := s.Find(ctx, "root")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, ok); diff != "" {
+				t.Fatalf("Find() mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
+
+func Test_Save_interrupted(t *testing.T) {
+	t.Parallel()
+	mem := vfs.NewMem()
+	fs := vfs.NewFaulty(mem)
+	ctx := context.Background()
+
+	s, err := New[int](WithPath("db"), WithFS(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(ctx, btree.NewNode[int]("root", []*btree.KeyVal[int]{{Key: 1, Val: []byte("one")}}, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	fs.Inject(vfs.Fault{Op: vfs.OpRename, Err: errors.New("power loss")})
+	if err := s.Save(ctx, btree.NewNode[int]("root", []*btree.KeyVal[int]{{Key: 1, Val: []byte("two")}}, nil)); err == nil {
+		t.Fatal("Save() error = nil, want rename failure")
+	}
+	fs.Reset()
+	mem.Crash()
+
+	s, err = New[int](WithPath("db"), WithFS(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	n, ok, err := s.Find(ctx, "root")
+	if err != nil || !ok {
+		t.Fatalf("Find() = %v, %v", ok, err)
+	}
+	if diff := cmp.Diff([]*btree.KeyVal[int]{{Key: 1, Val: []byte("one")}}, n.Keys()); diff != "" {
+		t.Fatalf("Find() mismatch (-want,+got): %s", diff)
+	}
+
+	ids, err := s.Nodes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]btree.NodeID{"root"}, ids); diff != "" {
+		t.Fatalf("Nodes() mismatch (-want,+got): %s", diff)
+	}
+}
+
+func Test_SaveRoots_durability(t *testing.T) {
+	tests := map[string]struct {
+		durability Durability
+	}{
+		"always": {
+			durability: DurabilityAlways,
+		},
+		"interval": {
+			durability: DurabilityInterval,
+		},
+		"none": {
+			durability: DurabilityNone,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			fs := vfs.NewMem()
+			ctx := context.Background()
+			opts := []Option{WithPath("db"), WithFS(fs), WithDurability(tc.durability), WithSyncInterval(time.Hour)}
+
+			s, err := New[int](opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bt := btree.New(s, btree.WithOrder(3), btree.WithCopyOnWrite(s))
+			for k := range 6 {
+				if err := bt.Add(ctx, "root", k, []byte("v")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// the swapped roots are on stable storage along with their nodes.
+			fs.Crash()
+
+			s, err = New[int](opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			bt = btree.New(s, btree.WithOrder(3), btree.WithCopyOnWrite(s))
+			issues, _, err := bt.Check(ctx, "root")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(issues) > 0 {
+				t.Fatalf("Check() found issues: %v", issues)
+			}
+			kvs, err := bt.Entries(ctx, "root")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) != 6 {
+				t.Fatalf("got %d keys after crash, want 6", len(kvs))
+			}
+		})
+	}
+}
@@ -1,5 +1,20 @@
 package file
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aliphe/filadb/btree"
+)
 
 var ErrExpectedDirectory = errors.New("expected directory")
+
+// ErrCorruptNode is returned when a node file fails verification.
+type ErrCorruptNode struct {
+	ID     btree.NodeID
+	Reason string
+}
+
+func (e *ErrCorruptNode) Error() string {
+	return fmt.Sprintf("corrupt node %s: %s", e.ID, e.Reason)
+}
@@ -0,0 +1,104 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/aliphe/filadb/btree"
+	"github.com/aliphe/filadb/btree/file/vfs"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_Btree_faults(t *testing.T) {
+	tests := map[string]struct {
+		fault vfs.Fault
+		want  error
+	}{
+		"no space left": {
+			fault: vfs.Fault{Op: vfs.OpWrite, Err: syscall.ENOSPC},
+			want:  syscall.ENOSPC,
+		},
+		"short write": {
+			fault: vfs.Fault{Op: vfs.OpWrite, Short: true},
+			want:  io.ErrShortWrite,
+		},
+		"failed sync": {
+			fault: vfs.Fault{Op: vfs.OpSync, Err: syscall.EIO},
+			want:  syscall.EIO,
+		},
+		"failed rename": {
+			fault: vfs.Fault{Op: vfs.OpRename, Err: syscall.EIO},
+			want:  syscall.EIO,
+		},
+		"failure midway through a split": {
+			fault: vfs.Fault{Op: vfs.OpWrite, After: 1, Err: syscall.ENOSPC},
+			want:  syscall.ENOSPC,
+		},
+		"failed meta page swap": {
+			fault: vfs.Fault{Op: vfs.OpRename, Path: "meta.json", Err: syscall.EIO},
+			want:  syscall.EIO,
+		},
+		"failed read": {
+			fault: vfs.Fault{Op: vfs.OpRead, Err: syscall.EIO},
+			want:  syscall.EIO,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			fs := vfs.NewFaulty(vfs.NewMem())
+			s, err := New[int](WithPath("db"), WithFS(fs))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			bt := btree.New(s, btree.WithOrder(3), btree.WithCopyOnWrite(s))
+			ctx := context.Background()
+
+			for i := range 5 {
+				if err := bt.Add(ctx, "root", i, []byte(strconv.Itoa(i))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := bt.Entries(ctx, "root")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fs.Inject(tc.fault)
+			err = bt.Add(ctx, "root", 5, []byte("5"))
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("Add() error = %v, want %v", err, tc.want)
+			}
+			fs.Reset()
+
+			got, err := bt.Entries(ctx, "root")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("Entries() mismatch (-want,+got): %s", diff)
+			}
+
+			issues, reached, err := bt.Check(ctx, "root")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(issues) > 0 {
+				t.Fatalf("Check() = %v", issues)
+			}
+			nodes, err := s.Nodes(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(len(reached), len(nodes)); diff != "" {
+				t.Fatalf("orphaned nodes mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
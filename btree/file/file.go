@@ -5,14 +5,38 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aliphe/filadb/btree"
+	"github.com/aliphe/filadb/btree/file/vfs"
+)
+
+// Durability tells when saved nodes are flushed to stable storage.
+type Durability int
+
+const (
+	// DurabilityAlways syncs every node, and the directory it is renamed in, before Save returns.
+	DurabilityAlways Durability = iota
+	// DurabilityInterval syncs the nodes saved since the last sync periodically.
+	// A crash may lose the nodes saved during the last interval, or leave them corrupt.
+	DurabilityInterval
+	// DurabilityNone leaves flushing to the operating system, but for the nodes
+	// the meta page of copy-on-write trees points to, synced before it.
+	DurabilityNone
 )
 
 type options struct {
-	path string
+	path         string
+	durability   Durability
+	syncInterval time.Duration
+	fs           vfs.FS
 }
 
 type Option func(*options)
@@ -23,74 +47,268 @@ func WithPath(path string) Option {
 	}
 }
 
+func WithDurability(d Durability) Option {
+	return func(o *options) {
+		o.durability = d
+	}
+}
+
+// WithFS runs the store on the given file system, the operating system's by default.
+func WithFS(fs vfs.FS) Option {
+	return func(o *options) {
+		o.fs = fs
+	}
+}
+
+// WithSyncInterval sets how often nodes are synced with DurabilityInterval.
+func WithSyncInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.syncInterval = d
+	}
+}
+
 type BtreeStore[K btree.Key] struct {
-	dir *os.File
+	dir        string
+	fs         vfs.FS
+	durability Durability
+	lock       io.Closer
+
+	mu sync.Mutex
+	// dirty holds the files written since the last sync.
+	dirty map[string]struct{}
+	// syncMu serialises syncs, so that one returns once the files written
+	// before it are synced, even when they were picked up by another.
+	syncMu sync.Mutex
+	stop   chan struct{}
+	done   chan struct{}
 }
 
 func New[K btree.Key](opts ...Option) (*BtreeStore[K], error) {
 	opt := options{
-		path: ".db",
+		path:         ".db",
+		durability:   DurabilityAlways,
+		syncInterval: time.Second,
+		fs:           vfs.OS{},
 	}
 	for _, o := range opts {
 		o(&opt)
 	}
 
-	file, err := initFS(opt.path)
+	// the lock is taken first, for a store in use to be left alone.
+	if err := opt.fs.MkdirAll(opt.path, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("init FS: %w", err)
+	}
+	lock, err := opt.fs.Lock(filepath.Join(opt.path, lockFile))
 	if err != nil {
+		return nil, fmt.Errorf("lock %s: %w", opt.path, err)
+	}
+	if err := initFS(opt.fs, opt.path); err != nil {
+		lock.Close()
 		return nil, err
 	}
 
-	return &BtreeStore[K]{
-		dir: file,
-	}, nil
+	b := &BtreeStore[K]{
+		dir:        opt.path,
+		fs:         opt.fs,
+		durability: opt.durability,
+		lock:       lock,
+		dirty:      make(map[string]struct{}),
+	}
+	if b.durability == DurabilityInterval {
+		b.stop = make(chan struct{})
+		b.done = make(chan struct{})
+		go b.syncEvery(opt.syncInterval)
+	}
+
+	return b, nil
 }
 
+// Close syncs the nodes which are not on stable storage yet, and unlocks the
+// store.
 func (b *BtreeStore[K]) Close() error {
-	return b.dir.Close()
+	if b.stop != nil {
+		close(b.stop)
+		<-b.done
+	}
+	defer b.lock.Close()
+	return b.Sync()
 }
 
-func initFS(path string) (*os.File, error) {
-	err := os.MkdirAll(path, os.ModePerm)
+func initFS(fs vfs.FS, path string) error {
+	err := fs.MkdirAll(path, os.ModePerm)
 	if err != nil {
-		return nil, fmt.Errorf("init FS: %w", err)
+		return fmt.Errorf("init FS: %w", err)
 	}
 
-	f, err := os.Open(path)
+	s, err := fs.Stat(path)
 	if err != nil {
-		return nil, fmt.Errorf("access FS: %w", err)
+		return fmt.Errorf("retrieve file info: %w", err)
+	}
+	if !s.IsDir() {
+		return fmt.Errorf("file %s: %w", path, ErrExpectedDirectory)
 	}
 
-	s, err := f.Stat()
+	// temporary files are left behind by writes interrupted by a crash.
+	entries, err := fs.ReadDir(path)
 	if err != nil {
-		return nil, fmt.Errorf("retrieve file info: %w", err)
+		return fmt.Errorf("list files: %w", err)
 	}
-	if !s.IsDir() {
-		return nil, fmt.Errorf("file %s: %w", f.Name(), ErrExpectedDirectory)
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), tmpSuffix) {
+			if err := fs.Remove(filepath.Join(path, e.Name())); err != nil {
+				return fmt.Errorf("remove temporary file: %w", err)
+			}
+		}
 	}
 
-	return f, nil
+	return nil
 }
 
 func (b *BtreeStore[K]) Save(ctx context.Context, n *btree.Node[K]) error {
-	path := filepath.Join(b.dir.Name(), string(n.ID()))
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	node := node[K]{
+		Keys: n.Keys(),
+		Refs: n.Refs(),
+	}
+	c, err := json.Marshal(node)
 	if err != nil {
-		return fmt.Errorf("open node file: %w", err)
+		return fmt.Errorf("marshal node: %w", err)
 	}
-	defer f.Close()
 
-	err = save(f, n)
+	if err := b.write(string(n.ID()), encode(c), b.durability == DurabilityAlways); err != nil {
+		return fmt.Errorf("write node to disk: %w", err)
+	}
+	return nil
+}
+
+// tmpSuffix ends the name of files being written.
+const tmpSuffix = ".tmp"
+
+// write replaces the content of the named file. The content goes to a
+// temporary file first, renamed over the previous one once complete, so that
+// readers never see a partially written file. The file and its directory are
+// synced if durable is set, and left for the next sync otherwise.
+func (b *BtreeStore[K]) write(name string, c []byte, durable bool) error {
+	f, err := b.fs.CreateTemp(b.dir, name+".*"+tmpSuffix)
 	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+	renamed := false
+	defer func() {
+		if !renamed {
+			b.fs.Remove(f.Name())
+		}
+	}()
+
+	if _, err := f.Write(c); err != nil {
+		f.Close()
+		return err
+	}
+	if durable {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return fmt.Errorf("sync file: %w", err)
+		}
+	}
+	if err := f.Close(); err != nil {
 		return err
 	}
 
+	if err := b.fs.Rename(f.Name(), filepath.Join(b.dir, name)); err != nil {
+		return fmt.Errorf("rename file: %w", err)
+	}
+	renamed = true
+
+	if durable {
+		return b.syncDir()
+	}
+	b.mu.Lock()
+	b.dirty[name] = struct{}{}
+	b.mu.Unlock()
+	return nil
+}
+
+// Sync flushes the files written since the last sync to stable storage.
+// It does nothing with DurabilityNone.
+func (b *BtreeStore[K]) Sync() error {
+	if b.durability == DurabilityNone {
+		return nil
+	}
+	return b.sync()
+}
+
+func (b *BtreeStore[K]) sync() error {
+	b.syncMu.Lock()
+	defer b.syncMu.Unlock()
+
+	b.mu.Lock()
+	dirty := b.dirty
+	b.dirty = make(map[string]struct{})
+	b.mu.Unlock()
+
+	if len(dirty) == 0 {
+		return nil
+	}
+	if err := b.syncAll(dirty); err != nil {
+		// left for the next sync to retry.
+		b.mu.Lock()
+		maps.Copy(b.dirty, dirty)
+		b.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (b *BtreeStore[K]) syncAll(names map[string]struct{}) error {
+	for name := range names {
+		if err := b.syncFile(filepath.Join(b.dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return b.syncDir()
+}
+
+func (b *BtreeStore[K]) syncEvery(interval time.Duration) {
+	defer close(b.done)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-t.C:
+			if err := b.Sync(); err != nil {
+				slog.Warn("sync node files", slog.Any("err", err))
+			}
+		}
+	}
+}
+
+func (b *BtreeStore[K]) syncFile(path string) error {
+	f, err := b.fs.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("sync file: %w", err)
+	}
+	return nil
+}
+
+// syncDir flushes the entries of the directory, such as renames, to stable storage.
+func (b *BtreeStore[K]) syncDir() error {
+	if err := b.syncFile(b.dir); err != nil {
+		return fmt.Errorf("sync directory: %w", err)
+	}
 	return nil
 }
 
 func (b *BtreeStore[K]) Find(ctx context.Context, id btree.NodeID) (*btree.Node[K], bool, error) {
-	path := filepath.Join(b.dir.Name(), string(id))
+	path := filepath.Join(b.dir, string(id))
 
-	c, err := os.ReadFile(path)
+	c, err := b.fs.ReadFile(path)
 	if errors.Is(err, os.ErrNotExist) {
 		return nil, false, nil
 	}
@@ -98,25 +316,80 @@ func (b *BtreeStore[K]) Find(ctx context.Context, id btree.NodeID) (*btree.Node[
 		return nil, false, fmt.Errorf("read node: %w", err)
 	}
 
+	payload, err := decode(id, c)
+	if err != nil {
+		return nil, false, err
+	}
+
 	var node node[K]
-	if err := json.Unmarshal(c, &node); err != nil {
-		return nil, false, fmt.Errorf("parse node file: %w", err)
+	if err := json.Unmarshal(payload, &node); err != nil {
+		return nil, false, &ErrCorruptNode{ID: id, Reason: err.Error()}
 	}
 	return btree.NewNode[K](id, node.Keys, node.Refs), true, nil
 }
 
-func save[K btree.Key](f *os.File, n *btree.Node[K]) error {
-	node := node[K]{
-		Keys: n.Keys(),
-		Refs: n.Refs(),
+// metaFile holds the meta page of copy-on-write trees.
+// Its extension keeps it apart from node files.
+const metaFile = "meta.json"
+
+// lockFile is locked by the process using the store.
+const lockFile = "filadb.lock"
+
+func (b *BtreeStore[K]) Roots(ctx context.Context) (map[btree.NodeID]btree.NodeID, error) {
+	c, err := b.fs.ReadFile(filepath.Join(b.dir, metaFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
 	}
-	b, err := json.Marshal(node)
 	if err != nil {
-		return fmt.Errorf("marshal node: %w", err)
+		return nil, fmt.Errorf("read meta page: %w", err)
+	}
+
+	var roots map[btree.NodeID]btree.NodeID
+	if err := json.Unmarshal(c, &roots); err != nil {
+		return nil, fmt.Errorf("parse meta page: %w", err)
 	}
-	_, err = f.Write(b)
+	return roots, nil
+}
+
+// SaveRoots replaces the meta page once every node written before is synced,
+// whatever the durability, so that it never points to nodes a crash may lose.
+// The meta page is synced along with its directory before SaveRoots returns.
+func (b *BtreeStore[K]) SaveRoots(ctx context.Context, roots map[btree.NodeID]btree.NodeID) error {
+	c, err := json.Marshal(roots)
 	if err != nil {
-		return fmt.Errorf("write node to disk: %w", err)
+		return fmt.Errorf("marshal meta page: %w", err)
+	}
+
+	if err := b.sync(); err != nil {
+		return fmt.Errorf("sync nodes: %w", err)
+	}
+	if err := b.write(metaFile, c, true); err != nil {
+		return fmt.Errorf("write meta page: %w", err)
+	}
+	return nil
+}
+
+// Nodes lists the IDs of every node file.
+func (b *BtreeStore[K]) Nodes(ctx context.Context) ([]btree.NodeID, error) {
+	entries, err := b.fs.ReadDir(b.dir)
+	if err != nil {
+		return nil, fmt.Errorf("list node files: %w", err)
+	}
+
+	var ids []btree.NodeID
+	for _, e := range entries {
+		if e.IsDir() || e.Name() == metaFile || e.Name() == lockFile || strings.HasSuffix(e.Name(), tmpSuffix) {
+			continue
+		}
+		ids = append(ids, btree.NodeID(e.Name()))
+	}
+	return ids, nil
+}
+
+func (b *BtreeStore[K]) Delete(ctx context.Context, id btree.NodeID) error {
+	err := b.fs.Remove(filepath.Join(b.dir, string(id)))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("delete node: %w", err)
 	}
 	return nil
 }
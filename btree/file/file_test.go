@@ -0,0 +1,134 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aliphe/filadb/btree"
+	"github.com/aliphe/filadb/btree/file/vfs"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_Find_corrupt(t *testing.T) {
+	tests := map[string]struct {
+		corrupt func(c []byte) []byte
+		want    string
+	}{
+		"bit flip": {
+			corrupt: func(c []byte) []byte {
+				c[len(c)-3] ^= 0x01
+				return c
+			},
+			want: "checksum mismatch",
+		},
+		"truncated payload": {
+			corrupt: func(c []byte) []byte {
+				return c[:len(c)-1]
+			},
+			want: "checksum mismatch",
+		},
+		"truncated header": {
+			corrupt: func(c []byte) []byte {
+				return c[:2]
+			},
+			want: "truncated header",
+		},
+		"unknown version": {
+			corrupt: func(c []byte) []byte {
+				c[0] = 9
+				return c
+			},
+			want: "unknown format version",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			s, err := New[int](WithPath(dir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			ctx := context.Background()
+
+			n := btree.NewNode[int]("root", []*btree.KeyVal[int]{{Key: 1, Val: []byte("one")}}, nil)
+			if err := s.Save(ctx, n); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(dir, "root")
+			c, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, tc.corrupt(c), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, _, err = s.Find(ctx, "root")
+			var corrupt *ErrCorruptNode
+			if !errors.As(err, &corrupt) {
+				t.Fatalf("Find() error = %v, want ErrCorruptNode", err)
+			}
+			if diff := cmp.Diff(&ErrCorruptNode{ID: "root", Reason: tc.want}, corrupt); diff != "" {
+				t.Fatalf("Find() mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
+
+func Test_Find_legacy(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	s, err := New[int](WithPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := os.WriteFile(filepath.Join(dir, "root"), []byte(`{"keys":[{"Key":1,"Val":"b25l"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	n, ok, err := s.Find(context.Background(), "root")
+	if err != nil || !ok {
+		t.Fatalf("Find() = %v, %v", ok, err)
+	}
+	if diff := cmp.Diff([]*btree.KeyVal[int]{{Key: 1, Val: []byte("one")}}, n.Keys()); diff != "" {
+		t.Fatalf("Find() mismatch (-want,+got): %s", diff)
+	}
+}
+
+func Test_New_locked(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	s, err := New[int](WithPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New[int](WithPath(dir)); !errors.Is(err, vfs.ErrLocked) {
+		t.Fatalf("New() error = %v, want %v", err, vfs.ErrLocked)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s, err = New[int](WithPath(dir))
+	if err != nil {
+		t.Fatalf("New() after Close() error = %v", err)
+	}
+	defer s.Close()
+
+	ids, err := s.Nodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 0 {
+		t.Fatalf("Nodes() = %v, want none", ids)
+	}
+}
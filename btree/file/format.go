@@ -0,0 +1,44 @@
+package file
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+
+	"github.com/aliphe/filadb/btree"
+)
+
+// Node files start with a header made of the format version and the CRC32C
+// checksum of the payload that follows. Files written before the header
+// existed hold the bare JSON payload, and are read as is.
+const (
+	formatVersion byte = 1
+	headerLen          = 5
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func encode(payload []byte) []byte {
+	out := make([]byte, headerLen, headerLen+len(payload))
+	out[0] = formatVersion
+	binary.BigEndian.PutUint32(out[1:headerLen], crc32.Checksum(payload, castagnoli))
+	return append(out, payload...)
+}
+
+// decode verifies the content of a node file, and returns its payload.
+func decode(id btree.NodeID, c []byte) ([]byte, error) {
+	if len(c) > 0 && c[0] == '{' {
+		return c, nil
+	}
+	if len(c) < headerLen {
+		return nil, &ErrCorruptNode{ID: id, Reason: "truncated header"}
+	}
+	if c[0] != formatVersion {
+		return nil, &ErrCorruptNode{ID: id, Reason: "unknown format version"}
+	}
+
+	payload := c[headerLen:]
+	if binary.BigEndian.Uint32(c[1:headerLen]) != crc32.Checksum(payload, castagnoli) {
+		return nil, &ErrCorruptNode{ID: id, Reason: "checksum mismatch"}
+	}
+	return payload, nil
+}
@@ -0,0 +1,156 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Op is a file system operation a fault can be injected in.
+type Op string
+
+const (
+	OpCreate Op = "create"
+	OpWrite  Op = "write"
+	OpSync   Op = "sync"
+	OpRename Op = "rename"
+	OpRead   Op = "read"
+	OpRemove Op = "remove"
+)
+
+// Fault makes matching operations fail.
+type Fault struct {
+	Op Op
+	// Path restricts the fault to the files whose base name matches it, as in filepath.Match.
+	Path string
+	// After lets that many matching operations succeed first.
+	After int
+	// Err is returned by failing operations, such as syscall.ENOSPC or syscall.EIO.
+	Err error
+	// Short makes failing writes write half of their data first.
+	Short bool
+}
+
+// Faulty wraps a file system, and fails the operations matching its faults.
+type Faulty struct {
+	FS
+
+	mu     sync.Mutex
+	faults []*fault
+}
+
+type fault struct {
+	Fault
+	seen int
+}
+
+func NewFaulty(fs FS) *Faulty {
+	return &Faulty{FS: fs}
+}
+
+func (f *Faulty) Inject(ft Fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.faults = append(f.faults, &fault{Fault: ft})
+}
+
+// Reset removes every fault.
+func (f *Faulty) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.faults = nil
+}
+
+// fail returns the fault the operation on name runs into, if any.
+func (f *Faulty) fail(op Op, name string) *Fault {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, ft := range f.faults {
+		if ft.Op != op {
+			continue
+		}
+		if ft.Path != "" {
+			if ok, _ := filepath.Match(ft.Path, filepath.Base(name)); !ok {
+				continue
+			}
+		}
+		ft.seen++
+		if ft.seen > ft.After {
+			return &ft.Fault
+		}
+	}
+	return nil
+}
+
+func (f *Faulty) Open(name string) (File, error) {
+	file, err := f.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyFile{File: file, f: f}, nil
+}
+
+func (f *Faulty) ReadFile(name string) ([]byte, error) {
+	if ft := f.fail(OpRead, name); ft != nil {
+		return nil, &os.PathError{Op: "read", Path: name, Err: ft.Err}
+	}
+	return f.FS.ReadFile(name)
+}
+
+func (f *Faulty) CreateTemp(dir, pattern string) (File, error) {
+	if ft := f.fail(OpCreate, pattern); ft != nil {
+		return nil, &os.PathError{Op: "createtemp", Path: filepath.Join(dir, pattern), Err: ft.Err}
+	}
+	file, err := f.FS.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyFile{File: file, f: f}, nil
+}
+
+func (f *Faulty) Rename(oldpath, newpath string) error {
+	if ft := f.fail(OpRename, newpath); ft != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: ft.Err}
+	}
+	return f.FS.Rename(oldpath, newpath)
+}
+
+func (f *Faulty) Remove(name string) error {
+	if ft := f.fail(OpRemove, name); ft != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: ft.Err}
+	}
+	return f.FS.Remove(name)
+}
+
+type faultyFile struct {
+	File
+	f *Faulty
+}
+
+func (ff *faultyFile) Write(p []byte) (int, error) {
+	ft := ff.f.fail(OpWrite, ff.Name())
+	if ft == nil {
+		return ff.File.Write(p)
+	}
+
+	var n int
+	if ft.Short {
+		n, _ = ff.File.Write(p[:len(p)/2])
+	}
+	err := ft.Err
+	if err == nil {
+		err = io.ErrShortWrite
+	}
+	return n, &os.PathError{Op: "write", Path: ff.Name(), Err: err}
+}
+
+func (ff *faultyFile) Sync() error {
+	if ft := ff.f.fail(OpSync, ff.Name()); ft != nil {
+		return &os.PathError{Op: "sync", Path: ff.Name(), Err: ft.Err}
+	}
+	return ff.File.Sync()
+}
@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package vfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Lock fails: files cannot be locked on this platform, and opening a store
+// without a lock would let another process open it too.
+func (OS) Lock(name string) (io.Closer, error) {
+	return nil, fmt.Errorf("lock %s: %w", name, errors.ErrUnsupported)
+}
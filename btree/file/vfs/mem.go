@@ -0,0 +1,264 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mem is an in-memory file system.
+//
+// It keeps track of what was synced, so that Crash can drop whatever a power
+// loss would: the content of files since their last sync, and the entries of
+// a directory since the directory's.
+type Mem struct {
+	mu      sync.Mutex
+	dirs    map[string]bool
+	files   map[string]*inode
+	durable map[string]*inode
+	locks   map[string]bool
+	seq     int
+}
+
+type inode struct {
+	data   []byte
+	synced []byte
+}
+
+func NewMem() *Mem {
+	return &Mem{
+		dirs:    make(map[string]bool),
+		files:   make(map[string]*inode),
+		durable: make(map[string]*inode),
+		locks:   make(map[string]bool),
+	}
+}
+
+// Crash drops everything which was not synced, and releases the locks.
+func (m *Mem) Crash() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clear(m.locks)
+	m.files = maps.Clone(m.durable)
+	for _, n := range m.files {
+		n.data = slices.Clone(n.synced)
+	}
+}
+
+func (m *Mem) MkdirAll(path string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for p := filepath.Clean(path); !m.dirs[p]; p = filepath.Dir(p) {
+		if _, ok := m.files[p]; ok {
+			return &os.PathError{Op: "mkdir", Path: p, Err: fs.ErrExist}
+		}
+		m.dirs[p] = true
+	}
+	return nil
+}
+
+func (m *Mem) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if m.dirs[name] {
+		return &info{name: filepath.Base(name), dir: true}, nil
+	}
+	n, ok := m.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return &info{name: filepath.Base(name), size: int64(len(n.data))}, nil
+}
+
+func (m *Mem) Open(name string) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if m.dirs[name] {
+		return &memFile{m: m, name: name}, nil
+	}
+	n, ok := m.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &memFile{m: m, name: name, n: n, readOnly: true}, nil
+}
+
+func (m *Mem) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.files[filepath.Clean(name)]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return slices.Clone(n.data), nil
+}
+
+func (m *Mem) ReadDir(name string) ([]os.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if !m.dirs[name] {
+		return nil, &os.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	var entries []os.DirEntry
+	for p := range m.dirs {
+		if p != name && filepath.Dir(p) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(&info{name: filepath.Base(p), dir: true}))
+		}
+	}
+	for p, n := range m.files {
+		if filepath.Dir(p) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(&info{name: filepath.Base(p), size: int64(len(n.data))}))
+		}
+	}
+	slices.SortFunc(entries, func(a, b os.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+func (m *Mem) CreateTemp(dir, pattern string) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dir = filepath.Clean(dir)
+	if !m.dirs[dir] {
+		return nil, &os.PathError{Op: "createtemp", Path: dir, Err: fs.ErrNotExist}
+	}
+	m.seq++
+	name := filepath.Join(dir, strings.Replace(pattern, "*", strconv.Itoa(m.seq), 1))
+	if !strings.Contains(pattern, "*") {
+		name += strconv.Itoa(m.seq)
+	}
+	n := &inode{}
+	m.files[name] = n
+	return &memFile{m: m, name: name, n: n}, nil
+}
+
+func (m *Mem) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldpath, newpath = filepath.Clean(oldpath), filepath.Clean(newpath)
+	n, ok := m.files[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	}
+	m.files[newpath] = n
+	delete(m.files, oldpath)
+	return nil
+}
+
+func (m *Mem) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if _, ok := m.files[name]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+func (m *Mem) Lock(name string) (io.Closer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if !m.dirs[filepath.Dir(name)] {
+		return nil, &os.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if m.locks[name] {
+		return nil, ErrLocked
+	}
+	if _, ok := m.files[name]; !ok {
+		m.files[name] = &inode{}
+	}
+	m.locks[name] = true
+	return &memLock{m: m, name: name}, nil
+}
+
+type memLock struct {
+	m    *Mem
+	name string
+	once sync.Once
+}
+
+func (l *memLock) Close() error {
+	l.once.Do(func() {
+		l.m.mu.Lock()
+		defer l.m.mu.Unlock()
+
+		delete(l.m.locks, l.name)
+	})
+	return nil
+}
+
+// memFile is a file of a Mem, or one of its directories when it has no inode.
+type memFile struct {
+	m        *Mem
+	name     string
+	n        *inode
+	readOnly bool
+}
+
+func (f *memFile) Name() string { return f.name }
+func (f *memFile) Close() error { return nil }
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if f.n == nil || f.readOnly {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: errors.ErrUnsupported}
+	}
+	f.m.mu.Lock()
+	defer f.m.mu.Unlock()
+
+	f.n.data = append(f.n.data, p...)
+	return len(p), nil
+}
+
+func (f *memFile) Sync() error {
+	f.m.mu.Lock()
+	defer f.m.mu.Unlock()
+
+	if f.n == nil {
+		f.m.durable = maps.Clone(f.m.files)
+		return nil
+	}
+	f.n.synced = slices.Clone(f.n.data)
+	return nil
+}
+
+type info struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i *info) Name() string       { return i.name }
+func (i *info) Size() int64        { return i.size }
+func (i *info) ModTime() time.Time { return time.Time{} }
+func (i *info) IsDir() bool        { return i.dir }
+func (i *info) Sys() any           { return nil }
+
+func (i *info) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
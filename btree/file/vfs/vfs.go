@@ -0,0 +1,50 @@
+// Package vfs abstracts the file system the file store runs on, so that it can
+// run in memory or with injected faults.
+package vfs
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrLocked is returned when locking a file locked by someone else.
+var ErrLocked = errors.New("file is locked")
+
+// FS is the part of a file system the file store relies on.
+type FS interface {
+	MkdirAll(path string, perm os.FileMode) error
+	Stat(name string) (os.FileInfo, error)
+	// Open opens a file or a directory, to sync it.
+	Open(name string) (File, error)
+	ReadFile(name string) ([]byte, error)
+	ReadDir(name string) ([]os.DirEntry, error)
+	CreateTemp(dir, pattern string) (File, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	// Lock creates the named file if needed, and locks it until the returned
+	// closer is closed. It fails with ErrLocked if the file already is.
+	Lock(name string) (io.Closer, error)
+}
+
+type File interface {
+	io.Writer
+	Name() string
+	Sync() error
+	Close() error
+}
+
+// OS is the file system of the operating system.
+type OS struct{}
+
+func (OS) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+func (OS) Stat(name string) (os.FileInfo, error)        { return os.Stat(name) }
+func (OS) Open(name string) (File, error)               { return os.Open(name) }
+func (OS) ReadFile(name string) ([]byte, error)         { return os.ReadFile(name) }
+func (OS) ReadDir(name string) ([]os.DirEntry, error)   { return os.ReadDir(name) }
+func (OS) Rename(oldpath, newpath string) error         { return os.Rename(oldpath, newpath) }
+func (OS) Remove(name string) error                     { return os.Remove(name) }
+
+func (OS) CreateTemp(dir, pattern string) (File, error) {
+	return os.CreateTemp(dir, pattern)
+}
@@ -0,0 +1,85 @@
+package btree
+
+import "sync"
+
+// latches hands out a read-write latch per node, so that operations working
+// on different parts of a tree run concurrently.
+// A latch only lives while it is held or waited for.
+type latches struct {
+	mu sync.Mutex
+	m  map[NodeID]*latch
+}
+
+type latch struct {
+	sync.RWMutex
+	refs int
+}
+
+// lock latches the node exclusively, and returns the function releasing it.
+func (l *latches) lock(id NodeID) func() {
+	lt := l.acquire(id)
+	lt.Lock()
+	return func() {
+		lt.Unlock()
+		l.release(id, lt)
+	}
+}
+
+// rlock latches the node in shared mode, and returns the function releasing it.
+func (l *latches) rlock(id NodeID) func() {
+	lt := l.acquire(id)
+	lt.RLock()
+	return func() {
+		lt.RUnlock()
+		l.release(id, lt)
+	}
+}
+
+func (l *latches) acquire(id NodeID) *latch {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.m == nil {
+		l.m = make(map[NodeID]*latch)
+	}
+	lt, ok := l.m[id]
+	if !ok {
+		lt = &latch{}
+		l.m[id] = lt
+	}
+	lt.refs++
+	return lt
+}
+
+func (l *latches) release(id NodeID, lt *latch) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lt.refs--
+	if lt.refs == 0 {
+		delete(l.m, id)
+	}
+}
+
+// held tracks the latches taken by an operation, in the order they were taken.
+type held []func()
+
+func (h *held) push(unlock func()) {
+	*h = append(*h, unlock)
+}
+
+// releaseAncestors releases every latch but the last one taken.
+func (h *held) releaseAncestors() {
+	last := len(*h) - 1
+	for _, unlock := range (*h)[:last] {
+		unlock()
+	}
+	*h = append((*h)[:0], (*h)[last])
+}
+
+func (h *held) release() {
+	for _, unlock := range *h {
+		unlock()
+	}
+	*h = nil
+}
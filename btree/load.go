@@ -0,0 +1,132 @@
+package btree
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+)
+
+// Load adds every pair of kvs to the tree. An empty tree is built bottom-up,
+// filling each node in turn from the sorted pairs, which saves every node once.
+// Pairs are added one by one to a tree which already holds keys.
+func (b *BTree[K]) Load(ctx context.Context, node string, kvs []*KeyVal[K]) error {
+	if len(kvs) == 0 {
+		return nil
+	}
+	kvs = slices.Clone(kvs)
+	slices.SortStableFunc(kvs, func(a, b *KeyVal[K]) int { return cmp.Compare(a.Key, b.Key) })
+
+	var loaded bool
+	var err error
+	if b.cow != nil {
+		loaded, err = b.loadCopy(ctx, NodeID(node), kvs)
+	} else {
+		loaded, err = b.loadInPlace(ctx, NodeID(node), kvs)
+	}
+	if err != nil || loaded {
+		return err
+	}
+
+	for _, kv := range kvs {
+		if err := b.Add(ctx, node, kv.Key, kv.Val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *BTree[K]) loadInPlace(ctx context.Context, tree NodeID, kvs []*KeyVal[K]) (bool, error) {
+	unlock := b.latches.lock(tree)
+	defer unlock()
+
+	_, ok, err := b.root(ctx, tree)
+	if err != nil || ok {
+		return false, err
+	}
+
+	_, err = b.build(kvs, tree, func(n *Node[K]) error {
+		return b.store.Save(ctx, n)
+	})
+	return err == nil, err
+}
+
+func (b *BTree[K]) loadCopy(ctx context.Context, tree NodeID, kvs []*KeyVal[K]) (bool, error) {
+	var loaded bool
+	err := b.writeCopy(ctx, tree, func(w *cowWrite, _ *Node[K], ok bool) (NodeID, error) {
+		if ok {
+			return "", nil
+		}
+		loaded = true
+		return b.build(kvs, "", func(n *Node[K]) error {
+			return b.saveCopy(ctx, w, n)
+		})
+	})
+	return loaded, err
+}
+
+// build saves a tree holding the sorted kvs, and returns its root.
+// The root is saved under rootID, unless empty.
+func (b *BTree[K]) build(kvs []*KeyVal[K], rootID NodeID, save func(*Node[K]) error) (NodeID, error) {
+	var refs []*Ref[K]
+	for start := 0; start < len(kvs); {
+		end := leafEnd(kvs, start, b.order)
+		n := leaf(kvs[start:end])
+		if start == 0 && end == len(kvs) && rootID != "" {
+			n.id = rootID
+		}
+		if err := save(n); err != nil {
+			return "", fmt.Errorf("save leaf: %w", err)
+		}
+
+		r := &Ref[K]{N: n.ID()}
+		if start > 0 {
+			r.From = &kvs[start].Key
+			refs[len(refs)-1].To = r.From
+		}
+		refs = append(refs, r)
+		start = end
+	}
+
+	for len(refs) > 1 {
+		var parents []*Ref[K]
+		for start := 0; start < len(refs); start += b.order {
+			children := refs[start:min(start+b.order, len(refs))]
+			n := nonLeaf(children)
+			if len(refs) <= b.order && rootID != "" {
+				n.id = rootID
+			}
+			if err := save(n); err != nil {
+				return "", fmt.Errorf("save node: %w", err)
+			}
+			parents = append(parents, &Ref[K]{
+				From: children[0].From,
+				To:   children[len(children)-1].To,
+				N:    n.ID(),
+			})
+		}
+		refs = parents
+	}
+
+	return refs[0].N, nil
+}
+
+// leafEnd returns where the leaf starting at start ends, holding up to order
+// keys. Runs of equal keys are kept in a single leaf, so that lookups find
+// every one of them.
+func leafEnd[K Key](kvs []*KeyVal[K], start, order int) int {
+	end := min(start+order, len(kvs))
+	if end == len(kvs) || kvs[end-1].Key != kvs[end].Key {
+		return end
+	}
+
+	for e := end - 1; e > start; e-- {
+		if kvs[e-1].Key != kvs[e].Key {
+			return e
+		}
+	}
+	for end < len(kvs) && kvs[end].Key == kvs[start].Key {
+		end++
+	}
+	return end
+}
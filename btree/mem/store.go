@@ -0,0 +1,119 @@
+// Package mem stores btree nodes in memory.
+package mem
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/aliphe/filadb/btree"
+)
+
+// Store keeps nodes in memory. Nodes are copied when saved and when found,
+// so that callers never share them.
+type Store[K btree.Key] struct {
+	mu    sync.RWMutex
+	nodes map[btree.NodeID]*btree.Node[K]
+	roots map[btree.NodeID]btree.NodeID
+}
+
+func New[K btree.Key]() *Store[K] {
+	return &Store[K]{
+		nodes: make(map[btree.NodeID]*btree.Node[K]),
+	}
+}
+
+func (s *Store[K]) Save(ctx context.Context, n *btree.Node[K]) error {
+	c := clone(n)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nodes[n.ID()] = c
+	return nil
+}
+
+func (s *Store[K]) Find(ctx context.Context, id btree.NodeID) (*btree.Node[K], bool, error) {
+	s.mu.RLock()
+	n, ok := s.nodes[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, false, nil
+	}
+
+	return clone(n), true, nil
+}
+
+func (s *Store[K]) Roots(ctx context.Context) (map[btree.NodeID]btree.NodeID, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return maps.Clone(s.roots), nil
+}
+
+func (s *Store[K]) SaveRoots(ctx context.Context, roots map[btree.NodeID]btree.NodeID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.roots = maps.Clone(roots)
+	return nil
+}
+
+func (s *Store[K]) Delete(ctx context.Context, id btree.NodeID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.nodes, id)
+	return nil
+}
+
+// Nodes lists the IDs of every node.
+func (s *Store[K]) Nodes(ctx context.Context) ([]btree.NodeID, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return slices.Sorted(maps.Keys(s.nodes)), nil
+}
+
+func (s *Store[K]) Close() error {
+	return nil
+}
+
+type dest[K btree.Key] interface {
+	Save(context.Context, *btree.Node[K]) error
+	SaveRoots(context.Context, map[btree.NodeID]btree.NodeID) error
+}
+
+// CopyTo saves every node and the meta page into another store, such as a file store.
+func (s *Store[K]) CopyTo(ctx context.Context, dst dest[K]) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, n := range s.nodes {
+		if err := dst.Save(ctx, n); err != nil {
+			return fmt.Errorf("copy node %s: %w", n.ID(), err)
+		}
+	}
+	if s.roots != nil {
+		if err := dst.SaveRoots(ctx, s.roots); err != nil {
+			return fmt.Errorf("copy meta page: %w", err)
+		}
+	}
+	return nil
+}
+
+func clone[K btree.Key](n *btree.Node[K]) *btree.Node[K] {
+	keys := make([]*btree.KeyVal[K], 0, len(n.Keys()))
+	for _, kv := range n.Keys() {
+		keys = append(keys, &btree.KeyVal[K]{Key: kv.Key, Val: slices.Clone(kv.Val)})
+	}
+	refs := make([]*btree.Ref[K], 0, len(n.Refs()))
+	for _, r := range n.Refs() {
+		c := *r
+		refs = append(refs, &c)
+	}
+
+	return btree.NewNode(n.ID(), keys, refs)
+}
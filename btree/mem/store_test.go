@@ -0,0 +1,69 @@
+package mem
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/aliphe/filadb/btree"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_Btree(t *testing.T) {
+	tests := map[string]struct {
+		cow  bool
+		want string
+	}{
+		"in place": {
+			want: "]-∞;3[(one,2)[3;5[(3,4)[5;∞[(5,6)",
+		},
+		"copy on write": {
+			cow:  true,
+			want: "]-∞;3[(one,2)[3;5[(3,4)[5;∞[(5,6)",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			s := New[int]()
+			opts := []btree.Option{btree.WithOrder(3)}
+			if tc.cow {
+				opts = append(opts, btree.WithCopyOnWrite(s))
+			}
+			bt := btree.New(s, opts...)
+			ctx := context.Background()
+
+			for _, a := range []int{1, 2, 3, 4, 5, 6} {
+				if err := bt.Add(ctx, "root", a, []byte(strconv.Itoa(a))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			kvs, err := bt.Entries(ctx, "root")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// entries handed out are not shared with the store.
+			kvs[0].Val = []byte("changed")
+			vals, err := bt.Get(ctx, "root", 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([][]byte{[]byte("1")}, vals); diff != "" {
+				t.Fatalf("Get() mismatch (-want,+got): %s", diff)
+			}
+
+			if err := bt.Set(ctx, "root", 1, []byte("one")); err != nil {
+				t.Fatal(err)
+			}
+
+			out, err := bt.Print(ctx, "root")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, out); diff != "" {
+				t.Fatalf("Print() mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
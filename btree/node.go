@@ -1,6 +1,10 @@
 package btree
 
-import "github.com/google/uuid"
+import (
+	"errors"
+
+	"github.com/google/uuid"
+)
 
 type Node[K Key] struct {
 	id   NodeID
@@ -43,7 +47,7 @@ func (n *Node[K]) ID() NodeID {
 }
 
 func (n *Node[K]) Leaf() bool {
-	return len(n.keys) > 0
+	return len(n.refs) == 0
 }
 
 func (n *Node[K]) Value(key K) (*KeyVal[K], bool) {
@@ -55,6 +59,29 @@ func (n *Node[K]) Value(key K) (*KeyVal[K], bool) {
 	return nil, false
 }
 
+// spans returns true if the node r points to may hold k. Keys equal to the
+// bounds of r may be on either side of them, as duplicate keys straddle
+// the splits which put them there.
+func (r *Ref[K]) spans(k K) bool {
+	return (r.From == nil || *r.From <= k) && (r.To == nil || *r.To >= k)
+}
+
+// overlaps returns true if the node r points to may hold keys from from to to,
+// both included, a nil bound being open.
+func (r *Ref[K]) overlaps(from, to *K) bool {
+	return (r.From == nil || to == nil || *r.From <= *to) && (r.To == nil || from == nil || *r.To >= *from)
+}
+
+// child returns the ref to the child node where k is inserted.
+func (n *Node[K]) child(k K) (*Ref[K], error) {
+	for _, r := range n.refs {
+		if r.To == nil || *r.To > k {
+			return r, nil
+		}
+	}
+	return nil, errors.New("no child node for key")
+}
+
 func (n *Node[K]) Refs() []*Ref[K] {
 	return n.refs
 }
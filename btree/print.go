@@ -9,14 +9,28 @@ import (
 )
 
 func (b *BTree[K]) Print(ctx context.Context, node string) (string, error) {
-	root, ok, err := b.root(context.Background(), NodeID(node))
+	var out string
+	err := b.read(ctx, NodeID(node), func(root NodeID) error {
+		var err error
+		out, err = b.print(ctx, root)
+		return err
+	})
+	return out, err
+}
+
+func (b *BTree[K]) print(ctx context.Context, id NodeID) (string, error) {
+	var h held
+	defer h.release()
+
+	h.push(b.latches.rlock(id))
+	root, ok, err := b.root(context.Background(), id)
 	if err != nil {
 		return "", fmt.Errorf("acquire root: %w", err)
 	}
 	if !ok {
 		return "", storage.ErrTableNotFound
 	}
-	out, err := b.printNode(ctx, root)
+	out, err := b.printNode(ctx, &h, root)
 	if err != nil {
 		return "", err
 	}
@@ -24,7 +38,7 @@ func (b *BTree[K]) Print(ctx context.Context, node string) (string, error) {
 	return out, nil
 }
 
-func (b *BTree[K]) printNode(ctx context.Context, n *Node[K]) (string, error) {
+func (b *BTree[K]) printNode(ctx context.Context, h *held, n *Node[K]) (string, error) {
 	if n.Leaf() {
 		var out []string
 		for _, k := range n.keys {
@@ -35,11 +49,12 @@ func (b *BTree[K]) printNode(ctx context.Context, n *Node[K]) (string, error) {
 
 	children := make([]string, 0, len(n.refs))
 	for _, c := range n.refs {
+		h.push(b.latches.rlock(c.N))
 		node, _, err := b.store.Find(ctx, c.N)
 		if err != nil {
 			return "", err
 		}
-		sub, err := b.printNode(ctx, node)
+		sub, err := b.printNode(ctx, h, node)
 		if err != nil {
 			return "", err
 		}
@@ -0,0 +1,46 @@
+package btree
+
+import (
+	"context"
+	"sync"
+)
+
+// Snapshot is a read-only view of a copy-on-write tree, as it was when taken.
+// Nodes it reads are kept until it is released.
+type Snapshot[K Key] struct {
+	b       *BTree[K]
+	root    NodeID
+	gen     uint64
+	release sync.Once
+}
+
+func (b *BTree[K]) Snapshot(ctx context.Context, node string) (*Snapshot[K], error) {
+	if b.cow == nil {
+		return nil, ErrNotCopyOnWrite
+	}
+
+	root, gen, err := b.cow.pin(ctx, NodeID(node))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Snapshot[K]{
+		b:    b,
+		root: root,
+		gen:  gen,
+	}, nil
+}
+
+func (s *Snapshot[K]) Get(ctx context.Context, key K) ([][]byte, error) {
+	return s.b.get(ctx, s.root, key)
+}
+
+func (s *Snapshot[K]) Entries(ctx context.Context) ([]*KeyVal[K], error) {
+	return s.b.entries(ctx, s.root)
+}
+
+func (s *Snapshot[K]) Release(ctx context.Context) {
+	s.release.Do(func() {
+		s.b.cow.unpin(ctx, s.gen)
+	})
+}
@@ -0,0 +1,165 @@
+// Package client connects to filadb servers over the native protocol.
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aliphe/filadb/query"
+	"github.com/aliphe/filadb/uri"
+)
+
+var (
+	ErrClosed = errors.New("client is closed")
+	ErrNoRows = errors.New("no rows in result set")
+)
+
+type options struct {
+	maxConns int
+}
+
+type Option func(*options)
+
+// WithMaxConns sets the number of connections opened at most, 4 by default.
+// Callers wait for a connection to be released past it.
+func WithMaxConns(n int) Option {
+	return func(o *options) {
+		o.maxConns = max(n, 1)
+	}
+}
+
+// Client runs statements on a pool of connections to a server. It is safe
+// for concurrent use.
+type Client struct {
+	uri *uri.URI
+	// conns holds a token per connection in use, so that no more than
+	// maxConns are.
+	conns chan struct{}
+	idle  chan *Conn
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// New returns a client of the server at the filadb:// URI. Connections are
+// opened when first needed.
+func New(dsn string, opts ...Option) (*Client, error) {
+	o := &options{
+		maxConns: 4,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	u, err := uri.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parse uri: %w", err)
+	}
+
+	return &Client{
+		uri:   u,
+		conns: make(chan struct{}, o.maxConns),
+		idle:  make(chan *Conn, o.maxConns),
+	}, nil
+}
+
+// Conn reserves a connection of the pool until it is closed. Its statements
+// share a session, so that they can run in a transaction block.
+func (c *Client) Conn(ctx context.Context) (*Conn, error) {
+	select {
+	case c.conns <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		<-c.conns
+		return nil, ErrClosed
+	}
+
+	select {
+	case conn := <-c.idle:
+		conn.reserved = true
+		return conn, nil
+	default:
+	}
+
+	conn, err := dial(ctx, c.uri)
+	if err != nil {
+		<-c.conns
+		return nil, err
+	}
+	conn.pool, conn.reserved = c, true
+	return conn, nil
+}
+
+// release puts a connection back in the pool, unless it can no longer be
+// used. Connections left in a transaction block are closed, which rolls it
+// back, rather than handed to the next caller.
+func (c *Client) release(conn *Conn) {
+	c.mu.Lock()
+	if conn.broken || conn.status != query.TxIdle || c.closed {
+		conn.nc.Close()
+	} else {
+		c.idle <- conn
+	}
+	c.mu.Unlock()
+	<-c.conns
+}
+
+// Exec runs the statements of sql, returning the result of the last one.
+// Arguments are bound as Conn.Query binds them.
+func (c *Client) Exec(ctx context.Context, sql string, args ...any) (Result, error) {
+	conn, err := c.Conn(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+
+	return conn.Exec(ctx, sql, args...)
+}
+
+// Query runs the statements of sql, returning the rows of the first one
+// returning rows. The connection is held until the rows are closed.
+// Arguments are bound as Conn.Query binds them.
+func (c *Client) Query(ctx context.Context, sql string, args ...any) (*Rows, error) {
+	conn, err := c.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	rows.release = conn.Close
+	return rows, nil
+}
+
+// QueryRow is Query, reading the first row only.
+func (c *Client) QueryRow(ctx context.Context, sql string, args ...any) *Row {
+	rows, err := c.Query(ctx, sql, args...)
+	return &Row{rows: rows, err: err}
+}
+
+// Close closes the idle connections, and the others once released.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	for {
+		select {
+		case conn := <-c.idle:
+			conn.nc.Close()
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package client_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aliphe/filadb/client"
+	"github.com/aliphe/filadb/cmd/db/app"
+	"github.com/aliphe/filadb/cmd/db/app/handler"
+	fnet "github.com/aliphe/filadb/net"
+	"github.com/google/go-cmp/cmp"
+)
+
+// start runs a database with a users table until the test ends, and returns
+// its URI.
+func start(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		app.Run(ctx,
+			app.WithStorage(app.StorageMemory),
+			app.WithHandlerOptions(handler.WithAddr(addr)),
+			app.WithBootstrapUser("filadb", "secret"),
+		)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	dsn := "filadb://filadb:secret@" + addr
+	c, err := client.New(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	_, err = c.Exec(t.Context(), `CREATE TABLE users (id NUMBER, email TEXT);
+		INSERT INTO users (id, email) VALUES (1, 'a@b.com'), (2, 'c@d.com');
+		INSERT INTO users (id) VALUES (3);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dsn
+}
+
+type user struct {
+	ID    int32
+	Email sql.NullString
+}
+
+func Test_Client(t *testing.T) {
+	t.Parallel()
+
+	c, err := client.New(start(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := t.Context()
+
+	t.Run("query", func(t *testing.T) {
+		rows, err := c.Query(ctx, "SELECT id, email FROM users")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		if diff := cmp.Diff([]string{"id", "email"}, rows.Columns()); diff != "" {
+			t.Errorf("columns mismatch (-want,+got): %s", diff)
+		}
+		var got []user
+		for rows.Next() {
+			var u user
+			if err := rows.Scan(&u.ID, &u.Email); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, u)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		want := []user{
+			{ID: 1, Email: sql.NullString{String: "a@b.com", Valid: true}},
+			{ID: 2, Email: sql.NullString{String: "c@d.com", Valid: true}},
+			{ID: 3},
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("rows mismatch (-want,+got): %s", diff)
+		}
+	})
+
+	t.Run("query row", func(t *testing.T) {
+		var email string
+		if err := c.QueryRow(ctx, "SELECT email FROM users WHERE id = 2").Scan(&email); err != nil {
+			t.Fatal(err)
+		}
+		if email != "c@d.com" {
+			t.Errorf("email = %q, want %q", email, "c@d.com")
+		}
+
+		err := c.QueryRow(ctx, "SELECT email FROM users WHERE id = 4").Scan(&email)
+		if !errors.Is(err, client.ErrNoRows) {
+			t.Errorf("got %v, want %v", err, client.ErrNoRows)
+		}
+
+		err = c.QueryRow(ctx, "SELECT email FROM users WHERE id = 3").Scan(&email)
+		if err == nil {
+			t.Error("scanned null into a string")
+		}
+	})
+
+	t.Run("exec", func(t *testing.T) {
+		res, err := c.Exec(ctx, "UPDATE users SET email = 'e@f.com' WHERE id = 3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(client.Result{Tag: "UPDATE 1", RowsAffected: 1}, res); diff != "" {
+			t.Errorf("result mismatch (-want,+got): %s", diff)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := c.Exec(ctx, "SELECT name FROM users")
+		var e *fnet.ErrorResponse
+		if !errors.As(err, &e) || e.Code != "42703" {
+			t.Fatalf("got %v, want an undefined column error", err)
+		}
+
+		// statements answered before the rows are skipped, and the errors
+		// after them are reported by the rows.
+		rows, err := c.Query(ctx, "INSERT INTO users (id) VALUES (5); SELECT id FROM users WHERE id = 5; SELECT name FROM users")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		if err := rows.Close(); !errors.As(err, &e) {
+			t.Errorf("got %v, want an undefined column error", err)
+		}
+		if diff := cmp.Diff([]int{5}, ids); diff != "" {
+			t.Errorf("rows mismatch (-want,+got): %s", diff)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		if _, err := c.Exec(ctx, "SELECT id FROM users"); !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want %v", err, context.Canceled)
+		}
+	})
+}
+
+func Test_Client_pool(t *testing.T) {
+	t.Parallel()
+
+	c, err := client.New(start(t), client.WithMaxConns(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := t.Context()
+
+	conn, err := c.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(ctx, "BEGIN; INSERT INTO users (id) VALUES (4)"); err != nil {
+		t.Fatal(err)
+	}
+
+	wait, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Exec(wait, "SELECT id FROM users"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want to wait for the connection", err)
+	}
+
+	var id int64
+	if err := conn.QueryRow(ctx, "SELECT id FROM users WHERE id = 4").Scan(&id); err != nil {
+		t.Fatalf("the session does not see its own transaction: %v", err)
+	}
+	if _, err := conn.Exec(ctx, "ROLLBACK"); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	err = c.QueryRow(ctx, "SELECT id FROM users WHERE id = 4").Scan(&id)
+	if !errors.Is(err, client.ErrNoRows) {
+		t.Errorf("got %v, want the insert rolled back", err)
+	}
+
+	// transactions left open are not handed to the next caller.
+	if _, err := c.Exec(ctx, "BEGIN; INSERT INTO users (id) VALUES (5)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Exec(ctx, "COMMIT"); err == nil {
+		t.Error("committed the transaction of a previous caller")
+	}
+	err = c.QueryRow(ctx, "SELECT id FROM users WHERE id = 5").Scan(&id)
+	if !errors.Is(err, client.ErrNoRows) {
+		t.Errorf("got %v, want the insert rolled back", err)
+	}
+
+	if _, err := c.Exec(ctx, "BEGIN; SELECT name FROM users"); err == nil {
+		t.Fatal("selected an unknown column")
+	}
+	if _, err := c.Exec(ctx, "SELECT id FROM users"); err != nil {
+		t.Errorf("got %v after a failed transaction of a previous caller", err)
+	}
+}
+
+func Test_Driver(t *testing.T) {
+	t.Parallel()
+
+	db, err := sql.Open(client.DriverName, start(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := t.Context()
+
+	if err := db.PingContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT id, email FROM users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []user
+	for rows.Next() {
+		var u user
+		if err := rows.Scan(&u.ID, &u.Email); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, u)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if len(got) != 3 {
+		t.Errorf("got %d rows, want 3", len(got))
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := tx.ExecContext(ctx, "INSERT INTO users (id, email) VALUES (4, 'g@h.com')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Errorf("affected %d rows, want 1", n)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	var email string
+	if err := db.QueryRowContext(ctx, "SELECT email FROM users WHERE id = 4").Scan(&email); err != nil {
+		t.Fatal(err)
+	}
+	if email != "g@h.com" {
+		t.Errorf("email = %q, want %q", email, "g@h.com")
+	}
+
+	if err := db.QueryRowContext(ctx, "SELECT email FROM users WHERE id = $1", 2).Scan(&email); err != nil {
+		t.Fatal(err)
+	}
+	if email != "c@d.com" {
+		t.Errorf("email = %q, want %q", email, "c@d.com")
+	}
+
+	if _, err := db.ExecContext(ctx, "SELECT id FROM users WHERE id = $1", "1"); err == nil {
+		t.Error("bound a text argument to a number parameter")
+	}
+
+	db.SetMaxOpenConns(1)
+	if _, err := db.ExecContext(ctx, "BEGIN"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, "COMMIT"); err == nil {
+		t.Error("committed the transaction of a previous caller")
+	}
+}
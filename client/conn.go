@@ -0,0 +1,178 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	fnet "github.com/aliphe/filadb/net"
+	"github.com/aliphe/filadb/query"
+	"github.com/aliphe/filadb/uri"
+)
+
+// ErrBroken is returned by connections whose session was interrupted, by a
+// network error or a canceled context.
+var ErrBroken = errors.New("connection is broken")
+
+// Result is the result of a statement not returning rows.
+type Result struct {
+	// Tag names the command, such as "INSERT 2".
+	Tag          string
+	RowsAffected int64
+}
+
+// Conn is a session on a server. It is not safe for concurrent use, and
+// running a statement closes the rows of the previous one.
+type Conn struct {
+	nc   net.Conn
+	pool *Client
+	// broken tells whether the session is out of sync with the server.
+	broken bool
+	// status is the transaction status of the session, as last answered.
+	status query.TxStatus
+	// reserved tells whether the connection of the pool is in use.
+	reserved bool
+	rows     *Rows
+}
+
+// dial opens a session as the user of the URI, over TLS if it asks for it.
+func dial(ctx context.Context, u *uri.URI) (*Conn, error) {
+	cfg, err := u.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	addr := u.HostPort()
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", addr, err)
+	}
+	if cfg != nil {
+		tc := tls.Client(nc, cfg)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("tls handshake with %s: %w", addr, err)
+		}
+		nc = tc
+	}
+
+	c := &Conn{nc: nc, status: query.TxIdle}
+	stop := c.watch(ctx)
+	err = fnet.Handshake(nc, u.User.Username, u.User.Password)
+	if !stop() || err != nil {
+		nc.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("start session: %w", err)
+	}
+	return c, nil
+}
+
+// watch interrupts the pending reads and writes of the connection once ctx
+// is done, until the returned function is called. It reports whether they
+// were left alone.
+func (c *Conn) watch(ctx context.Context) func() bool {
+	return context.AfterFunc(ctx, func() {
+		c.nc.SetDeadline(time.Unix(1, 0))
+	})
+}
+
+// Exec runs the statements of sql, returning the result of the last one.
+// With arguments, sql is a single statement whose placeholders they are bound
+// to, as Query does.
+func (c *Conn) Exec(ctx context.Context, sql string, args ...any) (Result, error) {
+	rows, err := c.Query(ctx, sql, args...)
+	if err != nil {
+		return Result{}, err
+	}
+	if err := rows.Close(); err != nil {
+		return Result{}, err
+	}
+	return rows.res, nil
+}
+
+// Query runs the statements of sql, returning the rows of the first one
+// returning rows. The errors of the statements following it are reported
+// by the rows.
+//
+// With arguments, sql is a single statement, prepared as the unnamed
+// statement of the session, and run with the arguments bound to its
+// placeholders $1, $2... or ?. Arguments are integers, strings or bytes, and
+// are never read as SQL.
+func (c *Conn) Query(ctx context.Context, sql string, args ...any) (*Rows, error) {
+	if c.rows != nil {
+		c.rows.Close()
+	}
+	if c.broken {
+		return nil, ErrBroken
+	}
+
+	var m fnet.Message = &fnet.Query{SQL: sql}
+	if len(args) > 0 {
+		params := make([]fnet.Param, 0, len(args))
+		for i, a := range args {
+			p, err := fnet.NewParam(a)
+			if err != nil {
+				return nil, fmt.Errorf("argument %d: %w", i+1, err)
+			}
+			params = append(params, p)
+		}
+		if err := c.prepare(ctx, "", sql); err != nil {
+			return nil, err
+		}
+		m = &fnet.Execute{Params: params}
+	}
+
+	r := &Rows{conn: c, ctx: ctx, stop: c.watch(ctx)}
+	if err := fnet.WriteMessage(c.nc, m); err != nil {
+		r.fail(err)
+		return nil, r.err
+	}
+	c.rows = r
+
+	// the answer is read up to the rows.
+	for !r.done && !r.reading() {
+		r.step()
+	}
+	if r.done && r.err != nil {
+		return nil, r.err
+	}
+	return r, nil
+}
+
+// QueryRow is Query, reading the first row only.
+func (c *Conn) QueryRow(ctx context.Context, sql string, args ...any) *Row {
+	rows, err := c.Query(ctx, sql, args...)
+	return &Row{rows: rows, err: err}
+}
+
+// prepare prepares sql as the statement name of the session.
+func (c *Conn) prepare(ctx context.Context, name, sql string) error {
+	r := &Rows{conn: c, ctx: ctx, stop: c.watch(ctx)}
+	if err := fnet.WriteMessage(c.nc, &fnet.Prepare{Name: name, SQL: sql}); err != nil {
+		r.fail(err)
+		return r.err
+	}
+	c.rows = r
+	return r.Close()
+}
+
+// Close puts a connection of a pool back in it, or closes it.
+func (c *Conn) Close() error {
+	if c.rows != nil {
+		c.rows.Close()
+	}
+	if c.pool == nil {
+		return c.nc.Close()
+	}
+	if c.reserved {
+		c.reserved = false
+		c.pool.release(c)
+	}
+	return nil
+}
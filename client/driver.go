@@ -0,0 +1,249 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aliphe/filadb/query"
+	"github.com/aliphe/filadb/uri"
+)
+
+// DriverName is the name of the database/sql driver, opening filadb:// URIs.
+const DriverName = "filadb"
+
+func init() {
+	sql.Register(DriverName, &Driver{})
+}
+
+// Driver implements database/sql/driver, on connections of its own, pooled
+// by database/sql.
+type Driver struct{}
+
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(context.Background())
+}
+
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	u, err := uri.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parse uri: %w", err)
+	}
+	return &connector{driver: d, uri: u}, nil
+}
+
+type connector struct {
+	driver *Driver
+	uri    *uri.URI
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := dial(ctx, c.uri)
+	if err != nil {
+		return nil, err
+	}
+	return &driverConn{conn: conn}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// driverConn runs statements on a connection, binding their arguments as
+// Conn.Query does. Statements are prepared on the server when run, so that
+// database/sql prepared statements hold no state of the session.
+type driverConn struct {
+	conn *Conn
+}
+
+func (c *driverConn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+func (c *driverConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *driverConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *driverConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if opts.ReadOnly || sql.IsolationLevel(opts.Isolation) != sql.LevelDefault {
+		return nil, errors.New("transaction options are not supported")
+	}
+	if _, err := c.exec(ctx, "BEGIN"); err != nil {
+		return nil, err
+	}
+	return &tx{conn: c}, nil
+}
+
+func (c *driverConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	vals, err := values(args)
+	if err != nil {
+		return nil, err
+	}
+	return c.exec(ctx, query, vals...)
+}
+
+func (c *driverConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	vals, err := values(args)
+	if err != nil {
+		return nil, err
+	}
+	return c.query(ctx, query, vals...)
+}
+
+// values returns the values of the arguments, which are bound by position.
+func values(args []driver.NamedValue) ([]any, error) {
+	out := make([]any, 0, len(args))
+	for _, a := range args {
+		if a.Name != "" {
+			return nil, fmt.Errorf("named argument %s: arguments are bound by position", a.Name)
+		}
+		out = append(out, a.Value)
+	}
+	return out, nil
+}
+
+func (c *driverConn) Ping(ctx context.Context) error {
+	_, err := c.exec(ctx, "")
+	return err
+}
+
+// IsValid reports whether the connection can go back to the pool, which it
+// cannot once broken or left in a transaction block.
+func (c *driverConn) IsValid() bool {
+	return !c.conn.broken && c.conn.status == query.TxIdle
+}
+
+func (c *driverConn) ResetSession(context.Context) error {
+	if !c.IsValid() {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func (c *driverConn) exec(ctx context.Context, query string, args ...any) (driver.Result, error) {
+	res, err := c.conn.Exec(ctx, query, args...)
+	if errors.Is(err, ErrBroken) {
+		return nil, driver.ErrBadConn
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result{res: res}, nil
+}
+
+func (c *driverConn) query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
+	rows, err := c.conn.Query(ctx, query, args...)
+	if errors.Is(err, ErrBroken) {
+		return nil, driver.ErrBadConn
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &driverRows{rows: rows}, nil
+}
+
+type stmt struct {
+	conn  *driverConn
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+// NumInput returns -1, as the server checks the number of arguments.
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.exec(context.Background(), s.query, anys(args)...)
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.query(context.Background(), s.query, anys(args)...)
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+func anys(args []driver.Value) []any {
+	out := make([]any, 0, len(args))
+	for _, a := range args {
+		out = append(out, a)
+	}
+	return out
+}
+
+type tx struct {
+	conn *driverConn
+}
+
+func (t *tx) Commit() error {
+	_, err := t.conn.exec(context.Background(), "COMMIT")
+	return err
+}
+
+func (t *tx) Rollback() error {
+	_, err := t.conn.exec(context.Background(), "ROLLBACK")
+	return err
+}
+
+type result struct {
+	res Result
+}
+
+func (r result) LastInsertId() (int64, error) {
+	return 0, errors.New("last insert id is not supported")
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return r.res.RowsAffected, nil
+}
+
+type driverRows struct {
+	rows *Rows
+}
+
+func (r *driverRows) Columns() []string {
+	return r.rows.Columns()
+}
+
+// ColumnTypeDatabaseTypeName returns the type of the column, NUMBER or TEXT.
+func (r *driverRows) ColumnTypeDatabaseTypeName(i int) string {
+	return strings.ToUpper(string(r.rows.cols[i].Type))
+}
+
+func (r *driverRows) Close() error {
+	return r.rows.Close()
+}
+
+func (r *driverRows) Next(dest []driver.Value) error {
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	for i, v := range r.rows.row {
+		dest[i] = v
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	fnet "github.com/aliphe/filadb/net"
+	"github.com/aliphe/filadb/query"
+)
+
+// Rows reads the rows returned by a statement. They must be closed for the
+// connection to run other statements.
+type Rows struct {
+	conn *Conn
+	ctx  context.Context
+	stop func() bool
+
+	cols []fnet.Column
+	// read tells whether every row of the statement was read.
+	read bool
+	row  []any
+	// res is the result of the last statement answered.
+	res Result
+	// err is the first error met.
+	err error
+	// done tells whether the whole answer was read.
+	done    bool
+	release func() error
+}
+
+// Columns returns the names of the columns of the rows.
+func (r *Rows) Columns() []string {
+	out := make([]string, 0, len(r.cols))
+	for _, c := range r.cols {
+		out = append(out, c.Name)
+	}
+	return out
+}
+
+// Next reads the next row, returning false once every row was read or on
+// error.
+func (r *Rows) Next() bool {
+	r.row = nil
+	for !r.done && r.reading() {
+		if r.step() {
+			return true
+		}
+	}
+	return false
+}
+
+// Scan copies the values of the current row into dest, as query.Assign
+// does.
+func (r *Rows) Scan(dest ...any) error {
+	if r.row == nil {
+		return errors.New("scan called without a row")
+	}
+	if len(dest) != len(r.row) {
+		return fmt.Errorf("%d destinations for %d columns", len(dest), len(r.row))
+	}
+	for i, d := range dest {
+		if err := query.Assign(d, r.row[i]); err != nil {
+			return fmt.Errorf("column %s: %w", r.cols[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// Err returns the error met reading the rows, or answering the statements.
+func (r *Rows) Err() error {
+	return r.err
+}
+
+// Close reads the rest of the answer, returning the error it holds if any.
+func (r *Rows) Close() error {
+	for !r.done {
+		r.step()
+	}
+	if r.release != nil {
+		r.release()
+		r.release = nil
+	}
+	return r.err
+}
+
+func (r *Rows) reading() bool {
+	return r.cols != nil && !r.read
+}
+
+// step reads a message of the answer, reporting whether it is a row to
+// return.
+func (r *Rows) step() bool {
+	m, err := fnet.ReadMessage(r.conn.nc)
+	if err != nil {
+		r.fail(err)
+		return false
+	}
+
+	switch m := m.(type) {
+	case *fnet.RowDescription:
+		if r.cols == nil {
+			r.cols = m.Columns
+		}
+	case *fnet.DataRow:
+		if !r.reading() {
+			return false
+		}
+		if len(m.Values) != len(r.cols) {
+			r.setErr(fmt.Errorf("%d values for %d columns: %w", len(m.Values), len(r.cols), fnet.ErrMalformed))
+			r.read = true
+			return false
+		}
+		row := make([]any, 0, len(m.Values))
+		for i, b := range m.Values {
+			v, err := r.cols[i].Decode(b)
+			if err != nil {
+				r.setErr(err)
+				r.read = true
+				return false
+			}
+			row = append(row, v)
+		}
+		r.row = row
+		return true
+	case *fnet.CommandComplete:
+		r.read = r.cols != nil
+		r.res = Result{Tag: m.Tag, RowsAffected: int64(m.Rows)}
+	case *fnet.ErrorResponse:
+		r.read = r.cols != nil
+		r.setErr(m)
+	case *fnet.ReadyForQuery:
+		r.conn.status = query.TxStatus(m.Status)
+		r.finish()
+	}
+	return false
+}
+
+func (r *Rows) setErr(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// fail stops reading the answer on a network error, which leaves the
+// session out of sync.
+func (r *Rows) fail(err error) {
+	r.conn.broken = true
+	if r.ctx.Err() != nil {
+		err = r.ctx.Err()
+	}
+	r.setErr(err)
+	r.finish()
+}
+
+func (r *Rows) finish() {
+	r.done = true
+	if !r.stop() {
+		// the deadline of the connection was set.
+		r.conn.broken = true
+	}
+	if r.conn.rows == r {
+		r.conn.rows = nil
+	}
+}
+
+// Row is a single row of the rows returned by a statement.
+type Row struct {
+	rows *Rows
+	err  error
+}
+
+// Scan copies the values of the row into dest as Rows.Scan does, returning
+// ErrNoRows if the statement returned none.
+func (r *Row) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	defer r.rows.Close()
+
+	if !r.rows.Next() {
+		if err := r.rows.Close(); err != nil {
+			return err
+		}
+		return ErrNoRows
+	}
+	if err := r.rows.Scan(dest...); err != nil {
+		return err
+	}
+	return r.rows.Close()
+}
@@ -2,17 +2,23 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net"
-	"os"
 	"strings"
 	"time"
 
-	"github.com/aliphe/filadb/btree/file"
 	"github.com/aliphe/filadb/cmd/bench/scenario"
 	"github.com/aliphe/filadb/cmd/db/app"
 	"github.com/aliphe/filadb/cmd/db/app/handler"
 	fnet "github.com/aliphe/filadb/net"
+	"github.com/aliphe/filadb/query/sql/lexer"
+)
+
+// the credentials of the user running the scenarios.
+const (
+	user     = "bench"
+	password = "bench"
 )
 
 func main() {
@@ -25,22 +31,14 @@ func main() {
 	listener.Close()
 	ctx := context.Background()
 
-	// init temp dir
-	dir, err := os.MkdirTemp(os.TempDir(), "bench-*")
-	if err != nil {
-		log.Fatal(err)
-	}
-	log.Println(dir)
-	defer func() {
-		if err := os.RemoveAll(dir); err != nil {
-			log.Fatalf("failed to remove dir %s: %s", dir, err)
-		}
-	}()
-
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	go app.Run(ctx, app.WithFileOptions(file.WithPath(dir)), app.WithHandlerOptions(handler.WithAddr(addr)))
+	go app.Run(ctx,
+		app.WithStorage(app.StorageMemory),
+		app.WithHandlerOptions(handler.WithAddr(addr)),
+		app.WithBootstrapUser(user, password),
+	)
 
 	conn, err := net.Dial("tcp", addr)
 	if err != nil {
@@ -53,20 +51,21 @@ func main() {
 }
 
 func run(conn net.Conn, scenario string) error {
+	if err := fnet.Handshake(conn, user, password); err != nil {
+		return err
+	}
+
 	log.Println("starting scenario...")
 	start := time.Now()
-	for q := range strings.SplitSeq(scenario, ";") {
-		if q == "" || q == "\n" {
-			continue
-		}
-		err := fnet.Write(conn, []byte(q))
+	for _, stmt := range lexer.Split(scenario) {
+		msgs, err := fnet.Exchange(conn, stmt.SQL)
 		if err != nil {
 			return err
 		}
-
-		_, err = fnet.Read(conn)
-		if err != nil {
-			return err
+		for _, m := range msgs {
+			if e, ok := m.(*fnet.ErrorResponse); ok {
+				return fmt.Errorf("%s: %w", strings.TrimSpace(stmt.SQL), e)
+			}
 		}
 	}
 
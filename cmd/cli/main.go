@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
@@ -9,13 +10,15 @@ import (
 	"log"
 	"net"
 	"os"
+	"strings"
 
 	fnet "github.com/aliphe/filadb/net"
+	"github.com/aliphe/filadb/query/sql/lexer"
 	"github.com/aliphe/filadb/uri"
 )
 
 var (
-	database_uri = flag.String("database_uri", "filadb://127.0.0.1:5432", "uri of running filadb database instance")
+	database_uri = flag.String("database_uri", "filadb://filadb@127.0.0.1:5432", "uri of running filadb database instance, with the user and password to authenticate with, and sslmode, sslrootcert, sslcert and sslkey parameters to connect over TLS")
 )
 
 func main() {
@@ -26,32 +29,107 @@ func main() {
 		log.Fatal(err)
 	}
 
-	conn, err := net.Dial("tcp", uri.Address())
+	cfg, err := uri.TLSConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	var conn net.Conn
+	if cfg != nil {
+		conn, err = tls.Dial("tcp", uri.HostPort(), cfg)
+	} else {
+		conn, err = net.Dial("tcp", uri.HostPort())
+	}
 	if err != nil {
 		log.Fatalf("connecting to database: %s", err)
 	}
 
+	if err := fnet.Handshake(conn, uri.User.Username, uri.User.Password); err != nil {
+		log.Fatalf("starting session: %s", err)
+	}
+
+	if flag.Arg(0) == "export" {
+		if err := export(conn, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	reader := bufio.NewReader(os.Stdin)
+	// pending holds the start of a statement, continued on the next lines.
+	var pending string
 	for {
-		fmt.Print("> ")
-		query, err := reader.ReadString(';')
-		if err != nil {
-			if errors.Is(io.EOF, err) {
+		if pending == "" {
+			fmt.Print("> ")
+		} else {
+			fmt.Print(". ")
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			log.Fatalf("reading input: %s", err)
+		}
+		eof := err != nil
+
+		stmts := lexer.Split(pending + line)
+		pending = ""
+		for _, stmt := range stmts {
+			// statements are run once terminated, or at the end of the input.
+			if !stmt.Terminated && !eof {
+				pending = stmt.SQL
 				break
 			}
-			log.Fatalf("reading input: %s", err)
+
+			res, err := fnet.Exchange(conn, stmt.SQL)
+			if err != nil {
+				log.Fatalf("sending query: %s", err)
+			}
+			fmt.Println(fnet.Format(res))
 		}
 
-		err = fnet.Write(conn, []byte(query))
-		if err != nil {
-			log.Fatalf("sending query: %s", err)
+		if eof {
+			break
 		}
+	}
+}
 
-		res, err := fnet.Read(conn)
-		if err != nil {
-			log.Fatalf("reading response: %s", err)
+// export writes the rows of a query to a file, or to the standard output.
+func export(conn net.Conn, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "csv", "format of the exported rows, csv, jsonl or columnar")
+	header := fs.Bool("header", false, "start CSV files with a line naming the columns")
+	out := fs.String("out", "", "file to write the rows to, the standard output if empty")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: cli export [flags] 'SELECT ...'")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	query := strings.TrimSuffix(strings.TrimSpace(fs.Arg(0)), ";")
+	opts := "FORMAT " + *format
+	if *header {
+		opts += ", HEADER"
+	}
+	msgs, err := fnet.Exchange(conn, fmt.Sprintf("COPY (%s) TO STDOUT WITH (%s);", query, opts))
+	if err != nil {
+		return fmt.Errorf("sending query: %w", err)
+	}
+
+	var res []byte
+	for _, m := range msgs {
+		switch m := m.(type) {
+		case *fnet.ErrorResponse:
+			return m
+		case *fnet.CopyData:
+			res = append(res, m.Data...)
 		}
+	}
 
-		fmt.Println(string(res))
+	if *out == "" {
+		_, err = os.Stdout.Write(res)
+		return err
 	}
+	return os.WriteFile(*out, res, 0o644)
 }
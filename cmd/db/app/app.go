@@ -2,77 +2,267 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
 
 	"github.com/aliphe/filadb/btree"
 	"github.com/aliphe/filadb/btree/file"
+	"github.com/aliphe/filadb/btree/mem"
 	"github.com/aliphe/filadb/cmd/db/app/handler"
+	"github.com/aliphe/filadb/cmd/db/app/pgwire"
+	"github.com/aliphe/filadb/cmd/db/app/restapi"
 	"github.com/aliphe/filadb/cmd/db/app/tcp"
 	"github.com/aliphe/filadb/db"
+	"github.com/aliphe/filadb/db/storage"
 	"github.com/aliphe/filadb/db/system"
+	"github.com/aliphe/filadb/db/txn"
+	"github.com/aliphe/filadb/net/scram"
 	"github.com/aliphe/filadb/query/sql"
 )
 
+// Storage is the engine the nodes of the database are stored with.
+type Storage string
+
+const (
+	StorageFile   Storage = "file"
+	StorageMemory Storage = "memory"
+)
+
+var (
+	ErrUnknownStorage = errors.New("unknown storage")
+	ErrUnknownHandler = errors.New("unknown handler")
+	ErrNoUsers        = errors.New("no users to authenticate sessions with")
+)
+
 type options struct {
+	storage     Storage
+	snapshot    bool
+	copyOnWrite bool
 	fileOpts    []file.Option
 	handlerOpts []handler.Option
+	listeners   []listener
+	user        string
+	password    string
+}
+
+type listener struct {
+	typ  handler.Type
+	opts []handler.Option
 }
 
 type Option func(*options)
 
+func WithStorage(s Storage) Option {
+	return func(o *options) {
+		o.storage = s
+	}
+}
+
+// WithSnapshot saves an in-memory database to the file store on shutdown,
+// from where it can be opened with StorageFile.
+func WithSnapshot() Option {
+	return func(o *options) {
+		o.snapshot = true
+	}
+}
+
+// WithCopyOnWrite never modifies the saved nodes of the trees, and swaps
+// their roots atomically instead. A store written so keeps being written so,
+// as its trees can only be reached from their swapped roots.
+func WithCopyOnWrite() Option {
+	return func(o *options) {
+		o.copyOnWrite = true
+	}
+}
+
 func WithFileOptions(opts ...file.Option) Option {
 	return func(o *options) {
 		o.fileOpts = opts
 	}
 }
 
+// WithHandlerOptions sets the options of every listener, before their own.
 func WithHandlerOptions(opts ...handler.Option) Option {
 	return func(o *options) {
 		o.handlerOpts = opts
 	}
 }
 
+// WithListener serves the database with a handler of type t, next to the
+// other listeners. Without any, the database is served with the TCP handler.
+func WithListener(t handler.Type, opts ...handler.Option) Option {
+	return func(o *options) {
+		o.listeners = append(o.listeners, listener{typ: t, opts: opts})
+	}
+}
+
+// WithBootstrapUser creates the user, a superuser, when the database has none,
+// such as when it is first run. Without users, Run fails with ErrNoUsers.
+func WithBootstrapUser(name, password string) Option {
+	return func(o *options) {
+		o.user = name
+		o.password = password
+	}
+}
+
+// engine stores the nodes of the database.
+type engine interface {
+	Save(context.Context, *btree.Node[string]) error
+	Find(context.Context, btree.NodeID) (*btree.Node[string], bool, error)
+	Roots(context.Context) (map[btree.NodeID]btree.NodeID, error)
+	SaveRoots(context.Context, map[btree.NodeID]btree.NodeID) error
+	Delete(context.Context, btree.NodeID) error
+	Close() error
+}
+
+func openEngine(opt options) (engine, error) {
+	switch opt.storage {
+	case StorageFile:
+		return file.New[string](opt.fileOpts...)
+	case StorageMemory:
+		return mem.New[string](), nil
+	default:
+		return nil, fmt.Errorf("%s: %w", opt.storage, ErrUnknownStorage)
+	}
+}
+
 func Run(ctx context.Context, opts ...Option) error {
-	var opt options
+	opt := options{
+		storage: StorageFile,
+	}
 	for _, o := range opts {
 		o(&opt)
 	}
 
-	fileStore, err := file.New[string](opt.fileOpts...)
+	eng, err := openEngine(opt)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer func() {
-		if err := fileStore.Close(); err != nil {
+		if err := eng.Close(); err != nil {
 			panic(err)
 		}
 	}()
-	btree := btree.New(fileStore)
+	if m, ok := eng.(*mem.Store[string]); ok && opt.snapshot {
+		defer func() {
+			if err := snapshot(m, opt.fileOpts); err != nil {
+				slog.Error("snapshot database", slog.Any("err", err))
+			}
+		}()
+	}
+	roots, err := eng.Roots(ctx)
+	if err != nil {
+		return fmt.Errorf("load meta page: %w", err)
+	}
+	var btreeOpts []btree.Option
+	if opt.copyOnWrite || len(roots) > 0 {
+		btreeOpts = append(btreeOpts, btree.WithCopyOnWrite(eng))
+	}
+	btree := btree.New(eng, btreeOpts...)
 
-	schema := system.NewSchemaRegistry(btree)
-	index := system.NewIndexRegistry(btree)
+	store, err := txn.New(ctx, btree)
+	if err != nil {
+		return err
+	}
 
-	db := db.NewClient(btree, schema, index)
-	q := sql.NewRunner(db)
+	schema := system.NewSchemaRegistry(store)
+	index := system.NewIndexRegistry(store)
+	stats := system.NewStatsRegistry(store)
+	roles := system.NewRoleRegistry(store)
 
-	server, err := tcp.NewServer(q, opt.handlerOpts...)
-	if err != nil {
+	db := db.NewClient(store, schema, index, stats, roles)
+	if err := bootstrap(ctx, db, opt.user, opt.password); err != nil {
 		return err
 	}
+	q := sql.NewRunner(db)
 
-	errChan := make(chan error, 1)
-	go func() {
-		if err := server.Listen(ctx); err != nil {
-			errChan <- fmt.Errorf("listening to request: %w", err)
+	listeners := opt.listeners
+	if len(listeners) == 0 {
+		listeners = []listener{{typ: handler.TypeTCP}}
+	}
+	servers := make([]handler.Handler, 0, len(listeners))
+	defer func() {
+		for _, s := range servers {
+			s.Close()
 		}
-		close(errChan)
 	}()
+	errChan := make(chan error, len(listeners))
+	for _, l := range listeners {
+		s, err := newHandler(q, l.typ, append(slices.Clone(opt.handlerOpts), l.opts...)...)
+		if err != nil {
+			return err
+		}
+		servers = append(servers, s)
+
+		go func() {
+			if err := s.Listen(ctx); err != nil {
+				errChan <- fmt.Errorf("listening to request: %w", err)
+			}
+		}()
+	}
 
 	select {
 	case err := <-errChan:
 		return err
 	case <-ctx.Done():
-		server.Close()
 		return ctx.Err()
 	}
 }
+
+// bootstrap creates the user, as a superuser, if there are no users yet.
+func bootstrap(ctx context.Context, c *db.Client, user, password string) error {
+	tx, err := c.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	ctx = storage.WithTx(ctx, tx)
+
+	users, err := c.Users(ctx)
+	if err != nil {
+		return fmt.Errorf("list users: %w", err)
+	}
+	switch {
+	case len(users) > 0:
+		return nil
+	case user == "" || password == "":
+		return ErrNoUsers
+	}
+
+	creds, err := scram.NewCredentials(password)
+	if err != nil {
+		return err
+	}
+	if err := c.CreateRole(ctx, &system.Role{Name: user, Superuser: true, Credentials: &creds}); err != nil {
+		return fmt.Errorf("create user %s: %w", user, err)
+	}
+	return tx.Commit(ctx)
+}
+
+func newHandler(q *sql.Runner, t handler.Type, opts ...handler.Option) (handler.Handler, error) {
+	switch t {
+	case handler.TypeTCP:
+		return tcp.NewServer(q, opts...)
+	case handler.TypePostgres:
+		return pgwire.NewServer(q, opts...)
+	case handler.TypeRestAPI:
+		return restapi.NewServer(q, q, opts...)
+	default:
+		return nil, fmt.Errorf("%s: %w", t, ErrUnknownHandler)
+	}
+}
+
+// snapshot saves an in-memory database to the file store.
+func snapshot(m *mem.Store[string], fileOpts []file.Option) error {
+	fileStore, err := file.New[string](fileOpts...)
+	if err != nil {
+		return err
+	}
+	if err := m.CopyTo(context.Background(), fileStore); err != nil {
+		fileStore.Close()
+		return err
+	}
+	return fileStore.Close()
+}
@@ -2,15 +2,30 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/aliphe/filadb/btree/file"
 	"github.com/aliphe/filadb/cmd/db/app/handler"
+	"github.com/aliphe/filadb/db/schema"
 	fnet "github.com/aliphe/filadb/net"
+	"github.com/aliphe/filadb/query/export"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// the credentials of the user the databases of the tests are bootstrapped
+// with.
+const (
+	testUser     = "filadb"
+	testPassword = "secret"
 )
 
 func Test_Run(t *testing.T) {
@@ -43,6 +58,10 @@ func Test_Run(t *testing.T) {
 					given: "UPDATE users SET email = 'new@email.com' WHERE id = 2;",
 					want:  strings.Join([]string{"UPDATE 1"}, "\n"),
 				},
+				{
+					given: "SELECT id, email FROM users WHERE id > 1;",
+					want:  strings.Join([]string{"id,email", "2,new@email.com"}, "\n"),
+				},
 				{
 					given: "SELECT * FROM users where id IN (1,2) LIMIT 10;",
 					want:  strings.Join([]string{"email,id", "test@tust.com,1", "new@email.com,2"}, "\n"),
@@ -71,6 +90,22 @@ func Test_Run(t *testing.T) {
 					given: "SELECT id FROM users WHERE email = 'test@indexed.com';",
 					want:  strings.Join([]string{"id", "1"}, "\n"),
 				},
+				{
+					given: "SELECT id FROM users WHERE email = 'missing@indexed.com';",
+					want:  "id",
+				},
+				{
+					given: "UPDATE users SET email = 'new@indexed.com' WHERE id = 1;",
+					want:  "UPDATE 1",
+				},
+				{
+					given: "SELECT id FROM users WHERE email = 'new@indexed.com';",
+					want:  strings.Join([]string{"id", "1"}, "\n"),
+				},
+				{
+					given: "SELECT id FROM users WHERE email = 'test@indexed.com';",
+					want:  "id",
+				},
 			},
 		},
 		"With join": {
@@ -115,51 +150,751 @@ func Test_Run(t *testing.T) {
 				},
 			},
 		},
+		"With transactions": {
+			scenario: []step{
+				{
+					given: "CREATE TABLE users (id NUMBER, email TEXT);",
+					want:  "CREATE TABLE",
+				},
+				{
+					given: "BEGIN;",
+					want:  "BEGIN",
+				},
+				{
+					given: "INSERT INTO users (id, email) VALUES (1, 'rolled@back.com');",
+					want:  "INSERT 1",
+				},
+				{
+					given: "SELECT id, email FROM users;",
+					want:  strings.Join([]string{"id,email", "1,rolled@back.com"}, "\n"),
+				},
+				{
+					given: "ROLLBACK;",
+					want:  "ROLLBACK",
+				},
+				{
+					given: "SELECT id, email FROM users;",
+					want:  "id,email",
+				},
+				{
+					given: "BEGIN;",
+					want:  "BEGIN",
+				},
+				{
+					given: "INSERT INTO users (id, email) VALUES (2, 'commit@ted.com');",
+					want:  "INSERT 1",
+				},
+				{
+					given: "UPDATE users SET email = 'updated@ted.com' WHERE id = 2;",
+					want:  "UPDATE 1",
+				},
+				{
+					given: "COMMIT;",
+					want:  "COMMIT",
+				},
+				{
+					given: "SELECT id, email FROM users;",
+					want:  strings.Join([]string{"id,email", "2,updated@ted.com"}, "\n"),
+				},
+				{
+					given: "CREATE TABLE txlog (id NUMBER);",
+					want:  "ERROR: eval expression: create table txlog: table name is reserved (SQLSTATE 42939)",
+				},
+			},
+		},
+		"With semicolons and comments": {
+			scenario: []step{
+				{
+					given: "CREATE TABLE users (id NUMBER, email TEXT); -- who signed up",
+					want:  "CREATE TABLE",
+				},
+				{
+					given: "INSERT INTO users (id, email) VALUES (1, 'a;b@test.com'); /* not; a statement */",
+					want:  "INSERT 1",
+				},
+				{
+					given: "SELECT email FROM users -- ; WHERE id = 2\nWHERE id = 1;",
+					want:  strings.Join([]string{"email", "a;b@test.com"}, "\n"),
+				},
+			},
+		},
+		"With prepared statements": {
+			scenario: []step{
+				{
+					given: "CREATE TABLE users (id NUMBER, email TEXT);",
+					want:  "CREATE TABLE",
+				},
+				{
+					given: "PREPARE add AS INSERT INTO users (id, email) VALUES ($1, $2);",
+					want:  "PREPARE",
+				},
+				{
+					given: "EXECUTE add(1, 'it''s@test.com');",
+					want:  "INSERT 1",
+				},
+				{
+					given: "EXECUTE add('2', 'b@test.com');",
+					want:  "ERROR: parameter $1: string in number column: value does not match column type (SQLSTATE 42804)",
+				},
+				{
+					given: "EXECUTE add(2);",
+					want:  "ERROR: 1 arguments for 2 parameters: wrong number of parameters (SQLSTATE 42601)",
+				},
+				{
+					given: "PREPARE by_email AS SELECT id FROM users WHERE email = ?;",
+					want:  "PREPARE",
+				},
+				{
+					given: "EXECUTE by_email('it''s@test.com');",
+					want:  strings.Join([]string{"id", "1"}, "\n"),
+				},
+				{
+					given: "SELECT id FROM users WHERE id = $1;",
+					want:  "ERROR: 0 arguments for 1 parameters: wrong number of parameters (SQLSTATE 42601)",
+				},
+				{
+					given: "PREPARE huge AS SELECT id FROM users WHERE id = $9000000000000000000;",
+					want:  `ERROR: parsing expression: unexpected token "$9000000000000000000" at position 48 (SQLSTATE 42601)`,
+				},
+				{
+					given: "DEALLOCATE add;",
+					want:  "DEALLOCATE",
+				},
+				{
+					given: "EXECUTE add(3, 'c@test.com');",
+					want:  "ERROR: add: prepared statement does not exist (SQLSTATE 26000)",
+				},
+			},
+		},
+		"With copy": {
+			scenario: []step{
+				{
+					given: "CREATE TABLE users (id NUMBER, email TEXT);",
+					want:  "CREATE TABLE",
+				},
+				{
+					given: "CREATE INDEX user_email ON users(email);",
+					want:  "CREATE INDEX",
+				},
+				{
+					given: "COPY users FROM 'testdata/users.csv' WITH (FORMAT csv, HEADER);",
+					want:  "COPY 3 REJECTED 1",
+				},
+				{
+					given: "COPY users FROM 'testdata/users.jsonl' WITH (FORMAT jsonl);",
+					want:  "COPY 2 REJECTED 2",
+				},
+				{
+					given: "SELECT id, email FROM users;",
+					want:  strings.Join([]string{"id,email", "1,a@copy.com", "2,b@copy.com", "3,c@copy.com", "4,d@copy.com", "6,NULL"}, "\n"),
+				},
+				{
+					given: "SELECT id FROM users WHERE email = 'b@copy.com';",
+					want:  strings.Join([]string{"id", "2"}, "\n"),
+				},
+				{
+					given: "INSERT INTO users (id, email) VALUES (7, 'g,h@copy.com');",
+					want:  "INSERT 1",
+				},
+				{
+					given: "SELECT id, email FROM users WHERE id = 7;",
+					want:  strings.Join([]string{"id,email", `7,"g,h@copy.com"`}, "\n"),
+				},
+				{
+					given: "COPY (SELECT id, email FROM users WHERE id > 5) TO STDOUT WITH (FORMAT csv, HEADER);",
+					want:  "id,email\r\n6,\r\n7,\"g,h@copy.com\"\r\n",
+				},
+				{
+					given: "COPY (SELECT email, id FROM users WHERE id > 5) TO STDOUT WITH (FORMAT jsonl);",
+					want:  "{\"email\":null,\"id\":6}\n{\"email\":\"g,h@copy.com\",\"id\":7}\n",
+				},
+				{
+					given: "COPY (SELECT id, email FROM users WHERE id > 5 LIMIT 1) TO STDOUT WITH (FORMAT csv);",
+					want:  "6,\r\n",
+				},
+			},
+		},
+		"With statistics": {
+			scenario: []step{
+				{
+					given: "CREATE TABLE users (id NUMBER, email TEXT);",
+					want:  "CREATE TABLE",
+				},
+				{
+					given: "INSERT INTO users (id, email) VALUES (1, 'a@test.com'), (2, 'b@test.com'), (3, 'a@test.com');",
+					want:  "INSERT 3",
+				},
+				{
+					given: "ANALYZE users;",
+					want:  "ANALYZE",
+				},
+				{
+					given: "SELECT column, rows, distinct, min, max FROM stats;",
+					want:  strings.Join([]string{"column,rows,distinct,min,max", "email,3,2,a@test.com,b@test.com", "id,3,3,1,3"}, "\n"),
+				},
+				{
+					given: "INSERT INTO users (id, email) VALUES (4, 'c@test.com');",
+					want:  "INSERT 1",
+				},
+				{
+					given: "ANALYZE;",
+					want:  "ANALYZE",
+				},
+				{
+					given: "SELECT rows, distinct, max FROM stats WHERE id = 'users.email';",
+					want:  strings.Join([]string{"rows,distinct,max", "4,3,c@test.com"}, "\n"),
+				},
+			},
+		},
 	}
 
-	for name, tc := range tests {
-		t.Run(name, func(t *testing.T) {
-			t.Parallel()
-			dir := t.TempDir()
+	storages := []Storage{StorageFile, StorageMemory}
 
-			// initialise a listener on a random port to retrieve a valid one.
-			listener, err := net.Listen("tcp", ":0")
-			if err != nil {
-				t.Fatal(err)
-			}
-			addr := listener.Addr().String()
-			listener.Close()
+	for name, tc := range tests {
+		for _, storage := range storages {
+			t.Run(name+" "+string(storage), func(t *testing.T) {
+				t.Parallel()
+				dir := t.TempDir()
 
-			ctx, cancel := context.WithCancel(t.Context())
-			go Run(ctx, WithFileOptions(file.WithPath(dir)), WithHandlerOptions(handler.WithAddr(addr)))
+				// initialise a listener on a random port to retrieve a valid one.
+				listener, err := net.Listen("tcp", ":0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				addr := listener.Addr().String()
+				listener.Close()
 
-			time.Sleep(50 * time.Millisecond)
+				ctx, cancel := context.WithCancel(t.Context())
+				go Run(ctx,
+					WithStorage(storage),
+					WithFileOptions(file.WithPath(dir)),
+					WithHandlerOptions(handler.WithAddr(addr)),
+					WithBootstrapUser(testUser, testPassword),
+				)
 
-			conn, err := net.Dial("tcp", addr)
-			if err != nil {
-				t.Fatal(err)
-			}
+				time.Sleep(50 * time.Millisecond)
 
-			for _, step := range tc.scenario {
-				err := fnet.Write(conn, []byte(step.given))
+				conn, err := net.Dial("tcp", addr)
 				if err != nil {
 					t.Fatal(err)
 				}
-				res, err := fnet.Read(conn)
-				if err != nil {
+
+				if err := fnet.Handshake(conn, testUser, testPassword); err != nil {
 					t.Fatal(err)
 				}
 
-				if string(res) != step.want {
-					t.Fatal(fmt.Errorf("%s mismatch, want='%s', got='%s'", strings.TrimSpace(step.given), string(step.want), string(res)))
+				for _, step := range tc.scenario {
+					msgs, err := fnet.Exchange(conn, step.given)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if res := fnet.Format(msgs); res != step.want {
+						t.Fatal(fmt.Errorf("%s mismatch, want='%s', got='%s'", strings.TrimSpace(step.given), step.want, res))
+					}
 				}
-			}
 
-			err = conn.Close()
+				err = conn.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				cancel()
+			})
+		}
+	}
+}
+
+func Test_Run_snapshot(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	serve(t, []Option{WithStorage(StorageMemory), WithSnapshot(), WithFileOptions(file.WithPath(dir))},
+		"CREATE TABLE users (id NUMBER, email TEXT);",
+		"INSERT INTO users (id, email) VALUES (1, 'test@tust.com');",
+	)
+	got := serve(t, []Option{WithStorage(StorageFile), WithFileOptions(file.WithPath(dir))}, "SELECT id, email FROM users;")
+
+	if diff := cmp.Diff([]string{"id,email\n1,test@tust.com"}, got); diff != "" {
+		t.Fatalf("snapshot mismatch (-want,+got): %s", diff)
+	}
+}
+
+func Test_Run_export(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	path := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	got := serve(t, []Option{WithStorage(StorageMemory)},
+		"CREATE TABLE users (id NUMBER, email TEXT);",
+		"INSERT INTO users (id, email) VALUES (1, 'a,b@test.com'), (2, 'c\"d@test.com'), (3, 'e@test.com');",
+		fmt.Sprintf("COPY (SELECT id, email FROM users WHERE id < 3) TO '%s' WITH (FORMAT csv, HEADER);", path("users.csv")),
+		fmt.Sprintf("COPY users TO '%s' WITH (FORMAT jsonl);", path("users.jsonl")),
+		fmt.Sprintf("COPY (SELECT id, email FROM users) TO '%s' WITH (FORMAT columnar);", path("users.col")),
+		"CREATE TABLE from_csv (id NUMBER, email TEXT);",
+		fmt.Sprintf("COPY from_csv FROM '%s' WITH (FORMAT csv, HEADER);", path("users.csv")),
+		"SELECT id, email FROM from_csv;",
+		"CREATE TABLE from_jsonl (id NUMBER, email TEXT);",
+		fmt.Sprintf("COPY from_jsonl FROM '%s' WITH (FORMAT jsonl);", path("users.jsonl")),
+		"SELECT id, email FROM from_jsonl;",
+	)
+	want := []string{
+		"CREATE TABLE",
+		"INSERT 3",
+		"COPY 2",
+		"COPY 3",
+		"COPY 3",
+		"CREATE TABLE",
+		"COPY 2 REJECTED 0",
+		strings.Join([]string{"id,email", `1,"a,b@test.com"`, `2,"c""d@test.com"`}, "\n"),
+		"CREATE TABLE",
+		"COPY 3 REJECTED 0",
+		strings.Join([]string{"id,email", `1,"a,b@test.com"`, `2,"c""d@test.com"`, "3,e@test.com"}, "\n"),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("mismatch (-want,+got): %s", diff)
+	}
+
+	f, err := os.Open(path("users.col"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := export.NewColumnarReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows [][]any
+	for {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, row)
+	}
+	wantRows := [][]any{
+		{int64(1), "a,b@test.com"},
+		{int64(2), `c"d@test.com`},
+		{int64(3), "e@test.com"},
+	}
+	if diff := cmp.Diff(wantRows, rows); diff != "" {
+		t.Fatalf("columnar mismatch (-want,+got): %s", diff)
+	}
+}
+
+// serve runs the database until the queries are answered, and returns the answers.
+func serve(t *testing.T, opts []Option, queries ...string) []string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		Run(ctx, append(opts, WithHandlerOptions(handler.WithAddr(addr)), WithBootstrapUser(testUser, testPassword))...)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fnet.Handshake(conn, testUser, testPassword); err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, q := range queries {
+		msgs, err := fnet.Exchange(conn, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, fnet.Format(msgs))
+	}
+	conn.Close()
+	cancel()
+	<-done
+	return out
+}
+
+func Test_Run_protocol(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go Run(ctx,
+		WithStorage(StorageMemory),
+		WithHandlerOptions(handler.WithAddr(addr), handler.WithHandshakeTimeout(time.Second)),
+		WithBootstrapUser(testUser, testPassword),
+	)
+	time.Sleep(50 * time.Millisecond)
+
+	// answer sends a message, and returns the messages answering it.
+	answer := func(t *testing.T, conn net.Conn, m fnet.Message) []fnet.Message {
+		t.Helper()
+		if err := fnet.WriteMessage(conn, m); err != nil {
+			t.Fatal(err)
+		}
+		var out []fnet.Message
+		for {
+			m, err := fnet.ReadMessage(conn)
 			if err != nil {
 				t.Fatal(err)
 			}
-			cancel()
-		})
+			out = append(out, m)
+			if m.Type() == fnet.TypeReadyForQuery {
+				return out
+			}
+		}
 	}
+
+	t.Run("unsupported version", func(t *testing.T) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		if err := fnet.WriteMessage(conn, &fnet.Startup{Version: 99}); err != nil {
+			t.Fatal(err)
+		}
+		m, err := fnet.ReadMessage(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e, ok := m.(*fnet.ErrorResponse); !ok || e.Code != "08P01" {
+			t.Fatalf("got %#v, want a protocol violation", m)
+		}
+		if _, err := fnet.ReadMessage(conn); !errors.Is(err, io.EOF) {
+			t.Fatalf("got %v, want the connection closed", err)
+		}
+	})
+
+	t.Run("startup too long", func(t *testing.T) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		// messages are limited to a few kilobytes until the client is authenticated.
+		if err := fnet.WriteMessage(conn, &fnet.Startup{Version: fnet.Version, User: strings.Repeat("a", 20000)}); err != nil {
+			t.Fatal(err)
+		}
+		if m, err := fnet.ReadMessage(conn); err == nil {
+			t.Fatalf("got %#v, want the connection closed", m)
+		}
+	})
+
+	t.Run("handshake timeout", func(t *testing.T) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+		// the client never sends its startup message.
+		if _, err := fnet.ReadMessage(conn); !errors.Is(err, io.EOF) {
+			t.Fatalf("got %v, want the connection closed", err)
+		}
+	})
+
+	t.Run("session", func(t *testing.T) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if err := fnet.Handshake(conn, testUser, testPassword); err != nil {
+			t.Fatal(err)
+		}
+
+		steps := []struct {
+			given fnet.Message
+			want  []fnet.Message
+		}{
+			{
+				given: &fnet.Query{SQL: "CREATE TABLE users (id NUMBER, email TEXT); INSERT INTO users (id, email) VALUES (1, 'a@b.com'); INSERT INTO users (id) VALUES (2)"},
+				want: []fnet.Message{
+					&fnet.CommandComplete{Tag: "CREATE TABLE"},
+					&fnet.CommandComplete{Tag: "INSERT 1", Rows: 1},
+					&fnet.CommandComplete{Tag: "INSERT 1", Rows: 1},
+					&fnet.ReadyForQuery{Status: 'I'},
+				},
+			},
+			{
+				given: &fnet.Query{SQL: "SELECT id, email FROM users"},
+				want: []fnet.Message{
+					&fnet.RowDescription{Columns: []fnet.Column{
+						{Name: "id", Type: schema.ColumnTypeNumber},
+						{Name: "email", Type: schema.ColumnTypeText},
+					}},
+					&fnet.DataRow{Values: [][]byte{[]byte("1"), []byte("a@b.com")}},
+					&fnet.DataRow{Values: [][]byte{[]byte("2"), nil}},
+					&fnet.CommandComplete{Tag: "SELECT 2", Rows: 2},
+					&fnet.ReadyForQuery{Status: 'I'},
+				},
+			},
+			{
+				// the statements following an error are skipped.
+				given: &fnet.Query{SQL: "BEGIN; SELECT id FROM users LIMIT x; SELECT id FROM users"},
+				want: []fnet.Message{
+					&fnet.CommandComplete{Tag: "BEGIN"},
+					&fnet.ErrorResponse{Code: "42601", Position: 35},
+					&fnet.ReadyForQuery{Status: 'E'},
+				},
+			},
+			{
+				given: &fnet.Query{SQL: "SELECT id FROM users"},
+				want: []fnet.Message{
+					&fnet.ErrorResponse{Code: "25P02"},
+					&fnet.ReadyForQuery{Status: 'E'},
+				},
+			},
+			{
+				given: &fnet.Query{SQL: "ROLLBACK"},
+				want: []fnet.Message{
+					&fnet.CommandComplete{Tag: "ROLLBACK"},
+					&fnet.ReadyForQuery{Status: 'I'},
+				},
+			},
+			{
+				given: &fnet.Query{SQL: "SELECT name FROM users"},
+				want: []fnet.Message{
+					&fnet.ErrorResponse{Code: "42703"},
+					&fnet.ReadyForQuery{Status: 'I'},
+				},
+			},
+		}
+
+		for _, step := range steps {
+			got := answer(t, conn, step.given)
+			if diff := cmp.Diff(step.want, got, cmpopts.IgnoreFields(fnet.ErrorResponse{}, "Message")); diff != "" {
+				t.Fatalf("%#v mismatch (-want,+got): %s", step.given, diff)
+			}
+		}
+	})
+
+	t.Run("prepared statements", func(t *testing.T) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if err := fnet.Handshake(conn, testUser, testPassword); err != nil {
+			t.Fatal(err)
+		}
+
+		number := func(v string) fnet.Param { return fnet.Param{Type: schema.ColumnTypeNumber, Value: []byte(v)} }
+		text := func(v string) fnet.Param { return fnet.Param{Type: schema.ColumnTypeText, Value: []byte(v)} }
+		steps := []struct {
+			given fnet.Message
+			want  []fnet.Message
+		}{
+			{
+				given: &fnet.Query{SQL: "CREATE TABLE notes (id NUMBER, body TEXT)"},
+				want: []fnet.Message{
+					&fnet.CommandComplete{Tag: "CREATE TABLE"},
+					&fnet.ReadyForQuery{Status: 'I'},
+				},
+			},
+			{
+				given: &fnet.Prepare{Name: "add", SQL: "INSERT INTO notes (id, body) VALUES (?, ?)"},
+				want: []fnet.Message{
+					&fnet.ParameterDescription{Types: []schema.ColumnType{schema.ColumnTypeNumber, schema.ColumnTypeText}},
+					&fnet.ReadyForQuery{Status: 'I'},
+				},
+			},
+			{
+				// parameters are never read as SQL.
+				given: &fnet.Execute{Name: "add", Params: []fnet.Param{number("1"), text("'); DROP TABLE notes; --")}},
+				want: []fnet.Message{
+					&fnet.CommandComplete{Tag: "INSERT 1", Rows: 1},
+					&fnet.ReadyForQuery{Status: 'I'},
+				},
+			},
+			{
+				given: &fnet.Execute{Name: "add", Params: []fnet.Param{text("2"), text("text id")}},
+				want: []fnet.Message{
+					&fnet.ErrorResponse{Code: "42804"},
+					&fnet.ReadyForQuery{Status: 'I'},
+				},
+			},
+			{
+				given: &fnet.Prepare{SQL: "SELECT body FROM notes WHERE id = $1"},
+				want: []fnet.Message{
+					&fnet.ParameterDescription{Types: []schema.ColumnType{schema.ColumnTypeNumber}},
+					&fnet.ReadyForQuery{Status: 'I'},
+				},
+			},
+			{
+				given: &fnet.Execute{Params: []fnet.Param{number("1")}},
+				want: []fnet.Message{
+					&fnet.RowDescription{Columns: []fnet.Column{{Name: "body", Type: schema.ColumnTypeText}}},
+					&fnet.DataRow{Values: [][]byte{[]byte("'); DROP TABLE notes; --")}},
+					&fnet.CommandComplete{Tag: "SELECT 1", Rows: 1},
+					&fnet.ReadyForQuery{Status: 'I'},
+				},
+			},
+			{
+				given: &fnet.Prepare{Name: "add", SQL: "SELECT id FROM notes"},
+				want: []fnet.Message{
+					&fnet.ErrorResponse{Code: "42P05"},
+					&fnet.ReadyForQuery{Status: 'I'},
+				},
+			},
+			{
+				given: &fnet.Execute{Name: "missing"},
+				want: []fnet.Message{
+					&fnet.ErrorResponse{Code: "26000"},
+					&fnet.ReadyForQuery{Status: 'I'},
+				},
+			},
+		}
+
+		for _, step := range steps {
+			got := answer(t, conn, step.given)
+			if diff := cmp.Diff(step.want, got, cmpopts.IgnoreFields(fnet.ErrorResponse{}, "Message")); diff != "" {
+				t.Fatalf("%#v mismatch (-want,+got): %s", step.given, diff)
+			}
+		}
+	})
+
+	// login opens a session as the user, returning the SQLSTATE code of
+	// the error rejecting it if any.
+	login := func(t *testing.T, user, password string) (net.Conn, string) {
+		t.Helper()
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		err = fnet.Handshake(conn, user, password)
+		var e *fnet.ErrorResponse
+		if errors.As(err, &e) {
+			return nil, e.Code
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn, ""
+	}
+	// exec runs q, returning the SQLSTATE code of its error if any.
+	exec := func(t *testing.T, conn net.Conn, q string) string {
+		t.Helper()
+		for _, m := range answer(t, conn, &fnet.Query{SQL: q}) {
+			if e, ok := m.(*fnet.ErrorResponse); ok {
+				return e.Code
+			}
+		}
+		return ""
+	}
+
+	t.Run("authentication", func(t *testing.T) {
+		if _, code := login(t, testUser, "wrong"); code != "28P01" {
+			t.Errorf("wrong password: got code %q, want 28P01", code)
+		}
+		if _, code := login(t, "nobody", testPassword); code != "28P01" {
+			t.Errorf("unknown user: got code %q, want 28P01", code)
+		}
+
+		admin, _ := login(t, testUser, testPassword)
+		if code := exec(t, admin, "CREATE USER alice WITH PASSWORD 'pencil'"); code != "" {
+			t.Fatalf("CREATE USER failed with code %s", code)
+		}
+		if code := exec(t, admin, "CREATE USER alice PASSWORD 'pencil'"); code != "42710" {
+			t.Errorf("duplicate user: got code %q, want 42710", code)
+		}
+		if code := exec(t, admin, "ALTER USER nobody PASSWORD 'pencil'"); code != "42704" {
+			t.Errorf("unknown user: got code %q, want 42704", code)
+		}
+		if code := exec(t, admin, "SELECT name, password FROM roles"); code == "" {
+			t.Error("credentials are queryable")
+		}
+		if code := exec(t, admin, "CREATE TABLE roles (name TEXT, password TEXT)"); code != "42939" {
+			t.Errorf("shadowing the credentials: got code %q, want 42939", code)
+		}
+		if _, code := login(t, "alice", "pencil"); code != "" {
+			t.Fatalf("login failed with code %s", code)
+		}
+
+		if code := exec(t, admin, "ALTER USER alice PASSWORD 'eraser'"); code != "" {
+			t.Fatalf("ALTER USER failed with code %s", code)
+		}
+		if _, code := login(t, "alice", "pencil"); code != "28P01" {
+			t.Errorf("previous password: got code %q, want 28P01", code)
+		}
+		if _, code := login(t, "alice", "eraser"); code != "" {
+			t.Errorf("new password: login failed with code %s", code)
+		}
+	})
+
+	t.Run("authorization", func(t *testing.T) {
+		admin, _ := login(t, testUser, testPassword)
+		for _, q := range []string{
+			"CREATE TABLE docs (id TEXT, title TEXT)",
+			"INSERT INTO docs (id, title) VALUES ('1', 'draft')",
+			"CREATE USER bob WITH PASSWORD 'pencil'",
+			"CREATE ROLE readers",
+		} {
+			if code := exec(t, admin, q); code != "" {
+				t.Fatalf("%s failed with code %s", q, code)
+			}
+		}
+		bob, code := login(t, "bob", "pencil")
+		if code != "" {
+			t.Fatalf("login failed with code %s", code)
+		}
+		if _, code := login(t, "readers", ""); code != "28P01" {
+			t.Errorf("role without password: got code %q, want 28P01", code)
+		}
+
+		steps := []struct {
+			conn net.Conn
+			q    string
+			want string
+		}{
+			{bob, "SELECT id FROM docs", "42501"},
+			{bob, "CREATE TABLE notes (id TEXT)", "42501"},
+			{bob, "CREATE USER eve PASSWORD 'pencil'", "42501"},
+			{bob, "GRANT SELECT ON docs TO bob", "42501"},
+			{bob, "ALTER USER bob SUPERUSER", "42501"},
+			{bob, "ALTER USER bob PASSWORD 'eraser'", ""},
+			{admin, "GRANT SELECT ON TABLE docs TO readers", ""},
+			{admin, "GRANT readers TO bob", ""},
+			{admin, "GRANT bob TO readers", "0LP01"},
+			{admin, "GRANT SELECT ON nope TO bob", "42P01"},
+			{bob, "SELECT id FROM docs", ""},
+			{bob, "INSERT INTO docs (id, title) VALUES ('2', 'final')", "42501"},
+			{admin, "GRANT INSERT ON docs TO bob", ""},
+			{bob, "INSERT INTO docs (id, title) VALUES ('2', 'final')", ""},
+			{admin, "REVOKE readers FROM bob", ""},
+			{bob, "SELECT id FROM docs", "42501"},
+			{admin, "REVOKE INSERT ON docs FROM bob", ""},
+			{bob, "INSERT INTO docs (id, title) VALUES ('3', 'copy')", "42501"},
+		}
+		for _, s := range steps {
+			if code := exec(t, s.conn, s.q); code != s.want {
+				t.Errorf("%s: got code %q, want %q", s.q, code, s.want)
+			}
+		}
+	})
 }
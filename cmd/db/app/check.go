@@ -0,0 +1,78 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+
+	"github.com/aliphe/filadb/btree"
+	"github.com/aliphe/filadb/btree/file"
+	"github.com/google/uuid"
+)
+
+var ErrInconsistent = errors.New("store is inconsistent")
+
+// Check walks every tree of the store, and writes the issues found to w:
+// unreadable nodes, dangling refs, out-of-order keys and orphaned node files.
+func Check(ctx context.Context, w io.Writer, opts ...Option) error {
+	var opt options
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	fileStore, err := file.New[string](opt.fileOpts...)
+	if err != nil {
+		return err
+	}
+	defer fileStore.Close()
+	bt := btree.New(fileStore, btree.WithCopyOnWrite(fileStore))
+
+	nodes, err := fileStore.Nodes(ctx)
+	if err != nil {
+		return err
+	}
+	roots, err := fileStore.Roots(ctx)
+	if err != nil {
+		return err
+	}
+
+	trees := slices.Collect(maps.Keys(roots))
+	for _, id := range nodes {
+		// trees written before copy-on-write keep their root under their own name.
+		if _, ok := roots[id]; !ok && uuid.Validate(string(id)) != nil {
+			trees = append(trees, id)
+		}
+	}
+	slices.Sort(trees)
+
+	var issues int
+	reached := make(map[btree.NodeID]struct{}, len(nodes))
+	for _, tree := range trees {
+		found, ids, err := bt.Check(ctx, string(tree))
+		if err != nil {
+			return fmt.Errorf("check %s: %w", tree, err)
+		}
+		for _, i := range found {
+			fmt.Fprintf(w, "%s: %s\n", tree, i)
+		}
+		issues += len(found)
+		for _, id := range ids {
+			reached[id] = struct{}{}
+		}
+	}
+
+	for _, id := range nodes {
+		if _, ok := reached[id]; !ok {
+			fmt.Fprintf(w, "orphaned node %s\n", id)
+			issues++
+		}
+	}
+
+	if issues > 0 {
+		return fmt.Errorf("%d issues found: %w", issues, ErrInconsistent)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aliphe/filadb/btree"
+	"github.com/aliphe/filadb/btree/file"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_Check(t *testing.T) {
+	tests := map[string]struct {
+		// damage returns the lines Check is expected to report, given the nodes of the tree.
+		damage func(t *testing.T, dir string, nodes []btree.NodeID) []string
+	}{
+		"consistent": {
+			damage: func(t *testing.T, dir string, nodes []btree.NodeID) []string {
+				return nil
+			},
+		},
+		"dangling ref": {
+			damage: func(t *testing.T, dir string, nodes []btree.NodeID) []string {
+				if err := os.Remove(filepath.Join(dir, string(nodes[1]))); err != nil {
+					t.Fatal(err)
+				}
+				return []string{"users: node " + string(nodes[0]) + ": dangling ref to " + string(nodes[1])}
+			},
+		},
+		"corrupt node": {
+			damage: func(t *testing.T, dir string, nodes []btree.NodeID) []string {
+				if err := os.WriteFile(filepath.Join(dir, string(nodes[1])), []byte{1, 0}, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return []string{"users: node " + string(nodes[1]) + ": unreadable: corrupt node " + string(nodes[1]) + ": truncated header"}
+			},
+		},
+		"orphaned node": {
+			damage: func(t *testing.T, dir string, nodes []btree.NodeID) []string {
+				id := "0b0c9ba4-3f2c-4a4e-9b0e-5d5c1e6a7f10"
+				if err := os.WriteFile(filepath.Join(dir, id), []byte("{}"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return []string{"orphaned node " + id}
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			ctx := context.Background()
+
+			s, err := file.New[string](file.WithPath(dir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			bt := btree.New(s, btree.WithOrder(3), btree.WithCopyOnWrite(s))
+			for i := range 6 {
+				if err := bt.Add(ctx, "users", strconv.Itoa(i), []byte(strconv.Itoa(i))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, nodes, err := bt.Check(ctx, "users")
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.Close()
+
+			want := tc.damage(t, dir, nodes)
+
+			var out strings.Builder
+			err = Check(ctx, &out, WithFileOptions(file.WithPath(dir)))
+			if len(want) == 0 && err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			if len(want) > 0 && !errors.Is(err, ErrInconsistent) {
+				t.Fatalf("Check() error = %v, want ErrInconsistent", err)
+			}
+
+			var got []string
+			if out.Len() > 0 {
+				got = strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("Check() mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
@@ -1,21 +1,44 @@
 package handler
 
-import "time"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aliphe/filadb/db/system"
+	"github.com/aliphe/filadb/net/scram"
+	"github.com/aliphe/filadb/query"
+)
 
 type Type string
 
 const (
-	TypeRestAPI Type = "restapi"
-	TypeTCP     Type = "tcp"
+	TypeRestAPI  Type = "restapi"
+	TypeTCP      Type = "tcp"
+	TypePostgres Type = "postgres"
 )
 
 type Handler interface {
-	Listen() error
+	Listen(ctx context.Context) error
+	Close()
 }
 
+// HandshakeTimeout is the time clients have to authenticate by default.
+const HandshakeTimeout = 10 * time.Second
+
 type Options struct {
 	Addr    string
 	Timeout time.Duration
+	// HandshakeTimeout bounds the time clients have to authenticate once
+	// connected.
+	HandshakeTimeout time.Duration
+
+	// CertFile and KeyFile hold the certificate securing the connections,
+	// which are not if empty.
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
 }
 
 type Option func(*Options)
@@ -31,3 +54,31 @@ func WithTimeout(timeout time.Duration) Option {
 		o.Timeout = timeout
 	}
 }
+
+func WithHandshakeTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.HandshakeTimeout = timeout
+	}
+}
+
+// Credentials returns the credentials of the user, nil if there is no such
+// user: its authentication goes on, to fail as with a wrong password.
+func Credentials(ctx context.Context, q query.SessionRunner, user string) (*scram.Credentials, error) {
+	creds, err := q.Credentials(ctx, user)
+	if errors.Is(err, system.ErrUnknownRole) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &query.Error{Code: query.CodeInternal, Err: fmt.Errorf("credentials of user %q: %w", user, err)}
+	}
+	return &creds, nil
+}
+
+// AuthError is the error answering a failed authentication, telling no more
+// than PostgreSQL does.
+func AuthError(user string) *query.Error {
+	return &query.Error{
+		Code: query.CodeInvalidPassword,
+		Err:  fmt.Errorf("password authentication failed for user %q", user),
+	}
+}
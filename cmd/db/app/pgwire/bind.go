@@ -0,0 +1,101 @@
+package pgwire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aliphe/filadb/db/schema"
+)
+
+// Object identifiers of the types of values.
+const (
+	oidUnknown = 0
+	oidInt8    = 20
+	oidInt2    = 21
+	oidInt4    = 23
+	oidText    = 25
+	oidVarchar = 1043
+)
+
+const (
+	formatText   = 0
+	formatBinary = 1
+)
+
+var ErrInvalidParameter = errors.New("invalid parameter")
+
+// oid returns the type of values of the column, unknown for empty types.
+func oid(t schema.ColumnType) int {
+	switch t {
+	case schema.ColumnTypeNumber:
+		return oidInt4
+	case "":
+		return oidUnknown
+	default:
+		return oidText
+	}
+}
+
+// encode returns the value in the format, nil for nil values.
+func encode(v any, format int) []byte {
+	if v == nil {
+		return nil
+	}
+	if format == formatBinary {
+		switch n := v.(type) {
+		case int32:
+			return binary.BigEndian.AppendUint32(nil, uint32(n))
+		case int64:
+			return binary.BigEndian.AppendUint32(nil, uint32(n))
+		case int:
+			return binary.BigEndian.AppendUint32(nil, uint32(n))
+		}
+	}
+	return fmt.Append(nil, v)
+}
+
+// param is a value bound to a placeholder.
+type param struct {
+	oid    int
+	format int
+	value  []byte
+}
+
+// decode returns the value of the parameter: a number for integer types, or
+// for unknown types when written as a number in text, and text otherwise.
+// Null parameters are nil.
+func (p param) decode() (any, error) {
+	if p.value == nil {
+		return nil, nil
+	}
+
+	switch p.oid {
+	case oidInt2, oidInt4, oidInt8:
+		if p.format == formatText {
+			n, err := strconv.ParseInt(string(p.value), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%q: %w", p.value, ErrInvalidParameter)
+			}
+			return n, nil
+		}
+		switch len(p.value) {
+		case 2:
+			return int64(int16(binary.BigEndian.Uint16(p.value))), nil
+		case 4:
+			return int64(int32(binary.BigEndian.Uint32(p.value))), nil
+		case 8:
+			return int64(binary.BigEndian.Uint64(p.value)), nil
+		default:
+			return nil, fmt.Errorf("%d bytes integer: %w", len(p.value), ErrInvalidParameter)
+		}
+	case oidUnknown:
+		if p.format == formatText {
+			if n, err := strconv.ParseInt(string(p.value), 10, 64); err == nil {
+				return n, nil
+			}
+		}
+	}
+	return string(p.value), nil
+}
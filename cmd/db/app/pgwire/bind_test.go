@@ -0,0 +1,73 @@
+package pgwire
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_param_decode(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		param   param
+		want    any
+		wantErr error
+	}{
+		"typed number": {
+			param: param{oid: oidInt4, value: []byte("12")},
+			want:  int64(12),
+		},
+		"binary number": {
+			param: param{oid: oidInt4, format: formatBinary, value: binary.BigEndian.AppendUint32(nil, 7)},
+			want:  int64(7),
+		},
+		"binary bigint": {
+			param: param{oid: oidInt8, format: formatBinary, value: binary.BigEndian.AppendUint64(nil, 1<<40)},
+			want:  int64(1 << 40),
+		},
+		"unknown number": {
+			param: param{value: []byte("3")},
+			want:  int64(3),
+		},
+		"unknown text": {
+			param: param{value: []byte("three")},
+			want:  "three",
+		},
+		"text is never read as SQL": {
+			param: param{oid: oidText, value: []byte("1'); DROP TABLE users; --")},
+			want:  "1'); DROP TABLE users; --",
+		},
+		"typed text of digits": {
+			param: param{oid: oidText, value: []byte("12")},
+			want:  "12",
+		},
+		"invalid number": {
+			param:   param{oid: oidInt4, value: []byte("one")},
+			wantErr: ErrInvalidParameter,
+		},
+		"invalid binary number": {
+			param:   param{oid: oidInt4, format: formatBinary, value: []byte{1, 2, 3}},
+			wantErr: ErrInvalidParameter,
+		},
+		"null": {
+			param: param{oid: oidInt4},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := tc.param.decode()
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("decode() error = %v, want %v", err, tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("decode() mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,687 @@
+package pgwire
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/aliphe/filadb/cmd/db/app/handler"
+	"github.com/aliphe/filadb/net/scram"
+	"github.com/aliphe/filadb/query"
+	"github.com/aliphe/filadb/query/sql/lexer"
+)
+
+// parameters are reported to clients on startup, as drivers expect them.
+var parameters = [][2]string{
+	{"server_version", "16.0"},
+	{"server_encoding", "UTF8"},
+	{"client_encoding", "UTF8"},
+	{"DateStyle", "ISO, MDY"},
+	{"TimeZone", "UTC"},
+	{"integer_datetimes", "on"},
+	{"standard_conforming_strings", "on"},
+}
+
+var errCancel = errors.New("cancel requests are not supported")
+
+// statement is a statement prepared by Parse, in the session under the same
+// name.
+type statement struct {
+	sql string
+	// oids are the types of the parameters the client gave, if any.
+	oids []int
+	// desc describes the statement, nil if it is empty.
+	desc *query.Statement
+}
+
+// oid returns the type of the parameter i, as the client gave it or as the
+// session told it.
+func (s *statement) oid(i int) int {
+	if i < len(s.oids) && s.oids[i] != oidUnknown {
+		return s.oids[i]
+	}
+	if s.desc == nil || i >= len(s.desc.Params) {
+		return oidUnknown
+	}
+	return oid(s.desc.Params[i])
+}
+
+// portal is a statement bound to its parameters by Bind.
+type portal struct {
+	// stmt names the statement, executed with args.
+	stmt    string
+	sql     string
+	args    []any
+	desc    *query.Statement
+	formats []int
+	// res holds the result of the statement once executed, and sent how many
+	// of its rows were sent.
+	res  *query.Result
+	sent int
+}
+
+// format returns the format of the values of the column i.
+func (p *portal) format(i int) int {
+	switch len(p.formats) {
+	case 0:
+		return formatText
+	case 1:
+		return p.formats[0]
+	default:
+		return p.formats[i]
+	}
+}
+
+type conn struct {
+	nc net.Conn
+	r  *bufio.Reader
+	w  *bufio.Writer
+	// tls secures the connection on request, which is required when set.
+	tls *tls.Config
+	q   query.SessionRunner
+	// sess is opened once the client is authenticated.
+	sess    query.Session
+	timeout time.Duration
+
+	statements map[string]*statement
+	portals    map[string]*portal
+	// failed is set when an extended query message fails, to skip the
+	// following ones until Sync.
+	failed bool
+}
+
+func newConn(nc net.Conn, q query.SessionRunner, timeout time.Duration, cfg *tls.Config) *conn {
+	return &conn{
+		nc:         nc,
+		r:          bufio.NewReader(nc),
+		w:          bufio.NewWriter(nc),
+		tls:        cfg,
+		q:          q,
+		timeout:    timeout,
+		statements: make(map[string]*statement),
+		portals:    make(map[string]*portal),
+	}
+}
+
+// startup reads the startup message of the client, securing the connection
+// with TLS if it asks to, and opens the session of its user once
+// authenticated.
+func (c *conn) startup() error {
+	var user string
+	for {
+		b, err := readBody(c.r, maxStartupMessage)
+		if err != nil {
+			return fmt.Errorf("read startup: %w", err)
+		}
+		r := &reader{b: b}
+		code := r.int32()
+
+		_, secure := c.nc.(*tls.Conn)
+		switch {
+		case code == sslRequest && c.tls != nil && !secure:
+			if err := c.secure(); err != nil {
+				return err
+			}
+			continue
+		case code == protocolVersion && c.tls != nil && !secure:
+			c.error(&query.Error{Code: query.CodeInvalidAuthorization, Err: handler.ErrTLSRequired})
+			c.w.Flush()
+			return handler.ErrTLSRequired
+		}
+
+		switch code {
+		case sslRequest, gssEncRequest:
+			if err := c.w.WriteByte('N'); err != nil {
+				return err
+			}
+			if err := c.w.Flush(); err != nil {
+				return err
+			}
+			continue
+		case cancelRequest:
+			return errCancel
+		case protocolVersion:
+		default:
+			err := fmt.Errorf("unsupported frontend protocol %d.%d", code>>16, code&0xffff)
+			c.error(&query.Error{Code: query.CodeProtocolViolation, Err: err})
+			c.w.Flush()
+			return err
+		}
+
+		// the parameters of the client other than its user are ignored.
+		for r.err == nil && len(r.b) > 1 {
+			if k, v := r.string(), r.string(); k == "user" {
+				user = v
+			}
+		}
+		if r.err != nil {
+			return fmt.Errorf("startup: %w", r.err)
+		}
+		break
+	}
+
+	if err := c.authenticate(user); err != nil {
+		var qerr *query.Error
+		if !errors.As(err, &qerr) {
+			qerr = handler.AuthError(user)
+		}
+		c.error(qerr)
+		c.w.Flush()
+		return fmt.Errorf("authenticate %q: %w", user, err)
+	}
+	c.sess = c.q.Session(user)
+
+	msgs := []message{newMessage(msgAuthentication).int32(authOK)}
+	for _, p := range parameters {
+		msgs = append(msgs, newMessage(msgParameterStatus).string(p[0]).string(p[1]))
+	}
+	var key [8]byte
+	rand.Read(key[:])
+	msgs = append(msgs, newMessage(msgBackendKeyData).raw(key[:]))
+	for _, m := range msgs {
+		if err := m.send(c.w); err != nil {
+			return err
+		}
+	}
+	return c.ready()
+}
+
+// secure accepts the SSLRequest of the client, and runs the TLS handshake
+// which follows.
+func (c *conn) secure() error {
+	if err := c.w.WriteByte('S'); err != nil {
+		return err
+	}
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+
+	tc := tls.Server(c.nc, c.tls)
+	if err := tc.Handshake(); err != nil {
+		return fmt.Errorf("tls handshake: %w", err)
+	}
+	c.nc = tc
+	c.r = bufio.NewReader(tc)
+	c.w = bufio.NewWriter(tc)
+	return nil
+}
+
+// authenticate runs the SCRAM-SHA-256 conversation of the user.
+func (c *conn) authenticate(user string) error {
+	creds, err := handler.Credentials(context.Background(), c.q, user)
+	if err != nil {
+		return err
+	}
+	srv := scram.NewServer(creds)
+
+	// the mechanisms are a list of strings, ending with an empty one.
+	m := newMessage(msgAuthentication).int32(authSASL).string(scram.Mechanism).byte(0)
+	r, err := c.sasl(m)
+	if err != nil {
+		return err
+	}
+	if mech := r.string(); mech != scram.Mechanism {
+		return fmt.Errorf("unsupported mechanism %s", mech)
+	}
+	data := r.bytes()
+	if r.err != nil {
+		return &query.Error{Code: query.CodeProtocolViolation, Err: fmt.Errorf("sasl initial response: %w", r.err)}
+	}
+	first, err := srv.First(data)
+	if err != nil {
+		return err
+	}
+
+	r, err = c.sasl(newMessage(msgAuthentication).int32(authSASLContinue).raw(first))
+	if err != nil {
+		return err
+	}
+	final, err := srv.Final(r.b)
+	if err != nil {
+		return err
+	}
+	return newMessage(msgAuthentication).int32(authSASLFinal).raw(final).send(c.w)
+}
+
+// sasl sends a message of the authentication, and reads the answer of the
+// client.
+func (c *conn) sasl(m message) (*reader, error) {
+	if err := m.send(c.w); err != nil {
+		return nil, err
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	t, b, err := readMessage(c.r, maxStartupMessage)
+	if err != nil {
+		return nil, err
+	}
+	if t != msgSASLResponse {
+		return nil, &query.Error{
+			Code: query.CodeProtocolViolation,
+			Err:  fmt.Errorf("unexpected message %q during authentication", t),
+		}
+	}
+	return &reader{b: b}, nil
+}
+
+// serve answers the messages of the client until it terminates.
+func (c *conn) serve() error {
+	for {
+		t, b, err := readMessage(c.r, maxMessage)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		r := &reader{b: b}
+
+		if c.failed && t != msgSync {
+			continue
+		}
+
+		switch t {
+		case msgQuery:
+			err = c.query(r.string())
+		case msgParse:
+			err = c.parse(r)
+		case msgBind:
+			err = c.bind(r)
+		case msgDescribe:
+			err = c.describe(r)
+		case msgExecute:
+			err = c.execute(r)
+		case msgClose:
+			err = c.close(r)
+		case msgSync:
+			c.failed = false
+			err = c.ready()
+		case msgFlush:
+			err = c.w.Flush()
+		case msgTerminate:
+			return c.w.Flush()
+		default:
+			err = &query.Error{
+				Code: query.CodeProtocolViolation,
+				Err:  fmt.Errorf("unsupported message %q", t),
+			}
+		}
+		if err == nil && r.err != nil {
+			err = &query.Error{Code: query.CodeProtocolViolation, Err: fmt.Errorf("message %q: %w", t, r.err)}
+		}
+
+		// errors of the extended query messages skip the following ones, while
+		// simple queries write their own.
+		var qerr *query.Error
+		if errors.As(err, &qerr) {
+			c.failed = true
+			err = c.error(qerr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *conn) ready() error {
+	if err := newMessage(msgReadyForQuery).byte(byte(c.sess.Status())).send(c.w); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+func (c *conn) error(err *query.Error) error {
+	m := newMessage(msgErrorResponse).
+		byte('S').string("ERROR").
+		byte('V').string("ERROR").
+		byte('C').string(string(err.Code)).
+		byte('M').string(err.Error())
+	if err.Position > 0 {
+		m = m.byte('P').string(fmt.Sprint(err.Position))
+	}
+	return m.byte(0).send(c.w)
+}
+
+// query runs the statements of a simple query until one fails.
+func (c *conn) query(q string) error {
+	stmts := lexer.Split(q)
+	if len(stmts) == 0 {
+		if err := newMessage(msgEmptyQueryResponse).send(c.w); err != nil {
+			return err
+		}
+		return c.ready()
+	}
+
+	for _, stmt := range stmts {
+		res, err := c.run(stmt.SQL)
+		if err != nil {
+			qerr := queryError(err)
+			if qerr.Position > 0 {
+				qerr.Position += stmt.Offset
+			}
+			if err := c.error(qerr); err != nil {
+				return err
+			}
+			break
+		}
+
+		p := &portal{res: res}
+		if res.Columns != nil {
+			if err := c.rowDescription(res.Columns, p); err != nil {
+				return err
+			}
+		}
+		if err := c.send(p, 0); err != nil {
+			return err
+		}
+	}
+	return c.ready()
+}
+
+func (c *conn) run(q string) (*query.Result, error) {
+	ctx, cancel := context.WithTimeout(query.WithCopyOut(context.Background(), copyOut{c.w}), c.timeout)
+	defer cancel()
+
+	slog.Debug("received", slog.String("query", lexer.Redact(q)))
+
+	return c.sess.Run(ctx, q)
+}
+
+func queryError(err error) *query.Error {
+	var qerr *query.Error
+	if errors.As(err, &qerr) {
+		return qerr
+	}
+	return &query.Error{Code: query.CodeInternal, Err: err}
+}
+
+func (c *conn) parse(r *reader) error {
+	name := r.string()
+	stmt := &statement{sql: r.string()}
+	n := r.int16()
+	for range n {
+		stmt.oids = append(stmt.oids, r.int32())
+	}
+	if r.err != nil {
+		return nil
+	}
+	if name == "" {
+		delete(c.statements, name)
+	}
+
+	stmts := lexer.Split(stmt.sql)
+	if len(stmts) > 1 {
+		return &query.Error{
+			Code: query.CodeSyntaxError,
+			Err:  errors.New("cannot insert multiple commands into a prepared statement"),
+		}
+	}
+	if _, ok := c.statements[name]; ok && name != "" {
+		return &query.Error{
+			Code: query.CodeDuplicatePreparedStatement,
+			Err:  fmt.Errorf("prepared statement %q already exists", name),
+		}
+	}
+
+	if len(stmts) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		defer cancel()
+		desc, err := c.sess.Prepare(ctx, name, stmt.sql)
+		if err != nil {
+			return err
+		}
+		stmt.desc = desc
+	}
+	c.statements[name] = stmt
+	return newMessage(msgParseComplete).send(c.w)
+}
+
+func (c *conn) bind(r *reader) error {
+	name := r.string()
+	stmtName := r.string()
+	pformats := make([]int, r.int16())
+	for i := range pformats {
+		pformats[i] = r.int16()
+	}
+	params := make([]param, r.int16())
+	for i := range params {
+		params[i].value = r.bytes()
+	}
+	p := &portal{formats: make([]int, r.int16())}
+	for i := range p.formats {
+		p.formats[i] = r.int16()
+	}
+	if r.err != nil {
+		return nil
+	}
+
+	stmt, ok := c.statements[stmtName]
+	if !ok {
+		return errNoStatement(stmtName)
+	}
+	p.stmt, p.sql, p.desc = stmtName, stmt.sql, stmt.desc
+	for i := range params {
+		params[i].oid = stmt.oid(i)
+		switch len(pformats) {
+		case 0:
+		case 1:
+			params[i].format = pformats[0]
+		default:
+			if i < len(pformats) {
+				params[i].format = pformats[i]
+			}
+		}
+
+		v, err := params[i].decode()
+		if err != nil {
+			return &query.Error{Code: query.CodeInvalidValue, Err: fmt.Errorf("parameter $%d: %w", i+1, err)}
+		}
+		p.args = append(p.args, v)
+	}
+	c.portals[name] = p
+	return newMessage(msgBindComplete).send(c.w)
+}
+
+func (c *conn) describe(r *reader) error {
+	kind := r.byte()
+	name := r.string()
+	if r.err != nil {
+		return nil
+	}
+
+	switch kind {
+	case 'S':
+		stmt, ok := c.statements[name]
+		if !ok {
+			return errNoStatement(name)
+		}
+
+		var n int
+		if stmt.desc != nil {
+			n = len(stmt.desc.Params)
+		}
+		m := newMessage(msgParameterDescription).int16(n)
+		for i := range n {
+			m = m.int32(stmt.oid(i))
+		}
+		if err := m.send(c.w); err != nil {
+			return err
+		}
+		return c.describeRows(stmt.desc, &portal{})
+	case 'P':
+		p, ok := c.portals[name]
+		if !ok {
+			return errNoPortal(name)
+		}
+		return c.describeRows(p.desc, p)
+	default:
+		return &query.Error{
+			Code: query.CodeProtocolViolation,
+			Err:  fmt.Errorf("unknown describe target %q", kind),
+		}
+	}
+}
+
+// describeRows writes the description of the rows returned by the statement,
+// in the formats of the portal.
+func (c *conn) describeRows(desc *query.Statement, p *portal) error {
+	if desc == nil || desc.Columns == nil {
+		return newMessage(msgNoData).send(c.w)
+	}
+	return c.rowDescription(desc.Columns, p)
+}
+
+func (c *conn) rowDescription(cols []query.Column, p *portal) error {
+	m := newMessage(msgRowDescription).int16(len(cols))
+	for i, col := range cols {
+		size := -1
+		if oid(col.Type) == oidInt4 {
+			size = 4
+		}
+		m = m.string(col.Name).
+			int32(0). // table
+			int16(0). // column number in the table
+			int32(oid(col.Type)).
+			int16(size).
+			int32(-1). // type modifier
+			int16(p.format(i))
+	}
+	return m.send(c.w)
+}
+
+func (c *conn) execute(r *reader) error {
+	name := r.string()
+	limit := r.int32()
+	if r.err != nil {
+		return nil
+	}
+
+	p, ok := c.portals[name]
+	if !ok {
+		return errNoPortal(name)
+	}
+	if p.res == nil {
+		if p.desc == nil {
+			return newMessage(msgEmptyQueryResponse).send(c.w)
+		}
+		res, err := c.exec(p)
+		if err != nil {
+			return queryError(err)
+		}
+		p.res = res
+	}
+	return c.send(p, limit)
+}
+
+// exec runs the statement of the portal with its arguments.
+func (c *conn) exec(p *portal) (*query.Result, error) {
+	ctx, cancel := context.WithTimeout(query.WithCopyOut(context.Background(), copyOut{c.w}), c.timeout)
+	defer cancel()
+
+	slog.Debug("received", slog.String("query", lexer.Redact(p.sql)))
+
+	return c.sess.Execute(ctx, p.stmt, p.args...)
+}
+
+// send writes up to limit rows of the result of the portal, all of them if
+// limit is 0, and completes the command once they were all sent.
+func (c *conn) send(p *portal, limit int) error {
+	res := p.res
+	end := len(res.Rows)
+	if limit > 0 {
+		end = min(end, p.sent+limit)
+	}
+	for _, row := range res.Rows[p.sent:end] {
+		m := newMessage(msgDataRow).int16(len(row))
+		for i, v := range row {
+			m = m.bytes(encode(v, p.format(i)))
+		}
+		if err := m.send(c.w); err != nil {
+			return err
+		}
+	}
+	p.sent = end
+	if p.sent < len(res.Rows) {
+		return newMessage(msgPortalSuspended).send(c.w)
+	}
+
+	return newMessage(msgCommandComplete).string(tag(res)).send(c.w)
+}
+
+// copyOut streams the output of COPY TO STDOUT to the client, in a CopyData
+// message per write.
+type copyOut struct {
+	w io.Writer
+}
+
+func (o copyOut) Begin() error {
+	return newMessage(msgCopyOutResponse).byte(formatText).int16(0).send(o.w)
+}
+
+func (o copyOut) Write(p []byte) (int, error) {
+	if err := newMessage(msgCopyData).raw(p).send(o.w); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (o copyOut) End() error {
+	return newMessage(msgCopyDone).send(o.w)
+}
+
+// tag returns the tag of the command as PostgreSQL writes it, which drivers
+// read the number of rows affected from.
+func tag(res *query.Result) string {
+	cmd, _, _ := strings.Cut(res.Tag, " ")
+	switch cmd {
+	case "INSERT":
+		return fmt.Sprintf("INSERT 0 %d", res.RowCount)
+	case "SELECT", "UPDATE", "COPY":
+		return fmt.Sprintf("%s %d", cmd, res.RowCount)
+	default:
+		return res.Tag
+	}
+}
+
+func (c *conn) close(r *reader) error {
+	kind := r.byte()
+	name := r.string()
+	if r.err != nil {
+		return nil
+	}
+
+	switch kind {
+	case 'S':
+		// empty statements were not prepared in the session.
+		if stmt, ok := c.statements[name]; ok && stmt.desc != nil {
+			c.sess.Deallocate(name)
+		}
+		delete(c.statements, name)
+	case 'P':
+		delete(c.portals, name)
+	}
+	return newMessage(msgCloseComplete).send(c.w)
+}
+
+func errNoStatement(name string) error {
+	return &query.Error{
+		Code: query.CodeInvalidStatementName,
+		Err:  fmt.Errorf("prepared statement %q does not exist", name),
+	}
+}
+
+func errNoPortal(name string) error {
+	return &query.Error{
+		Code: query.CodeInvalidCursorName,
+		Err:  fmt.Errorf("portal %q does not exist", name),
+	}
+}
@@ -0,0 +1,215 @@
+package pgwire
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Messages sent by clients.
+const (
+	msgQuery     = 'Q'
+	msgParse     = 'P'
+	msgBind      = 'B'
+	msgDescribe  = 'D'
+	msgExecute   = 'E'
+	msgSync      = 'S'
+	msgClose     = 'C'
+	msgFlush     = 'H'
+	msgTerminate = 'X'
+	// msgSASLResponse holds both SASLInitialResponse and SASLResponse.
+	msgSASLResponse = 'p'
+)
+
+// Messages sent by servers.
+const (
+	msgAuthentication       = 'R'
+	msgParameterStatus      = 'S'
+	msgBackendKeyData       = 'K'
+	msgReadyForQuery        = 'Z'
+	msgRowDescription       = 'T'
+	msgDataRow              = 'D'
+	msgCommandComplete      = 'C'
+	msgEmptyQueryResponse   = 'I'
+	msgErrorResponse        = 'E'
+	msgParseComplete        = '1'
+	msgBindComplete         = '2'
+	msgCloseComplete        = '3'
+	msgNoData               = 'n'
+	msgParameterDescription = 't'
+	msgPortalSuspended      = 's'
+	msgCopyOutResponse      = 'H'
+	msgCopyData             = 'd'
+	msgCopyDone             = 'c'
+)
+
+// Codes of the authentication messages.
+const (
+	authOK           = 0
+	authSASL         = 10
+	authSASLContinue = 11
+	authSASLFinal    = 12
+)
+
+// Codes of the untyped messages opening a connection.
+const (
+	protocolVersion = 3 << 16
+	sslRequest      = 80877103
+	gssEncRequest   = 80877104
+	cancelRequest   = 80877102
+)
+
+// maxMessage is the size over which messages are rejected.
+const maxMessage = 1 << 30
+
+// maxStartupMessage is the size over which messages are rejected before the
+// client is authenticated, as PostgreSQL does.
+const maxStartupMessage = 10000
+
+var ErrMalformed = errors.New("malformed message")
+
+// readMessage reads a typed message of up to limit bytes, returning its type
+// and content.
+func readMessage(r *bufio.Reader, limit uint32) (byte, []byte, error) {
+	t, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	b, err := readBody(r, limit)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	return t, b, nil
+}
+
+// readBody reads the length of a message, then its content, rejecting
+// messages over limit bytes.
+func readBody(r io.Reader, limit uint32) ([]byte, error) {
+	var l [4]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(l[:])
+	if n < 4 || n > limit {
+		return nil, fmt.Errorf("length %d: %w", n, ErrMalformed)
+	}
+	b := make([]byte, n-4)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// message builds a message sent by the server.
+type message []byte
+
+func newMessage(t byte) message {
+	return message{t, 0, 0, 0, 0}
+}
+
+func (m message) byte(b byte) message {
+	return append(m, b)
+}
+
+func (m message) int16(n int) message {
+	return binary.BigEndian.AppendUint16(m, uint16(n))
+}
+
+func (m message) int32(n int) message {
+	return binary.BigEndian.AppendUint32(m, uint32(n))
+}
+
+func (m message) string(s string) message {
+	m = append(m, s...)
+	return append(m, 0)
+}
+
+// bytes appends b prefixed with its length, -1 for nil.
+func (m message) bytes(b []byte) message {
+	if b == nil {
+		return m.int32(-1)
+	}
+	m = m.int32(len(b))
+	return append(m, b...)
+}
+
+func (m message) raw(b []byte) message {
+	return append(m, b...)
+}
+
+// send writes the message, once its length is known.
+func (m message) send(w io.Writer) error {
+	binary.BigEndian.PutUint32(m[1:5], uint32(len(m)-1))
+	_, err := w.Write(m)
+	return err
+}
+
+// reader reads the fields of a message sent by a client, keeping the first
+// error met.
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.b) < n {
+		r.err = ErrMalformed
+		return nil
+	}
+	out := r.b[:n]
+	r.b = r.b[n:]
+	return out
+}
+
+func (r *reader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) int16() int {
+	if b := r.next(2); b != nil {
+		return int(int16(binary.BigEndian.Uint16(b)))
+	}
+	return 0
+}
+
+func (r *reader) int32() int {
+	if b := r.next(4); b != nil {
+		return int(int32(binary.BigEndian.Uint32(b)))
+	}
+	return 0
+}
+
+func (r *reader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	for i, c := range r.b {
+		if c == 0 {
+			s := string(r.b[:i])
+			r.b = r.b[i+1:]
+			return s
+		}
+	}
+	r.err = ErrMalformed
+	return ""
+}
+
+// bytes reads a value prefixed with its length, nil when it is -1.
+func (r *reader) bytes() []byte {
+	n := r.int32()
+	if n == -1 {
+		return nil
+	}
+	return r.next(n)
+}
@@ -0,0 +1,115 @@
+// Package pgwire serves the database over the version 3 of the PostgreSQL
+// frontend/backend protocol, so that psql and PostgreSQL drivers can connect
+// to it.
+package pgwire
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/aliphe/filadb/cmd/db/app/handler"
+	"github.com/aliphe/filadb/query"
+)
+
+type Server struct {
+	q       query.SessionRunner
+	timeout time.Duration
+	// handshakeTimeout bounds the startup and authentication of clients.
+	handshakeTimeout time.Duration
+	tls              *tls.Config
+	l                net.Listener
+	wg               sync.WaitGroup
+	quit             chan any
+}
+
+func NewServer(q query.SessionRunner, opts ...handler.Option) (*Server, error) {
+	o := &handler.Options{
+		Addr:             ":5432",
+		HandshakeTimeout: handler.HandshakeTimeout,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	cfg, err := o.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("tcp", o.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("init postgres listener: %w", err)
+	}
+
+	s := &Server{
+		q:                q,
+		l:                ln,
+		timeout:          o.Timeout,
+		handshakeTimeout: o.HandshakeTimeout,
+		tls:              cfg,
+		quit:             make(chan any),
+	}
+
+	s.wg.Add(1)
+	return s, nil
+}
+
+func (s *Server) Listen(ctx context.Context) error {
+	defer s.wg.Done()
+
+	for {
+		nc, err := s.l.Accept()
+		if err != nil {
+			select {
+			case <-s.quit:
+				return nil
+			default:
+				slog.Error("accept connection", slog.Any("err", err))
+				continue
+			}
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					slog.Info("panic recovered", slog.Any("err", r))
+				}
+			}()
+			defer nc.Close()
+
+			if err := s.serve(nc); err != nil {
+				slog.Error("serve postgres connection", slog.Any("err", err))
+			}
+		}()
+	}
+}
+
+func (s *Server) Close() {
+	close(s.quit)
+	s.l.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve(nc net.Conn) error {
+	c := newConn(nc, s.q, s.timeout, s.tls)
+	nc.SetDeadline(time.Now().Add(s.handshakeTimeout))
+	if err := c.startup(); err != nil {
+		return err
+	}
+	// the connection may have been secured with TLS since.
+	c.nc.SetDeadline(time.Time{})
+	defer func() {
+		if err := c.sess.Close(context.Background()); err != nil {
+			slog.Error("close session", slog.Any("err", err))
+		}
+	}()
+
+	return c.serve()
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aliphe/filadb/cmd/db/app/handler"
+	"github.com/google/go-cmp/cmp"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func Test_Run_postgres(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go Run(ctx,
+		WithStorage(StorageMemory),
+		WithListener(handler.TypePostgres, handler.WithAddr(addr)),
+		WithBootstrapUser(testUser, testPassword),
+	)
+	time.Sleep(50 * time.Millisecond)
+
+	_, err = pgx.Connect(ctx, "postgres://"+testUser+":wrong@"+addr+"/filadb?sslmode=disable")
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "28P01" {
+		t.Fatalf("error = %v, want an invalid password error", err)
+	}
+
+	conn, err := pgx.Connect(ctx, "postgres://"+testUser+":"+testPassword+"@"+addr+"/filadb?sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "CREATE TABLE users (id NUMBER, email TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	tag, err := conn.Exec(ctx, "INSERT INTO users (id, email) VALUES ($1, $2)", 1, "it's@test.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.RowsAffected() != 1 {
+		t.Errorf("inserted %d rows, want 1", tag.RowsAffected())
+	}
+	// parameters are never read as SQL.
+	if _, err := conn.Exec(ctx, "INSERT INTO users (id, email) VALUES ($1, $2)", 2, "'); DROP TABLE users; --"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("extended query", func(t *testing.T) {
+		type user struct {
+			ID    int32
+			Email string
+		}
+		rows, err := conn.Query(ctx, "SELECT id, email FROM users WHERE id IN ($1, $2)", 1, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := pgx.CollectRows(rows, pgx.RowToStructByPos[user])
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []user{{1, "it's@test.com"}, {2, "'); DROP TABLE users; --"}}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("mismatch (-want,+got): %s", diff)
+		}
+	})
+
+	t.Run("simple query", func(t *testing.T) {
+		// arguments are interpolated client-side as text literals.
+		var id int32
+		err := conn.QueryRow(ctx, "SELECT id FROM users WHERE email = $1", pgx.QueryExecModeSimpleProtocol, "it's@test.com").Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != 1 {
+			t.Errorf("id = %d, want 1", id)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := conn.Exec(ctx, "SELECT name FROM users")
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || pgErr.Code != "42703" {
+			t.Fatalf("error = %v, want an undefined column error", err)
+		}
+
+		// the connection is still usable.
+		var n int32
+		if err := conn.QueryRow(ctx, "SELECT id FROM users WHERE id = 1").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("transaction", func(t *testing.T) {
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tx.Exec(ctx, "INSERT INTO users (id, email) VALUES ($1, $2)", 3, "rolled@back.com"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Rollback(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		rows, err := conn.Query(ctx, "SELECT id FROM users WHERE id = $1", 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids, err := pgx.CollectRows(rows, pgx.RowTo[int32])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != 0 {
+			t.Errorf("got rows %v after rollback", ids)
+		}
+	})
+
+	t.Run("copy to stdout", func(t *testing.T) {
+		// the output is larger than a chunk, so it is sent in several CopyData.
+		var want strings.Builder
+		want.WriteString("10,\"\"\r\n")
+		batch := &pgx.Batch{}
+		batch.Queue("INSERT INTO users (id, email) VALUES ($1, $2)", 10, "")
+		for i := range 800 {
+			email := fmt.Sprintf("user%04d@%s.com", i, strings.Repeat("a", 80))
+			batch.Queue("INSERT INTO users (id, email) VALUES ($1, $2)", 100+i, email)
+			fmt.Fprintf(&want, "%d,%s\r\n", 100+i, email)
+		}
+		if err := conn.SendBatch(ctx, batch).Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		var got bytes.Buffer
+		tag, err := conn.PgConn().CopyTo(ctx, &got, "COPY (SELECT id, email FROM users WHERE id > 9) TO STDOUT WITH (FORMAT csv)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tag.RowsAffected() != 801 {
+			t.Errorf("copied %d rows, want 801", tag.RowsAffected())
+		}
+		if diff := cmp.Diff(want.String(), got.String()); diff != "" {
+			t.Errorf("mismatch (-want,+got): %s", diff)
+		}
+	})
+}
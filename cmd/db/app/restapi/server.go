@@ -0,0 +1,325 @@
+// Package restapi serves the database over HTTP, with JSON responses.
+// Requests other than health checks authenticate with the basic scheme, so
+// the API should be served over TLS.
+package restapi
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aliphe/filadb/cmd/db/app/handler"
+	"github.com/aliphe/filadb/db/object"
+	"github.com/aliphe/filadb/net/scram"
+	"github.com/aliphe/filadb/query"
+	"github.com/aliphe/filadb/query/sql/lexer"
+)
+
+// maxQueryLen bounds the length of the queries of POST /query.
+const maxQueryLen = 16 << 20
+
+type Server struct {
+	q       query.SessionRunner
+	catalog query.Catalog
+	timeout time.Duration
+	l       net.Listener
+	srv     *http.Server
+}
+
+func NewServer(q query.SessionRunner, catalog query.Catalog, opts ...handler.Option) (*Server, error) {
+	o := &handler.Options{
+		Addr: ":8080",
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	cfg, err := o.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("tcp", o.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("init http listener: %w", err)
+	}
+	if cfg != nil {
+		ln = tls.NewListener(ln, cfg)
+	}
+
+	s := &Server{
+		q:       q,
+		catalog: catalog,
+		timeout: o.Timeout,
+		l:       ln,
+	}
+
+	mux := http.NewServeMux()
+	for _, r := range []struct {
+		method, path string
+		h            http.HandlerFunc
+	}{
+		{http.MethodGet, "/health", s.health},
+		{http.MethodPost, "/query", s.authenticated(s.query)},
+		{http.MethodGet, "/tables", s.authenticated(s.tables)},
+		{http.MethodGet, "/tables/{name}/schema", s.authenticated(s.schema)},
+	} {
+		mux.HandleFunc(r.method+" "+r.path, r.h)
+		mux.HandleFunc(r.path, notAllowed(r.method))
+	}
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, &errorBody{Message: fmt.Sprintf("no such endpoint %s", r.URL.Path)})
+	})
+
+	s.srv = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s, nil
+}
+
+func (s *Server) Listen(ctx context.Context) error {
+	err := s.srv.Serve(s.l)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Close waits for the requests being served.
+func (s *Server) Close() {
+	if err := s.srv.Shutdown(context.Background()); err != nil {
+		slog.Error("shutdown http server", slog.Any("err", err))
+	}
+}
+
+type errorBody struct {
+	Code    query.Code `json:"code,omitempty"`
+	Message string     `json:"message"`
+	// Position is the 1-based offset in the query of the error, 0 if unknown.
+	Position int `json:"position,omitempty"`
+}
+
+type column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type result struct {
+	Tag      string   `json:"tag"`
+	Columns  []column `json:"columns,omitempty"`
+	Rows     [][]any  `json:"rows,omitempty"`
+	RowCount int      `json:"row_count"`
+	// Data holds the output of COPY TO STDOUT.
+	Data string `json:"data,omitempty"`
+}
+
+type errorResponse struct {
+	Error *errorBody `json:"error"`
+}
+
+type queryResponse struct {
+	// Results holds the results of the statements which ran, up to the one
+	// which failed if any.
+	Results []result   `json:"results"`
+	Error   *errorBody `json:"error,omitempty"`
+}
+
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// query runs the statements of the body of the request, in a session of their
+// own.
+func (s *Server) query(w http.ResponseWriter, r *http.Request, user string) {
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxQueryLen))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, &errorBody{Message: err.Error()})
+		return
+	}
+	stmts := lexer.Split(string(b))
+	if len(stmts) == 0 {
+		writeError(w, http.StatusBadRequest, &errorBody{Code: query.CodeSyntaxError, Message: "empty query"})
+		return
+	}
+
+	ctx, cancel := s.context(r)
+	defer cancel()
+	sess := s.q.Session(user)
+	defer sess.Close(ctx)
+
+	out := queryResponse{Results: []result{}}
+	for _, stmt := range stmts {
+		slog.Debug("received", slog.String("query", lexer.Redact(stmt.SQL)))
+		res, err := sess.Run(ctx, stmt.SQL)
+		if err != nil {
+			qerr := queryError(err)
+			if qerr.Position > 0 {
+				qerr.Position += stmt.Offset
+			}
+			out.Error = newErrorBody(qerr)
+			writeJSON(w, status(qerr.Code), out)
+			return
+		}
+		out.Results = append(out.Results, newResult(res))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) tables(w http.ResponseWriter, r *http.Request, user string) {
+	ctx, cancel := s.context(r)
+	defer cancel()
+
+	tables, err := s.catalog.Tables(ctx, user)
+	if err != nil {
+		qerr := queryError(err)
+		writeError(w, status(qerr.Code), newErrorBody(qerr))
+		return
+	}
+	if tables == nil {
+		tables = []object.Table{}
+	}
+	writeJSON(w, http.StatusOK, map[string][]object.Table{"tables": tables})
+}
+
+func (s *Server) schema(w http.ResponseWriter, r *http.Request, user string) {
+	ctx, cancel := s.context(r)
+	defer cancel()
+
+	sch, err := s.catalog.Schema(ctx, user, object.Table(r.PathValue("name")))
+	if err != nil {
+		qerr := queryError(err)
+		writeError(w, status(qerr.Code), newErrorBody(qerr))
+		return
+	}
+
+	out := struct {
+		Table   object.Table `json:"table"`
+		Columns []column     `json:"columns"`
+	}{Table: sch.Table, Columns: make([]column, 0, len(sch.Columns))}
+	for _, c := range sch.Columns {
+		out.Columns = append(out.Columns, column{Name: c.Name, Type: string(c.Type)})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// authenticated checks the credentials of the basic authorization of the
+// requests, and passes their user along.
+func (s *Server) authenticated(h func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="filadb", charset="UTF-8"`)
+			writeError(w, http.StatusUnauthorized, &errorBody{Code: query.CodeInvalidAuthorization, Message: "missing credentials"})
+			return
+		}
+
+		creds, err := handler.Credentials(r.Context(), s.q, user)
+		if err != nil {
+			qerr := queryError(err)
+			writeError(w, status(qerr.Code), newErrorBody(qerr))
+			return
+		}
+		if creds == nil {
+			// unknown users take as long to reject as the others.
+			scram.NewCredentials(password)
+		}
+		if creds == nil || !creds.Verify(password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="filadb", charset="UTF-8"`)
+			writeError(w, http.StatusUnauthorized, newErrorBody(handler.AuthError(user)))
+			return
+		}
+
+		h(w, r, user)
+	}
+}
+
+func (s *Server) context(r *http.Request) (context.Context, context.CancelFunc) {
+	if s.timeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), s.timeout)
+}
+
+func notAllowed(method string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, &errorBody{Message: fmt.Sprintf("method %s not allowed, want %s", r.Method, method)})
+	}
+}
+
+func newResult(res *query.Result) result {
+	out := result{
+		Tag:      res.Tag,
+		Rows:     res.Rows,
+		RowCount: res.RowCount,
+		Data:     string(res.Data),
+	}
+	if res.Columns != nil {
+		out.Columns = make([]column, 0, len(res.Columns))
+		for _, c := range res.Columns {
+			out.Columns = append(out.Columns, column{Name: c.Name, Type: string(c.Type)})
+		}
+		if out.Rows == nil {
+			out.Rows = [][]any{}
+		}
+	}
+	return out
+}
+
+func queryError(err error) *query.Error {
+	var qerr *query.Error
+	if !errors.As(err, &qerr) {
+		qerr = &query.Error{Code: query.CodeInternal, Err: err}
+	}
+	return qerr
+}
+
+func newErrorBody(err *query.Error) *errorBody {
+	return &errorBody{
+		Code:     err.Code,
+		Message:  err.Error(),
+		Position: err.Position,
+	}
+}
+
+// status returns the HTTP status of the responses failing with the code.
+func status(code query.Code) int {
+	switch {
+	case code == query.CodeInternal:
+		return http.StatusInternalServerError
+	case code == query.CodeFeatureNotSupported:
+		return http.StatusNotImplemented
+	case strings.HasPrefix(string(code), "28"):
+		return http.StatusUnauthorized
+	case code == query.CodeInsufficientPrivilege:
+		return http.StatusForbidden
+	case code == query.CodeUndefinedTable, code == query.CodeUndefinedObject:
+		return http.StatusNotFound
+	case strings.HasPrefix(string(code), "23"), strings.HasPrefix(string(code), "25"), strings.HasPrefix(string(code), "40"),
+		code == query.CodeDuplicateObject:
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err *errorBody) {
+	writeJSON(w, status, errorResponse{Error: err})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("write response", slog.Any("err", err))
+	}
+}
@@ -0,0 +1,170 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aliphe/filadb/cmd/db/app/handler"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_Run_restapi(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go Run(ctx,
+		WithStorage(StorageMemory),
+		WithListener(handler.TypeRestAPI, handler.WithAddr(addr)),
+		WithBootstrapUser(testUser, testPassword),
+	)
+	time.Sleep(50 * time.Millisecond)
+
+	type credentials struct{ user, password string }
+	admin := &credentials{testUser, testPassword}
+	bob := &credentials{"bob", "pencil"}
+
+	steps := []struct {
+		method, path string
+		creds        *credentials
+		body         string
+		wantStatus   int
+		want         string
+	}{
+		{
+			method: "GET", path: "/health",
+			wantStatus: http.StatusOK,
+			want:       `{"status": "ok"}`,
+		},
+		{
+			method: "GET", path: "/tables",
+			wantStatus: http.StatusUnauthorized,
+			want:       `{"error": {"code": "28000", "message": "missing credentials"}}`,
+		},
+		{
+			method: "GET", path: "/tables",
+			creds:      &credentials{testUser, "wrong"},
+			wantStatus: http.StatusUnauthorized,
+			want:       `{"error": {"code": "28P01", "message": "password authentication failed for user \"filadb\""}}`,
+		},
+		{
+			method: "POST", path: "/query", creds: admin,
+			body:       "CREATE TABLE users (id NUMBER, email TEXT); INSERT INTO users (id, email) VALUES (1, 'a@test.com');",
+			wantStatus: http.StatusOK,
+			want:       `{"results": [{"tag": "CREATE TABLE", "row_count": 0}, {"tag": "INSERT 1", "row_count": 1}]}`,
+		},
+		{
+			method: "POST", path: "/query", creds: admin,
+			body:       "SELECT id, email FROM users",
+			wantStatus: http.StatusOK,
+			want: `{"results": [{
+				"tag": "SELECT 1",
+				"columns": [{"name": "id", "type": "number"}, {"name": "email", "type": "text"}],
+				"rows": [[1, "a@test.com"]],
+				"row_count": 1
+			}]}`,
+		},
+		{
+			method: "POST", path: "/query", creds: admin,
+			body:       "INSERT INTO users (id, email) VALUES (2, 'b@test.com'); SELECT id FROM nope",
+			wantStatus: http.StatusBadRequest,
+			want: `{
+				"results": [{"tag": "INSERT 1", "row_count": 1}],
+				"error": {"code": "42703", "message": "id: reference not found"}
+			}`,
+		},
+		{
+			method: "POST", path: "/query", creds: admin,
+			body:       " ; ",
+			wantStatus: http.StatusBadRequest,
+			want:       `{"error": {"code": "42601", "message": "empty query"}}`,
+		},
+		{
+			method: "GET", path: "/tables", creds: admin,
+			wantStatus: http.StatusOK,
+			want:       `{"tables": ["users"]}`,
+		},
+		{
+			method: "GET", path: "/tables/users/schema", creds: admin,
+			wantStatus: http.StatusOK,
+			want:       `{"table": "users", "columns": [{"name": "email", "type": "text"}, {"name": "id", "type": "number"}]}`,
+		},
+		{
+			method: "GET", path: "/tables/nope/schema", creds: admin,
+			wantStatus: http.StatusNotFound,
+			want:       `{"error": {"code": "42P01", "message": "table nope: table not found"}}`,
+		},
+		{
+			method: "POST", path: "/query", creds: admin,
+			body:       "CREATE USER bob PASSWORD 'pencil'",
+			wantStatus: http.StatusOK,
+			want:       `{"results": [{"tag": "CREATE ROLE", "row_count": 0}]}`,
+		},
+		{
+			method: "GET", path: "/tables", creds: bob,
+			wantStatus: http.StatusOK,
+			want:       `{"tables": []}`,
+		},
+		{
+			method: "GET", path: "/tables/users/schema", creds: bob,
+			wantStatus: http.StatusForbidden,
+			want:       `{"error": {"code": "42501", "message": "permission denied for table users"}}`,
+		},
+		{
+			method: "GET", path: "/query",
+			wantStatus: http.StatusMethodNotAllowed,
+			want:       `{"error": {"message": "method GET not allowed, want POST"}}`,
+		},
+		{
+			method: "GET", path: "/nope",
+			wantStatus: http.StatusNotFound,
+			want:       `{"error": {"message": "no such endpoint /nope"}}`,
+		},
+	}
+
+	for _, s := range steps {
+		req, err := http.NewRequestWithContext(ctx, s.method, "http://"+addr+s.path, strings.NewReader(s.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.creds != nil {
+			req.SetBasicAuth(s.creds.user, s.creds.password)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != s.wantStatus {
+			t.Errorf("%s %s: status = %d, want %d", s.method, s.path, resp.StatusCode, s.wantStatus)
+		}
+		var got, want any
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatalf("%s %s: decode %q: %v", s.method, s.path, b, err)
+		}
+		if err := json.Unmarshal([]byte(s.want), &want); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("%s %s: mismatch (-want,+got): %s", s.method, s.path, diff)
+		}
+	}
+}
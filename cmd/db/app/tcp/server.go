@@ -1,47 +1,62 @@
 package tcp
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/aliphe/filadb/cmd/db/app/handler"
 	fnet "github.com/aliphe/filadb/net"
+	"github.com/aliphe/filadb/net/scram"
 	"github.com/aliphe/filadb/query"
+	"github.com/aliphe/filadb/query/sql/lexer"
 )
 
 type Server struct {
-	q       query.Runner
+	q       query.SessionRunner
 	timeout time.Duration
-	l       net.Listener
-	wg      sync.WaitGroup
-	quit    chan any
+	// handshakeTimeout bounds the startup and authentication of clients.
+	handshakeTimeout time.Duration
+	l                net.Listener
+	wg               sync.WaitGroup
+	quit             chan any
 }
 
-func NewServer(q query.Runner, opts ...handler.Option) (*Server, error) {
+func NewServer(q query.SessionRunner, opts ...handler.Option) (*Server, error) {
 	o := &handler.Options{
-		Addr: ":5432",
+		Addr:             ":5432",
+		HandshakeTimeout: handler.HandshakeTimeout,
 	}
 	for _, opt := range opts {
 		opt(o)
 	}
 
+	cfg, err := o.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	ln, err := net.Listen("tcp", o.Addr)
 	if err != nil {
 		return nil, fmt.Errorf("init tcp connection: %w", err)
 	}
+	if cfg != nil {
+		ln = tls.NewListener(ln, cfg)
+	}
 
 	s := &Server{
-		q:       q,
-		l:       ln,
-		timeout: o.Timeout,
-		quit:    make(chan any),
+		q:                q,
+		l:                ln,
+		timeout:          o.Timeout,
+		handshakeTimeout: o.HandshakeTimeout,
+		quit:             make(chan any),
 	}
 
 	s.wg.Add(1)
@@ -64,13 +79,13 @@ func (s *Server) Listen(ctx context.Context) error {
 
 		s.wg.Add(1)
 		go func() {
+			defer s.wg.Done()
 			defer func() {
 				if r := recover(); r != nil {
 					slog.Info("panic recovered", slog.Any("err", r))
 				}
 			}()
 			s.handleClient(conn)
-			s.wg.Done()
 		}()
 	}
 }
@@ -83,63 +98,285 @@ func (s *Server) Close() {
 
 func (s *Server) handleClient(conn net.Conn) {
 	defer conn.Close()
+	w := bufio.NewWriter(conn)
+
+	conn.SetDeadline(time.Now().Add(s.handshakeTimeout))
+	user, err := s.startup(conn, w)
+	if err != nil {
+		slog.Error("start session", slog.Any("err", err))
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	sess := s.q.Session(user)
+	defer func() {
+		if err := sess.Close(context.Background()); err != nil {
+			slog.Error("close session", slog.Any("err", err))
+		}
+	}()
 
 	for {
-		queries, err := readQueries(conn)
+		m, err := fnet.ReadMessage(conn)
 		if err != nil {
 			if !errors.Is(err, io.EOF) {
-				fmt.Fprintf(conn, "handle query: %s", err)
+				slog.Error("read message", slog.Any("err", err))
+				writeError(w, &query.Error{Code: query.CodeProtocolViolation, Err: err})
+				w.Flush()
 			}
 			return
 		}
 
-		for _, q := range queries {
-			out, err := s.handleRequest(q)
-			if err != nil {
-				fmt.Fprintf(conn, "handle query: %s", err)
-				continue
-			}
+		switch m := m.(type) {
+		case *fnet.Query:
+			err = s.handleQuery(sess, w, m.SQL)
+		case *fnet.Prepare:
+			err = s.handlePrepare(sess, w, m)
+		case *fnet.Execute:
+			err = s.handleExecute(sess, w, m)
+		case *fnet.Terminate:
+			return
+		default:
+			err = writeError(w, &query.Error{
+				Code: query.CodeProtocolViolation,
+				Err:  fmt.Errorf("unexpected message %q", m.Type()),
+			})
+		}
+		if err == nil {
+			err = fnet.WriteMessage(w, &fnet.ReadyForQuery{Status: byte(sess.Status())})
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			slog.Error("write response", slog.Any("err", err))
+			return
+		}
+	}
+}
+
+// startup reads the Startup message of the client and authenticates it,
+// answering ReadyForQuery if it speaks the version of the protocol. It
+// returns the authenticated user. Messages are limited to a few kilobytes
+// until then.
+func (s *Server) startup(r io.Reader, w *bufio.Writer) (string, error) {
+	m, err := fnet.ReadStartupMessage(r)
+	if err != nil {
+		return "", err
+	}
 
-			err = fnet.Write(conn, out)
-			if err != nil {
-				slog.Error("write response", slog.Any("err", err))
-				return
+	st, ok := m.(*fnet.Startup)
+	switch {
+	case !ok:
+		err = fmt.Errorf("unexpected message %q, want startup", m.Type())
+	case st.Version != fnet.Version:
+		err = fmt.Errorf("unsupported protocol version %d, want %d", st.Version, fnet.Version)
+	}
+	if err != nil {
+		writeError(w, &query.Error{Code: query.CodeProtocolViolation, Err: err})
+		w.Flush()
+		return "", err
+	}
+
+	if err := s.authenticate(r, w, st.User); err != nil {
+		var qerr *query.Error
+		if !errors.As(err, &qerr) {
+			qerr = handler.AuthError(st.User)
+		}
+		writeError(w, qerr)
+		w.Flush()
+		return "", fmt.Errorf("authenticate %q: %w", st.User, err)
+	}
+
+	if err := fnet.WriteMessage(w, &fnet.ReadyForQuery{Status: byte(query.TxIdle)}); err != nil {
+		return "", err
+	}
+	return st.User, w.Flush()
+}
+
+// authenticate runs the SCRAM-SHA-256 conversation of the user.
+func (s *Server) authenticate(r io.Reader, w *bufio.Writer, user string) error {
+	creds, err := handler.Credentials(context.Background(), s.q, user)
+	if err != nil {
+		return err
+	}
+	srv := scram.NewServer(creds)
+
+	if err := fnet.WriteMessage(w, &fnet.AuthenticationSASL{Mechanisms: []string{scram.Mechanism}}); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	var init *fnet.SASLInitialResponse
+	if err := readAuth(r, &init); err != nil {
+		return err
+	}
+	if init.Mechanism != scram.Mechanism {
+		return fmt.Errorf("unsupported mechanism %s", init.Mechanism)
+	}
+	first, err := srv.First(init.Data)
+	if err != nil {
+		return err
+	}
+
+	if err := fnet.WriteMessage(w, &fnet.AuthenticationSASLContinue{Data: first}); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	var resp *fnet.SASLResponse
+	if err := readAuth(r, &resp); err != nil {
+		return err
+	}
+	final, err := srv.Final(resp.Data)
+	if err != nil {
+		return err
+	}
+	return fnet.WriteMessage(w, &fnet.AuthenticationSASLFinal{Data: final})
+}
+
+// readAuth reads the next message of the authentication into dst.
+func readAuth[T fnet.Message](r io.Reader, dst *T) error {
+	m, err := fnet.ReadStartupMessage(r)
+	if err != nil {
+		return err
+	}
+	out, ok := m.(T)
+	if !ok {
+		return &query.Error{
+			Code: query.CodeProtocolViolation,
+			Err:  fmt.Errorf("unexpected message %q during authentication", m.Type()),
+		}
+	}
+	*dst = out
+	return nil
+}
+
+// handleQuery runs the statements of q until one fails, writing their results.
+func (s *Server) handleQuery(sess query.Session, w io.Writer, q string) error {
+	for _, stmt := range lexer.Split(q) {
+		res, err := s.handleRequest(sess, w, stmt.SQL)
+		if err != nil {
+			qerr := queryError(err)
+			if qerr.Position > 0 {
+				qerr.Position += stmt.Offset
 			}
+			return writeError(w, qerr)
+		}
+
+		if err := writeResult(w, res); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
-func (s *Server) handleRequest(q string) ([]byte, error) {
+func (s *Server) handleRequest(sess query.Session, w io.Writer, q string) (*query.Result, error) {
+	ctx, cancel := context.WithTimeout(query.WithCopyOut(context.Background(), copyOut{w}), s.timeout)
+	defer cancel()
+
+	slog.Debug("received", slog.String("query", lexer.Redact(q)))
+
+	return sess.Run(ctx, q)
+}
+
+// handlePrepare prepares the statement of the message, writing the types of
+// its parameters.
+func (s *Server) handlePrepare(sess query.Session, w io.Writer, m *fnet.Prepare) error {
+	if len(lexer.Split(m.SQL)) > 1 {
+		return writeError(w, &query.Error{
+			Code: query.CodeSyntaxError,
+			Err:  errors.New("cannot insert multiple commands into a prepared statement"),
+		})
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
 	defer cancel()
 
-	slog.Info("received", slog.String("query", string(q)))
+	slog.Debug("prepare", slog.String("name", m.Name), slog.String("query", lexer.Redact(m.SQL)))
 
-	res, err := s.q.Run(ctx, string(q))
+	stmt, err := sess.Prepare(ctx, m.Name, m.SQL)
 	if err != nil {
-		return fmt.Appendf(nil, "run sql query: %s\n", err), nil
+		return writeError(w, queryError(err))
 	}
+	return fnet.WriteMessage(w, &fnet.ParameterDescription{Types: stmt.Params})
+}
 
-	if len(res) == 0 {
-		return nil, nil
+// handleExecute runs a prepared statement with the parameters of the
+// message, writing its result.
+func (s *Server) handleExecute(sess query.Session, w io.Writer, m *fnet.Execute) error {
+	args := make([]any, 0, len(m.Params))
+	for i, p := range m.Params {
+		v, err := p.Decode()
+		if err != nil {
+			return writeError(w, &query.Error{Code: query.CodeInvalidValue, Err: fmt.Errorf("parameter $%d: %w", i+1, err)})
+		}
+		args = append(args, v)
 	}
 
-	return res, nil
-}
+	ctx, cancel := context.WithTimeout(query.WithCopyOut(context.Background(), copyOut{w}), s.timeout)
+	defer cancel()
+
+	slog.Debug("execute", slog.String("name", m.Name))
 
-// readQueries reads queries from the given io.Reader, splitting them by semicolons.
-func readQueries(r io.Reader) ([]string, error) {
-	q, err := fnet.Read(r)
+	res, err := sess.Execute(ctx, m.Name, args...)
 	if err != nil {
-		return nil, err
+		return writeError(w, queryError(err))
 	}
+	return writeResult(w, res)
+}
 
-	out := make([]string, 0, 1)
-	for part := range strings.SplitSeq(string(q), ";") {
-		if part != "" {
-			out = append(out, part)
+func queryError(err error) *query.Error {
+	var qerr *query.Error
+	if errors.As(err, &qerr) {
+		return qerr
+	}
+	return &query.Error{Code: query.CodeInternal, Err: err}
+}
+
+func writeResult(w io.Writer, res *query.Result) error {
+	if res.Columns != nil {
+		desc := &fnet.RowDescription{Columns: make([]fnet.Column, 0, len(res.Columns))}
+		for _, c := range res.Columns {
+			desc.Columns = append(desc.Columns, fnet.Column{Name: c.Name, Type: c.Type})
+		}
+		if err := fnet.WriteMessage(w, desc); err != nil {
+			return err
 		}
 	}
+	for _, row := range res.Rows {
+		vals := make([][]byte, 0, len(row))
+		for _, v := range row {
+			vals = append(vals, fnet.Encode(v))
+		}
+		if err := fnet.WriteMessage(w, &fnet.DataRow{Values: vals}); err != nil {
+			return err
+		}
+	}
+	return fnet.WriteMessage(w, &fnet.CommandComplete{Tag: res.Tag, Rows: uint64(res.RowCount)})
+}
+
+// copyOut sends the output of COPY TO STDOUT as CopyData messages.
+type copyOut struct {
+	w io.Writer
+}
+
+func (copyOut) Begin() error { return nil }
+
+func (o copyOut) Write(p []byte) (int, error) {
+	if err := fnet.WriteMessage(o.w, &fnet.CopyData{Data: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (copyOut) End() error { return nil }
 
-	return out, nil
+func writeError(w io.Writer, err *query.Error) error {
+	return fnet.WriteMessage(w, &fnet.ErrorResponse{
+		Code:     string(err.Code),
+		Message:  err.Error(),
+		Position: uint32(err.Position),
+	})
 }
@@ -0,0 +1,204 @@
+package app
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aliphe/filadb/client"
+	"github.com/aliphe/filadb/cmd/db/app/handler"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// certificates writes to a temporary directory the certificate authority
+// ca.pem, and the server.pem and client.pem certificates it signs, with their
+// keys. The server one names 127.0.0.1 only.
+func certificates(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	write := func(name, typ string, der []byte) {
+		b := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	issue := func(name string, tmpl, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parent == nil {
+			parent, parentKey = tmpl, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		write(name+".pem", "CERTIFICATE", der)
+		write(name+"-key.pem", "EC PRIVATE KEY", keyDER)
+		return cert, key
+	}
+
+	now := time.Now()
+	ca, caKey := issue("ca", &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "filadb test ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil, nil)
+	issue("server", &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "filadb"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}, ca, caKey)
+	issue("client", &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: testUser},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	return dir
+}
+
+func Test_Run_tls(t *testing.T) {
+	t.Parallel()
+
+	dir := certificates(t)
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	var ports [2]string
+	for i := range ports {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, ports[i], _ = net.SplitHostPort(listener.Addr().String())
+		listener.Close()
+	}
+	tcpPort, pgPort := ports[0], ports[1]
+
+	ctx, cancel := context.WithCancel(t.Context())
+	t.Cleanup(cancel)
+	go Run(ctx,
+		WithStorage(StorageMemory),
+		WithListener(handler.TypeTCP,
+			handler.WithAddr("127.0.0.1:"+tcpPort),
+			handler.WithTLS(file("server.pem"), file("server-key.pem"), file("ca.pem")),
+		),
+		WithListener(handler.TypePostgres,
+			handler.WithAddr("127.0.0.1:"+pgPort),
+			handler.WithTLS(file("server.pem"), file("server-key.pem"), ""),
+		),
+		WithBootstrapUser(testUser, testPassword),
+	)
+	time.Sleep(50 * time.Millisecond)
+
+	clientCert := "&sslcert=" + file("client.pem") + "&sslkey=" + file("client-key.pem")
+	tests := map[string]struct {
+		host    string
+		params  string
+		wantErr bool
+	}{
+		"verify-full": {
+			host:   "127.0.0.1",
+			params: "sslmode=verify-full&sslrootcert=" + file("ca.pem") + clientCert,
+		},
+		"verify-ca, whatever the host name": {
+			host:   "localhost",
+			params: "sslmode=verify-ca&sslrootcert=" + file("ca.pem") + clientCert,
+		},
+		"require, without certificate authorities": {
+			host:   "127.0.0.1",
+			params: "sslmode=require" + clientCert,
+		},
+		"verify-full, with another host name": {
+			host:    "localhost",
+			params:  "sslmode=verify-full&sslrootcert=" + file("ca.pem") + clientCert,
+			wantErr: true,
+		},
+		"verify-full, with the system authorities": {
+			host:    "127.0.0.1",
+			params:  "sslmode=verify-full" + clientCert,
+			wantErr: true,
+		},
+		"without client certificate": {
+			host:    "127.0.0.1",
+			params:  "sslmode=verify-full&sslrootcert=" + file("ca.pem"),
+			wantErr: true,
+		},
+		"without tls": {
+			host:    "127.0.0.1",
+			params:  "sslmode=disable",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			c, err := client.New("filadb://" + testUser + ":" + testPassword + "@" + net.JoinHostPort(tc.host, tcpPort) + "?" + tc.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			ctx, cancel := context.WithTimeout(ctx, time.Second)
+			defer cancel()
+			_, err = c.Exec(ctx, "ANALYZE")
+			if (err != nil) != tc.wantErr {
+				t.Errorf("error = %v, want error %v", err, tc.wantErr)
+			}
+		})
+	}
+
+	t.Run("postgres", func(t *testing.T) {
+		t.Parallel()
+		dsn := "postgres://" + testUser + ":" + testPassword + "@127.0.0.1:" + pgPort + "/filadb"
+
+		_, err := pgx.Connect(ctx, dsn+"?sslmode=disable")
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || pgErr.Code != "28000" {
+			t.Fatalf("error = %v, want TLS to be required", err)
+		}
+
+		conn, err := pgx.Connect(ctx, dsn+"?sslmode=verify-full&sslrootcert="+file("ca.pem"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close(context.Background())
+		if _, err := conn.Exec(ctx, "ANALYZE"); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -2,16 +2,35 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/aliphe/filadb/cmd/db/app"
+	"github.com/aliphe/filadb/cmd/db/app/handler"
 )
 
 var (
-	verbose = flag.Bool("verbose", false, "enable more verbose logging")
+	verbose  = flag.Bool("verbose", false, "enable more verbose logging")
+	storage  = flag.String("storage", string(app.StorageFile), "storage engine, file or memory")
+	snapshot = flag.Bool("snapshot", false, "with the memory storage, save the database to disk on shutdown")
+	cow      = flag.Bool("copy_on_write", false, "never modify saved nodes, swapping the roots of trees atomically instead")
+	addr     = flag.String("addr", ":5432", "address to serve the native protocol on, none if empty")
+	postgres = flag.String("postgres_addr", "", "address to serve the PostgreSQL protocol on")
+	httpAddr = flag.String("http_addr", "", "address to serve the HTTP API on")
+	user     = flag.String("user", "filadb", "user created on first run, with the password of the "+passwordEnv+" environment variable")
+	tlsCert  = flag.String("tls_cert", "", "PEM certificate to serve connections over TLS with")
+	tlsKey   = flag.String("tls_key", "", "PEM key of the TLS certificate")
+	clientCA = flag.String("tls_client_ca", "", "PEM certificate authorities which must sign the certificates of clients")
 )
 
+// passwordEnv holds the password of the user created on first run.
+const passwordEnv = "FILADB_PASSWORD"
+
 func main() {
 	flag.Parse()
 
@@ -19,7 +38,44 @@ func main() {
 		slog.SetLogLoggerLevel(slog.LevelDebug)
 	}
 
-	if err := app.Run(context.Background()); err != nil {
+	if flag.Arg(0) == "check" {
+		if err := app.Check(context.Background(), os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	opts := []app.Option{
+		app.WithStorage(app.Storage(*storage)),
+		app.WithBootstrapUser(*user, os.Getenv(passwordEnv)),
+	}
+	if *snapshot {
+		opts = append(opts, app.WithSnapshot())
+	}
+	if *cow {
+		opts = append(opts, app.WithCopyOnWrite())
+	}
+	if *tlsCert != "" || *tlsKey != "" {
+		opts = append(opts, app.WithHandlerOptions(handler.WithTLS(*tlsCert, *tlsKey, *clientCA)))
+	}
+	for _, l := range []struct {
+		typ  handler.Type
+		addr string
+	}{
+		{handler.TypeTCP, *addr},
+		{handler.TypePostgres, *postgres},
+		{handler.TypeRestAPI, *httpAddr},
+	} {
+		if l.addr != "" {
+			opts = append(opts, app.WithListener(l.typ, handler.WithAddr(l.addr)))
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := app.Run(ctx, opts...); err != nil && !errors.Is(err, context.Canceled) {
 		panic(err)
 	}
 }
@@ -2,38 +2,66 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/aliphe/filadb/db/index"
 	"github.com/aliphe/filadb/db/object"
 	"github.com/aliphe/filadb/db/schema"
+	"github.com/aliphe/filadb/db/stats"
 	"github.com/aliphe/filadb/db/storage"
 	"github.com/aliphe/filadb/db/system"
+	"github.com/aliphe/filadb/net/scram"
 )
 
 type schemaStore interface {
 	Create(ctx context.Context, sch *schema.Schema) error
 	Get(ctx context.Context, table object.Table) (*schema.Schema, error)
 	Shape(ctx context.Context, tables []object.Table) (*system.DatabaseShape, error)
+	Tables(ctx context.Context) ([]object.Table, error)
 }
 
 type indexStore interface {
 	Scan(ctx context.Context, table object.Table) ([]*index.Index, error)
 	Create(ctx context.Context, idx *index.Index) error
 	Index(ctx context.Context, idx *index.Index, rows ...object.Row) error
+	Unindex(ctx context.Context, idx *index.Index, rows ...object.Row) error
+}
+
+type statsStore interface {
+	Save(ctx context.Context, t *stats.Table) error
+	Get(ctx context.Context, sch *schema.Schema) (*stats.Table, error)
+}
+
+type roleStore interface {
+	Create(ctx context.Context, r *system.Role) error
+	Get(ctx context.Context, name string) (*system.Role, error)
+	Update(ctx context.Context, r *system.Role) error
+	Credentials(ctx context.Context, name string) (scram.Credentials, error)
+	Users(ctx context.Context) ([]string, error)
+	GrantRole(ctx context.Context, role, member string) error
+	RevokeRole(ctx context.Context, role, member string) error
+	Grant(ctx context.Context, role string, t object.Table, privs ...system.Privilege) error
+	Revoke(ctx context.Context, role string, t object.Table, privs ...system.Privilege) error
+	HasPrivilege(ctx context.Context, role string, t object.Table, p system.Privilege) (bool, error)
 }
 
 type Client struct {
-	store  storage.ReaderWriter
+	store  storage.Store
 	schema schemaStore
 	index  indexStore
+	stats  statsStore
+	roles  roleStore
 }
 
-func NewClient(store storage.ReaderWriter, schema schemaStore, index indexStore) *Client {
+func NewClient(store storage.Store, schema schemaStore, index indexStore, stats statsStore, roles roleStore) *Client {
 	c := &Client{
 		store:  store,
 		schema: schema,
 		index:  index,
+		stats:  stats,
+		roles:  roles,
 	}
 
 	return c
@@ -56,6 +84,12 @@ type Filter struct {
 	Val any
 }
 
+// Begin starts a transaction. Operations join it when their context carries it,
+// see storage.WithTx.
+func (c *Client) Begin(ctx context.Context) (storage.Tx, error) {
+	return c.store.Begin(ctx)
+}
+
 //
 // Row operations
 //
@@ -91,12 +125,90 @@ func (c *Client) InsertRow(ctx context.Context, t object.Table, r object.Row) er
 	return nil
 }
 
+// BulkResult reports the outcome of a bulk insert.
+type BulkResult struct {
+	Loaded   int
+	Rejected []Rejection
+}
+
+// Rejection is a row left out of a bulk insert.
+type Rejection struct {
+	// Row is the index of the row in the batch.
+	Row int
+	Err error
+}
+
+// BulkInsert inserts the valid rows of the batch at once, and reports the
+// others. Indexes are updated once every row is stored.
+func (c *Client) BulkInsert(ctx context.Context, t object.Table, rows []object.Row) (BulkResult, error) {
+	sch, err := c.schema.Get(ctx, t)
+	if err != nil {
+		return BulkResult{}, err
+	}
+	m := sch.Marshaler()
+
+	var res BulkResult
+	valid := make([]object.Row, 0, len(rows))
+	entries := make([]storage.Entry, 0, len(rows))
+	ids := make(map[object.ID]bool, len(rows))
+	for i, r := range rows {
+		id := r.ObjectID()
+		if ids[id] {
+			res.Rejected = append(res.Rejected, Rejection{Row: i, Err: fmt.Errorf("id %s: %w", id, storage.ErrDuplicate)})
+			continue
+		}
+		b, err := m.Marshal(r)
+		if err != nil {
+			res.Rejected = append(res.Rejected, Rejection{Row: i, Err: err})
+			continue
+		}
+
+		ids[id] = true
+		valid = append(valid, r)
+		entries = append(entries, storage.Entry{Key: string(id), Val: b})
+	}
+	if len(valid) == 0 {
+		return res, nil
+	}
+
+	if l, ok := c.store.(storage.Loader); ok {
+		err = l.Load(ctx, string(t), entries)
+	} else {
+		for _, e := range entries {
+			if err = c.store.Add(ctx, string(t), e.Key, e.Val); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return BulkResult{}, fmt.Errorf("load rows: %w", err)
+	}
+
+	idxs, err := c.index.Scan(ctx, t)
+	if err != nil {
+		return BulkResult{}, fmt.Errorf("fetch indexes: %w", err)
+	}
+	for _, idx := range idxs {
+		if err := c.index.Index(ctx, idx, valid...); err != nil {
+			return BulkResult{}, fmt.Errorf("index rows: %w", err)
+		}
+	}
+
+	res.Loaded = len(valid)
+	return res, nil
+}
+
 func (c *Client) UpdateRow(ctx context.Context, t object.Table, r object.Row) error {
 	sch, err := c.schema.Get(ctx, t)
 	if err != nil {
 		return err
 	}
 
+	var prev object.Row
+	if err := c.GetRow(ctx, t, r.ObjectID(), &prev); err != nil {
+		return fmt.Errorf("fetch previous row: %w", err)
+	}
+
 	b, err := sch.Marshaler().Marshal(r)
 	if err != nil {
 		return err
@@ -107,6 +219,26 @@ func (c *Client) UpdateRow(ctx context.Context, t object.Table, r object.Row) er
 		return err
 	}
 
+	idxs, err := c.index.Scan(ctx, t)
+	if err != nil {
+		return fmt.Errorf("fetch indexes: %w", err)
+	}
+
+	// entries move along with the values of their columns.
+	for _, idx := range idxs {
+		if prev != nil && idx.Key(prev) == idx.Key(r) {
+			continue
+		}
+		if prev != nil {
+			if err := c.index.Unindex(ctx, idx, prev); err != nil {
+				return fmt.Errorf("unindex previous row: %w", err)
+			}
+		}
+		if err := c.index.Index(ctx, idx, r); err != nil {
+			return fmt.Errorf("index row: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -136,76 +268,99 @@ func (c *Client) GetRow(ctx context.Context, t object.Table, id object.ID, dst *
 	return nil
 }
 
-func (c *Client) Scan(ctx context.Context, t object.Table, dst *[]object.Row, filters ...Filter) error {
-	sch, err := c.schema.Get(ctx, t)
-	if err != nil {
-		return err
-	}
+func (c *Client) Scan(ctx context.Context, t object.Table, dst *[]object.Row, filters ...Filter) (ScanResult, error) {
+	return c.ScanColumns(ctx, t, nil, dst, filters...)
+}
 
-	s, err := c.indexScan(ctx, t, filters...)
-	if err != nil {
-		return err
-	}
-	// fallback to full scan
-	if len(s) == 0 {
-		s, err = c.store.Scan(ctx, string(t))
-		if err != nil {
-			return nil
-		}
-	}
+// ScanColumns is Scan decoding only the given columns of each row, or every
+// one when cols is empty.
+func (c *Client) ScanColumns(ctx context.Context, t object.Table, cols []string, dst *[]object.Row, filters ...Filter) (ScanResult, error) {
+	return c.ScanEach(ctx, t, cols, func(r object.Row) error {
+		*dst = append(*dst, r)
+		return nil
+	}, filters...)
+}
 
-	err = sch.Marshaler().UnmarshalBatch(s, dst)
+// ScanEach is ScanColumns calling fn with each row as it is read, instead of
+// returning them all. It stops at the first error fn returns.
+func (c *Client) ScanEach(ctx context.Context, t object.Table, cols []string, fn func(object.Row) error, filters ...Filter) (ScanResult, error) {
+	sch, err := c.schema.Get(ctx, t)
 	if err != nil {
-		return err
+		return ScanResult{}, err
 	}
 
-	return nil
-}
-
-// indexScan will attempt to fetch the rows using indexes defined on the table.
-// if none are usable, it will return an empty slice and empty error.
-func (c *Client) indexScan(ctx context.Context, t object.Table, filters ...Filter) ([][]byte, error) {
-	idxs, err := c.index.Scan(ctx, t)
+	p, err := c.plan(ctx, sch, filters)
 	if err != nil {
-		return nil, err
+		return ScanResult{}, fmt.Errorf("plan scan: %w", err)
 	}
 
-	cols := make([]string, 0, len(filters))
-	for _, f := range filters {
-		cols = append(cols, f.Col)
+	// filters need their columns decoded too.
+	if len(cols) > 0 {
+		cols = slices.Clip(cols)
+		for _, f := range p.residual {
+			cols = append(cols, f.Col)
+		}
 	}
+	m := sch.Marshaler(cols...)
 
-	var idx *index.Index
-	for _, i := range idxs {
-		if i.Matches(cols) {
-			idx = i
-			break
+	res := ScanResult{Access: AccessFullScan}
+	each := func(b []byte) error {
+		var r object.Row
+		if err := m.Unmarshal(b, &r); err != nil {
+			return err
 		}
-	}
-	if idx == nil {
-		return nil, nil
+		if slices.ContainsFunc(p.residual, func(f Filter) bool { return !f.Matches(r) }) {
+			return nil
+		}
+		res.Rows++
+		return fn(r)
 	}
 
-	row := make(object.Row)
-	for _, f := range filters {
-		row[f.Col] = f.Val
+	if p.index != nil {
+		res.Access, res.Index = AccessIndex, p.index.Name
+		err = c.indexScan(ctx, t, p, each)
+	} else {
+		err = c.store.Each(ctx, string(t), "", "", each)
 	}
-
-	ids, err := c.store.Get(ctx, string(idx.Name), string(idx.Key(row)))
-	if err != nil {
-		return nil, err
+	// the schema exists, so the table is only empty.
+	if err != nil && !errors.Is(err, storage.ErrTableNotFound) {
+		return ScanResult{}, fmt.Errorf("%s %s: %w", res.Access, t, err)
 	}
-	out := make([][]byte, 0, len(ids))
-	// get each row with GetRow
-	for _, id := range ids {
-		s, err := c.store.Get(ctx, string(t), string(id))
+
+	return res, nil
+}
+
+// indexScan calls fn with the rows found by scanning the ranges of the path in its index.
+func (c *Client) indexScan(ctx context.Context, t object.Table, p accessPath, fn func([]byte) error) error {
+	seen := make(map[string]bool)
+	for _, r := range p.ranges {
+		err := c.store.Each(ctx, string(p.index.Name), string(r.From), string(r.To), func(id []byte) error {
+			if seen[string(id)] {
+				return nil
+			}
+			seen[string(id)] = true
+
+			s, err := c.store.Get(ctx, string(t), string(id))
+			if err != nil {
+				return err
+			}
+			for _, b := range s {
+				if err := fn(b); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if errors.Is(err, storage.ErrTableNotFound) {
+			// nothing was indexed yet.
+			return nil
+		}
 		if err != nil {
-			return nil, err
+			return err
 		}
-		out = append(out, s[0])
 	}
 
-	return out, nil
+	return nil
 }
 
 /**
@@ -220,8 +375,13 @@ func (c *Client) CreateSchema(ctx context.Context, sch *schema.Schema) error {
 	return nil
 }
 
+// GetSchema returns the schema of the table, failing with
+// storage.ErrTableNotFound if there is no such table.
 func (c *Client) GetSchema(ctx context.Context, t object.Table) (*schema.Schema, error) {
 	sch, err := c.schema.Get(ctx, t)
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return nil, fmt.Errorf("table %s: %w", t, storage.ErrTableNotFound)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -229,6 +389,11 @@ func (c *Client) GetSchema(ctx context.Context, t object.Table) (*schema.Schema,
 	return sch, nil
 }
 
+// Tables lists the tables created by users.
+func (c *Client) Tables(ctx context.Context) ([]object.Table, error) {
+	return c.schema.Tables(ctx)
+}
+
 // Index functions
 func (c *Client) CreateIndex(ctx context.Context, idx *index.Index) error {
 	err := c.index.Create(ctx, idx)
@@ -237,7 +402,7 @@ func (c *Client) CreateIndex(ctx context.Context, idx *index.Index) error {
 	}
 
 	var rows []object.Row
-	err = c.Scan(ctx, idx.Table, &rows)
+	_, err = c.Scan(ctx, idx.Table, &rows)
 	if err != nil {
 		return fmt.Errorf("retrieve rows to index: %w", err)
 	}
@@ -250,6 +415,101 @@ func (c *Client) CreateIndex(ctx context.Context, idx *index.Index) error {
 	return nil
 }
 
+// Statistics functions
+
+// Analyze collects the statistics of the given tables, or of every table if none is given.
+func (c *Client) Analyze(ctx context.Context, tables ...object.Table) error {
+	if len(tables) == 0 {
+		var err error
+		tables, err = c.schema.Tables(ctx)
+		if err != nil {
+			return fmt.Errorf("list tables: %w", err)
+		}
+	}
+
+	for _, t := range tables {
+		sch, err := c.schema.Get(ctx, t)
+		if err != nil {
+			return err
+		}
+
+		var rows []object.Row
+		if _, err := c.Scan(ctx, t, &rows); err != nil {
+			return fmt.Errorf("scan %s: %w", t, err)
+		}
+
+		if err := c.stats.Save(ctx, stats.Collect(sch, rows)); err != nil {
+			return fmt.Errorf("save stats of %s: %w", t, err)
+		}
+	}
+
+	return nil
+}
+
+// Stats returns the statistics of the table as of its last analysis, or nil
+// if it was never analyzed.
+func (c *Client) Stats(ctx context.Context, t object.Table) (*stats.Table, error) {
+	sch, err := c.schema.Get(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.stats.Get(ctx, sch)
+}
+
 func (c *Client) Shape(ctx context.Context, tables []object.Table) (*system.DatabaseShape, error) {
 	return c.schema.Shape(ctx, tables)
 }
+
+// Role functions
+
+func (c *Client) CreateRole(ctx context.Context, r *system.Role) error {
+	return c.roles.Create(ctx, r)
+}
+
+// Role returns the role, failing with system.ErrUnknownRole if there is no
+// such role.
+func (c *Client) Role(ctx context.Context, name string) (*system.Role, error) {
+	return c.roles.Get(ctx, name)
+}
+
+func (c *Client) UpdateRole(ctx context.Context, r *system.Role) error {
+	return c.roles.Update(ctx, r)
+}
+
+// Credentials returns the credentials the user authenticates with, failing
+// with system.ErrUnknownRole if there is no such user.
+func (c *Client) Credentials(ctx context.Context, name string) (scram.Credentials, error) {
+	return c.roles.Credentials(ctx, name)
+}
+
+func (c *Client) Users(ctx context.Context) ([]string, error) {
+	return c.roles.Users(ctx)
+}
+
+func (c *Client) GrantRole(ctx context.Context, role, member string) error {
+	return c.roles.GrantRole(ctx, role, member)
+}
+
+func (c *Client) RevokeRole(ctx context.Context, role, member string) error {
+	return c.roles.RevokeRole(ctx, role, member)
+}
+
+// Grant grants the privileges on the table, which must exist, to the role.
+func (c *Client) Grant(ctx context.Context, role string, t object.Table, privs ...system.Privilege) error {
+	if _, err := c.GetSchema(ctx, t); err != nil {
+		return err
+	}
+	return c.roles.Grant(ctx, role, t, privs...)
+}
+
+func (c *Client) Revoke(ctx context.Context, role string, t object.Table, privs ...system.Privilege) error {
+	if _, err := c.GetSchema(ctx, t); err != nil {
+		return err
+	}
+	return c.roles.Revoke(ctx, role, t, privs...)
+}
+
+func (c *Client) HasPrivilege(ctx context.Context, role string, t object.Table, p system.Privilege) (bool, error) {
+	return c.roles.HasPrivilege(ctx, role, t, p)
+}
@@ -0,0 +1,288 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/aliphe/filadb/db/index"
+	"github.com/aliphe/filadb/db/object"
+	"github.com/aliphe/filadb/db/schema"
+	"github.com/aliphe/filadb/db/storage"
+	"github.com/aliphe/filadb/db/system"
+	"github.com/google/go-cmp/cmp"
+)
+
+type fakeSchemas map[object.Table]*schema.Schema
+
+func (f fakeSchemas) Create(context.Context, *schema.Schema) error {
+	return nil
+}
+
+func (f fakeSchemas) Get(_ context.Context, t object.Table) (*schema.Schema, error) {
+	return f[t], nil
+}
+
+func (f fakeSchemas) Shape(context.Context, []object.Table) (*system.DatabaseShape, error) {
+	return nil, nil
+}
+
+func (f fakeSchemas) Tables(context.Context) ([]object.Table, error) {
+	return nil, nil
+}
+
+// fakeStore holds the values of each key of each table, and fails scans with err.
+type fakeStore struct {
+	tables map[string]map[string][][]byte
+	err    error
+}
+
+func (f *fakeStore) Add(_ context.Context, table, key string, val []byte) error {
+	f.tables[table][key] = append(f.tables[table][key], val)
+	return nil
+}
+
+func (f *fakeStore) Set(_ context.Context, table, key string, val []byte) error {
+	f.tables[table][key] = [][]byte{val}
+	return nil
+}
+
+func (f *fakeStore) Delete(_ context.Context, table, key string) error {
+	delete(f.tables[table], key)
+	return nil
+}
+
+func (f *fakeStore) Get(_ context.Context, table, key string) ([][]byte, error) {
+	t, ok := f.tables[table]
+	if !ok {
+		return nil, storage.ErrTableNotFound
+	}
+	return t[key], nil
+}
+
+func (f *fakeStore) Scan(_ context.Context, table string) ([][]byte, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	t, ok := f.tables[table]
+	if !ok {
+		return nil, storage.ErrTableNotFound
+	}
+	var out [][]byte
+	for _, vals := range t {
+		out = append(out, vals...)
+	}
+	return out, nil
+}
+
+func (f *fakeStore) Each(_ context.Context, table, from, to string, fn func([]byte) error) error {
+	if f.err != nil {
+		return f.err
+	}
+	t, ok := f.tables[table]
+	if !ok {
+		return storage.ErrTableNotFound
+	}
+	for _, k := range slices.Sorted(maps.Keys(t)) {
+		if k < from || (to != "" && k >= to) {
+			continue
+		}
+		for _, v := range t[k] {
+			if err := fn(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *fakeStore) Begin(context.Context) (storage.Tx, error) {
+	return nil, errors.New("not implemented")
+}
+
+func Test_Client_Scan(t *testing.T) {
+	users := &schema.Schema{
+		Table: "users",
+		Columns: []schema.Column{
+			{Name: "id", Type: schema.ColumnTypeNumber},
+			{Name: "email", Type: schema.ColumnTypeText},
+		},
+	}
+	byEmail := &index.Index{Table: "users", Name: "by_email", Columns: []string{"email"}}
+	errIO := errors.New("i/o error")
+
+	row := object.Row{"id": int32(1), "email": "a@test.com"}
+	b, err := users.Marshaler().Marshal(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		indexes fakeIndexes
+		tables  map[string]map[string][][]byte
+		scanErr error
+		filters []Filter
+		want    []object.Row
+		wantRes ScanResult
+		wantErr error
+	}{
+		"full scan": {
+			tables:  map[string]map[string][][]byte{"users": {"1": {b}}},
+			filters: []Filter{{Col: "id", Op: OpMoreThan, Val: int32(0)}},
+			want:    []object.Row{row},
+			wantRes: ScanResult{Access: AccessFullScan, Rows: 1},
+		},
+		"residual filter": {
+			tables:  map[string]map[string][][]byte{"users": {"1": {b}}},
+			filters: []Filter{{Col: "id", Op: OpMoreThan, Val: int32(1)}},
+			wantRes: ScanResult{Access: AccessFullScan},
+		},
+		"index hit": {
+			indexes: fakeIndexes{byEmail},
+			tables: map[string]map[string][][]byte{
+				"users":    {"1": {b}},
+				"by_email": {string(byEmail.Key(row)): {[]byte("1")}},
+			},
+			filters: []Filter{{Col: "email", Op: OpEqual, Val: "a@test.com"}},
+			want:    []object.Row{row},
+			wantRes: ScanResult{Access: AccessIndex, Index: "by_email", Rows: 1},
+		},
+		"index miss": {
+			indexes: fakeIndexes{byEmail},
+			tables: map[string]map[string][][]byte{
+				"users":    {"1": {b}},
+				"by_email": {string(byEmail.Key(row)): {[]byte("1")}},
+			},
+			filters: []Filter{{Col: "email", Op: OpEqual, Val: "b@test.com"}},
+			wantRes: ScanResult{Access: AccessIndex, Index: "by_email"},
+		},
+		"empty table": {
+			tables:  map[string]map[string][][]byte{},
+			wantRes: ScanResult{Access: AccessFullScan},
+		},
+		"scan error": {
+			tables:  map[string]map[string][][]byte{"users": {"1": {b}}},
+			scanErr: errIO,
+			wantErr: errIO,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			store := &fakeStore{tables: tc.tables, err: tc.scanErr}
+			c := NewClient(store, fakeSchemas{"users": users}, tc.indexes, fakeStats{}, nil)
+
+			var got []object.Row
+			res, err := c.Scan(t.Context(), "users", &got, tc.filters...)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Scan() error = %v, want %v", err, tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.wantRes, res); diff != "" {
+				t.Fatalf("Scan() result mismatch (-want,+got): %s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("Scan() rows mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
+
+// recordingIndexes records the rows indexed.
+type recordingIndexes struct {
+	fakeIndexes
+	indexed []object.Row
+}
+
+func (r *recordingIndexes) Index(_ context.Context, _ *index.Index, rows ...object.Row) error {
+	r.indexed = append(r.indexed, rows...)
+	return nil
+}
+
+func Test_Client_BulkInsert(t *testing.T) {
+	t.Parallel()
+	users := &schema.Schema{
+		Table: "users",
+		Columns: []schema.Column{
+			{Name: "id", Type: schema.ColumnTypeNumber},
+			{Name: "email", Type: schema.ColumnTypeText},
+		},
+	}
+	store := &fakeStore{tables: map[string]map[string][][]byte{"users": {}}}
+	idxs := &recordingIndexes{fakeIndexes: fakeIndexes{{Table: "users", Name: "by_email", Columns: []string{"email"}}}}
+	c := NewClient(store, fakeSchemas{"users": users}, idxs, fakeStats{}, nil)
+
+	rows := []object.Row{
+		{"id": int32(1), "email": "a@test.com"},
+		{"id": "two", "email": "b@test.com"},
+		{"id": int32(1), "email": "c@test.com"},
+		{"id": int32(3)},
+	}
+	res, err := c.BulkInsert(t.Context(), "users", rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Loaded != 2 {
+		t.Fatalf("BulkInsert() loaded %d rows, want 2", res.Loaded)
+	}
+	var rejected []int
+	for _, r := range res.Rejected {
+		rejected = append(rejected, r.Row)
+	}
+	if diff := cmp.Diff([]int{1, 2}, rejected); diff != "" {
+		t.Fatalf("BulkInsert() rejected mismatch (-want,+got): %s", diff)
+	}
+	if !errors.Is(res.Rejected[0].Err, schema.ErrTypeMismatch) || !errors.Is(res.Rejected[1].Err, storage.ErrDuplicate) {
+		t.Fatalf("BulkInsert() rejection errors = %v", res.Rejected)
+	}
+	if diff := cmp.Diff([]object.Row{rows[0], rows[3]}, idxs.indexed); diff != "" {
+		t.Fatalf("indexed rows mismatch (-want,+got): %s", diff)
+	}
+}
+
+// storedIndexes writes the entries of its indexes to the store.
+type storedIndexes struct {
+	fakeIndexes
+	registry *system.IndexRegistry
+}
+
+func (s storedIndexes) Index(ctx context.Context, idx *index.Index, rows ...object.Row) error {
+	return s.registry.Index(ctx, idx, rows...)
+}
+
+func (s storedIndexes) Unindex(ctx context.Context, idx *index.Index, rows ...object.Row) error {
+	return s.registry.Unindex(ctx, idx, rows...)
+}
+
+func Test_Client_UpdateRow(t *testing.T) {
+	t.Parallel()
+	users := &schema.Schema{
+		Table: "users",
+		Columns: []schema.Column{
+			{Name: "id", Type: schema.ColumnTypeNumber},
+			{Name: "email", Type: schema.ColumnTypeText},
+		},
+	}
+	byEmail := &index.Index{Table: "users", Name: "by_email", Columns: []string{"email"}}
+	store := &fakeStore{tables: map[string]map[string][][]byte{"users": {}, "by_email": {}}}
+	idxs := storedIndexes{fakeIndexes: fakeIndexes{byEmail}, registry: system.NewIndexRegistry(store)}
+	c := NewClient(store, fakeSchemas{"users": users}, idxs, fakeStats{}, nil)
+	ctx := t.Context()
+
+	row := object.Row{"id": int32(1), "email": "a@test.com"}
+	if err := c.InsertRow(ctx, "users", row); err != nil {
+		t.Fatal(err)
+	}
+	updated := object.Row{"id": int32(1), "email": "b@test.com"}
+	if err := c.UpdateRow(ctx, "users", updated); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][][]byte{string(byEmail.Key(updated)): {[]byte("1")}}
+	if diff := cmp.Diff(want, store.tables["by_email"]); diff != "" {
+		t.Fatalf("index entries mismatch (-want,+got): %s", diff)
+	}
+}
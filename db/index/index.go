@@ -1,9 +1,10 @@
 package index
 
 import (
-	"crypto/md5"
-	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"slices"
 
 	"github.com/aliphe/filadb/db/object"
 )
@@ -23,21 +24,18 @@ func New(table object.Table, columns ...string) *Index {
 	}
 }
 
-// Key represents an index key based on a given row
+// Key represents an index key based on a given row.
+// Keys sort as the values of the columns of the index, column after column,
+// and end with the ID of the row, so that every row has its own key.
 type Key string
 
 // Key builds the index key based on the properties of the given row
 func (i *Index) Key(row object.Row) Key {
-	var key string
+	vals := make([]any, 0, len(i.Columns)+1)
 	for _, c := range i.Columns {
-		key += fmt.Sprintf("%s=%v,", c, row[c])
+		vals = append(vals, row[c])
 	}
-
-	b := md5.Sum([]byte(key))
-
-	str := base64.StdEncoding.EncodeToString(b[:])
-
-	return Key(str)
+	return key(encode(append(vals, string(row.ObjectID()))))
 }
 
 // Matches returns true if the Index can be used to fetch the row given the filters.
@@ -49,3 +47,114 @@ func (idx *Index) Matches(cols []string) bool {
 	}
 	return true
 }
+
+// Range holds the keys from From, included, to To, excluded.
+// An empty To leaves the range unbounded.
+type Range struct {
+	From, To Key
+}
+
+// Prefix returns the range of the keys whose leading columns equal vals.
+func Prefix(vals ...any) Range {
+	p := encode(vals)
+	return Range{From: key(p), To: key(successor(p))}
+}
+
+// Bound limits the values of a column, which may equal Val only if Inclusive.
+type Bound struct {
+	Val       any
+	Inclusive bool
+}
+
+// Between returns the range of the keys whose leading columns equal prefix,
+// and whose next column is within lower and upper, a nil bound leaving the
+// range open on its side. Null values are never within.
+func Between(prefix []any, lower, upper *Bound) Range {
+	p := encode(prefix)
+
+	from := append(slices.Clip(p), tagNull+1)
+	if lower != nil {
+		from = appendValue(slices.Clip(p), lower.Val)
+		if !lower.Inclusive {
+			from = successor(from)
+		}
+	}
+	to := successor(p)
+	if upper != nil {
+		to = appendValue(slices.Clip(p), upper.Val)
+		if upper.Inclusive {
+			to = successor(to)
+		}
+	}
+
+	return Range{From: key(from), To: key(to)}
+}
+
+// Tags start the encoding of values, ordering nulls first, then numbers, then texts.
+const (
+	tagNull byte = iota + 1
+	tagNumber
+	tagText
+)
+
+func encode(vals []any) []byte {
+	var b []byte
+	for _, v := range vals {
+		b = appendValue(b, v)
+	}
+	return b
+}
+
+// appendValue appends the encoding of v, which no other encoding starts with,
+// so that the values of the next columns only order keys with the same v.
+func appendValue(b []byte, v any) []byte {
+	if v == nil {
+		return append(b, tagNull)
+	}
+	if n, ok := number(v); ok {
+		// flipping the sign bit orders negative numbers first.
+		b = append(b, tagNumber)
+		return binary.BigEndian.AppendUint64(b, uint64(n)^1<<63)
+	}
+
+	// zero bytes are escaped, for the terminator to sort before any byte.
+	b = append(b, tagText)
+	for _, c := range []byte(fmt.Sprint(v)) {
+		b = append(b, c)
+		if c == 0x00 {
+			b = append(b, 0xff)
+		}
+	}
+	return append(b, 0x00, 0x01)
+}
+
+// successor returns the smallest encoding greater than any starting with b,
+// or nil if there is none.
+func successor(b []byte) []byte {
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			s := slices.Clone(b[:i+1])
+			s[i]++
+			return s
+		}
+	}
+	return nil
+}
+
+// key hex-encodes b, which keeps the order of encodings in keys stored as text.
+func key(b []byte) Key {
+	return Key(hex.EncodeToString(b))
+}
+
+func number(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	default:
+		return 0, false
+	}
+}
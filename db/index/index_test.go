@@ -0,0 +1,95 @@
+package index
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/aliphe/filadb/db/object"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_Index_Key(t *testing.T) {
+	idx := New("users", "a", "b")
+
+	// rows in the order of their values, column after column.
+	rows := []object.Row{
+		{"a": nil, "b": "z"},
+		{"a": int64(-300), "b": "z"},
+		{"a": int32(-1), "b": nil},
+		{"a": int32(-1), "b": ""},
+		{"a": int32(-1), "b": "a"},
+		{"a": int32(-1), "b": "a\x00"},
+		{"a": int32(-1), "b": "ab"},
+		{"a": 0, "b": "a"},
+		{"a": int64(256), "b": "a"},
+		{"a": "", "b": "a"},
+		{"a": "a", "b": "a"},
+		{"a": "a\x00b", "b": "a"},
+		{"a": "ab", "b": "a"},
+	}
+
+	keys := make([]Key, 0, len(rows))
+	for _, r := range rows {
+		keys = append(keys, idx.Key(r))
+	}
+	if !slices.IsSorted(keys) {
+		t.Fatalf("keys are not sorted as the rows: %v", keys)
+	}
+	if idx.Key(object.Row{"a": int32(3), "b": "x"}) != idx.Key(object.Row{"a": int64(3), "b": "x"}) {
+		t.Fatal("equal numbers of different types give different keys")
+	}
+}
+
+func Test_Range(t *testing.T) {
+	idx := New("users", "a", "b")
+	rows := []object.Row{
+		{"a": 1, "b": nil},
+		{"a": 1, "b": 1},
+		{"a": 1, "b": 2},
+		{"a": 1, "b": 3},
+		{"a": 2, "b": 1},
+		{"a": "1", "b": 1},
+	}
+
+	tests := map[string]struct {
+		rng  Range
+		want []object.Row
+	}{
+		"prefix": {
+			rng:  Prefix(1),
+			want: rows[:4],
+		},
+		"full key": {
+			rng:  Prefix(1, 2),
+			want: rows[2:3],
+		},
+		"between": {
+			rng:  Between([]any{1}, &Bound{Val: 1}, &Bound{Val: 3, Inclusive: true}),
+			want: rows[2:4],
+		},
+		"open lower bound": {
+			rng:  Between([]any{1}, nil, &Bound{Val: 2}),
+			want: rows[1:2],
+		},
+		"open upper bound": {
+			rng:  Between(nil, &Bound{Val: 1}, nil),
+			want: rows[4:],
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var got []object.Row
+			for _, r := range rows {
+				k := idx.Key(r)
+				if k >= tc.rng.From && (tc.rng.To == "" || k < tc.rng.To) {
+					got = append(got, r)
+				}
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("rows in range mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
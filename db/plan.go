@@ -0,0 +1,256 @@
+package db
+
+import (
+	"context"
+	"slices"
+
+	"github.com/aliphe/filadb/db/index"
+	"github.com/aliphe/filadb/db/object"
+	"github.com/aliphe/filadb/db/schema"
+	"github.com/aliphe/filadb/db/stats"
+)
+
+// Costs are relative to reading a row of a full scan.
+const (
+	// costLookup is the cost of looking a key up in an index.
+	costLookup = 1
+	// costFetch is the cost of fetching a row found in an index, read out of order.
+	costFetch = 4
+)
+
+// Estimates used for tables which were never analyzed.
+const (
+	defaultRows             = 1000
+	defaultSelectivity      = 0.1
+	defaultRangeSelectivity = 1.0 / 3
+)
+
+// Access is the way a scan reads the rows of a table.
+type Access int
+
+const (
+	AccessFullScan Access = iota + 1
+	AccessIndex
+)
+
+func (a Access) String() string {
+	switch a {
+	case AccessFullScan:
+		return "full scan"
+	case AccessIndex:
+		return "index"
+	default:
+		return "unknown"
+	}
+}
+
+// ScanResult describes how a scan was served.
+type ScanResult struct {
+	Access Access
+	// Index is the name of the index used, with AccessIndex.
+	Index string
+	// Rows is the number of rows returned.
+	Rows int
+}
+
+// accessPath tells how to read the rows matching filters: with scans of
+// ranges of keys of an index, or with a full scan when index is nil.
+type accessPath struct {
+	index  *index.Index
+	ranges []index.Range
+	// residual are the filters the path does not apply, left to check on every row read.
+	residual []Filter
+	cost     float64
+}
+
+// plan returns the cheapest path to the rows of the table matching filters.
+func (c *Client) plan(ctx context.Context, sch *schema.Schema, filters []Filter) (accessPath, error) {
+	idxs, err := c.index.Scan(ctx, sch.Table)
+	if err != nil {
+		return accessPath{}, err
+	}
+	st, err := c.stats.Get(ctx, sch)
+	if err != nil {
+		return accessPath{}, err
+	}
+
+	rows := float64(defaultRows)
+	if st != nil {
+		rows = float64(st.Rows)
+	}
+
+	best := accessPath{
+		residual: filters,
+		cost:     rows,
+	}
+	for _, idx := range idxs {
+		if idx.Table != sch.Table {
+			continue
+		}
+		if p, ok := indexPath(idx, st, rows, filters); ok && p.cost < best.cost {
+			best = p
+		}
+	}
+
+	return best, nil
+}
+
+// indexPath returns the path scanning idx over the keys whose leading columns
+// equal the values filters give them, and whose next column is within the
+// bounds filters give it. It requires a filter on the first column at least.
+func indexPath(idx *index.Index, st *stats.Table, rows float64, filters []Filter) (accessPath, bool) {
+	used := make([]bool, len(filters))
+	prefixes := [][]any{{}}
+	sel := 1.0
+	var lower, upper *index.Bound
+	for _, col := range idx.Columns {
+		i := slices.IndexFunc(filters, func(f Filter) bool {
+			return f.Col == col && (f.Op == OpEqual || f.Op == OpInclude)
+		})
+		if i >= 0 {
+			used[i] = true
+			vals := filters[i].values()
+			prefixes = withValues(prefixes, vals)
+			sel *= selectivity(st, col, len(vals))
+			continue
+		}
+
+		for i, f := range filters {
+			switch {
+			case f.Col != col:
+			case lower == nil && (f.Op == OpMoreThan || f.Op == OpMoreThanEqual):
+				lower = &index.Bound{Val: f.Val, Inclusive: f.Op == OpMoreThanEqual}
+				used[i] = true
+			case upper == nil && (f.Op == OpLessThan || f.Op == OpLessThanEqual):
+				upper = &index.Bound{Val: f.Val, Inclusive: f.Op == OpLessThanEqual}
+				used[i] = true
+			}
+		}
+		sel *= rangeSelectivity(st, col, lower, upper)
+		break
+	}
+	if !slices.Contains(used, true) {
+		return accessPath{}, false
+	}
+
+	p := accessPath{
+		index: idx,
+		cost:  float64(len(prefixes))*costLookup + rows*sel*costFetch,
+	}
+	for _, prefix := range prefixes {
+		if lower == nil && upper == nil {
+			p.ranges = append(p.ranges, index.Prefix(prefix...))
+		} else {
+			p.ranges = append(p.ranges, index.Between(prefix, lower, upper))
+		}
+	}
+	for i, f := range filters {
+		if !used[i] {
+			p.residual = append(p.residual, f)
+		}
+	}
+	return p, true
+}
+
+// withValues returns a copy of each prefix for each value, appended to it.
+func withValues(prefixes [][]any, vals []any) [][]any {
+	out := make([][]any, 0, len(prefixes)*len(vals))
+	for _, p := range prefixes {
+		for _, v := range vals {
+			out = append(out, append(slices.Clip(p), v))
+		}
+	}
+	return out
+}
+
+// selectivity estimates the fraction of rows where col equals one of n values.
+func selectivity(st *stats.Table, col string, n int) float64 {
+	if st == nil || st.Columns[col] == nil {
+		return min(1, float64(n)*defaultSelectivity)
+	}
+
+	c := st.Columns[col]
+	if c.Distinct == 0 {
+		return 0
+	}
+	return min(1, float64(n)/float64(c.Distinct)) * nonNull(st, c)
+}
+
+// rangeSelectivity estimates the fraction of rows where col is within lower
+// and upper, from the buckets of its histogram whose upper bound is.
+func rangeSelectivity(st *stats.Table, col string, lower, upper *index.Bound) float64 {
+	if lower == nil && upper == nil {
+		return 1
+	}
+	if st == nil || st.Columns[col] == nil {
+		return defaultRangeSelectivity
+	}
+
+	c := st.Columns[col]
+	if len(c.Histogram) == 0 {
+		return 0
+	}
+	n := 0.5 // the bucket the range ends in, partly within.
+	for _, b := range c.Histogram {
+		if within(b, lower, upper) {
+			n++
+		}
+	}
+	return min(1, n/float64(len(c.Histogram))) * nonNull(st, c)
+}
+
+// within tells whether v is within lower and upper, nil bounds being open.
+func within(v any, lower, upper *index.Bound) bool {
+	if lower != nil {
+		if c := stats.Compare(v, lower.Val); c < 0 || (c == 0 && !lower.Inclusive) {
+			return false
+		}
+	}
+	if upper != nil {
+		if c := stats.Compare(v, upper.Val); c > 0 || (c == 0 && !upper.Inclusive) {
+			return false
+		}
+	}
+	return true
+}
+
+// nonNull returns the fraction of rows where c is not null.
+func nonNull(st *stats.Table, c *stats.Column) float64 {
+	if st.Rows == 0 {
+		return 1
+	}
+	return float64(st.Rows-c.Nulls) / float64(st.Rows)
+}
+
+// values returns the values an equality or inclusion filter accepts.
+func (f Filter) values() []any {
+	if vals, ok := f.Val.([]any); ok && f.Op == OpInclude {
+		return vals
+	}
+	return []any{f.Val}
+}
+
+// Matches tells whether the row passes the filter. Null values never do.
+func (f Filter) Matches(r object.Row) bool {
+	v, ok := r[f.Col]
+	if !ok || v == nil {
+		return false
+	}
+
+	switch f.Op {
+	case OpEqual, OpInclude:
+		return slices.ContainsFunc(f.values(), func(val any) bool {
+			return stats.Compare(v, val) == 0
+		})
+	case OpLessThan:
+		return stats.Compare(v, f.Val) < 0
+	case OpLessThanEqual:
+		return stats.Compare(v, f.Val) <= 0
+	case OpMoreThan:
+		return stats.Compare(v, f.Val) > 0
+	case OpMoreThanEqual:
+		return stats.Compare(v, f.Val) >= 0
+	default:
+		return false
+	}
+}
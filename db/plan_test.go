@@ -0,0 +1,224 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aliphe/filadb/db/index"
+	"github.com/aliphe/filadb/db/object"
+	"github.com/aliphe/filadb/db/schema"
+	"github.com/aliphe/filadb/db/stats"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+type fakeIndexes []*index.Index
+
+func (f fakeIndexes) Scan(context.Context, object.Table) ([]*index.Index, error) {
+	return f, nil
+}
+
+func (f fakeIndexes) Create(context.Context, *index.Index) error {
+	return nil
+}
+
+func (f fakeIndexes) Index(context.Context, *index.Index, ...object.Row) error {
+	return nil
+}
+
+func (f fakeIndexes) Unindex(context.Context, *index.Index, ...object.Row) error {
+	return nil
+}
+
+type fakeStats map[object.Table]*stats.Table
+
+func (f fakeStats) Save(context.Context, *stats.Table) error {
+	return nil
+}
+
+func (f fakeStats) Get(_ context.Context, sch *schema.Schema) (*stats.Table, error) {
+	return f[sch.Table], nil
+}
+
+func Test_Client_plan(t *testing.T) {
+	users := &schema.Schema{Table: "users"}
+	byAB := &index.Index{Table: "users", Name: "by_a_b", Columns: []string{"a", "b"}}
+	byA := &index.Index{Table: "users", Name: "by_a", Columns: []string{"a"}}
+	byC := &index.Index{Table: "users", Name: "by_c", Columns: []string{"c"}}
+	posts := &index.Index{Table: "posts", Name: "posts_by_a", Columns: []string{"a"}}
+
+	analyzed := fakeStats{
+		"users": {
+			Table: "users",
+			Rows:  10_000,
+			Columns: map[string]*stats.Column{
+				"a": {Name: "a", Distinct: 2},
+				"c": {
+					Name:      "c",
+					Distinct:  5_000,
+					Histogram: []any{500, 1_000, 1_500, 2_000, 2_500, 3_000, 3_500, 4_000, 4_500, 5_000},
+				},
+			},
+		},
+	}
+
+	tests := map[string]struct {
+		indexes fakeIndexes
+		stats   fakeStats
+		filters []Filter
+		want    accessPath
+	}{
+		"no index": {
+			filters: []Filter{{Col: "a", Op: OpEqual, Val: 1}},
+			want: accessPath{
+				residual: []Filter{{Col: "a", Op: OpEqual, Val: 1}},
+				cost:     defaultRows,
+			},
+		},
+		"filters out of index order": {
+			indexes: fakeIndexes{byAB},
+			filters: []Filter{{Col: "b", Op: OpEqual, Val: 1}, {Col: "a", Op: OpEqual, Val: 2}},
+			want: accessPath{
+				index:  byAB,
+				ranges: []index.Range{index.Prefix(2, 1)},
+				cost:   1 + defaultRows*0.1*0.1*costFetch,
+			},
+		},
+		"most selective index": {
+			indexes: fakeIndexes{byA, byC},
+			stats:   analyzed,
+			filters: []Filter{{Col: "a", Op: OpEqual, Val: 1}, {Col: "c", Op: OpEqual, Val: 2}},
+			want: accessPath{
+				index:    byC,
+				ranges:   []index.Range{index.Prefix(2)},
+				residual: []Filter{{Col: "a", Op: OpEqual, Val: 1}},
+				cost:     1 + 2*costFetch,
+			},
+		},
+		"full scan cheaper than index": {
+			indexes: fakeIndexes{byA},
+			stats:   analyzed,
+			filters: []Filter{{Col: "a", Op: OpEqual, Val: 1}},
+			want: accessPath{
+				residual: []Filter{{Col: "a", Op: OpEqual, Val: 1}},
+				cost:     10_000,
+			},
+		},
+		"inclusion": {
+			indexes: fakeIndexes{byC},
+			stats:   analyzed,
+			filters: []Filter{{Col: "c", Op: OpInclude, Val: []any{1, 2}}, {Col: "a", Op: OpMoreThan, Val: 1}},
+			want: accessPath{
+				index:    byC,
+				ranges:   []index.Range{index.Prefix(1), index.Prefix(2)},
+				residual: []Filter{{Col: "a", Op: OpMoreThan, Val: 1}},
+				cost:     2 + 4*costFetch,
+			},
+		},
+		"prefix": {
+			indexes: fakeIndexes{byAB},
+			filters: []Filter{{Col: "a", Op: OpEqual, Val: 1}},
+			want: accessPath{
+				index:  byAB,
+				ranges: []index.Range{index.Prefix(1)},
+				cost:   1 + defaultRows*0.1*costFetch,
+			},
+		},
+		"range": {
+			indexes: fakeIndexes{byC},
+			stats:   analyzed,
+			filters: []Filter{{Col: "c", Op: OpMoreThan, Val: 4_800}},
+			want: accessPath{
+				index:  byC,
+				ranges: []index.Range{index.Between(nil, &index.Bound{Val: 4_800}, nil)},
+				cost:   1 + 10_000*0.15*costFetch,
+			},
+		},
+		"wide range": {
+			indexes: fakeIndexes{byC},
+			stats:   analyzed,
+			filters: []Filter{{Col: "c", Op: OpMoreThanEqual, Val: 2_000}},
+			want: accessPath{
+				residual: []Filter{{Col: "c", Op: OpMoreThanEqual, Val: 2_000}},
+				cost:     10_000,
+			},
+		},
+		"prefix and range": {
+			indexes: fakeIndexes{byAB},
+			filters: []Filter{
+				{Col: "b", Op: OpLessThan, Val: 3},
+				{Col: "a", Op: OpEqual, Val: 1},
+				{Col: "b", Op: OpLessThan, Val: 2},
+				{Col: "b", Op: OpMoreThanEqual, Val: 0},
+			},
+			want: accessPath{
+				index: byAB,
+				ranges: []index.Range{index.Between(
+					[]any{1},
+					&index.Bound{Val: 0, Inclusive: true},
+					&index.Bound{Val: 3},
+				)},
+				residual: []Filter{{Col: "b", Op: OpLessThan, Val: 2}},
+				cost:     1 + defaultRows*0.1*defaultRangeSelectivity*costFetch,
+			},
+		},
+		"no filter on the first column": {
+			indexes: fakeIndexes{byAB},
+			filters: []Filter{{Col: "b", Op: OpEqual, Val: 1}},
+			want: accessPath{
+				residual: []Filter{{Col: "b", Op: OpEqual, Val: 1}},
+				cost:     defaultRows,
+			},
+		},
+		"index of another table": {
+			indexes: fakeIndexes{posts},
+			filters: []Filter{{Col: "a", Op: OpEqual, Val: 1}},
+			want: accessPath{
+				residual: []Filter{{Col: "a", Op: OpEqual, Val: 1}},
+				cost:     defaultRows,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			c := NewClient(nil, nil, tc.indexes, tc.stats, nil)
+
+			got, err := c.plan(t.Context(), users, tc.filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(accessPath{}), cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+				t.Fatalf("plan() mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
+
+func Test_Filter_Matches(t *testing.T) {
+	row := object.Row{"id": int32(2), "email": "b@test.com"}
+
+	tests := map[string]struct {
+		filter Filter
+		want   bool
+	}{
+		"equal":           {filter: Filter{Col: "id", Op: OpEqual, Val: int32(2)}, want: true},
+		"not equal":       {filter: Filter{Col: "id", Op: OpEqual, Val: int32(3)}},
+		"include":         {filter: Filter{Col: "email", Op: OpInclude, Val: []any{"a@test.com", "b@test.com"}}, want: true},
+		"less than":       {filter: Filter{Col: "id", Op: OpLessThan, Val: int32(2)}},
+		"less than equal": {filter: Filter{Col: "id", Op: OpLessThanEqual, Val: int32(2)}, want: true},
+		"more than":       {filter: Filter{Col: "email", Op: OpMoreThan, Val: "a@test.com"}, want: true},
+		"more than equal": {filter: Filter{Col: "id", Op: OpMoreThanEqual, Val: int32(3)}},
+		"null":            {filter: Filter{Col: "name", Op: OpEqual, Val: "john"}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if got := tc.filter.Matches(row); got != tc.want {
+				t.Fatalf("Matches() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
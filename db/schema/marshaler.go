@@ -4,11 +4,22 @@ import (
 	"bytes"
 	"encoding/gob"
 	"errors"
+	"fmt"
+	"maps"
 	"reflect"
+	"slices"
+
+	"github.com/aliphe/filadb/db/object"
 )
 
 type marshaler struct {
 	src *Schema
+	// cols are the columns decoded, every one when nil.
+	cols map[string]bool
+}
+
+func (a *marshaler) projected(col string) bool {
+	return a.cols == nil || a.cols[col]
 }
 
 func (a *marshaler) Shape() []string {
@@ -20,18 +31,89 @@ func (a *marshaler) Shape() []string {
 	return out
 }
 
+// Marshal encodes an object.Row, or a struct whose fields are named after the columns.
 func (a *marshaler) Marshal(obj any) ([]byte, error) {
-	w := new(bytes.Buffer)
-	enc := gob.NewEncoder(w)
+	if r, ok := obj.(object.Row); ok {
+		return a.marshalRow(r)
+	}
+
+	rv := reflect.Indirect(reflect.ValueOf(obj))
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("marshal %T: %w", obj, ErrTypeMismatch)
+	}
+	fields := a.fieldsOf(rv.Type())
+	return a.encodeRow(func(i int) (any, bool) {
+		if fields[i] < 0 {
+			return nil, false
+		}
+		return rv.Field(fields[i]).Interface(), true
+	}, nil, nil)
+}
 
-	if err := enc.Encode(obj); err != nil {
-		return nil, err
+func (a *marshaler) marshalRow(r object.Row) ([]byte, error) {
+	var extras []string
+	for col := range r {
+		if !slices.ContainsFunc(a.src.Columns, func(c Column) bool { return c.Name == col }) {
+			extras = append(extras, col)
+		}
 	}
+	slices.Sort(extras)
 
-	return w.Bytes(), nil
+	return a.encodeRow(func(i int) (any, bool) {
+		v, ok := r[a.src.Columns[i].Name]
+		return v, ok
+	}, extras, func(col string) any {
+		return r[col]
+	})
 }
 
 func (a *marshaler) Unmarshal(b []byte, dst any) error {
+	if !isBinaryRow(b) {
+		return a.unmarshalGob(b, dst)
+	}
+
+	if r, ok := dst.(*object.Row); ok {
+		return a.unmarshalRow(b, r)
+	}
+
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("unmarshal into %T: %w", dst, ErrTypeMismatch)
+	}
+	return a.unmarshalStruct(b, rv.Elem(), a.fieldsOf(rv.Elem().Type()))
+}
+
+func (a *marshaler) unmarshalRow(b []byte, dst *object.Row) error {
+	r := make(object.Row, len(a.src.Columns))
+	err := a.decodeRow(b, func(i int, v any) error {
+		r[a.src.Columns[i].Name] = v
+		return nil
+	}, func(name string, v any) {
+		r[name] = v
+	})
+	if err != nil {
+		return err
+	}
+
+	if *dst == nil {
+		*dst = r
+	} else {
+		maps.Copy(*dst, r)
+	}
+	return nil
+}
+
+func (a *marshaler) unmarshalStruct(b []byte, dst reflect.Value, fields []int) error {
+	return a.decodeRow(b, func(i int, v any) error {
+		if fields[i] < 0 {
+			return nil
+		}
+		return setField(dst.Field(fields[i]), v)
+	}, func(string, any) {})
+}
+
+// unmarshalGob decodes rows written before the binary format.
+func (a *marshaler) unmarshalGob(b []byte, dst any) error {
 	r := bytes.NewReader(b)
 	dec := gob.NewDecoder(r)
 
@@ -39,10 +121,24 @@ func (a *marshaler) Unmarshal(b []byte, dst any) error {
 		return err
 	}
 
+	if r, ok := dst.(*object.Row); ok && a.cols != nil {
+		maps.DeleteFunc(*r, func(col string, _ any) bool { return !a.cols[col] })
+	}
 	return nil
 }
 
 func (a *marshaler) UnmarshalBatch(s [][]byte, dst any) error {
+	if rows, ok := dst.(*[]object.Row); ok {
+		for _, b := range s {
+			var r object.Row
+			if err := a.Unmarshal(b, &r); err != nil {
+				return err
+			}
+			*rows = append(*rows, r)
+		}
+		return nil
+	}
+
 	dstValue := reflect.ValueOf(dst)
 	if dstValue.Kind() != reflect.Ptr || dstValue.Elem().Kind() != reflect.Slice {
 		return errors.New("dst must be a pointer to a slice")
@@ -50,13 +146,23 @@ func (a *marshaler) UnmarshalBatch(s [][]byte, dst any) error {
 
 	sliceValue := dstValue.Elem()
 	elementType := sliceValue.Type().Elem()
+	if elementType.Kind() != reflect.Struct {
+		return fmt.Errorf("unmarshal into %s: %w", elementType, ErrTypeMismatch)
+	}
+	fields := a.fieldsOf(elementType)
 
 	for _, r := range s {
-		newElement := reflect.New(elementType).Interface()
-		if err := a.Unmarshal(r, newElement); err != nil {
+		newElement := reflect.New(elementType)
+		var err error
+		if isBinaryRow(r) {
+			err = a.unmarshalStruct(r, newElement.Elem(), fields)
+		} else {
+			err = a.unmarshalGob(r, newElement.Interface())
+		}
+		if err != nil {
 			return err
 		}
-		sliceValue = reflect.Append(sliceValue, reflect.ValueOf(newElement).Elem())
+		sliceValue = reflect.Append(sliceValue, newElement.Elem())
 	}
 
 	dstValue.Elem().Set(sliceValue)
@@ -0,0 +1,187 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"testing"
+
+	"github.com/aliphe/filadb/db/object"
+	"github.com/google/go-cmp/cmp"
+)
+
+var users = &Schema{
+	Table: "users",
+	Columns: []Column{
+		{Name: "id", Type: ColumnTypeNumber},
+		{Name: "email", Type: ColumnTypeText},
+	},
+}
+
+func Test_Marshaler_row(t *testing.T) {
+	tests := map[string]struct {
+		given object.Row
+		want  object.Row
+	}{
+		"every column": {
+			given: object.Row{"id": int32(1), "email": "test@test.com"},
+			want:  object.Row{"id": int32(1), "email": "test@test.com"},
+		},
+		"null column": {
+			given: object.Row{"id": int32(1)},
+			want:  object.Row{"id": int32(1)},
+		},
+		"extras": {
+			given: object.Row{"email": "test@test.com", "uid": "4f0c", "age": int32(30)},
+			want:  object.Row{"email": "test@test.com", "uid": "4f0c", "age": int32(30)},
+		},
+		"other numeric types": {
+			given: object.Row{"id": 7},
+			want:  object.Row{"id": int32(7)},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			m := users.Marshaler()
+
+			b, err := m.Marshal(tc.given)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got object.Row
+			if err := m.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("Unmarshal() mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
+
+func Test_Marshaler_struct(t *testing.T) {
+	t.Parallel()
+	type user struct {
+		ID    int
+		Email string
+	}
+	m := users.Marshaler()
+
+	var rows [][]byte
+	for _, u := range []user{{ID: 1, Email: "a@a.com"}, {ID: 2}} {
+		b, err := m.Marshal(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, b)
+	}
+
+	var got []user
+	if err := m.UnmarshalBatch(rows, &got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]user{{ID: 1, Email: "a@a.com"}, {ID: 2}}, got); diff != "" {
+		t.Fatalf("UnmarshalBatch() mismatch (-want,+got): %s", diff)
+	}
+}
+
+func Test_Marshaler_gob(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(object.Row{"id": int32(1), "email": "old@gob.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []object.Row
+	if err := users.Marshaler().UnmarshalBatch([][]byte{buf.Bytes()}, &got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]object.Row{{"id": int32(1), "email": "old@gob.com"}}, got); diff != "" {
+		t.Fatalf("UnmarshalBatch() mismatch (-want,+got): %s", diff)
+	}
+}
+
+func Test_Marshaler_addedColumn(t *testing.T) {
+	t.Parallel()
+	b, err := users.Marshaler().Marshal(object.Row{"id": int32(1), "email": "a@a.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grown := &Schema{
+		Table:   users.Table,
+		Columns: append(append([]Column{}, users.Columns...), Column{Name: "name", Type: ColumnTypeText}),
+	}
+	var got object.Row
+	if err := grown.Marshaler().Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(object.Row{"id": int32(1), "email": "a@a.com"}, got); diff != "" {
+		t.Fatalf("Unmarshal() mismatch (-want,+got): %s", diff)
+	}
+}
+
+func Test_Marshaler_errors(t *testing.T) {
+	t.Parallel()
+	m := users.Marshaler()
+
+	if _, err := m.Marshal(object.Row{"id": "one"}); !errors.Is(err, ErrTypeMismatch) {
+		t.Fatalf("Marshal() error = %v, want ErrTypeMismatch", err)
+	}
+
+	b, err := m.Marshal(object.Row{"id": int32(1), "email": "a@a.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got object.Row
+	if err := m.Unmarshal(b[:len(b)-3], &got); !errors.Is(err, ErrCorruptRow) {
+		t.Fatalf("Unmarshal() error = %v, want ErrCorruptRow", err)
+	}
+}
+
+func Test_Marshaler_projection(t *testing.T) {
+	t.Parallel()
+	b, err := users.Marshaler().Marshal(object.Row{"id": int32(1), "email": "a@a.com", "uid": "4f0c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(object.Row{"id": int32(2), "email": "old@gob.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		cols []string
+		want []object.Row
+	}{
+		"column": {
+			cols: []string{"email"},
+			want: []object.Row{{"email": "a@a.com"}, {"email": "old@gob.com"}},
+		},
+		"extra": {
+			cols: []string{"id", "uid"},
+			want: []object.Row{{"id": int32(1), "uid": "4f0c"}, {"id": int32(2)}},
+		},
+		"every column": {
+			want: []object.Row{
+				{"id": int32(1), "email": "a@a.com", "uid": "4f0c"},
+				{"id": int32(2), "email": "old@gob.com"},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var got []object.Row
+			if err := users.Marshaler(tc.cols...).UnmarshalBatch([][]byte{b, buf.Bytes()}, &got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("UnmarshalBatch() mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
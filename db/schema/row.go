@@ -0,0 +1,314 @@
+package schema
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// Rows are encoded as
+//
+//	format | column count | null bitmap | values | extras
+//
+// where values are those of the non-null columns, in schema order. Numbers
+// take 8 bytes, big-endian, and texts are prefixed with their length. The
+// column count lets rows written before columns were added be read back.
+// Extras hold the values of columns missing from the schema, such as a
+// generated id: their count, then for each its name, a kind and the value.
+//
+// Counts and lengths are uvarints.
+const (
+	// rowFormat starts rows in the binary format. Gob streams never start with
+	// a byte between 0x80 and 0xf7, which tells them apart from legacy gob rows.
+	rowFormat byte = 0x81
+
+	kindText   byte = 't'
+	kindNumber byte = 'n'
+)
+
+var (
+	ErrTypeMismatch = errors.New("value does not match column type")
+	ErrCorruptRow   = errors.New("corrupt row")
+)
+
+func isBinaryRow(b []byte) bool {
+	return len(b) > 0 && b[0] == rowFormat
+}
+
+// encodeRow encodes the values get returns for each column, followed by the extras.
+func (a *marshaler) encodeRow(get func(i int) (any, bool), extras []string, extra func(col string) any) ([]byte, error) {
+	cols := a.src.Columns
+	out := make([]byte, 0, 64)
+	out = append(out, rowFormat)
+	out = binary.AppendUvarint(out, uint64(len(cols)))
+
+	bitmap := len(out)
+	out = append(out, make([]byte, (len(cols)+7)/8)...)
+	for i, c := range cols {
+		v, ok := get(i)
+		if !ok || v == nil {
+			out[bitmap+i/8] |= 1 << (i % 8)
+			continue
+		}
+
+		var err error
+		out, err = appendValue(out, c.Type, v)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", c.Name, err)
+		}
+	}
+
+	out = binary.AppendUvarint(out, uint64(len(extras)))
+	for _, name := range extras {
+		v := extra(name)
+		kind := kindText
+		if _, ok := toInt(v); ok {
+			kind = kindNumber
+		}
+
+		out = appendText(out, name)
+		out = append(out, kind)
+		var err error
+		out, err = appendValue(out, kindType(kind), v)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", name, err)
+		}
+	}
+
+	return out, nil
+}
+
+func appendValue(out []byte, t ColumnType, v any) ([]byte, error) {
+	switch t {
+	case ColumnTypeNumber:
+		n, ok := toInt(v)
+		if !ok {
+			return nil, fmt.Errorf("%T in %s column: %w", v, t, ErrTypeMismatch)
+		}
+		return binary.BigEndian.AppendUint64(out, uint64(n)), nil
+	case ColumnTypeText:
+		s, ok := toText(v)
+		if !ok {
+			return nil, fmt.Errorf("%T in %s column: %w", v, t, ErrTypeMismatch)
+		}
+		return appendText(out, s), nil
+	default:
+		return nil, fmt.Errorf("unknown column type %s", t)
+	}
+}
+
+func appendText(out []byte, s string) []byte {
+	out = binary.AppendUvarint(out, uint64(len(s)))
+	return append(out, s...)
+}
+
+func kindType(kind byte) ColumnType {
+	if kind == kindNumber {
+		return ColumnTypeNumber
+	}
+	return ColumnTypeText
+}
+
+func toInt(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return int64(n), true
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return int64(rv.Uint()), true
+	default:
+		return 0, false
+	}
+}
+
+func toText(v any) (string, bool) {
+	if s, ok := v.(string); ok {
+		return s, true
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.String {
+		return rv.String(), true
+	}
+	return "", false
+}
+
+// rowDecoder reads the values of a binary row.
+type rowDecoder struct {
+	b   []byte
+	pos int
+}
+
+// decodeRow calls col with the index and value of every non-null projected
+// column of the row, then extra with the name and value of every projected extra.
+// The other values are skipped over without being decoded.
+// Numbers are decoded as int32, as the parser reads them.
+func (a *marshaler) decodeRow(b []byte, col func(i int, v any) error, extra func(name string, v any)) error {
+	d := rowDecoder{b: b, pos: 1}
+
+	n, err := d.uvarint()
+	if err != nil {
+		return err
+	}
+	if n > uint64(len(a.src.Columns)) {
+		return fmt.Errorf("%d columns for %d in schema: %w", n, len(a.src.Columns), ErrCorruptRow)
+	}
+	bitmap, err := d.next((int(n) + 7) / 8)
+	if err != nil {
+		return err
+	}
+
+	for i, c := range a.src.Columns[:n] {
+		if bitmap[i/8]&(1<<(i%8)) != 0 {
+			continue
+		}
+		if !a.projected(c.Name) {
+			if err := d.skip(c.Type); err != nil {
+				return err
+			}
+			continue
+		}
+		v, err := d.value(c.Type)
+		if err != nil {
+			return err
+		}
+		if err := col(i, v); err != nil {
+			return fmt.Errorf("column %s: %w", c.Name, err)
+		}
+	}
+
+	extras, err := d.uvarint()
+	if err != nil {
+		return err
+	}
+	for range extras {
+		name, err := d.text()
+		if err != nil {
+			return err
+		}
+		kind, err := d.next(1)
+		if err != nil {
+			return err
+		}
+		if !a.projected(name) {
+			if err := d.skip(kindType(kind[0])); err != nil {
+				return err
+			}
+			continue
+		}
+		v, err := d.value(kindType(kind[0]))
+		if err != nil {
+			return err
+		}
+		extra(name, v)
+	}
+
+	return nil
+}
+
+func (d *rowDecoder) value(t ColumnType) (any, error) {
+	if t == ColumnTypeNumber {
+		b, err := d.next(8)
+		if err != nil {
+			return nil, err
+		}
+		n := int64(binary.BigEndian.Uint64(b))
+		if n < math.MinInt32 || n > math.MaxInt32 {
+			return n, nil
+		}
+		return int32(n), nil
+	}
+	return d.text()
+}
+
+func (d *rowDecoder) skip(t ColumnType) error {
+	n := uint64(8)
+	if t != ColumnTypeNumber {
+		var err error
+		if n, err = d.uvarint(); err != nil {
+			return err
+		}
+	}
+	_, err := d.next(int(n))
+	return err
+}
+
+func (d *rowDecoder) text() (string, error) {
+	n, err := d.uvarint()
+	if err != nil {
+		return "", err
+	}
+	b, err := d.next(int(n))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (d *rowDecoder) uvarint() (uint64, error) {
+	n, read := binary.Uvarint(d.b[d.pos:])
+	if read <= 0 {
+		return 0, fmt.Errorf("truncated length: %w", ErrCorruptRow)
+	}
+	d.pos += read
+	return n, nil
+}
+
+func (d *rowDecoder) next(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.b) {
+		return nil, fmt.Errorf("truncated value: %w", ErrCorruptRow)
+	}
+	b := d.b[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// fieldsOf maps each column of the schema to the index of the struct field
+// with the same name, regardless of case, or -1 if there is none.
+func (a *marshaler) fieldsOf(t reflect.Type) []int {
+	fields := make([]int, len(a.src.Columns))
+	for i, c := range a.src.Columns {
+		fields[i] = -1
+		for j := range t.NumField() {
+			if f := t.Field(j); f.IsExported() && strings.EqualFold(f.Name, c.Name) {
+				fields[i] = j
+				break
+			}
+		}
+	}
+	return fields
+}
+
+func setField(f reflect.Value, v any) error {
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := toInt(v)
+		if !ok {
+			return fmt.Errorf("%T in %s field: %w", v, f.Type(), ErrTypeMismatch)
+		}
+		f.SetInt(n)
+	case reflect.String:
+		s, ok := toText(v)
+		if !ok {
+			return fmt.Errorf("%T in %s field: %w", v, f.Type(), ErrTypeMismatch)
+		}
+		f.SetString(s)
+	case reflect.Interface:
+		f.Set(reflect.ValueOf(v))
+	default:
+		return fmt.Errorf("%s field: %w", f.Type(), ErrTypeMismatch)
+	}
+	return nil
+}
@@ -9,10 +9,19 @@ type Schema struct {
 	Columns []Column
 }
 
-func (s *Schema) Marshaler() object.Marshaler {
-	return &marshaler{
+// Marshaler encodes rows of the schema. When columns are given, decoding
+// skips every other column.
+func (s *Schema) Marshaler(cols ...string) object.Marshaler {
+	m := &marshaler{
 		src: s,
 	}
+	if len(cols) > 0 {
+		m.cols = make(map[string]bool, len(cols))
+		for _, c := range cols {
+			m.cols[c] = true
+		}
+	}
+	return m
 }
 
 func (s *Schema) ObjectID() object.ID {
@@ -0,0 +1,62 @@
+package stats
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// precision is the number of hash bits indexing the registers of a sketch,
+// for a standard error of about 1.6%.
+const precision = 12
+
+// Sketch estimates the number of distinct values added to it, with HyperLogLog.
+type Sketch struct {
+	reg [1 << precision]uint8
+}
+
+func NewSketch() *Sketch {
+	return &Sketch{}
+}
+
+func (s *Sketch) Add(v any) {
+	h := hash(key(v))
+	i := h >> (64 - precision)
+	rank := uint8(bits.LeadingZeros64(h<<precision|1<<(precision-1))) + 1
+	s.reg[i] = max(s.reg[i], rank)
+}
+
+// Estimate returns the estimated number of distinct values.
+func (s *Sketch) Estimate() int {
+	m := float64(len(s.reg))
+	var sum float64
+	var zeros int
+	for _, r := range s.reg {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// small cardinalities are better estimated by counting empty registers.
+	if e <= 2.5*m && zeros > 0 {
+		e = m * math.Log(m/float64(zeros))
+	}
+	return int(math.Round(e))
+}
+
+// hash returns a 64-bit hash of s whose bits are all evenly distributed, as
+// HyperLogLog requires: FNV-1a, then the finalizer of SplitMix64.
+func hash(s string) uint64 {
+	f := fnv.New64a()
+	f.Write([]byte(s))
+	h := f.Sum64()
+
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
@@ -0,0 +1,36 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+func Test_Sketch(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		distinct int
+		repeat   int
+	}{
+		"empty":           {distinct: 0, repeat: 1},
+		"few":             {distinct: 10, repeat: 3},
+		"linear counting": {distinct: 2_000, repeat: 2},
+		"large":           {distinct: 100_000, repeat: 1},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			s := NewSketch()
+			for range tc.repeat {
+				for i := range tc.distinct {
+					s.Add(int32(i))
+				}
+			}
+
+			got := s.Estimate()
+			if err := math.Abs(float64(got-tc.distinct)) / max(float64(tc.distinct), 1); err > 0.05 {
+				t.Fatalf("Estimate() = %d, want %d within 5%%", got, tc.distinct)
+			}
+		})
+	}
+}
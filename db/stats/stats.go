@@ -0,0 +1,108 @@
+// Package stats computes the statistics the planner uses to estimate the cost of a scan.
+package stats
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/aliphe/filadb/db/object"
+	"github.com/aliphe/filadb/db/schema"
+)
+
+// Buckets is the number of buckets of the histograms.
+const Buckets = 10
+
+// Table holds the statistics of a table, as of its last analysis.
+type Table struct {
+	Table   object.Table
+	Rows    int
+	Columns map[string]*Column
+}
+
+// Column holds the statistics of a column.
+type Column struct {
+	Name     string
+	Distinct int
+	Nulls    int
+	Min, Max any
+	// Histogram holds the upper bound of buckets holding about as many values
+	// each, the last one being Max.
+	Histogram []any
+}
+
+// Collect computes the statistics of the given rows of the table.
+func Collect(sch *schema.Schema, rows []object.Row) *Table {
+	t := &Table{
+		Table:   sch.Table,
+		Rows:    len(rows),
+		Columns: make(map[string]*Column, len(sch.Columns)),
+	}
+
+	for _, c := range sch.Columns {
+		col := &Column{Name: c.Name}
+		sk := NewSketch()
+		vals := make([]any, 0, len(rows))
+		for _, r := range rows {
+			v, ok := r[c.Name]
+			if !ok || v == nil {
+				col.Nulls++
+				continue
+			}
+			sk.Add(v)
+			vals = append(vals, v)
+		}
+
+		if len(vals) > 0 {
+			slices.SortFunc(vals, Compare)
+			col.Distinct = min(sk.Estimate(), len(vals))
+			col.Min, col.Max = vals[0], vals[len(vals)-1]
+			col.Histogram = histogram(vals)
+		}
+		t.Columns[c.Name] = col
+	}
+
+	return t
+}
+
+// histogram returns the upper bounds of equi-depth buckets over the sorted values.
+func histogram(vals []any) []any {
+	n := min(Buckets, len(vals))
+	bounds := make([]any, 0, n)
+	for i := 1; i <= n; i++ {
+		bounds = append(bounds, vals[i*len(vals)/n-1])
+	}
+	return bounds
+}
+
+// Compare orders values of the same column: numbers by value, texts lexically.
+func Compare(a, b any) int {
+	x, xok := number(a)
+	y, yok := number(b)
+	if xok && yok {
+		return cmp.Compare(x, y)
+	}
+	return cmp.Compare(key(a), key(b))
+}
+
+func number(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	default:
+		return 0, false
+	}
+}
+
+// key formats v, so that equal numbers of different types give the same key.
+func key(v any) string {
+	if n, ok := number(v); ok {
+		return strconv.FormatInt(n, 10)
+	}
+	return fmt.Sprint(v)
+}
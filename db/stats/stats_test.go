@@ -0,0 +1,53 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/aliphe/filadb/db/object"
+	"github.com/aliphe/filadb/db/schema"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_Collect(t *testing.T) {
+	t.Parallel()
+	sch := &schema.Schema{
+		Table: "users",
+		Columns: []schema.Column{
+			{Name: "id", Type: schema.ColumnTypeNumber},
+			{Name: "email", Type: schema.ColumnTypeText},
+		},
+	}
+	var rows []object.Row
+	for i := range 20 {
+		r := object.Row{"id": int32(20 - i)}
+		if i%2 == 0 {
+			r["email"] = "same@mail.com"
+		}
+		rows = append(rows, r)
+	}
+
+	want := &Table{
+		Table: "users",
+		Rows:  20,
+		Columns: map[string]*Column{
+			"id": {
+				Name:      "id",
+				Distinct:  20,
+				Min:       int32(1),
+				Max:       int32(20),
+				Histogram: []any{int32(2), int32(4), int32(6), int32(8), int32(10), int32(12), int32(14), int32(16), int32(18), int32(20)},
+			},
+			"email": {
+				Name:      "email",
+				Distinct:  1,
+				Nulls:     10,
+				Min:       "same@mail.com",
+				Max:       "same@mail.com",
+				Histogram: []any{"same@mail.com", "same@mail.com", "same@mail.com", "same@mail.com", "same@mail.com", "same@mail.com", "same@mail.com", "same@mail.com", "same@mail.com", "same@mail.com"},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, Collect(sch, rows)); diff != "" {
+		t.Fatalf("Collect() mismatch (-want,+got): %s", diff)
+	}
+}
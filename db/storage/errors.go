@@ -4,5 +4,10 @@ import "errors"
 
 var (
 	ErrTableNotFound = errors.New("table not found")
+	ErrKeyNotFound   = errors.New("key not found")
 	ErrDuplicate     = errors.New("duplicate key")
+	ErrTxDone        = errors.New("transaction already committed or rolled back")
+	// ErrWriteConflict is returned when a transaction updates a value that a
+	// concurrent transaction already updated. The transaction can be retried.
+	ErrWriteConflict = errors.New("could not serialize access due to concurrent update")
 )
@@ -4,6 +4,13 @@ import (
 	"context"
 )
 
+// Nodes holding the records of the transaction store, which no table may be
+// named after.
+const (
+	TxLogNode  = "txlog"
+	TxMetaNode = "txmeta"
+)
+
 type ReaderWriter interface {
 	Reader
 	Writer
@@ -12,9 +19,39 @@ type ReaderWriter interface {
 type Writer interface {
 	Add(ctx context.Context, node, key string, val []byte) error
 	Set(ctx context.Context, node, key string, val []byte) error
+	// Delete removes the values stored under key.
+	Delete(ctx context.Context, node, key string) error
 }
 
 type Reader interface {
 	Get(ctx context.Context, table, key string) ([][]byte, error)
 	Scan(ctx context.Context, table string) ([][]byte, error)
+	// Each calls fn with the values stored under the keys from from, included,
+	// to to, excluded, in key order, as they are read. An empty to leaves the
+	// range unbounded. Each stops at the first error fn returns.
+	Each(ctx context.Context, table, from, to string, fn func(val []byte) error) error
+}
+
+// Loader is a Writer able to add many values at once, faster than one by one.
+type Loader interface {
+	Load(ctx context.Context, node string, entries []Entry) error
+}
+
+// Entry is a value stored under a key.
+type Entry struct {
+	Key string
+	Val []byte
+}
+
+// Store is a ReaderWriter able to group operations in transactions.
+type Store interface {
+	ReaderWriter
+	Begin(ctx context.Context) (Tx, error)
+}
+
+// Tx groups storage operations so that they are applied atomically.
+// Operations join a transaction when their context carries it, see WithTx.
+type Tx interface {
+	Commit(ctx context.Context) error
+	Rollback(ctx context.Context) error
 }
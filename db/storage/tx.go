@@ -0,0 +1,17 @@
+package storage
+
+import "context"
+
+type txKey struct{}
+
+// WithTx returns a copy of ctx carrying tx.
+// Storage operations made with the returned context join the transaction.
+func WithTx(ctx context.Context, tx Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// TxFromContext returns the transaction carried by ctx, if any.
+func TxFromContext(ctx context.Context) (Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(Tx)
+	return tx, ok
+}
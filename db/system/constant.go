@@ -1,7 +1,37 @@
 package system
 
+import (
+	"errors"
+
+	"github.com/aliphe/filadb/db/object"
+	"github.com/aliphe/filadb/db/schema"
+	"github.com/aliphe/filadb/db/storage"
+)
+
 const (
-	internalTableTablesName  = "tables"
-	internalTableColumnsName = "columns"
-	internalTableIndexesName = "indexes"
+	internalTableTablesName     = "tables"
+	internalTableColumnsName    = "columns"
+	internalTableIndexesName    = "indexes"
+	internalTableStatsName      = "stats"
+	internalTableRolesName      = "roles"
+	internalTablePrivilegesName = "privileges"
 )
+
+// catalog holds the system tables which can be queried like any other.
+var catalog = map[object.Table]*schema.Schema{
+	internalTableStatsName: internalTableStatsSchema,
+}
+
+// internal holds the system tables and transaction store nodes which no table
+// may shadow, as their rows would be read and written along with its own.
+var internal = map[object.Table]bool{
+	internalTableTablesName:     true,
+	internalTableColumnsName:    true,
+	internalTableIndexesName:    true,
+	internalTableRolesName:      true,
+	internalTablePrivilegesName: true,
+	storage.TxLogNode:           true,
+	storage.TxMetaNode:          true,
+}
+
+var ErrReservedTable = errors.New("table name is reserved")
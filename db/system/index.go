@@ -42,7 +42,9 @@ func (ir *IndexRegistry) Scan(ctx context.Context, t object.Table) ([]*index.Ind
 
 	idxs := make([]*index.Index, 0, len(raw))
 	for _, idx := range raw {
-		idxs = append(idxs, idx.Index())
+		if idx.Table == t {
+			idxs = append(idxs, idx.Index())
+		}
 	}
 
 	return idxs, nil
@@ -67,6 +69,14 @@ func (ir *IndexRegistry) Create(ctx context.Context, idx *index.Index) error {
 }
 
 func (ir *IndexRegistry) Index(ctx context.Context, idx *index.Index, rows ...object.Row) error {
+	if l, ok := ir.store.(storage.Loader); ok && len(rows) > 1 {
+		entries := make([]storage.Entry, 0, len(rows))
+		for _, row := range rows {
+			entries = append(entries, storage.Entry{Key: string(idx.Key(row)), Val: []byte(row.ObjectID())})
+		}
+		return l.Load(ctx, idx.Name, entries)
+	}
+
 	for _, row := range rows {
 		key := idx.Key(row)
 		if err := ir.store.Add(ctx, idx.Name, string(key), []byte(row.ObjectID())); err != nil {
@@ -77,6 +87,17 @@ func (ir *IndexRegistry) Index(ctx context.Context, idx *index.Index, rows ...ob
 	return nil
 }
 
+// Unindex removes the entries of the rows from the index.
+func (ir *IndexRegistry) Unindex(ctx context.Context, idx *index.Index, rows ...object.Row) error {
+	for _, row := range rows {
+		if err := ir.store.Delete(ctx, idx.Name, string(idx.Key(row))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 type internalTableIndexes struct {
 	Table   object.Table
 	Name    string
@@ -0,0 +1,387 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aliphe/filadb/db/object"
+	"github.com/aliphe/filadb/db/schema"
+	"github.com/aliphe/filadb/db/storage"
+	"github.com/aliphe/filadb/db/table"
+	"github.com/aliphe/filadb/net/scram"
+)
+
+var (
+	ErrRoleExists      = errors.New("role already exists")
+	ErrUnknownRole     = errors.New("role does not exist")
+	ErrMembershipCycle = errors.New("role would be a member of itself")
+)
+
+// Privilege allows a role to run a kind of statement on a table.
+type Privilege string
+
+const (
+	PrivilegeSelect Privilege = "SELECT"
+	PrivilegeInsert Privilege = "INSERT"
+	PrivilegeUpdate Privilege = "UPDATE"
+	PrivilegeDelete Privilege = "DELETE"
+	// PrivilegeCreate allows indexing and analyzing the table.
+	PrivilegeCreate Privilege = "CREATE"
+)
+
+// Privileges lists every privilege, which GRANT ALL grants.
+var Privileges = []Privilege{PrivilegeSelect, PrivilegeInsert, PrivilegeUpdate, PrivilegeDelete, PrivilegeCreate}
+
+// Role holds privileges, of its own and of the roles it is a member of. Roles
+// with credentials are users, which can authenticate.
+type Role struct {
+	Name string
+	// Superuser roles have every privilege, which their members do not
+	// inherit.
+	Superuser   bool
+	Credentials *scram.Credentials
+	MemberOf    []string
+}
+
+// RoleRegistry holds the roles, and the privileges granted to them.
+type RoleRegistry struct {
+	roles      *table.Querier[internalTableRoles]
+	privileges *table.Querier[internalTablePrivileges]
+}
+
+func NewRoleRegistry(store storage.ReaderWriter) *RoleRegistry {
+	return &RoleRegistry{
+		roles:      table.NewQuerier[internalTableRoles](store, internalTableRolesSchema.Marshaler(), object.Table(internalTableRolesName)),
+		privileges: table.NewQuerier[internalTablePrivileges](store, internalTablePrivilegesSchema.Marshaler(), object.Table(internalTablePrivilegesName)),
+	}
+}
+
+func (rr *RoleRegistry) Create(ctx context.Context, r *Role) error {
+	_, err := rr.Get(ctx, r.Name)
+	switch {
+	case err == nil:
+		return fmt.Errorf("create role %s: %w", r.Name, ErrRoleExists)
+	case !errors.Is(err, ErrUnknownRole):
+		return err
+	}
+	return rr.roles.Insert(ctx, fromRole(r))
+}
+
+// Get returns the role, failing with ErrUnknownRole if there is no such role.
+func (rr *RoleRegistry) Get(ctx context.Context, name string) (*Role, error) {
+	var r internalTableRoles
+	err := rr.roles.Get(ctx, name, &r)
+	if errors.Is(err, storage.ErrKeyNotFound) || errors.Is(err, storage.ErrTableNotFound) {
+		return nil, fmt.Errorf("role %s: %w", name, ErrUnknownRole)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.role()
+}
+
+// Update replaces the role.
+func (rr *RoleRegistry) Update(ctx context.Context, r *Role) error {
+	if _, err := rr.Get(ctx, r.Name); err != nil {
+		return err
+	}
+	return rr.roles.Update(ctx, fromRole(r))
+}
+
+// Credentials returns the credentials of the user, failing with
+// ErrUnknownRole if there is no such role or if it cannot authenticate.
+func (rr *RoleRegistry) Credentials(ctx context.Context, name string) (scram.Credentials, error) {
+	r, err := rr.Get(ctx, name)
+	if err != nil {
+		return scram.Credentials{}, err
+	}
+	if r.Credentials == nil {
+		return scram.Credentials{}, fmt.Errorf("role %s has no password: %w", name, ErrUnknownRole)
+	}
+	return *r.Credentials, nil
+}
+
+// Users lists the names of the roles which can authenticate.
+func (rr *RoleRegistry) Users(ctx context.Context) ([]string, error) {
+	var roles []internalTableRoles
+	err := rr.roles.Scan(ctx, &roles)
+	if err != nil {
+		if errors.Is(err, storage.ErrTableNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	out := make([]string, 0, len(roles))
+	for _, r := range roles {
+		if r.Password != "" {
+			out = append(out, r.Name)
+		}
+	}
+	return out, nil
+}
+
+// GrantRole makes member a member of the role.
+func (rr *RoleRegistry) GrantRole(ctx context.Context, role, member string) error {
+	if _, err := rr.Get(ctx, role); err != nil {
+		return err
+	}
+	m, err := rr.Get(ctx, member)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(m.MemberOf, role) {
+		return nil
+	}
+
+	inherited, err := rr.inherited(ctx, role)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(inherited, member) {
+		return fmt.Errorf("grant %s to %s: %w", role, member, ErrMembershipCycle)
+	}
+
+	m.MemberOf = append(m.MemberOf, role)
+	return rr.roles.Update(ctx, fromRole(m))
+}
+
+func (rr *RoleRegistry) RevokeRole(ctx context.Context, role, member string) error {
+	m, err := rr.Get(ctx, member)
+	if err != nil {
+		return err
+	}
+	m.MemberOf = slices.DeleteFunc(m.MemberOf, func(r string) bool { return r == role })
+	return rr.roles.Update(ctx, fromRole(m))
+}
+
+// Grant grants the privileges on the table to the role.
+func (rr *RoleRegistry) Grant(ctx context.Context, role string, t object.Table, privs ...Privilege) error {
+	if _, err := rr.Get(ctx, role); err != nil {
+		return err
+	}
+	row, found, err := rr.privilegesOn(ctx, role, t)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range privs {
+		if !slices.Contains(row.privileges(), p) {
+			row.setPrivileges(append(row.privileges(), p))
+		}
+	}
+
+	if found {
+		return rr.privileges.Update(ctx, row)
+	}
+	return rr.privileges.Insert(ctx, row)
+}
+
+// Revoke revokes the privileges on the table from the role, those it has as
+// a member of other roles aside.
+func (rr *RoleRegistry) Revoke(ctx context.Context, role string, t object.Table, privs ...Privilege) error {
+	if _, err := rr.Get(ctx, role); err != nil {
+		return err
+	}
+	row, found, err := rr.privilegesOn(ctx, role, t)
+	if err != nil || !found {
+		return err
+	}
+
+	kept := slices.DeleteFunc(row.privileges(), func(p Privilege) bool { return slices.Contains(privs, p) })
+	row.setPrivileges(kept)
+	return rr.privileges.Update(ctx, row)
+}
+
+// HasPrivilege tells whether the role has the privilege on the table, of its
+// own or as a member of other roles.
+func (rr *RoleRegistry) HasPrivilege(ctx context.Context, role string, t object.Table, p Privilege) (bool, error) {
+	r, err := rr.Get(ctx, role)
+	if err != nil {
+		return false, err
+	}
+	if r.Superuser {
+		return true, nil
+	}
+
+	roles, err := rr.inherited(ctx, role)
+	if err != nil {
+		return false, err
+	}
+	for _, name := range roles {
+		row, _, err := rr.privilegesOn(ctx, name, t)
+		if err != nil {
+			return false, err
+		}
+		if slices.Contains(row.privileges(), p) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// inherited returns the role, and the roles it is a member of, directly or
+// not.
+func (rr *RoleRegistry) inherited(ctx context.Context, role string) ([]string, error) {
+	out := []string{role}
+	for i := 0; i < len(out); i++ {
+		r, err := rr.Get(ctx, out[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range r.MemberOf {
+			if !slices.Contains(out, m) {
+				out = append(out, m)
+			}
+		}
+	}
+	return out, nil
+}
+
+// privilegesOn returns the privileges granted to the role on the table, and
+// whether any ever was.
+func (rr *RoleRegistry) privilegesOn(ctx context.Context, role string, t object.Table) (internalTablePrivileges, bool, error) {
+	row := internalTablePrivileges{
+		ID:    object.ID(object.Key(t, role)),
+		Role:  role,
+		Table: t,
+	}
+	err := rr.privileges.Get(ctx, string(row.ID), &row)
+	switch {
+	case errors.Is(err, storage.ErrKeyNotFound), errors.Is(err, storage.ErrTableNotFound):
+		return row, false, nil
+	case err != nil:
+		return row, false, err
+	}
+	return row, true, nil
+}
+
+type internalTableRoles struct {
+	Name string
+	// Password holds the SCRAM credentials of the user, never the password,
+	// and is empty for roles which cannot authenticate.
+	Password  string
+	Superuser int
+	MemberOf  string
+}
+
+func fromRole(r *Role) internalTableRoles {
+	out := internalTableRoles{
+		Name:     r.Name,
+		MemberOf: strings.Join(r.MemberOf, columnSeparator),
+	}
+	if r.Credentials != nil {
+		out.Password = r.Credentials.String()
+	}
+	if r.Superuser {
+		out.Superuser = 1
+	}
+	return out
+}
+
+func (i internalTableRoles) role() (*Role, error) {
+	r := &Role{
+		Name:      i.Name,
+		Superuser: i.Superuser != 0,
+	}
+	if i.MemberOf != "" {
+		r.MemberOf = strings.Split(i.MemberOf, columnSeparator)
+	}
+	if i.Password != "" {
+		creds, err := scram.ParseCredentials(i.Password)
+		if err != nil {
+			return nil, fmt.Errorf("credentials of role %s: %w", i.Name, err)
+		}
+		r.Credentials = &creds
+	}
+	return r, nil
+}
+
+func (i internalTableRoles) ObjectID() object.ID {
+	return object.ID(i.Name)
+}
+
+func (i internalTableRoles) ObjectTable() object.Table {
+	return internalTableRolesName
+}
+
+var internalTableRolesSchema = &schema.Schema{
+	Table: internalTableRolesName,
+	Columns: []schema.Column{
+		{
+			Name: "name",
+			Type: schema.ColumnTypeText,
+		},
+		{
+			Name: "password",
+			Type: schema.ColumnTypeText,
+		},
+		{
+			Name: "superuser",
+			Type: schema.ColumnTypeNumber,
+		},
+		{
+			Name: "memberof",
+			Type: schema.ColumnTypeText,
+		},
+	},
+}
+
+type internalTablePrivileges struct {
+	ID         object.ID
+	Role       string
+	Table      object.Table
+	Privileges string
+}
+
+func (i internalTablePrivileges) privileges() []Privilege {
+	if i.Privileges == "" {
+		return nil
+	}
+	var out []Privilege
+	for p := range strings.SplitSeq(i.Privileges, columnSeparator) {
+		out = append(out, Privilege(p))
+	}
+	return out
+}
+
+func (i *internalTablePrivileges) setPrivileges(privs []Privilege) {
+	s := make([]string, 0, len(privs))
+	for _, p := range privs {
+		s = append(s, string(p))
+	}
+	i.Privileges = strings.Join(s, columnSeparator)
+}
+
+func (i internalTablePrivileges) ObjectID() object.ID {
+	return i.ID
+}
+
+func (i internalTablePrivileges) ObjectTable() object.Table {
+	return internalTablePrivilegesName
+}
+
+var internalTablePrivilegesSchema = &schema.Schema{
+	Table: internalTablePrivilegesName,
+	Columns: []schema.Column{
+		{
+			Name: "id",
+			Type: schema.ColumnTypeText,
+		},
+		{
+			Name: "role",
+			Type: schema.ColumnTypeText,
+		},
+		{
+			Name: "table",
+			Type: schema.ColumnTypeText,
+		},
+		{
+			Name: "privileges",
+			Type: schema.ColumnTypeText,
+		},
+	},
+}
@@ -2,6 +2,7 @@ package system
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/aliphe/filadb/db/object"
@@ -23,6 +24,10 @@ func NewSchemaRegistry(store storage.ReaderWriter) *SchemaRegistry {
 }
 
 func (sr *SchemaRegistry) Create(ctx context.Context, sch *schema.Schema) error {
+	if _, ok := catalog[sch.Table]; ok || internal[sch.Table] {
+		return fmt.Errorf("create table %s: %w", sch.Table, ErrReservedTable)
+	}
+
 	err := sr.createTable(ctx, sch.Table)
 	if err != nil {
 		return err
@@ -37,6 +42,10 @@ func (sr *SchemaRegistry) Create(ctx context.Context, sch *schema.Schema) error
 }
 
 func (sr *SchemaRegistry) Get(ctx context.Context, table object.Table) (*schema.Schema, error) {
+	if sch, ok := catalog[table]; ok {
+		return sch, nil
+	}
+
 	var t internalTableTables
 	err := sr.tables.Get(ctx, string(table), &t)
 	if err != nil {
@@ -51,6 +60,26 @@ func (sr *SchemaRegistry) Get(ctx context.Context, table object.Table) (*schema.
 	return sch, nil
 }
 
+// Tables lists the tables created by users.
+func (sr *SchemaRegistry) Tables(ctx context.Context) ([]object.Table, error) {
+	var tables []internalTableTables
+	err := sr.tables.Scan(ctx, &tables)
+	if err != nil {
+		if errors.Is(err, storage.ErrTableNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	out := make([]object.Table, 0, len(tables))
+	for _, t := range tables {
+		if t.Public() {
+			out = append(out, t.Table)
+		}
+	}
+	return out, nil
+}
+
 func (sr *SchemaRegistry) createTable(ctx context.Context, table object.Table) error {
 	err := sr.tables.Insert(ctx, internalTableTables{
 		ID:      object.ID(table),
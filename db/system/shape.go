@@ -36,16 +36,22 @@ func NewDatabaseShape(schemas []*schema.Schema) *DatabaseShape {
 }
 
 func (sr *SchemaRegistry) Shape(ctx context.Context, onlyTables []object.Table) (*DatabaseShape, error) {
+	schemas := make([]*schema.Schema, 0, len(onlyTables))
+	for _, t := range onlyTables {
+		if sch, ok := catalog[t]; ok {
+			schemas = append(schemas, sch)
+		}
+	}
+
 	var tables []internalTableTables
 	err := sr.tables.Scan(ctx, &tables)
 	if err != nil {
 		if errors.Is(storage.ErrTableNotFound, err) {
-			return NewDatabaseShape(nil), nil
+			return NewDatabaseShape(schemas), nil
 		}
 		return nil, err
 	}
 
-	schemas := make([]*schema.Schema, 0, len(onlyTables))
 	for _, t := range tables {
 		if !slices.Contains(onlyTables, t.Table) {
 			continue
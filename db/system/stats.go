@@ -0,0 +1,238 @@
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/aliphe/filadb/db/object"
+	"github.com/aliphe/filadb/db/schema"
+	"github.com/aliphe/filadb/db/stats"
+	"github.com/aliphe/filadb/db/storage"
+	"github.com/aliphe/filadb/db/table"
+)
+
+type StatsRegistry struct {
+	stats *table.Querier[internalTableStats]
+}
+
+func NewStatsRegistry(store storage.ReaderWriter) *StatsRegistry {
+	return &StatsRegistry{
+		stats: table.NewQuerier[internalTableStats](store, internalTableStatsSchema.Marshaler(), object.Table(internalTableStatsName)),
+	}
+}
+
+// Save replaces the statistics of the table.
+func (sr *StatsRegistry) Save(ctx context.Context, t *stats.Table) error {
+	for _, c := range t.Columns {
+		row, err := fromColumnStats(t, c)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", c.Name, err)
+		}
+
+		var prev internalTableStats
+		err = sr.stats.Get(ctx, string(row.ID), &prev)
+		switch {
+		case errors.Is(err, storage.ErrKeyNotFound), errors.Is(err, storage.ErrTableNotFound):
+			err = sr.stats.Insert(ctx, row)
+		case err == nil:
+			err = sr.stats.Update(ctx, row)
+		}
+		if err != nil {
+			return fmt.Errorf("save stats of column %s: %w", c.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Get returns the statistics of the table, or nil if it was never analyzed.
+func (sr *StatsRegistry) Get(ctx context.Context, sch *schema.Schema) (*stats.Table, error) {
+	var rows []internalTableStats
+	err := sr.stats.Scan(ctx, &rows)
+	if err != nil {
+		if errors.Is(err, storage.ErrTableNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var out *stats.Table
+	for _, r := range rows {
+		if r.Table != sch.Table {
+			continue
+		}
+		if out == nil {
+			out = &stats.Table{
+				Table:   sch.Table,
+				Rows:    r.Rows,
+				Columns: make(map[string]*stats.Column),
+			}
+		}
+		c, err := r.columnStats(sch)
+		if err != nil {
+			return nil, fmt.Errorf("stats of column %s: %w", r.Column, err)
+		}
+		if c != nil {
+			out.Columns[c.Name] = c
+		}
+	}
+
+	return out, nil
+}
+
+type internalTableStats struct {
+	ID        object.ID
+	Table     object.Table
+	Column    string
+	Rows      int
+	Distinct  int
+	Nulls     int
+	Min       string
+	Max       string
+	Histogram string
+}
+
+func (i internalTableStats) ObjectID() object.ID {
+	return i.ID
+}
+
+func (i internalTableStats) ObjectTable() object.Table {
+	return internalTableStatsName
+}
+
+func fromColumnStats(t *stats.Table, c *stats.Column) (internalTableStats, error) {
+	bounds := make([]string, 0, len(c.Histogram))
+	for _, b := range c.Histogram {
+		bounds = append(bounds, formatStat(b))
+	}
+	hist, err := json.Marshal(bounds)
+	if err != nil {
+		return internalTableStats{}, fmt.Errorf("marshal histogram: %w", err)
+	}
+
+	return internalTableStats{
+		ID:        object.ID(object.Key(t.Table, c.Name)),
+		Table:     t.Table,
+		Column:    c.Name,
+		Rows:      t.Rows,
+		Distinct:  c.Distinct,
+		Nulls:     c.Nulls,
+		Min:       formatStat(c.Min),
+		Max:       formatStat(c.Max),
+		Histogram: string(hist),
+	}, nil
+}
+
+// columnStats returns the stats of the row, typed after the column in the
+// schema, or nil if the column was dropped.
+func (i internalTableStats) columnStats(sch *schema.Schema) (*stats.Column, error) {
+	var typ schema.ColumnType
+	for _, c := range sch.Columns {
+		if c.Name == i.Column {
+			typ = c.Type
+		}
+	}
+	if typ == "" {
+		return nil, nil
+	}
+
+	var bounds []string
+	if err := json.Unmarshal([]byte(i.Histogram), &bounds); err != nil {
+		return nil, fmt.Errorf("parse histogram: %w", err)
+	}
+
+	c := &stats.Column{
+		Name:     i.Column,
+		Distinct: i.Distinct,
+		Nulls:    i.Nulls,
+	}
+	var err error
+	if c.Min, err = parseStat(typ, i.Min); err != nil {
+		return nil, err
+	}
+	if c.Max, err = parseStat(typ, i.Max); err != nil {
+		return nil, err
+	}
+	for _, b := range bounds {
+		v, err := parseStat(typ, b)
+		if err != nil {
+			return nil, err
+		}
+		c.Histogram = append(c.Histogram, v)
+	}
+	return c, nil
+}
+
+// formatStat formats a value of a column as text, empty for nil.
+func formatStat(v any) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// parseStat parses a value formatted by formatStat. Numbers are parsed as
+// int32 when in range, as the parser reads them.
+func parseStat(typ schema.ColumnType, s string) (any, error) {
+	switch {
+	case s == "":
+		return nil, nil
+	case typ != schema.ColumnTypeNumber:
+		return s, nil
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parse %q: %w", s, err)
+	}
+	if n < math.MinInt32 || n > math.MaxInt32 {
+		return n, nil
+	}
+	return int32(n), nil
+}
+
+var internalTableStatsSchema = &schema.Schema{
+	Table: internalTableStatsName,
+	Columns: []schema.Column{
+		{
+			Name: "id",
+			Type: schema.ColumnTypeText,
+		},
+		{
+			Name: "table",
+			Type: schema.ColumnTypeText,
+		},
+		{
+			Name: "column",
+			Type: schema.ColumnTypeText,
+		},
+		{
+			Name: "rows",
+			Type: schema.ColumnTypeNumber,
+		},
+		{
+			Name: "distinct",
+			Type: schema.ColumnTypeNumber,
+		},
+		{
+			Name: "nulls",
+			Type: schema.ColumnTypeNumber,
+		},
+		{
+			Name: "min",
+			Type: schema.ColumnTypeText,
+		},
+		{
+			Name: "max",
+			Type: schema.ColumnTypeText,
+		},
+		{
+			Name: "histogram",
+			Type: schema.ColumnTypeText,
+		},
+	},
+}
@@ -3,6 +3,8 @@ package table
 import (
 	"context"
 	"fmt"
+
+	"github.com/aliphe/filadb/db/storage"
 )
 
 func (q *Querier[T]) Get(ctx context.Context, key string, dest *T) error {
@@ -10,6 +12,9 @@ func (q *Querier[T]) Get(ctx context.Context, key string, dest *T) error {
 	if err != nil {
 		return err
 	}
+	if len(d) == 0 {
+		return fmt.Errorf("%s in table %s: %w", key, q.table, storage.ErrKeyNotFound)
+	}
 
 	err = q.marshaler.Unmarshal(d[0], dest)
 	if err != nil {
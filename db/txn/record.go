@@ -0,0 +1,46 @@
+package txn
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// record is the commit record of a transaction, listing the nodes it wrote to.
+type record struct {
+	id    uint64
+	ts    uint64
+	nodes []string
+}
+
+func recordKey(id uint64) string {
+	return fmt.Sprintf("%016x", id)
+}
+
+func decodeRecord(b []byte) (record, error) {
+	if len(b) < 16 {
+		return record{}, ErrMalformedRecord
+	}
+
+	r := record{
+		id: binary.BigEndian.Uint64(b[:8]),
+		ts: binary.BigEndian.Uint64(b[8:16]),
+	}
+	for rest := b[16:]; len(rest) > 0; {
+		n, l := binary.Uvarint(rest)
+		if l <= 0 || n > uint64(len(rest)-l) {
+			return record{}, ErrMalformedRecord
+		}
+		r.nodes = append(r.nodes, string(rest[l:l+int(n)]))
+		rest = rest[l+int(n):]
+	}
+	return r, nil
+}
+
+func (r record) encode() []byte {
+	b := binary.BigEndian.AppendUint64(binary.BigEndian.AppendUint64(nil, r.id), r.ts)
+	for _, node := range r.nodes {
+		b = binary.AppendUvarint(b, uint64(len(node)))
+		b = append(b, node...)
+	}
+	return b
+}
@@ -0,0 +1,671 @@
+package txn
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aliphe/filadb/btree"
+	"github.com/aliphe/filadb/db/storage"
+)
+
+const (
+	// logNode holds a commit record for every committed transaction.
+	logNode = storage.TxLogNode
+	// metaNode holds the boot epoch, making transaction ids unique across restarts.
+	metaNode = storage.TxMetaNode
+	epochKey = "epoch"
+)
+
+var ErrMalformedRecord = errors.New("malformed transaction record")
+
+type rawStore interface {
+	Add(ctx context.Context, node, key string, val []byte) error
+	Load(ctx context.Context, node string, kvs []*btree.KeyVal[string]) error
+	Get(ctx context.Context, node, key string) ([][]byte, error)
+	Entries(ctx context.Context, node string) ([]*btree.KeyVal[string], error)
+	Range(ctx context.Context, node string, from, to *string, limit int) ([]*btree.KeyVal[string], error)
+	Update(ctx context.Context, node, key string, fn func([]byte) ([]byte, bool)) error
+	Prune(ctx context.Context, node string, fn func(string, []byte) bool) error
+}
+
+type options struct {
+	vacuumThreshold int
+}
+
+type Option func(*options)
+
+// WithVacuumThreshold sets how many dead versions a node may accumulate
+// before they get garbage collected, and how many transactions may commit
+// before the commit log gets compacted.
+func WithVacuumThreshold(n int) Option {
+	return func(o *options) {
+		o.vacuumThreshold = n
+	}
+}
+
+// Store provides transactions on top of a raw key-value store, isolating
+// them from each other with multi-version concurrency control.
+//
+// Values are kept in the transaction that wrote them until it commits, and are
+// then written to the raw store tagged with it. They only become visible to
+// others once a commit record for that transaction is in the log, so crashing
+// before the commit discards them, and rolling back leaves nothing behind.
+// Updates write new versions of values, and keep the old ones until no running
+// transaction can see them anymore. Once every snapshot includes a transaction,
+// the versions it wrote are frozen and its commit record is dropped.
+//
+// Operations made outside of a transaction run in their own one.
+type Store struct {
+	raw             rawStore
+	epoch           uint64
+	seq             atomic.Uint64
+	vacuumThreshold int
+
+	mu sync.RWMutex
+	// log maps committed transactions to their commit timestamp.
+	log map[uint64]uint64
+	// nodes maps committed transactions to the nodes they wrote to.
+	nodes map[uint64][]string
+	// commits counts the transactions committed since the log was last compacted.
+	commits int
+	// clock is the timestamp of the last commit.
+	clock uint64
+	// active maps running transactions to their snapshot.
+	active map[uint64]uint64
+	// garbage counts, per node, the versions which were superseded or rolled back since the last vacuum.
+	garbage map[string]int
+
+	// commitMu serialises commits.
+	commitMu sync.Mutex
+	// compactMu serialises compactions of the log.
+	compactMu sync.Mutex
+}
+
+func New(ctx context.Context, raw rawStore, opts ...Option) (*Store, error) {
+	opt := options{
+		vacuumThreshold: 100,
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	s := &Store{
+		raw:             raw,
+		vacuumThreshold: opt.vacuumThreshold,
+		log:             make(map[uint64]uint64),
+		nodes:           make(map[uint64][]string),
+		active:          make(map[uint64]uint64),
+		garbage:         make(map[string]int),
+	}
+
+	if err := s.boot(ctx); err != nil {
+		return nil, fmt.Errorf("boot transaction store: %w", err)
+	}
+	if err := s.loadLog(ctx); err != nil {
+		return nil, fmt.Errorf("load commit log: %w", err)
+	}
+
+	return s, nil
+}
+
+func (s *Store) boot(ctx context.Context) error {
+	vals, err := s.raw.Get(ctx, metaNode, epochKey)
+	if err != nil && !errors.Is(err, storage.ErrTableNotFound) {
+		return err
+	}
+
+	var epoch uint64
+	if len(vals) > 0 {
+		if len(vals[0]) != 8 {
+			return fmt.Errorf("epoch: %w", ErrMalformedRecord)
+		}
+		epoch = binary.BigEndian.Uint64(vals[0])
+	}
+	s.epoch = epoch + 1
+
+	b := binary.BigEndian.AppendUint64(nil, s.epoch)
+	if len(vals) == 0 {
+		return s.raw.Add(ctx, metaNode, epochKey, b)
+	}
+	return s.raw.Update(ctx, metaNode, epochKey, func([]byte) ([]byte, bool) {
+		return b, true
+	})
+}
+
+func (s *Store) loadLog(ctx context.Context) error {
+	kvs, err := s.raw.Entries(ctx, logNode)
+	if err != nil {
+		if errors.Is(err, storage.ErrTableNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	for _, kv := range kvs {
+		rec, err := decodeRecord(kv.Val)
+		if err != nil {
+			return fmt.Errorf("commit record %s: %w", kv.Key, err)
+		}
+		s.log[rec.id] = rec.ts
+		s.nodes[rec.id] = rec.nodes
+		s.clock = max(s.clock, rec.ts)
+	}
+	return nil
+}
+
+func (s *Store) Begin(ctx context.Context) (storage.Tx, error) {
+	return s.begin(), nil
+}
+
+func (s *Store) begin() *Tx {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.epoch<<32 | s.seq.Add(1)
+	s.active[id] = s.clock
+
+	return &Tx{
+		id:         id,
+		snapshot:   s.clock,
+		store:      s,
+		superseded: make(map[versionRef]struct{}),
+		pending:    make(map[string]map[string][][]byte),
+	}
+}
+
+// tx returns the transaction of the store carried by ctx, if any.
+func (s *Store) tx(ctx context.Context) (*Tx, bool) {
+	tx, ok := storage.TxFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	t, ok := tx.(*Tx)
+	if !ok || t.store != s {
+		return nil, false
+	}
+	return t, true
+}
+
+// run calls fn with the transaction carried by ctx, or within a transaction of
+// its own if there is none.
+func (s *Store) run(ctx context.Context, fn func(*Tx) error) error {
+	if tx, ok := s.tx(ctx); ok {
+		if tx.done {
+			return storage.ErrTxDone
+		}
+		return fn(tx)
+	}
+
+	tx := s.begin()
+	if err := fn(tx); err != nil {
+		return errors.Join(err, tx.Rollback(ctx))
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *Store) Add(ctx context.Context, node, key string, val []byte) error {
+	return s.run(ctx, func(tx *Tx) error {
+		tx.write(node, key, val)
+		return nil
+	})
+}
+
+// Load adds every entry, as Add does for each.
+func (s *Store) Load(ctx context.Context, node string, entries []storage.Entry) error {
+	return s.run(ctx, func(tx *Tx) error {
+		for _, e := range entries {
+			tx.write(node, e.Key, e.Val)
+		}
+		return nil
+	})
+}
+
+// Set replaces the values stored under key.
+// Values written by the transaction itself are updated in place, the others
+// are superseded by new versions.
+func (s *Store) Set(ctx context.Context, node, key string, val []byte) error {
+	return s.run(ctx, func(tx *Tx) error {
+		others, err := s.visible(ctx, tx, node, key)
+		if err != nil {
+			return err
+		}
+
+		own := tx.pending[node][key]
+		for i := range own {
+			own[i] = val
+		}
+
+		for _, v := range others {
+			tx.superseded[versionRef{node, key, v.xmin}] = struct{}{}
+			tx.write(node, key, val)
+		}
+
+		return nil
+	})
+}
+
+// Delete removes the values stored under key, superseding the ones written by
+// other transactions.
+func (s *Store) Delete(ctx context.Context, node, key string) error {
+	return s.run(ctx, func(tx *Tx) error {
+		others, err := s.visible(ctx, tx, node, key)
+		if err != nil {
+			return err
+		}
+
+		delete(tx.pending[node], key)
+		for _, v := range others {
+			tx.superseded[versionRef{node, key, v.xmin}] = struct{}{}
+		}
+
+		return nil
+	})
+}
+
+func (s *Store) Get(ctx context.Context, node, key string) ([][]byte, error) {
+	var out [][]byte
+	err := s.run(ctx, func(tx *Tx) error {
+		vs, err := s.visible(ctx, tx, node, key)
+		if err != nil {
+			return err
+		}
+
+		own := tx.pending[node][key]
+		out = make([][]byte, 0, len(vs)+len(own))
+		for _, v := range vs {
+			out = append(out, v.payload)
+		}
+		out = append(out, own...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (s *Store) Scan(ctx context.Context, node string) ([][]byte, error) {
+	var out [][]byte
+	err := s.Each(ctx, node, "", "", func(val []byte) error {
+		out = append(out, val)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// eachPage is how many versions Each reads from the raw store at once.
+const eachPage = 256
+
+// Each calls fn with the values stored under the keys from from, included, to
+// to, excluded, in key order. An empty to leaves the range unbounded.
+// Values are read a page at a time, from a single snapshot, and fn is called
+// without holding any latch, so that it may block.
+func (s *Store) Each(ctx context.Context, node, from, to string, fn func(val []byte) error) error {
+	var upper *string
+	if to != "" {
+		upper = &to
+	}
+
+	return s.run(ctx, func(tx *Tx) error {
+		// the values of tx come after the stored ones under the same key.
+		own := tx.pending[node]
+		keys := slices.DeleteFunc(slices.Sorted(maps.Keys(own)), func(k string) bool {
+			return k < from || (upper != nil && k >= to)
+		})
+		emit := func(vals [][]byte) error {
+			for _, val := range vals {
+				if err := fn(val); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		for {
+			kvs, err := s.raw.Range(ctx, node, &from, upper, eachPage)
+			if err := absent(tx, node, err); err != nil {
+				return err
+			}
+			for _, kv := range kvs {
+				for ; len(keys) > 0 && keys[0] < kv.Key; keys = keys[1:] {
+					if err := emit(own[keys[0]]); err != nil {
+						return err
+					}
+				}
+				if v := decode(kv.Val); tx.sees(node, kv.Key, v) {
+					if err := fn(v.payload); err != nil {
+						return err
+					}
+				}
+			}
+			if len(kvs) < eachPage {
+				break
+			}
+			// pages end with the last value of a key.
+			from = kvs[len(kvs)-1].Key + "\x00"
+		}
+
+		for _, key := range keys {
+			if err := emit(own[key]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// visible returns the versions stored under key which tx sees.
+func (s *Store) visible(ctx context.Context, tx *Tx, node, key string) ([]version, error) {
+	vals, err := s.raw.Get(ctx, node, key)
+	if err != nil {
+		return nil, absent(tx, node, err)
+	}
+
+	var out []version
+	for _, b := range vals {
+		if v := decode(b); tx.sees(node, key, v) {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+// absent returns nil if err only reports that node is not in the store yet,
+// while tx has values pending for it.
+func absent(tx *Tx, node string, err error) error {
+	if errors.Is(err, storage.ErrTableNotFound) && len(tx.pending[node]) > 0 {
+		return nil
+	}
+	return err
+}
+
+// commit checks that no transaction committed since the snapshot of tx superseded
+// the same versions, writes the values of tx, marks these versions as superseded
+// by tx, then writes its commit record. Until the record is written, none of the
+// writes of tx are visible.
+func (s *Store) commit(ctx context.Context, tx *Tx) error {
+	s.commitMu.Lock()
+	defer s.commitMu.Unlock()
+
+	for ref := range tx.superseded {
+		vals, err := s.raw.Get(ctx, ref.node, ref.key)
+		if err != nil {
+			return fmt.Errorf("check %s/%s: %w", ref.node, ref.key, err)
+		}
+		for _, b := range vals {
+			if v := decode(b); v.xmin == ref.xmin && v.xmax != 0 && s.committed(v.xmax) {
+				return fmt.Errorf("%s/%s: %w", ref.node, ref.key, storage.ErrWriteConflict)
+			}
+		}
+	}
+
+	if err := s.flush(ctx, tx); err != nil {
+		return err
+	}
+
+	for ref := range tx.superseded {
+		err := s.raw.Update(ctx, ref.node, ref.key, func(b []byte) ([]byte, bool) {
+			v := decode(b)
+			if v.xmin != ref.xmin {
+				return b, false
+			}
+			v.xmax = tx.id
+			return v.encode(), true
+		})
+		if err != nil {
+			return fmt.Errorf("supersede %s/%s: %w", ref.node, ref.key, err)
+		}
+	}
+
+	s.mu.RLock()
+	ts := s.clock + 1
+	s.mu.RUnlock()
+
+	rec := record{id: tx.id, ts: ts, nodes: tx.nodes()}
+	if err := s.raw.Add(ctx, logNode, recordKey(tx.id), rec.encode()); err != nil {
+		return fmt.Errorf("write commit record: %w", err)
+	}
+
+	s.mu.Lock()
+	s.log[tx.id] = ts
+	s.nodes[tx.id] = rec.nodes
+	s.clock = ts
+	s.mu.Unlock()
+
+	return nil
+}
+
+// flush writes the values pending in tx to the store, tagged with tx.
+func (s *Store) flush(ctx context.Context, tx *Tx) error {
+	tx.flushed = true
+	for node, pending := range tx.pending {
+		var kvs []*btree.KeyVal[string]
+		for key, vals := range pending {
+			for _, val := range vals {
+				kvs = append(kvs, &btree.KeyVal[string]{
+					Key: key,
+					Val: version{xmin: tx.id, payload: val}.encode(),
+				})
+			}
+		}
+		if err := s.raw.Load(ctx, node, kvs); err != nil {
+			return fmt.Errorf("write %s: %w", node, err)
+		}
+	}
+	return nil
+}
+
+// end unregisters tx once it committed or rolled back, garbage collects
+// the nodes where enough versions died, and compacts the log once enough
+// transactions committed.
+func (s *Store) end(ctx context.Context, tx *Tx, committed bool) {
+	s.mu.Lock()
+	delete(s.active, tx.id)
+
+	var compact bool
+	if committed {
+		s.commits++
+		if s.commits >= s.vacuumThreshold {
+			s.commits = 0
+			compact = true
+		}
+	}
+
+	var dirty []string
+	for _, node := range tx.nodes() {
+		if committed {
+			for ref := range tx.superseded {
+				if ref.node == node {
+					s.garbage[node]++
+				}
+			}
+		} else if tx.flushed {
+			s.garbage[node]++
+		}
+		if s.garbage[node] >= s.vacuumThreshold {
+			delete(s.garbage, node)
+			dirty = append(dirty, node)
+		}
+	}
+	s.mu.Unlock()
+
+	horizon := s.horizon()
+	for _, node := range dirty {
+		if err := s.vacuum(ctx, node, horizon); err != nil {
+			slog.Warn("vacuum", slog.String("node", node), slog.Any("err", err))
+		}
+	}
+
+	if compact && s.compactMu.TryLock() {
+		defer s.compactMu.Unlock()
+		if err := s.compact(ctx); err != nil {
+			slog.Warn("compact commit log", slog.Any("err", err))
+		}
+	}
+}
+
+// Vacuum garbage collects every node where versions died since the last vacuum,
+// then compacts the log.
+func (s *Store) Vacuum(ctx context.Context) error {
+	s.mu.Lock()
+	dirty := make([]string, 0, len(s.garbage))
+	for node := range s.garbage {
+		dirty = append(dirty, node)
+	}
+	clear(s.garbage)
+	s.mu.Unlock()
+
+	horizon := s.horizon()
+	for _, node := range dirty {
+		if err := s.vacuum(ctx, node, horizon); err != nil {
+			return fmt.Errorf("vacuum %s: %w", node, err)
+		}
+	}
+
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+	return s.compact(ctx)
+}
+
+// horizon returns the snapshot of the oldest running transaction, or the
+// timestamp of the last commit if none is running.
+func (s *Store) horizon() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	horizon := s.clock
+	for _, snapshot := range s.active {
+		horizon = min(horizon, snapshot)
+	}
+	return horizon
+}
+
+// vacuum removes the versions of node that no transaction can see anymore:
+// the ones written by transactions that failed to commit, and the ones superseded
+// before horizon. It then freezes the versions written before horizon, which
+// stay visible once the commit records of their writers are dropped.
+func (s *Store) vacuum(ctx context.Context, node string, horizon uint64) error {
+	err := s.raw.Prune(ctx, node, func(_ string, b []byte) bool {
+		v := decode(b)
+		if v.xmin != 0 && !v.frozen && !s.committed(v.xmin) && !s.running(v.xmin) {
+			return true
+		}
+		ts, ok := s.commitTs(v.xmax)
+		return v.xmax != 0 && ok && ts <= horizon
+	})
+	if errors.Is(err, storage.ErrTableNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	kvs, err := s.raw.Entries(ctx, node)
+	if err != nil {
+		return err
+	}
+	var keys []string
+	for _, kv := range kvs {
+		if s.freezable(decode(kv.Val), horizon) && (len(keys) == 0 || keys[len(keys)-1] != kv.Key) {
+			keys = append(keys, kv.Key)
+		}
+	}
+	for _, key := range keys {
+		err := s.raw.Update(ctx, node, key, func(b []byte) ([]byte, bool) {
+			v := decode(b)
+			if !s.freezable(v, horizon) {
+				return b, false
+			}
+			v.frozen = true
+			return v.encode(), true
+		})
+		if err != nil {
+			return fmt.Errorf("freeze %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// freezable returns true if v was written by a transaction which committed
+// before horizon, and is not frozen yet.
+func (s *Store) freezable(v version, horizon uint64) bool {
+	ts, ok := s.commitTs(v.xmin)
+	return !v.frozen && v.xmin != 0 && ok && ts <= horizon
+}
+
+// compact drops the commit records of the transactions which committed before
+// every running snapshot, once the nodes they wrote to are vacuumed.
+func (s *Store) compact(ctx context.Context) error {
+	horizon := s.horizon()
+
+	var ids []uint64
+	nodes := make(map[string]struct{})
+	s.mu.RLock()
+	for id, ts := range s.log {
+		// records written before they listed nodes cannot be dropped.
+		if ts > horizon || len(s.nodes[id]) == 0 {
+			continue
+		}
+		ids = append(ids, id)
+		for _, node := range s.nodes[id] {
+			nodes[node] = struct{}{}
+		}
+	}
+	s.mu.RUnlock()
+	if len(ids) == 0 {
+		return nil
+	}
+
+	for node := range nodes {
+		if err := s.vacuum(ctx, node, horizon); err != nil {
+			return fmt.Errorf("vacuum %s: %w", node, err)
+		}
+	}
+
+	drop := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		drop[recordKey(id)] = true
+	}
+	if err := s.raw.Prune(ctx, logNode, func(key string, _ []byte) bool { return drop[key] }); err != nil {
+		return fmt.Errorf("drop commit records: %w", err)
+	}
+
+	s.mu.Lock()
+	for _, id := range ids {
+		delete(s.log, id)
+		delete(s.nodes, id)
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Store) commitTs(id uint64) (uint64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ts, ok := s.log[id]
+	return ts, ok
+}
+
+func (s *Store) committed(id uint64) bool {
+	_, ok := s.commitTs(id)
+	return ok
+}
+
+func (s *Store) running(id uint64) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.active[id]
+	return ok
+}
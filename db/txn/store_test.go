@@ -0,0 +1,492 @@
+package txn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/aliphe/filadb/btree"
+	"github.com/aliphe/filadb/btree/file"
+	"github.com/aliphe/filadb/btree/file/vfs"
+	"github.com/aliphe/filadb/db/storage"
+	"github.com/google/go-cmp/cmp"
+)
+
+func newRaw(t *testing.T, dir string, opts ...file.Option) *btree.BTree[string] {
+	t.Helper()
+	f, err := file.New[string](append(opts, file.WithPath(dir))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+
+	return btree.New(f, btree.WithOrder(3))
+}
+
+func scan(t *testing.T, ctx context.Context, s *Store) []string {
+	t.Helper()
+	vals, err := s.Scan(ctx, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]string, 0, len(vals))
+	for _, v := range vals {
+		out = append(out, string(v))
+	}
+	return out
+}
+
+func Test_Store(t *testing.T) {
+	tests := map[string]struct {
+		run  func(t *testing.T, ctx context.Context, s *Store) error
+		want []string
+	}{
+		"commit makes writes visible": {
+			run: func(t *testing.T, ctx context.Context, s *Store) error {
+				tx, _ := s.Begin(ctx)
+				txCtx := storage.WithTx(ctx, tx)
+				if err := s.Add(txCtx, "users", "2", []byte("bob")); err != nil {
+					return err
+				}
+				if got := scan(t, ctx, s); len(got) != 1 {
+					t.Errorf("uncommitted write visible outside of transaction: %v", got)
+				}
+				if got := scan(t, txCtx, s); len(got) != 2 {
+					t.Errorf("transaction does not see its own write: %v", got)
+				}
+				return tx.Commit(ctx)
+			},
+			want: []string{"alice", "bob"},
+		},
+		"rollback discards writes": {
+			run: func(t *testing.T, ctx context.Context, s *Store) error {
+				tx, _ := s.Begin(ctx)
+				txCtx := storage.WithTx(ctx, tx)
+				if err := s.Add(txCtx, "users", "2", []byte("bob")); err != nil {
+					return err
+				}
+				if err := s.Set(txCtx, "users", "1", []byte("alicia")); err != nil {
+					return err
+				}
+				if err := s.Add(txCtx, "posts", "1", []byte("hello")); err != nil {
+					return err
+				}
+				if vals, err := s.Get(txCtx, "posts", "1"); err != nil || len(vals) != 1 {
+					t.Errorf("Get() = %q, %v, want the write of the transaction", vals, err)
+				}
+				if err := tx.Rollback(ctx); err != nil {
+					return err
+				}
+
+				kvs, err := s.raw.Entries(ctx, "users")
+				if err != nil {
+					return err
+				}
+				if len(kvs) != 1 {
+					t.Errorf("got %d versions after rollback, want 1", len(kvs))
+				}
+				if _, err := s.raw.Entries(ctx, "posts"); !errors.Is(err, storage.ErrTableNotFound) {
+					t.Errorf("Entries() error = %v, want %v", err, storage.ErrTableNotFound)
+				}
+				return nil
+			},
+			want: []string{"alice"},
+		},
+		"set supersedes committed values": {
+			run: func(t *testing.T, ctx context.Context, s *Store) error {
+				tx, _ := s.Begin(ctx)
+				txCtx := storage.WithTx(ctx, tx)
+				if err := s.Set(txCtx, "users", "1", []byte("alicia")); err != nil {
+					return err
+				}
+				if got := scan(t, ctx, s); !cmp.Equal(got, []string{"alice"}) {
+					t.Errorf("uncommitted update visible outside of transaction: %v", got)
+				}
+				if err := s.Set(txCtx, "users", "1", []byte("ali")); err != nil {
+					return err
+				}
+				return tx.Commit(ctx)
+			},
+			want: []string{"ali"},
+		},
+		"delete supersedes committed values": {
+			run: func(t *testing.T, ctx context.Context, s *Store) error {
+				tx, _ := s.Begin(ctx)
+				txCtx := storage.WithTx(ctx, tx)
+				if err := s.Add(txCtx, "users", "2", []byte("bob")); err != nil {
+					return err
+				}
+				if err := tx.Commit(ctx); err != nil {
+					return err
+				}
+
+				tx, _ = s.Begin(ctx)
+				txCtx = storage.WithTx(ctx, tx)
+				if err := s.Delete(txCtx, "users", "1"); err != nil {
+					return err
+				}
+				if got := scan(t, ctx, s); !cmp.Equal(got, []string{"alice", "bob"}) {
+					t.Errorf("uncommitted delete visible outside of transaction: %v", got)
+				}
+				if got := scan(t, txCtx, s); !cmp.Equal(got, []string{"bob"}) {
+					t.Errorf("transaction does not see its own delete: %v", got)
+				}
+				return tx.Commit(ctx)
+			},
+			want: []string{"bob"},
+		},
+		"snapshot ignores later commits": {
+			run: func(t *testing.T, ctx context.Context, s *Store) error {
+				tx, _ := s.Begin(ctx)
+				txCtx := storage.WithTx(ctx, tx)
+				if err := s.Add(ctx, "users", "2", []byte("bob")); err != nil {
+					return err
+				}
+				if err := s.Set(ctx, "users", "1", []byte("alicia")); err != nil {
+					return err
+				}
+				if got := scan(t, txCtx, s); !cmp.Equal(got, []string{"alice"}) {
+					t.Errorf("transaction sees writes committed after its snapshot: %v", got)
+				}
+				return tx.Commit(ctx)
+			},
+			want: []string{"alicia", "bob"},
+		},
+		"versions split across leaves": {
+			run: func(t *testing.T, ctx context.Context, s *Store) error {
+				if err := s.Add(ctx, "users", "2", []byte("bob")); err != nil {
+					return err
+				}
+				for _, name := range []string{"al", "ali", "alic", "alici", "alicia"} {
+					if err := s.Set(ctx, "users", "1", []byte(name)); err != nil {
+						return err
+					}
+				}
+				vals, err := s.Get(ctx, "users", "1")
+				if err != nil {
+					return err
+				}
+				if len(vals) != 1 || string(vals[0]) != "alicia" {
+					t.Errorf("Get() = %q, want only the latest version", vals)
+				}
+				return nil
+			},
+			want: []string{"alicia", "bob"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			s, err := New(ctx, newRaw(t, t.TempDir()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Add(ctx, "users", "1", []byte("alice")); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tc.run(t, ctx, s); err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tc.want, scan(t, ctx, s)); diff != "" {
+				t.Fatalf("Scan() mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
+
+func Test_Store_restart(t *testing.T) {
+	ctx := context.Background()
+	fs := vfs.NewMem()
+
+	s, err := New(ctx, newRaw(t, "db", file.WithFS(fs)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(ctx, "users", "1", []byte("alice")); err != nil {
+		t.Fatal(err)
+	}
+	// never committed, as the process crashes mid-transaction.
+	tx, _ := s.Begin(ctx)
+	if err := s.Add(storage.WithTx(ctx, tx), "users", "2", []byte("bob")); err != nil {
+		t.Fatal(err)
+	}
+	fs.Crash()
+
+	s, err = New(ctx, newRaw(t, "db", file.WithFS(fs)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(ctx, "users", "3", []byte("carol")); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"alice", "carol"}, scan(t, ctx, s)); diff != "" {
+		t.Fatalf("Scan() mismatch (-want,+got): %s", diff)
+	}
+}
+
+func Test_Store_malformedLog(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	raw := newRaw(t, t.TempDir())
+	if err := raw.Add(ctx, logNode, "1", []byte("short")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(ctx, raw); !errors.Is(err, ErrMalformedRecord) {
+		t.Fatalf("New() error = %v, want %v", err, ErrMalformedRecord)
+	}
+}
+
+func Test_Store_conflict(t *testing.T) {
+	ctx := context.Background()
+	s, err := New(ctx, newRaw(t, t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(ctx, "users", "1", []byte("alice")); err != nil {
+		t.Fatal(err)
+	}
+
+	first, _ := s.Begin(ctx)
+	second, _ := s.Begin(ctx)
+	if err := s.Set(storage.WithTx(ctx, first), "users", "1", []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(storage.WithTx(ctx, second), "users", "1", []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Commit(ctx); !errors.Is(err, storage.ErrWriteConflict) {
+		t.Fatalf("Commit() error = %v, want %v", err, storage.ErrWriteConflict)
+	}
+
+	if diff := cmp.Diff([]string{"first"}, scan(t, ctx, s)); diff != "" {
+		t.Fatalf("Scan() mismatch (-want,+got): %s", diff)
+	}
+}
+
+func Test_Store_Each(t *testing.T) {
+	ctx := context.Background()
+	s, err := New(ctx, newRaw(t, t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"a", "c", "e"} {
+		if err := s.Add(ctx, "users", k, []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tx, _ := s.Begin(ctx)
+	defer tx.Rollback(ctx)
+	txCtx := storage.WithTx(ctx, tx)
+	for _, k := range []string{"b", "d", "f"} {
+		if err := s.Add(txCtx, "users", k, []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := map[string]struct {
+		from, to string
+		want     []string
+	}{
+		"bounded":   {from: "b", to: "e", want: []string{"b", "c", "d"}},
+		"unbounded": {from: "c", want: []string{"c", "d", "e", "f"}},
+		"empty":     {from: "e", to: "e", want: []string{}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := []string{}
+			err := s.Each(txCtx, "users", tc.from, tc.to, func(val []byte) error {
+				got = append(got, string(val))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("Each() mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
+
+func Test_Store_Each_pages(t *testing.T) {
+	ctx := context.Background()
+	s, err := New(ctx, newRaw(t, t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// duplicate keys straddle the pages.
+	var want []string
+	entries := make([]storage.Entry, 0, 3*eachPage)
+	for i := range 3 * eachPage {
+		k := fmt.Sprintf("%04d", i/3)
+		entries = append(entries, storage.Entry{Key: k, Val: []byte(k)})
+		want = append(want, k)
+	}
+	if err := s.Load(ctx, "users", entries); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	err = s.Each(ctx, "users", "", "", func(val []byte) error {
+		got = append(got, string(val))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("Each() mismatch (-want,+got): %s", diff)
+	}
+}
+
+func Test_Store_vacuum(t *testing.T) {
+	ctx := context.Background()
+	raw := newRaw(t, t.TempDir())
+	s, err := New(ctx, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(ctx, "users", "1", []byte("alice")); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, _ := s.Begin(ctx)
+	for _, name := range []string{"alicia", "ali", "al"} {
+		if err := s.Set(ctx, "users", "1", []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rolledBack, _ := s.Begin(ctx)
+	if err := s.Add(storage.WithTx(ctx, rolledBack), "users", "2", []byte("bob")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rolledBack.Rollback(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// the reader still needs the first version.
+	if err := s.Vacuum(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"alice"}, scan(t, storage.WithTx(ctx, reader), s)); diff != "" {
+		t.Fatalf("Scan() mismatch (-want,+got): %s", diff)
+	}
+	if err := reader.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Set(ctx, "users", "1", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Vacuum(ctx); err != nil {
+		t.Fatal(err)
+	}
+	kvs, err := raw.Entries(ctx, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvs) != 1 {
+		t.Fatalf("got %d versions after vacuum, want 1", len(kvs))
+	}
+	if diff := cmp.Diff([]string{"a"}, scan(t, ctx, s)); diff != "" {
+		t.Fatalf("Scan() mismatch (-want,+got): %s", diff)
+	}
+}
+
+func Test_Store_compact(t *testing.T) {
+	ctx := context.Background()
+	fs := vfs.NewMem()
+	raw := newRaw(t, "db", file.WithFS(fs))
+	s, err := New(ctx, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if err := s.Add(ctx, "users", name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the writer read versions whose commit records get dropped meanwhile.
+	writer, _ := s.Begin(ctx)
+	if err := s.Set(storage.WithTx(ctx, writer), "users", "alice", []byte("alicia")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Vacuum(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Vacuum(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	recs, err := raw.Entries(ctx, logNode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 0 {
+		t.Fatalf("got %d commit records after vacuum, want 0", len(recs))
+	}
+	if diff := cmp.Diff([]string{"alicia", "bob", "carol"}, scan(t, ctx, s)); diff != "" {
+		t.Fatalf("Scan() mismatch (-want,+got): %s", diff)
+	}
+
+	fs.Crash()
+	s, err = New(ctx, newRaw(t, "db", file.WithFS(fs)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"alicia", "bob", "carol"}, scan(t, ctx, s)); diff != "" {
+		t.Fatalf("Scan() after restart mismatch (-want,+got): %s", diff)
+	}
+}
+
+func Test_Store_concurrent(t *testing.T) {
+	ctx := context.Background()
+	s, err := New(ctx, newRaw(t, t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 20 {
+				key := strconv.Itoa(w*100 + i)
+				if err := s.Add(ctx, "users", key, []byte(key)); err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := s.Scan(ctx, "users"); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := scan(t, ctx, s); len(got) != 8*20 {
+		t.Fatalf("got %d values, want %d", len(got), 8*20)
+	}
+}
@@ -0,0 +1,101 @@
+package txn
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/aliphe/filadb/db/storage"
+)
+
+// Tx is a transaction of a Store.
+// It reads from a snapshot of the store taken when it began, along with its own writes.
+// It is not safe for concurrent use.
+type Tx struct {
+	id       uint64
+	snapshot uint64
+	store    *Store
+
+	// superseded holds the versions written by other transactions that this one replaced.
+	// They are marked as such when the transaction commits.
+	superseded map[versionRef]struct{}
+	// pending holds, per node and key, the values the transaction wrote.
+	// They are only added to the store when it commits.
+	pending map[string]map[string][][]byte
+	// flushed is set once the pending values were added to the store.
+	flushed bool
+	done    bool
+}
+
+type versionRef struct {
+	node string
+	key  string
+	xmin uint64
+}
+
+// Commit commits the transaction, or fails with storage.ErrWriteConflict if
+// a transaction which committed since the snapshot was taken updated the same values.
+func (t *Tx) Commit(ctx context.Context) error {
+	if t.done {
+		return storage.ErrTxDone
+	}
+	t.done = true
+
+	if len(t.pending) == 0 && len(t.superseded) == 0 {
+		t.store.end(ctx, t, false)
+		return nil
+	}
+
+	err := t.store.commit(ctx, t)
+	t.store.end(ctx, t, err == nil)
+	return err
+}
+
+// Rollback discards the writes of the transaction. As they were only kept
+// in the transaction, nothing is left of them in the store.
+func (t *Tx) Rollback(ctx context.Context) error {
+	if t.done {
+		return storage.ErrTxDone
+	}
+	t.done = true
+
+	t.store.end(ctx, t, false)
+	return nil
+}
+
+func (t *Tx) write(node, key string, val []byte) {
+	if t.pending[node] == nil {
+		t.pending[node] = make(map[string][][]byte)
+	}
+	t.pending[node][key] = append(t.pending[node][key], val)
+}
+
+// nodes returns the nodes the transaction wrote to, or superseded values of.
+func (t *Tx) nodes() []string {
+	nodes := slices.Collect(maps.Keys(t.pending))
+	for ref := range t.superseded {
+		nodes = append(nodes, ref.node)
+	}
+	slices.Sort(nodes)
+	return slices.Compact(nodes)
+}
+
+// sees returns true if v is visible from the transaction.
+func (t *Tx) sees(node, key string, v version) bool {
+	if !v.frozen && !t.includes(v.xmin) {
+		return false
+	}
+	if _, ok := t.superseded[versionRef{node, key, v.xmin}]; ok {
+		return false
+	}
+	return v.xmax == 0 || !t.includes(v.xmax)
+}
+
+// includes returns true if the writes of transaction id are visible from the transaction.
+func (t *Tx) includes(id uint64) bool {
+	if id == 0 || id == t.id {
+		return true
+	}
+	ts, ok := t.store.commitTs(id)
+	return ok && ts <= t.snapshot
+}
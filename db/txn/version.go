@@ -0,0 +1,49 @@
+package txn
+
+import "encoding/binary"
+
+// versionFormat prefixes every value written by the Store, so that values
+// written without a version header are still readable. Frozen versions are
+// prefixed with frozenFormat instead.
+const (
+	versionFormat byte = 1
+	frozenFormat  byte = 2
+)
+
+const headerLen = 1 + 8 + 8
+
+// version is a stored value, tagged with the transactions that wrote and superseded it.
+type version struct {
+	// xmin is the transaction that wrote the value, 0 if it is visible to everyone.
+	xmin uint64
+	// xmax is the transaction that superseded the value, 0 if it is live.
+	xmax uint64
+	// frozen is set once xmin is visible to every transaction, so that its
+	// commit record can be dropped.
+	frozen  bool
+	payload []byte
+}
+
+func decode(b []byte) version {
+	if len(b) < headerLen || (b[0] != versionFormat && b[0] != frozenFormat) {
+		return version{payload: b}
+	}
+
+	return version{
+		xmin:    binary.BigEndian.Uint64(b[1:9]),
+		xmax:    binary.BigEndian.Uint64(b[9:17]),
+		frozen:  b[0] == frozenFormat,
+		payload: b[headerLen:],
+	}
+}
+
+func (v version) encode() []byte {
+	b := make([]byte, headerLen, headerLen+len(v.payload))
+	b[0] = versionFormat
+	if v.frozen {
+		b[0] = frozenFormat
+	}
+	binary.BigEndian.PutUint64(b[1:9], v.xmin)
+	binary.BigEndian.PutUint64(b[9:17], v.xmax)
+	return append(b, v.payload...)
+}
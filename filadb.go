@@ -0,0 +1,229 @@
+// Package filadb runs a database in the process, stored in a directory
+// which no other process can open meanwhile.
+package filadb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/aliphe/filadb/btree"
+	"github.com/aliphe/filadb/btree/file"
+	"github.com/aliphe/filadb/db"
+	"github.com/aliphe/filadb/db/system"
+	"github.com/aliphe/filadb/db/txn"
+	"github.com/aliphe/filadb/query"
+	"github.com/aliphe/filadb/query/sql"
+)
+
+var (
+	ErrClosed = errors.New("database is closed")
+	ErrTxDone = errors.New("transaction is already committed or rolled back")
+	ErrNoRows = errors.New("no rows in result set")
+)
+
+type options struct {
+	fileOpts    []file.Option
+	copyOnWrite bool
+}
+
+type Option func(*options)
+
+// WithFileOptions sets the options of the file store, such as its
+// durability. The path given to Open takes precedence.
+func WithFileOptions(opts ...file.Option) Option {
+	return func(o *options) {
+		o.fileOpts = opts
+	}
+}
+
+// WithCopyOnWrite never modifies the saved nodes of the trees, and swaps
+// their roots atomically instead. A store written so keeps being written so,
+// as its trees can only be reached from their swapped roots.
+func WithCopyOnWrite() Option {
+	return func(o *options) {
+		o.copyOnWrite = true
+	}
+}
+
+// DB is a database opened in the process. It is safe for concurrent use.
+type DB struct {
+	store *file.BtreeStore[string]
+	q     *sql.Runner
+
+	// mu is held for reading by running statements, which Close waits for.
+	mu     sync.RWMutex
+	closed bool
+}
+
+// Open opens the database stored in the directory at path, creating it if
+// needed. It fails with vfs.ErrLocked if another process has it open.
+func Open(path string, opts ...Option) (*DB, error) {
+	var opt options
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	store, err := file.New[string](append(slices.Clone(opt.fileOpts), file.WithPath(path))...)
+	if err != nil {
+		return nil, fmt.Errorf("open store: %w", err)
+	}
+	roots, err := store.Roots(context.Background())
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("load meta page: %w", err)
+	}
+	var btreeOpts []btree.Option
+	if opt.copyOnWrite || len(roots) > 0 {
+		btreeOpts = append(btreeOpts, btree.WithCopyOnWrite(store))
+	}
+	bt := btree.New(store, btreeOpts...)
+
+	txs, err := txn.New(context.Background(), bt)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	client := db.NewClient(txs, system.NewSchemaRegistry(txs), system.NewIndexRegistry(txs), system.NewStatsRegistry(txs), system.NewRoleRegistry(txs))
+	return &DB{
+		store: store,
+		q:     sql.NewRunner(client),
+	}, nil
+}
+
+// Result is the result of a statement not returning rows.
+type Result struct {
+	// Tag names the command, such as "INSERT 2".
+	Tag          string
+	RowsAffected int64
+}
+
+// Exec runs a statement in a session of its own, with the arguments bound
+// to its placeholders $1, $2... or ?. Arguments are integers or strings, and
+// are never read as SQL.
+func (d *DB) Exec(ctx context.Context, q string, args ...any) (Result, error) {
+	res, err := d.run(ctx, nil, q, args)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Tag: res.Tag, RowsAffected: int64(res.RowCount)}, nil
+}
+
+// Query runs a statement returning rows in a session of its own, binding
+// the arguments as Exec does.
+func (d *DB) Query(ctx context.Context, q string, args ...any) (*Rows, error) {
+	res, err := d.run(ctx, nil, q, args)
+	if err != nil {
+		return nil, err
+	}
+	return &Rows{res: res}, nil
+}
+
+// QueryRow is Query, reading the first row only.
+func (d *DB) QueryRow(ctx context.Context, q string, args ...any) *Row {
+	rows, err := d.Query(ctx, q, args...)
+	return &Row{rows: rows, err: err}
+}
+
+// Begin starts a transaction, in a session kept until it ends.
+func (d *DB) Begin(ctx context.Context) (*Tx, error) {
+	sess := d.q.Session("")
+	if _, err := d.run(ctx, sess, "BEGIN", nil); err != nil {
+		sess.Close(ctx)
+		return nil, err
+	}
+	return &Tx{db: d, sess: sess}, nil
+}
+
+// Close waits for the running statements, and closes the store. The
+// transactions left open are rolled back.
+func (d *DB) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+	d.closed = true
+	return d.store.Close()
+}
+
+// run runs q in the session, or in a session of its own if nil. With
+// arguments, q is prepared as the unnamed statement of the session.
+func (d *DB) run(ctx context.Context, sess query.Session, q string, args []any) (*query.Result, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.closed {
+		return nil, ErrClosed
+	}
+	if sess == nil {
+		sess = d.q.Session("")
+		defer sess.Close(ctx)
+	}
+	if len(args) == 0 {
+		return sess.Run(ctx, q)
+	}
+	if _, err := sess.Prepare(ctx, "", q); err != nil {
+		return nil, err
+	}
+	return sess.Execute(ctx, "", args...)
+}
+
+// Tx is a transaction. It is not safe for concurrent use.
+type Tx struct {
+	db   *DB
+	sess query.Session
+	done bool
+}
+
+func (t *Tx) Exec(ctx context.Context, q string, args ...any) (Result, error) {
+	if t.done {
+		return Result{}, ErrTxDone
+	}
+	res, err := t.db.run(ctx, t.sess, q, args)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Tag: res.Tag, RowsAffected: int64(res.RowCount)}, nil
+}
+
+func (t *Tx) Query(ctx context.Context, q string, args ...any) (*Rows, error) {
+	if t.done {
+		return nil, ErrTxDone
+	}
+	res, err := t.db.run(ctx, t.sess, q, args)
+	if err != nil {
+		return nil, err
+	}
+	return &Rows{res: res}, nil
+}
+
+func (t *Tx) QueryRow(ctx context.Context, q string, args ...any) *Row {
+	rows, err := t.Query(ctx, q, args...)
+	return &Row{rows: rows, err: err}
+}
+
+// Commit commits the transaction. A transaction in which a statement
+// failed is rolled back instead, and reported as failing.
+func (t *Tx) Commit(ctx context.Context) error {
+	return t.end(ctx, "COMMIT")
+}
+
+func (t *Tx) Rollback(ctx context.Context) error {
+	return t.end(ctx, "ROLLBACK")
+}
+
+func (t *Tx) end(ctx context.Context, q string) error {
+	if t.done {
+		return ErrTxDone
+	}
+	t.done = true
+	defer t.sess.Close(ctx)
+
+	_, err := t.db.run(ctx, t.sess, q, nil)
+	return err
+}
@@ -0,0 +1,165 @@
+package filadb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aliphe/filadb/btree/file/vfs"
+	"github.com/aliphe/filadb/query"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_Open(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	d, err := Open(dir, WithCopyOnWrite())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(dir); !errors.Is(err, vfs.ErrLocked) {
+		t.Fatalf("Open() error = %v, want %v", err, vfs.ErrLocked)
+	}
+
+	if _, err := d.Exec(ctx, "CREATE TABLE users (id NUMBER, email TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := d.Exec(ctx, "INSERT INTO users (id, email) VALUES (1, 'a@b.com'), (2, 'c@d.com')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(Result{Tag: "INSERT 2", RowsAffected: 2}, res); diff != "" {
+		t.Fatalf("Exec() mismatch (-want,+got): %s", diff)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Exec(ctx, "SELECT id FROM users"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Exec() after Close() error = %v, want %v", err, ErrClosed)
+	}
+
+	d, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	rows, err := d.Query(ctx, "SELECT id, email FROM users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	if diff := cmp.Diff([]string{"id", "email"}, rows.Columns()); diff != "" {
+		t.Fatalf("Columns() mismatch (-want,+got): %s", diff)
+	}
+	got := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var email string
+		if err := rows.Scan(&id, &email); err != nil {
+			t.Fatal(err)
+		}
+		got[id] = email
+	}
+	if diff := cmp.Diff(map[int]string{1: "a@b.com", 2: "c@d.com"}, got); diff != "" {
+		t.Fatalf("rows mismatch (-want,+got): %s", diff)
+	}
+
+	var id int
+	if err := d.QueryRow(ctx, "SELECT id FROM users WHERE id = 3").Scan(&id); !errors.Is(err, ErrNoRows) {
+		t.Fatalf("Scan() error = %v, want %v", err, ErrNoRows)
+	}
+	var qerr *query.Error
+	if _, err := d.Query(ctx, "SELECT name FROM users"); !errors.As(err, &qerr) || qerr.Code != query.CodeUndefinedColumn {
+		t.Fatalf("Query() error = %v, want an undefined column error", err)
+	}
+
+	if _, err := d.Exec(ctx, "INSERT INTO users (id, email) VALUES (?, ?)", 3, "x'); DROP TABLE users; --"); err != nil {
+		t.Fatal(err)
+	}
+	var email string
+	if err := d.QueryRow(ctx, "SELECT email FROM users WHERE id = $1", 3).Scan(&email); err != nil {
+		t.Fatal(err)
+	}
+	if email != "x'); DROP TABLE users; --" {
+		t.Fatalf("email = %q, want the bound value", email)
+	}
+	if _, err := d.Exec(ctx, "SELECT id FROM users WHERE id = $1", "3"); !errors.As(err, &qerr) || qerr.Code != query.CodeDatatypeMismatch {
+		t.Fatalf("Exec() error = %v, want a datatype mismatch error", err)
+	}
+}
+
+func Test_Tx(t *testing.T) {
+	ctx := context.Background()
+
+	tests := map[string]struct {
+		end  func(tx *Tx) error
+		want []int
+	}{
+		"commit": {
+			end:  func(tx *Tx) error { return tx.Commit(ctx) },
+			want: []int{1, 2},
+		},
+		"rollback": {
+			end:  func(tx *Tx) error { return tx.Rollback(ctx) },
+			want: []int{1},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			d, err := Open(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+			if _, err := d.Exec(ctx, "CREATE TABLE users (id NUMBER)"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := d.Exec(ctx, "INSERT INTO users (id) VALUES (1)"); err != nil {
+				t.Fatal(err)
+			}
+
+			tx, err := d.Begin(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tx.Exec(ctx, "INSERT INTO users (id) VALUES (2)"); err != nil {
+				t.Fatal(err)
+			}
+			var n int
+			if err := tx.QueryRow(ctx, "SELECT id FROM users WHERE id = 2").Scan(&n); err != nil {
+				t.Fatalf("the transaction does not see its own insert: %v", err)
+			}
+			if err := d.QueryRow(ctx, "SELECT id FROM users WHERE id = 2").Scan(&n); !errors.Is(err, ErrNoRows) {
+				t.Fatalf("uncommitted insert seen outside of the transaction: %v", err)
+			}
+
+			if err := tc.end(tx); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tx.Exec(ctx, "SELECT id FROM users"); !errors.Is(err, ErrTxDone) {
+				t.Fatalf("Exec() after the end error = %v, want %v", err, ErrTxDone)
+			}
+
+			rows, err := d.Query(ctx, "SELECT id FROM users")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for rows.Next() {
+				if err := rows.Scan(&n); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, n)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("rows mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/aliphe/filadb/net/scram"
+)
+
+// Handshake starts a session as the user, authenticating with SCRAM-SHA-256.
+// It fails with the ErrorResponse of the server if it rejects the session.
+func Handshake(rw io.ReadWriter, user, password string) error {
+	if err := WriteMessage(rw, &Startup{Version: Version, User: user}); err != nil {
+		return err
+	}
+	var auth *AuthenticationSASL
+	if err := readAuth(rw, &auth); err != nil {
+		return err
+	}
+	if !slices.Contains(auth.Mechanisms, scram.Mechanism) {
+		return fmt.Errorf("server mechanisms %v do not include %s", auth.Mechanisms, scram.Mechanism)
+	}
+
+	c := scram.NewClient(user, password)
+	if err := WriteMessage(rw, &SASLInitialResponse{Mechanism: scram.Mechanism, Data: c.First()}); err != nil {
+		return err
+	}
+	var cont *AuthenticationSASLContinue
+	if err := readAuth(rw, &cont); err != nil {
+		return err
+	}
+	final, err := c.Final(cont.Data)
+	if err != nil {
+		return err
+	}
+	if err := WriteMessage(rw, &SASLResponse{Data: final}); err != nil {
+		return err
+	}
+	var fin *AuthenticationSASLFinal
+	if err := readAuth(rw, &fin); err != nil {
+		return err
+	}
+	if err := c.Verify(fin.Data); err != nil {
+		return err
+	}
+
+	msgs, err := readAnswer(rw)
+	if err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		if e, ok := m.(*ErrorResponse); ok {
+			return e
+		}
+	}
+	return nil
+}
+
+// readAuth reads the next message of the authentication into dst, failing
+// with the ErrorResponse of the server if it sends one instead.
+func readAuth[T Message](r io.Reader, dst *T) error {
+	m, err := ReadMessage(r)
+	if err != nil {
+		return err
+	}
+	switch m := m.(type) {
+	case T:
+		*dst = m
+		return nil
+	case *ErrorResponse:
+		return m
+	default:
+		return fmt.Errorf("unexpected message %q during authentication", m.Type())
+	}
+}
+
+// Exchange sends a query, and returns the messages answering it, up to
+// ReadyForQuery excluded.
+func Exchange(rw io.ReadWriter, sql string) ([]Message, error) {
+	if err := WriteMessage(rw, &Query{SQL: sql}); err != nil {
+		return nil, err
+	}
+	return readAnswer(rw)
+}
+
+func readAnswer(r io.Reader) ([]Message, error) {
+	var msgs []Message
+	for {
+		m, err := ReadMessage(r)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := m.(*ReadyForQuery); ok {
+			return msgs, nil
+		}
+		msgs = append(msgs, m)
+	}
+}
+
+// Format renders messages answering a query as text, the answer to each
+// statement on lines of its own. Rows are written as CSV following a line
+// naming the columns, and null values as NULL. Statements returning no rows
+// are written as their tag.
+func Format(msgs []Message) string {
+	var out []string
+	var table bytes.Buffer
+	w := csv.NewWriter(&table)
+	// copied holds the output of COPY TO STDOUT, sent in chunks.
+	var copied bytes.Buffer
+	for _, m := range msgs {
+		switch m := m.(type) {
+		case *RowDescription:
+			rec := make([]string, 0, len(m.Columns))
+			for _, c := range m.Columns {
+				rec = append(rec, c.Name)
+			}
+			w.Write(rec)
+		case *DataRow:
+			rec := make([]string, 0, len(m.Values))
+			for _, v := range m.Values {
+				if v == nil {
+					rec = append(rec, "NULL")
+					continue
+				}
+				rec = append(rec, string(v))
+			}
+			w.Write(rec)
+		case *CopyData:
+			copied.Write(m.Data)
+		case *CommandComplete:
+			w.Flush()
+			switch {
+			case table.Len() > 0:
+				out = append(out, strings.TrimSuffix(table.String(), "\n"))
+				table.Reset()
+			case copied.Len() > 0:
+				out = append(out, copied.String())
+				copied.Reset()
+			default:
+				out = append(out, m.Tag)
+			}
+		case *ErrorResponse:
+			out = append(out, fmt.Sprintf("ERROR: %s", m.Error()))
+		}
+	}
+	return strings.Join(out, "\n")
+}
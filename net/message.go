@@ -22,7 +22,19 @@ func Write(conn io.Writer, res []byte) error {
 	return nil
 }
 
+// maxMessage is the size over which frames are rejected.
+const maxMessage = 1 << 30
+
+// maxStartupMessage is the size over which frames are rejected before the
+// client is authenticated, as PostgreSQL does, so that unauthenticated
+// clients cannot have large buffers allocated.
+const maxStartupMessage = 10000
+
 func Read(conn io.Reader) ([]byte, error) {
+	return read(conn, maxMessage)
+}
+
+func read(conn io.Reader, limit uint32) ([]byte, error) {
 	lenBuf := make([]byte, 4)
 	_, err := io.ReadFull(conn, lenBuf)
 	if err != nil {
@@ -30,6 +42,9 @@ func Read(conn io.Reader) ([]byte, error) {
 	}
 
 	resLen := binary.BigEndian.Uint32(lenBuf)
+	if resLen > limit {
+		return nil, fmt.Errorf("frame of %d bytes: %w", resLen, ErrMalformed)
+	}
 
 	res := make([]byte, resLen)
 	_, err = io.ReadFull(conn, res)
@@ -0,0 +1,631 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/aliphe/filadb/db/schema"
+)
+
+// Version is the version of the protocol, sent by clients on startup.
+const Version uint32 = 2
+
+// A session starts with the client sending Startup, which the server answers
+// with ErrorResponse if it does not speak that version, and AuthenticationSASL
+// otherwise, naming the mechanisms it accepts. The client authenticates with
+// SASLInitialResponse, which the server answers with
+// AuthenticationSASLContinue, and SASLResponse, which it answers with
+// AuthenticationSASLFinal and ReadyForQuery. Authentication failing is
+// answered with ErrorResponse instead, and the server closes the session.
+//
+// The client then sends a Query at a time. The server answers each statement
+// of the query in turn, with RowDescription, a DataRow per row and
+// CommandComplete for those returning rows, CopyData messages holding chunks
+// of the output and CommandComplete for COPY TO STDOUT, and only
+// CommandComplete otherwise. A statement failing is
+// answered with ErrorResponse, and the statements after it are skipped. The
+// answer ends with ReadyForQuery.
+//
+// Instead of a Query, the client can send Prepare, which the server answers
+// with ParameterDescription and ReadyForQuery, keeping the statement for the
+// session. Execute then binds values to the placeholders of the statement and
+// runs it, answered as a statement of a Query. Values are never read as SQL.
+//
+// Each message is written in a frame, starting with its MessageType.
+
+type MessageType byte
+
+const (
+	// Sent by clients.
+	TypeStartup             MessageType = 'S'
+	TypeSASLInitialResponse MessageType = 'p'
+	TypeSASLResponse        MessageType = 'r'
+	TypeQuery               MessageType = 'Q'
+	TypePrepare             MessageType = 'P'
+	TypeExecute             MessageType = 'e'
+	TypeTerminate           MessageType = 'X'
+
+	// Sent by servers.
+	TypeAuthenticationSASL         MessageType = 'R'
+	TypeAuthenticationSASLContinue MessageType = 'c'
+	TypeAuthenticationSASLFinal    MessageType = 'f'
+	TypeParameterDescription       MessageType = 't'
+	TypeRowDescription             MessageType = 'T'
+	TypeDataRow                    MessageType = 'D'
+	TypeCopyData                   MessageType = 'd'
+	TypeCommandComplete            MessageType = 'C'
+	TypeErrorResponse              MessageType = 'E'
+	TypeReadyForQuery              MessageType = 'Z'
+)
+
+var (
+	ErrUnknownMessage  = errors.New("unknown message type")
+	ErrMalformed       = errors.New("malformed message")
+	ErrUnsupportedType = errors.New("unsupported parameter type")
+)
+
+type Message interface {
+	Type() MessageType
+	encode(b []byte) []byte
+	decode(d *decoder)
+}
+
+type Startup struct {
+	Version uint32
+	User    string
+}
+
+// SASLInitialResponse picks the mechanism of the authentication, and holds
+// the first message of the client.
+type SASLInitialResponse struct {
+	Mechanism string
+	Data      []byte
+}
+
+type SASLResponse struct {
+	Data []byte
+}
+
+type Query struct {
+	SQL string
+}
+
+// Prepare prepares SQL, a single statement which may hold placeholders, as
+// the statement Name. The unnamed statement "" is replaced by each Prepare.
+type Prepare struct {
+	Name string
+	SQL  string
+}
+
+// Execute runs the prepared statement Name, with Params bound to its
+// placeholders in order.
+type Execute struct {
+	Name   string
+	Params []Param
+}
+
+// Param is a value bound to a placeholder, in text as in a DataRow. Its type
+// is checked against the one of the placeholder.
+type Param struct {
+	Type  schema.ColumnType
+	Value []byte
+}
+
+// Terminate closes the session.
+type Terminate struct{}
+
+// AuthenticationSASL asks the client to authenticate with one of the
+// mechanisms.
+type AuthenticationSASL struct {
+	Mechanisms []string
+}
+
+type AuthenticationSASLContinue struct {
+	Data []byte
+}
+
+// AuthenticationSASLFinal holds the last message of the server, once the
+// client is authenticated.
+type AuthenticationSASLFinal struct {
+	Data []byte
+}
+
+// ParameterDescription holds the types of the parameters of a prepared
+// statement, empty for those whose type could not be told.
+type ParameterDescription struct {
+	Types []schema.ColumnType
+}
+
+type RowDescription struct {
+	Columns []Column
+}
+
+type Column struct {
+	Name string
+	Type schema.ColumnType
+}
+
+// DataRow holds the values of a row, in text. Nil values are null.
+type DataRow struct {
+	Values [][]byte
+}
+
+// CopyData holds a chunk of the output of COPY TO STDOUT.
+type CopyData struct {
+	Data []byte
+}
+
+type CommandComplete struct {
+	// Tag names the command, followed by the number of rows it affected if
+	// any, such as "INSERT 2".
+	Tag  string
+	Rows uint64
+}
+
+type ErrorResponse struct {
+	// Code is the SQLSTATE code of the error.
+	Code    string
+	Message string
+	// Position is the 1-based offset in the query of the error, 0 if unknown.
+	Position uint32
+}
+
+func (e *ErrorResponse) Error() string {
+	return fmt.Sprintf("%s (SQLSTATE %s)", e.Message, e.Code)
+}
+
+type ReadyForQuery struct {
+	// Status is the transaction status of the session: 'I' when idle, 'T' in a
+	// transaction block, and 'E' in a failed one.
+	Status byte
+}
+
+func (*Startup) Type() MessageType                    { return TypeStartup }
+func (*SASLInitialResponse) Type() MessageType        { return TypeSASLInitialResponse }
+func (*SASLResponse) Type() MessageType               { return TypeSASLResponse }
+func (*Query) Type() MessageType                      { return TypeQuery }
+func (*Prepare) Type() MessageType                    { return TypePrepare }
+func (*Execute) Type() MessageType                    { return TypeExecute }
+func (*Terminate) Type() MessageType                  { return TypeTerminate }
+func (*AuthenticationSASL) Type() MessageType         { return TypeAuthenticationSASL }
+func (*AuthenticationSASLContinue) Type() MessageType { return TypeAuthenticationSASLContinue }
+func (*AuthenticationSASLFinal) Type() MessageType    { return TypeAuthenticationSASLFinal }
+func (*ParameterDescription) Type() MessageType       { return TypeParameterDescription }
+func (*RowDescription) Type() MessageType             { return TypeRowDescription }
+func (*DataRow) Type() MessageType                    { return TypeDataRow }
+func (*CopyData) Type() MessageType                   { return TypeCopyData }
+func (*CommandComplete) Type() MessageType            { return TypeCommandComplete }
+func (*ErrorResponse) Type() MessageType              { return TypeErrorResponse }
+func (*ReadyForQuery) Type() MessageType              { return TypeReadyForQuery }
+
+// Encode returns the value in text, nil for nil values.
+func Encode(v any) []byte {
+	if v == nil {
+		return nil
+	}
+	return fmt.Append(nil, v)
+}
+
+// Decode parses a value of the column, as encoded in a DataRow. Numbers are
+// returned as int64.
+func (c Column) Decode(b []byte) (any, error) {
+	if b == nil {
+		return nil, nil
+	}
+	if c.Type != schema.ColumnTypeNumber {
+		return string(b), nil
+	}
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("column %s: %w", c.Name, err)
+	}
+	return n, nil
+}
+
+// NewParam returns the parameter holding v: a number for integers, and text
+// for strings and bytes. Nil values are null.
+func NewParam(v any) (Param, error) {
+	switch v := v.(type) {
+	case nil:
+		return Param{}, nil
+	case string:
+		return Param{Type: schema.ColumnTypeText, Value: []byte(v)}, nil
+	case []byte:
+		return Param{Type: schema.ColumnTypeText, Value: append([]byte{}, v...)}, nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return Param{Type: schema.ColumnTypeNumber, Value: Encode(v)}, nil
+	default:
+		return Param{}, fmt.Errorf("%T: %w", v, ErrUnsupportedType)
+	}
+}
+
+// Decode returns the value of the parameter, numbers as int64, and nil for
+// null ones.
+func (p Param) Decode() (any, error) {
+	if p.Value == nil {
+		return nil, nil
+	}
+	switch p.Type {
+	case schema.ColumnTypeNumber:
+		n, err := strconv.ParseInt(string(p.Value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", p.Value, ErrMalformed)
+		}
+		return n, nil
+	case schema.ColumnTypeText:
+		return string(p.Value), nil
+	default:
+		return nil, fmt.Errorf("%s: %w", p.Type, ErrUnsupportedType)
+	}
+}
+
+// WriteMessage writes m in a frame.
+func WriteMessage(w io.Writer, m Message) error {
+	b := m.encode([]byte{byte(m.Type())})
+	return Write(w, b)
+}
+
+// ReadMessage reads the message of the next frame.
+func ReadMessage(r io.Reader) (Message, error) {
+	return readMessage(r, maxMessage)
+}
+
+// ReadStartupMessage reads the message of the next frame sent before the
+// client is authenticated, rejecting frames over 10000 bytes.
+func ReadStartupMessage(r io.Reader) (Message, error) {
+	return readMessage(r, maxStartupMessage)
+}
+
+func readMessage(r io.Reader, limit uint32) (Message, error) {
+	b, err := read(r, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty frame: %w", ErrMalformed)
+	}
+
+	var m Message
+	switch MessageType(b[0]) {
+	case TypeStartup:
+		m = &Startup{}
+	case TypeSASLInitialResponse:
+		m = &SASLInitialResponse{}
+	case TypeSASLResponse:
+		m = &SASLResponse{}
+	case TypeQuery:
+		m = &Query{}
+	case TypePrepare:
+		m = &Prepare{}
+	case TypeExecute:
+		m = &Execute{}
+	case TypeTerminate:
+		m = &Terminate{}
+	case TypeAuthenticationSASL:
+		m = &AuthenticationSASL{}
+	case TypeAuthenticationSASLContinue:
+		m = &AuthenticationSASLContinue{}
+	case TypeAuthenticationSASLFinal:
+		m = &AuthenticationSASLFinal{}
+	case TypeParameterDescription:
+		m = &ParameterDescription{}
+	case TypeRowDescription:
+		m = &RowDescription{}
+	case TypeDataRow:
+		m = &DataRow{}
+	case TypeCopyData:
+		m = &CopyData{}
+	case TypeCommandComplete:
+		m = &CommandComplete{}
+	case TypeErrorResponse:
+		m = &ErrorResponse{}
+	case TypeReadyForQuery:
+		m = &ReadyForQuery{}
+	default:
+		return nil, fmt.Errorf("%q: %w", b[0], ErrUnknownMessage)
+	}
+
+	d := &decoder{b: b[1:]}
+	m.decode(d)
+	if d.err == nil && len(d.b) > 0 {
+		d.err = ErrMalformed
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("%q: %w", b[0], d.err)
+	}
+	return m, nil
+}
+
+func (m *Startup) encode(b []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, m.Version)
+	return appendString(b, m.User)
+}
+
+func (m *Startup) decode(d *decoder) {
+	m.Version = d.uint32()
+	// clients of the first version send no user, and are told their version
+	// is not supported.
+	if len(d.b) > 0 {
+		m.User = d.string()
+	}
+}
+
+func (m *SASLInitialResponse) encode(b []byte) []byte {
+	b = appendString(b, m.Mechanism)
+	return appendBytes(b, m.Data)
+}
+
+func (m *SASLInitialResponse) decode(d *decoder) {
+	m.Mechanism = d.string()
+	m.Data = d.bytes()
+}
+
+func (m *SASLResponse) encode(b []byte) []byte {
+	return appendBytes(b, m.Data)
+}
+
+func (m *SASLResponse) decode(d *decoder) {
+	m.Data = d.bytes()
+}
+
+func (m *AuthenticationSASL) encode(b []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(m.Mechanisms)))
+	for _, s := range m.Mechanisms {
+		b = appendString(b, s)
+	}
+	return b
+}
+
+func (m *AuthenticationSASL) decode(d *decoder) {
+	n := d.count()
+	m.Mechanisms = make([]string, 0, n)
+	for range n {
+		m.Mechanisms = append(m.Mechanisms, d.string())
+	}
+}
+
+func (m *AuthenticationSASLContinue) encode(b []byte) []byte {
+	return appendBytes(b, m.Data)
+}
+
+func (m *AuthenticationSASLContinue) decode(d *decoder) {
+	m.Data = d.bytes()
+}
+
+func (m *AuthenticationSASLFinal) encode(b []byte) []byte {
+	return appendBytes(b, m.Data)
+}
+
+func (m *AuthenticationSASLFinal) decode(d *decoder) {
+	m.Data = d.bytes()
+}
+
+func (m *Query) encode(b []byte) []byte {
+	return appendString(b, m.SQL)
+}
+
+func (m *Query) decode(d *decoder) {
+	m.SQL = d.string()
+}
+
+func (m *Prepare) encode(b []byte) []byte {
+	b = appendString(b, m.Name)
+	return appendString(b, m.SQL)
+}
+
+func (m *Prepare) decode(d *decoder) {
+	m.Name = d.string()
+	m.SQL = d.string()
+}
+
+func (m *Execute) encode(b []byte) []byte {
+	b = appendString(b, m.Name)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(m.Params)))
+	for _, p := range m.Params {
+		b = appendString(b, string(p.Type))
+		b = appendValue(b, p.Value)
+	}
+	return b
+}
+
+func (m *Execute) decode(d *decoder) {
+	m.Name = d.string()
+	n := d.count()
+	m.Params = make([]Param, 0, n)
+	for range n {
+		m.Params = append(m.Params, Param{
+			Type:  schema.ColumnType(d.string()),
+			Value: d.bytes(),
+		})
+	}
+}
+
+func (m *ParameterDescription) encode(b []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(m.Types)))
+	for _, t := range m.Types {
+		b = appendString(b, string(t))
+	}
+	return b
+}
+
+func (m *ParameterDescription) decode(d *decoder) {
+	n := d.count()
+	m.Types = make([]schema.ColumnType, 0, n)
+	for range n {
+		m.Types = append(m.Types, schema.ColumnType(d.string()))
+	}
+}
+
+func (m *Terminate) encode(b []byte) []byte {
+	return b
+}
+
+func (m *Terminate) decode(*decoder) {}
+
+func (m *RowDescription) encode(b []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(m.Columns)))
+	for _, c := range m.Columns {
+		b = appendString(b, c.Name)
+		b = appendString(b, string(c.Type))
+	}
+	return b
+}
+
+func (m *RowDescription) decode(d *decoder) {
+	n := d.count()
+	m.Columns = make([]Column, 0, n)
+	for range n {
+		m.Columns = append(m.Columns, Column{
+			Name: d.string(),
+			Type: schema.ColumnType(d.string()),
+		})
+	}
+}
+
+func (m *DataRow) encode(b []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(m.Values)))
+	for _, v := range m.Values {
+		b = appendValue(b, v)
+	}
+	return b
+}
+
+func (m *DataRow) decode(d *decoder) {
+	n := d.count()
+	m.Values = make([][]byte, 0, n)
+	for range n {
+		m.Values = append(m.Values, d.bytes())
+	}
+}
+
+func (m *CopyData) encode(b []byte) []byte {
+	return append(b, m.Data...)
+}
+
+func (m *CopyData) decode(d *decoder) {
+	m.Data = bytes.Clone(d.b)
+	d.b = nil
+}
+
+func (m *CommandComplete) encode(b []byte) []byte {
+	b = appendString(b, m.Tag)
+	return binary.BigEndian.AppendUint64(b, m.Rows)
+}
+
+func (m *CommandComplete) decode(d *decoder) {
+	m.Tag = d.string()
+	m.Rows = d.uint64()
+}
+
+func (m *ErrorResponse) encode(b []byte) []byte {
+	b = appendString(b, m.Code)
+	b = appendString(b, m.Message)
+	return binary.BigEndian.AppendUint32(b, m.Position)
+}
+
+func (m *ErrorResponse) decode(d *decoder) {
+	m.Code = d.string()
+	m.Message = d.string()
+	m.Position = d.uint32()
+}
+
+func (m *ReadyForQuery) encode(b []byte) []byte {
+	return append(b, m.Status)
+}
+
+func (m *ReadyForQuery) decode(d *decoder) {
+	m.Status = d.byte()
+}
+
+// null is the length of null values.
+const null = ^uint32(0)
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+func appendBytes(b []byte, v []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(v)))
+	return append(b, v...)
+}
+
+// appendValue appends v as bytes, or as null if nil.
+func appendValue(b []byte, v []byte) []byte {
+	if v == nil {
+		return binary.BigEndian.AppendUint32(b, null)
+	}
+	return appendBytes(b, v)
+}
+
+// decoder reads the fields of a message, keeping the first error met.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.b) < n {
+		d.err = ErrMalformed
+		return nil
+	}
+	out := d.b[:n]
+	d.b = d.b[n:]
+	return out
+}
+
+func (d *decoder) byte() byte {
+	if b := d.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint64() uint64 {
+	if b := d.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// count reads a number of elements, each taking at least 4 bytes.
+func (d *decoder) count() int {
+	n := d.uint32()
+	if uint64(n)*4 > uint64(len(d.b)) {
+		d.err = ErrMalformed
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.uint32()
+	if n == null {
+		return nil
+	}
+	b := d.next(int(n))
+	if b == nil {
+		return nil
+	}
+	// values are never nil, null ones aside.
+	return append(make([]byte, 0, n), b...)
+}
+
+func (d *decoder) string() string {
+	n := d.uint32()
+	return string(d.next(int(n)))
+}
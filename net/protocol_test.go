@@ -0,0 +1,184 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aliphe/filadb/db/schema"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_Message(t *testing.T) {
+	tests := map[string]Message{
+		"startup":               &Startup{Version: Version, User: "filadb"},
+		"sasl initial response": &SASLInitialResponse{Mechanism: "SCRAM-SHA-256", Data: []byte("n,,n=filadb,r=abc")},
+		"sasl response":         &SASLResponse{Data: []byte("c=biws,r=abcdef,p=proof")},
+		"query":                 &Query{SQL: "SELECT * FROM users;"},
+		"prepare":               &Prepare{Name: "by_id", SQL: "SELECT * FROM users WHERE id = $1"},
+		"execute": &Execute{Name: "by_id", Params: []Param{
+			{Type: schema.ColumnTypeNumber, Value: []byte("1")},
+			{Type: schema.ColumnTypeText, Value: []byte{}},
+			{},
+		}},
+		"parameter description":   &ParameterDescription{Types: []schema.ColumnType{schema.ColumnTypeNumber, ""}},
+		"terminate":               &Terminate{},
+		"authentication sasl":     &AuthenticationSASL{Mechanisms: []string{"SCRAM-SHA-256"}},
+		"authentication continue": &AuthenticationSASLContinue{Data: []byte("r=abcdef,s=c2FsdA==,i=4096")},
+		"authentication final":    &AuthenticationSASLFinal{Data: []byte("v=signature")},
+		"row description": &RowDescription{Columns: []Column{
+			{Name: "id", Type: schema.ColumnTypeNumber},
+			{Name: "email", Type: schema.ColumnTypeText},
+		}},
+		"data row":         &DataRow{Values: [][]byte{[]byte("1"), nil, {}}},
+		"copy data":        &CopyData{Data: []byte("1,a\r\n")},
+		"command complete": &CommandComplete{Tag: "INSERT 2", Rows: 2},
+		"error response":   &ErrorResponse{Code: "42601", Message: "unexpected token", Position: 12},
+		"ready for query":  &ReadyForQuery{Status: 'T'},
+	}
+
+	for name, m := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			if err := WriteMessage(&buf, m); err != nil {
+				t.Fatalf("WriteMessage() error = %v", err)
+			}
+			got, err := ReadMessage(&buf)
+			if err != nil {
+				t.Fatalf("ReadMessage() error = %v", err)
+			}
+
+			if diff := cmp.Diff(m, got); diff != "" {
+				t.Errorf("mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
+
+func Test_ReadMessage_errors(t *testing.T) {
+	tests := map[string]struct {
+		frame []byte
+		want  error
+	}{
+		"empty": {
+			want: ErrMalformed,
+		},
+		"unknown type": {
+			frame: []byte{'?'},
+			want:  ErrUnknownMessage,
+		},
+		"truncated": {
+			frame: []byte{byte(TypeQuery), 0, 0, 0, 9, 'S'},
+			want:  ErrMalformed,
+		},
+		"trailing bytes": {
+			frame: []byte{byte(TypeReadyForQuery), 'I', 'I'},
+			want:  ErrMalformed,
+		},
+		"too many values": {
+			frame: []byte{byte(TypeDataRow), 0xff, 0xff, 0xff, 0xfe},
+			want:  ErrMalformed,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			if err := Write(&buf, tc.frame); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ReadMessage(&buf)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("error = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func Test_Read_tooLong(t *testing.T) {
+	t.Parallel()
+
+	// the length is checked before anything else is read.
+	_, err := Read(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff}))
+	if !errors.Is(err, ErrMalformed) {
+		t.Errorf("error = %v, want %v", err, ErrMalformed)
+	}
+}
+
+func Test_ReadStartupMessage_tooLong(t *testing.T) {
+	t.Parallel()
+
+	var b bytes.Buffer
+	if err := WriteMessage(&b, &Startup{Version: Version, User: strings.Repeat("a", 10000)}); err != nil {
+		t.Fatal(err)
+	}
+	frame := b.Bytes()
+
+	if _, err := ReadStartupMessage(bytes.NewReader(frame)); !errors.Is(err, ErrMalformed) {
+		t.Errorf("ReadStartupMessage() error = %v, want %v", err, ErrMalformed)
+	}
+	// the same message is accepted once the client is authenticated.
+	if _, err := ReadMessage(bytes.NewReader(frame)); err != nil {
+		t.Errorf("ReadMessage() error = %v", err)
+	}
+}
+
+func Test_Format(t *testing.T) {
+	msgs := []Message{
+		&CommandComplete{Tag: "BEGIN"},
+		&RowDescription{Columns: []Column{{Name: "id"}, {Name: "email"}}},
+		&DataRow{Values: [][]byte{[]byte("1"), []byte("a,b@test.com")}},
+		&DataRow{Values: [][]byte{[]byte("2"), nil}},
+		&CommandComplete{Tag: "SELECT 2", Rows: 2},
+		&CopyData{Data: []byte("1\r\n")},
+		&CommandComplete{Tag: "COPY 1", Rows: 1},
+		&ErrorResponse{Code: "25P02", Message: "current transaction is aborted"},
+	}
+	want := "BEGIN\nid,email\n1,\"a,b@test.com\"\n2,NULL\n1\r\n\nERROR: current transaction is aborted (SQLSTATE 25P02)"
+
+	if diff := cmp.Diff(want, Format(msgs)); diff != "" {
+		t.Errorf("mismatch (-want,+got): %s", diff)
+	}
+}
+
+func Test_Param(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		given   any
+		want    any
+		wantErr error
+	}{
+		"number": {given: int32(-4), want: int64(-4)},
+		"text":   {given: "it's", want: "it's"},
+		"bytes":  {given: []byte("ab"), want: "ab"},
+		"null":   {given: nil, want: nil},
+		"float":  {given: 1.5, wantErr: ErrUnsupportedType},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := NewParam(tc.given)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("NewParam() error = %v, want %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got, err := p.Decode()
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
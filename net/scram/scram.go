@@ -0,0 +1,316 @@
+// Package scram implements the SCRAM-SHA-256 authentication mechanism of
+// RFC 7677, without channel binding. Passwords are used as is, without
+// SASLprep normalization.
+package scram
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Mechanism is the name of the SASL mechanism.
+const Mechanism = "SCRAM-SHA-256"
+
+// Iterations is the number of iterations of the key derivation of new
+// credentials.
+const Iterations = 4096
+
+const (
+	saltLen  = 16
+	nonceLen = 18
+)
+
+var (
+	ErrMalformed  = errors.New("malformed scram message")
+	ErrAuthFailed = errors.New("authentication failed")
+)
+
+// Credentials are what servers keep of a password, which is enough to check
+// it but not to recover it.
+type Credentials struct {
+	Salt       []byte
+	Iterations int
+	StoredKey  []byte
+	ServerKey  []byte
+}
+
+// NewCredentials derives the credentials of a password, with a random salt.
+func NewCredentials(password string) (Credentials, error) {
+	salt := make([]byte, saltLen)
+	rand.Read(salt)
+	return derive(password, salt, Iterations)
+}
+
+func derive(password string, salt []byte, iterations int) (Credentials, error) {
+	salted, err := pbkdf2.Key(sha256.New, password, salt, iterations, sha256.Size)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("derive key: %w", err)
+	}
+	stored := sha256.Sum256(mac(salted, "Client Key"))
+	return Credentials{
+		Salt:       salt,
+		Iterations: iterations,
+		StoredKey:  stored[:],
+		ServerKey:  mac(salted, "Server Key"),
+	}, nil
+}
+
+// Verify tells whether the credentials are those of the password, for the
+// clients sending it as is rather than through a conversation.
+func (c Credentials) Verify(password string) bool {
+	d, err := derive(password, c.Salt, c.Iterations)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(d.StoredKey, c.StoredKey)
+}
+
+// String encodes the credentials as PostgreSQL does, as
+// SCRAM-SHA-256$<iterations>:<salt>$<stored key>:<server key>.
+func (c Credentials) String() string {
+	b64 := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("%s$%d:%s$%s:%s", Mechanism, c.Iterations, b64(c.Salt), b64(c.StoredKey), b64(c.ServerKey))
+}
+
+// ParseCredentials decodes credentials encoded by Credentials.String.
+func ParseCredentials(s string) (Credentials, error) {
+	parts := strings.Split(s, "$")
+	if len(parts) != 3 || parts[0] != Mechanism {
+		return Credentials{}, ErrMalformed
+	}
+	iter, salt, ok1 := strings.Cut(parts[1], ":")
+	stored, server, ok2 := strings.Cut(parts[2], ":")
+	if !ok1 || !ok2 {
+		return Credentials{}, ErrMalformed
+	}
+
+	var c Credentials
+	var err error
+	if c.Iterations, err = strconv.Atoi(iter); err != nil || c.Iterations < 1 {
+		return Credentials{}, ErrMalformed
+	}
+	for _, f := range []struct {
+		dst *[]byte
+		s   string
+	}{{&c.Salt, salt}, {&c.StoredKey, stored}, {&c.ServerKey, server}} {
+		if *f.dst, err = base64.StdEncoding.DecodeString(f.s); err != nil {
+			return Credentials{}, ErrMalformed
+		}
+	}
+	if len(c.StoredKey) != sha256.Size || len(c.ServerKey) != sha256.Size {
+		return Credentials{}, ErrMalformed
+	}
+	return c, nil
+}
+
+func mac(key []byte, msg string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(msg))
+	return h.Sum(nil)
+}
+
+func nonce() string {
+	b := make([]byte, nonceLen)
+	rand.Read(b)
+	return base64.RawStdEncoding.EncodeToString(b)
+}
+
+// attributes parses the comma separated attributes of a message, such as
+// r=nonce, which must start with the given names, in order.
+func attributes(msg string, names ...byte) ([]string, error) {
+	parts := strings.Split(msg, ",")
+	if len(parts) < len(names) {
+		return nil, ErrMalformed
+	}
+	out := make([]string, 0, len(names))
+	for i, n := range names {
+		if len(parts[i]) < 2 || parts[i][0] != n || parts[i][1] != '=' {
+			return nil, ErrMalformed
+		}
+		out = append(out, parts[i][2:])
+	}
+	return out, nil
+}
+
+// Client is the client side of a conversation.
+type Client struct {
+	user, password string
+	nonce          string
+	first          string
+	serverSig      []byte
+}
+
+func NewClient(user, password string) *Client {
+	return newClient(user, password, nonce())
+}
+
+func newClient(user, password, nonce string) *Client {
+	return &Client{user: user, password: password, nonce: nonce}
+}
+
+// gs2Header tells servers that clients do not support channel binding.
+const gs2Header = "n,,"
+
+// First returns the first message of the client.
+func (c *Client) First() []byte {
+	name := strings.NewReplacer("=", "=3D", ",", "=2C").Replace(c.user)
+	c.first = "n=" + name + ",r=" + c.nonce
+	return []byte(gs2Header + c.first)
+}
+
+// Final returns the final message of the client, answering the first
+// message of the server.
+func (c *Client) Final(serverFirst []byte) ([]byte, error) {
+	attrs, err := attributes(string(serverFirst), 'r', 's', 'i')
+	if err != nil {
+		return nil, err
+	}
+	nonce, salt64, iter := attrs[0], attrs[1], attrs[2]
+	if !strings.HasPrefix(nonce, c.nonce) || len(nonce) == len(c.nonce) {
+		return nil, fmt.Errorf("server nonce: %w", ErrMalformed)
+	}
+	salt, err := base64.StdEncoding.DecodeString(salt64)
+	if err != nil {
+		return nil, fmt.Errorf("salt: %w", ErrMalformed)
+	}
+	iterations, err := strconv.Atoi(iter)
+	if err != nil || iterations < 1 {
+		return nil, fmt.Errorf("iterations: %w", ErrMalformed)
+	}
+
+	salted, err := pbkdf2.Key(sha256.New, c.password, salt, iterations, sha256.Size)
+	if err != nil {
+		return nil, fmt.Errorf("derive key: %w", err)
+	}
+	clientKey := mac(salted, "Client Key")
+	stored := sha256.Sum256(clientKey)
+
+	final := "c=" + base64.StdEncoding.EncodeToString([]byte(gs2Header)) + ",r=" + nonce
+	auth := c.first + "," + string(serverFirst) + "," + final
+	proof := mac(stored[:], auth)
+	subtle.XORBytes(proof, proof, clientKey)
+	c.serverSig = mac(mac(salted, "Server Key"), auth)
+
+	return []byte(final + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+}
+
+// Verify checks the final message of the server, which proves that it knows
+// the credentials of the user.
+func (c *Client) Verify(serverFinal []byte) error {
+	msg := string(serverFinal)
+	if e, ok := strings.CutPrefix(msg, "e="); ok {
+		return fmt.Errorf("%s: %w", e, ErrAuthFailed)
+	}
+	attrs, err := attributes(msg, 'v')
+	if err != nil {
+		return err
+	}
+	sig, err := base64.StdEncoding.DecodeString(attrs[0])
+	if err != nil || !hmac.Equal(sig, c.serverSig) {
+		return fmt.Errorf("server signature: %w", ErrAuthFailed)
+	}
+	return nil
+}
+
+// Server is the server side of a conversation.
+type Server struct {
+	creds Credentials
+	// known tells whether the credentials are the user's.
+	known bool
+	nonce string
+
+	header      string
+	clientFirst string
+	serverFirst string
+}
+
+// NewServer starts the conversation of a server holding the credentials of
+// the user, or nil if there are none. The conversation of users without
+// credentials fails at the same step as with a wrong password, so that
+// clients cannot tell which users exist.
+func NewServer(creds *Credentials) *Server {
+	return newServer(creds, nonce())
+}
+
+func newServer(creds *Credentials, nonce string) *Server {
+	s := &Server{nonce: nonce}
+	if creds != nil {
+		s.creds, s.known = *creds, true
+	} else {
+		salt := make([]byte, saltLen)
+		rand.Read(salt)
+		s.creds = Credentials{Salt: salt, Iterations: Iterations}
+	}
+	return s
+}
+
+// First returns the first message of the server, answering the first
+// message of the client.
+func (s *Server) First(clientFirst []byte) ([]byte, error) {
+	// clients supporting channel binding send y,, instead.
+	for _, h := range []string{gs2Header, "y,,"} {
+		if bare, ok := strings.CutPrefix(string(clientFirst), h); ok {
+			s.header, s.clientFirst = h, bare
+		}
+	}
+	if s.header == "" {
+		return nil, fmt.Errorf("gs2 header: %w", ErrMalformed)
+	}
+
+	attrs, err := attributes(s.clientFirst, 'n', 'r')
+	if err != nil {
+		return nil, err
+	}
+	if attrs[1] == "" {
+		return nil, fmt.Errorf("client nonce: %w", ErrMalformed)
+	}
+
+	s.nonce = attrs[1] + s.nonce
+	s.serverFirst = fmt.Sprintf("r=%s,s=%s,i=%d", s.nonce, base64.StdEncoding.EncodeToString(s.creds.Salt), s.creds.Iterations)
+	return []byte(s.serverFirst), nil
+}
+
+// Final checks the proof of the final message of the client, and returns
+// the final message of the server. It fails with ErrAuthFailed if the
+// client does not know the password.
+func (s *Server) Final(clientFinal []byte) ([]byte, error) {
+	msg := string(clientFinal)
+	i := strings.LastIndex(msg, ",p=")
+	if i < 0 {
+		return nil, fmt.Errorf("client proof: %w", ErrMalformed)
+	}
+	final, proof64 := msg[:i], msg[i+len(",p="):]
+
+	attrs, err := attributes(final, 'c', 'r')
+	if err != nil {
+		return nil, err
+	}
+	if attrs[0] != base64.StdEncoding.EncodeToString([]byte(s.header)) {
+		return nil, fmt.Errorf("channel binding: %w", ErrMalformed)
+	}
+	if attrs[1] != s.nonce {
+		return nil, fmt.Errorf("nonce: %w", ErrAuthFailed)
+	}
+	proof, err := base64.StdEncoding.DecodeString(proof64)
+	if err != nil || len(proof) != sha256.Size {
+		return nil, fmt.Errorf("client proof: %w", ErrMalformed)
+	}
+
+	auth := s.clientFirst + "," + s.serverFirst + "," + final
+	clientKey := mac(s.creds.StoredKey, auth)
+	subtle.XORBytes(clientKey, clientKey, proof)
+	stored := sha256.Sum256(clientKey)
+	if !s.known || subtle.ConstantTimeCompare(stored[:], s.creds.StoredKey) != 1 {
+		return nil, ErrAuthFailed
+	}
+
+	return []byte("v=" + base64.StdEncoding.EncodeToString(mac(s.creds.ServerKey, auth))), nil
+}
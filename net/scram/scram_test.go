@@ -0,0 +1,166 @@
+package scram
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Test_conversation follows the example of RFC 7677.
+func Test_conversation(t *testing.T) {
+	t.Parallel()
+
+	salt, _ := base64.StdEncoding.DecodeString("W22ZaJ0SNY7soEsUEjb6gQ==")
+	creds, err := derive("pencil", salt, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newClient("user", "pencil", "rOprNGfwEbeRWgbNEkqO")
+	s := newServer(&creds, "%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0")
+
+	steps := []struct {
+		got  func() ([]byte, error)
+		want string
+	}{
+		{
+			got:  func() ([]byte, error) { return c.First(), nil },
+			want: "n,,n=user,r=rOprNGfwEbeRWgbNEkqO",
+		},
+		{
+			got:  func() ([]byte, error) { return s.First(c.First()) },
+			want: "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+		},
+		{
+			got: func() ([]byte, error) {
+				return c.Final([]byte("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"))
+			},
+			want: "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+		},
+		{
+			got: func() ([]byte, error) {
+				return s.Final([]byte("c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="))
+			},
+			want: "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=",
+		},
+	}
+	for _, step := range steps {
+		got, err := step.got()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(step.want, string(got)); diff != "" {
+			t.Fatalf("message mismatch (-want,+got): %s", diff)
+		}
+	}
+
+	if err := c.Verify([]byte("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_authenticate(t *testing.T) {
+	t.Parallel()
+
+	creds, err := NewCredentials("pencil")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		creds    *Credentials
+		password string
+		wantErr  error
+	}{
+		"valid password": {
+			creds:    &creds,
+			password: "pencil",
+		},
+		"wrong password": {
+			creds:    &creds,
+			password: "pen",
+			wantErr:  ErrAuthFailed,
+		},
+		"unknown user": {
+			password: "pencil",
+			wantErr:  ErrAuthFailed,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c := NewClient("user", tc.password)
+			s := NewServer(tc.creds)
+
+			first, err := s.First(c.First())
+			if err != nil {
+				t.Fatal(err)
+			}
+			final, err := c.Final(first)
+			if err != nil {
+				t.Fatal(err)
+			}
+			serverFinal, err := s.Final(final)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Final() error = %v, want %v", err, tc.wantErr)
+			}
+			if err == nil {
+				if err := c.Verify(serverFinal); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func Test_ParseCredentials(t *testing.T) {
+	t.Parallel()
+
+	creds, err := NewCredentials("pencil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseCredentials(creds.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(creds, got); diff != "" {
+		t.Fatalf("ParseCredentials() mismatch (-want,+got): %s", diff)
+	}
+
+	for _, s := range []string{"pencil", "SCRAM-SHA-256$0:c2FsdA==$a2V5:a2V5", "MD5$4096:c2FsdA==$a2V5:a2V5"} {
+		if _, err := ParseCredentials(s); !errors.Is(err, ErrMalformed) {
+			t.Errorf("ParseCredentials(%q) error = %v, want %v", s, err, ErrMalformed)
+		}
+	}
+}
+
+func Test_Credentials_Verify(t *testing.T) {
+	t.Parallel()
+
+	creds, err := NewCredentials("pencil")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		password string
+		want     bool
+	}{
+		"right password": {password: "pencil", want: true},
+		"wrong password": {password: "eraser", want: false},
+		"empty password": {password: "", want: false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if got := creds.Verify(tc.password); got != tc.want {
+				t.Errorf("Verify() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package query
+
+import (
+	"context"
+	"io"
+)
+
+// CopyOut sends the output of COPY TO STDOUT to a client as it is written,
+// a chunk per Write.
+type CopyOut interface {
+	// Begin is called before the output is written.
+	Begin() error
+	io.Writer
+	// End is called once the whole output was written.
+	End() error
+}
+
+type copyOutKey struct{}
+
+// WithCopyOut returns a copy of ctx whose COPY TO STDOUT statements stream
+// their output to out, instead of holding it in Result.Data.
+func WithCopyOut(ctx context.Context, out CopyOut) context.Context {
+	return context.WithValue(ctx, copyOutKey{}, out)
+}
+
+// CopyOutFromContext returns the CopyOut carried by ctx, if any.
+func CopyOutFromContext(ctx context.Context) (CopyOut, bool) {
+	out, ok := ctx.Value(copyOutKey{}).(CopyOut)
+	return out, ok
+}
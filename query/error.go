@@ -0,0 +1,49 @@
+package query
+
+// Code classifies errors, using the SQLSTATE codes of the SQL standard.
+type Code string
+
+const (
+	CodeSyntaxError           Code = "42601"
+	CodeUndefinedTable        Code = "42P01"
+	CodeUndefinedColumn       Code = "42703"
+	CodeAmbiguousColumn       Code = "42702"
+	CodeReservedName          Code = "42939"
+	CodeDatatypeMismatch      Code = "42804"
+	CodeInvalidValue          Code = "22P02"
+	CodeUniqueViolation       Code = "23505"
+	CodeActiveTransaction     Code = "25001"
+	CodeNoActiveTransaction   Code = "25P01"
+	CodeInFailedTransaction   Code = "25P02"
+	CodeSerializationFailure  Code = "40001"
+	CodeProtocolViolation     Code = "08P01"
+	CodeFeatureNotSupported   Code = "0A000"
+	CodeDuplicateObject       Code = "42710"
+	CodeUndefinedObject       Code = "42704"
+	CodeInvalidPassword       Code = "28P01"
+	CodeInvalidAuthorization  Code = "28000"
+	CodeInsufficientPrivilege Code = "42501"
+	CodeInvalidGrantOperation Code = "0LP01"
+
+	CodeDuplicatePreparedStatement Code = "42P05"
+	CodeInvalidStatementName       Code = "26000"
+	CodeInvalidCursorName          Code = "34000"
+
+	CodeInternal Code = "XX000"
+)
+
+// Error is an error raised running a query.
+type Error struct {
+	Code Code
+	// Position is the 1-based offset in the query of the error, 0 if unknown.
+	Position int
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
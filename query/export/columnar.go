@@ -0,0 +1,266 @@
+package export
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/aliphe/filadb/db/schema"
+)
+
+// Columnar files are laid out as
+//
+//	magic | column count | columns | row groups | 0
+//
+// where each column is its name and a type byte, 'n' for numbers and 't' for
+// texts. A row group is its row count, then each column in turn: a bitmap
+// with a bit set for each null value, then the other values. Numbers take 8
+// bytes, big-endian, and texts are prefixed with their length.
+//
+// Counts and lengths are uvarints.
+const (
+	columnarMagic = "FILACOL\x01"
+
+	// groupRows is the number of rows a writer buffers before writing a group.
+	groupRows = 1024
+
+	typeNumber byte = 'n'
+	typeText   byte = 't'
+)
+
+var ErrCorruptColumnar = errors.New("corrupt columnar file")
+
+type columnarWriter struct {
+	w     *bufio.Writer
+	cols  []Column
+	group [][]any
+	rows  int
+}
+
+func newColumnar(w io.Writer, cols []Column) (*columnarWriter, error) {
+	c := &columnarWriter{
+		w:     bufio.NewWriter(w),
+		cols:  cols,
+		group: make([][]any, len(cols)),
+	}
+
+	head := []byte(columnarMagic)
+	head = binary.AppendUvarint(head, uint64(len(cols)))
+	for _, col := range cols {
+		head = appendText(head, col.Name)
+		head = append(head, columnType(col.Type))
+	}
+	if _, err := c.w.Write(head); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func columnType(t schema.ColumnType) byte {
+	if t == schema.ColumnTypeNumber {
+		return typeNumber
+	}
+	return typeText
+}
+
+func (c *columnarWriter) Write(row []any) error {
+	for i, v := range row {
+		c.group[i] = append(c.group[i], v)
+	}
+	c.rows++
+	if c.rows == groupRows {
+		return c.flush()
+	}
+	return nil
+}
+
+// flush writes the buffered rows as a group.
+func (c *columnarWriter) flush() error {
+	if c.rows == 0 {
+		return nil
+	}
+
+	buf := binary.AppendUvarint(nil, uint64(c.rows))
+	for i, col := range c.cols {
+		vals := c.group[i]
+		bitmap := len(buf)
+		buf = append(buf, make([]byte, (len(vals)+7)/8)...)
+		for j, v := range vals {
+			if v == nil {
+				buf[bitmap+j/8] |= 1 << (j % 8)
+				continue
+			}
+
+			if columnType(col.Type) == typeText {
+				buf = appendText(buf, fmt.Sprint(v))
+				continue
+			}
+			n, ok := number(v)
+			if !ok {
+				return fmt.Errorf("column %s: %T is not a number", col.Name, v)
+			}
+			buf = binary.BigEndian.AppendUint64(buf, uint64(n))
+		}
+		c.group[i] = vals[:0]
+	}
+	c.rows = 0
+
+	_, err := c.w.Write(buf)
+	return err
+}
+
+func (c *columnarWriter) Close() error {
+	if err := c.flush(); err != nil {
+		return err
+	}
+	if err := c.w.WriteByte(0); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+func appendText(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func number(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	default:
+		return 0, false
+	}
+}
+
+// ColumnarReader reads the rows of a columnar file.
+type ColumnarReader struct {
+	r     *bufio.Reader
+	cols  []Column
+	group [][]any
+	next  int
+}
+
+func NewColumnarReader(r io.Reader) (*ColumnarReader, error) {
+	c := &ColumnarReader{r: bufio.NewReader(r)}
+
+	magic := make([]byte, len(columnarMagic))
+	if _, err := io.ReadFull(c.r, magic); err != nil || string(magic) != columnarMagic {
+		return nil, fmt.Errorf("magic: %w", ErrCorruptColumnar)
+	}
+
+	n, err := c.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	for range n {
+		name, err := c.text()
+		if err != nil {
+			return nil, err
+		}
+		t, err := c.r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("column type: %w", ErrCorruptColumnar)
+		}
+		col := Column{Name: name, Type: schema.ColumnTypeText}
+		if t == typeNumber {
+			col.Type = schema.ColumnTypeNumber
+		}
+		c.cols = append(c.cols, col)
+	}
+	return c, nil
+}
+
+// Columns describes the columns of the file.
+func (c *ColumnarReader) Columns() []Column {
+	return c.cols
+}
+
+// Read returns the next row, or io.EOF once every row was read.
+// Numbers are read as int64.
+func (c *ColumnarReader) Read() ([]any, error) {
+	if len(c.group) == 0 || c.next == len(c.group[0]) {
+		if err := c.readGroup(); err != nil {
+			return nil, err
+		}
+	}
+
+	row := make([]any, len(c.cols))
+	for i := range c.cols {
+		row[i] = c.group[i][c.next]
+	}
+	c.next++
+	return row, nil
+}
+
+func (c *ColumnarReader) readGroup() error {
+	rows, err := c.uvarint()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return io.EOF
+	}
+	if len(c.cols) == 0 {
+		return fmt.Errorf("rows without columns: %w", ErrCorruptColumnar)
+	}
+
+	c.group = make([][]any, len(c.cols))
+	c.next = 0
+	for i, col := range c.cols {
+		bitmap := make([]byte, (rows+7)/8)
+		if _, err := io.ReadFull(c.r, bitmap); err != nil {
+			return fmt.Errorf("null bitmap: %w", ErrCorruptColumnar)
+		}
+
+		vals := make([]any, rows)
+		for j := range vals {
+			if bitmap[j/8]&(1<<(j%8)) != 0 {
+				continue
+			}
+			if col.Type == schema.ColumnTypeText {
+				if vals[j], err = c.text(); err != nil {
+					return err
+				}
+				continue
+			}
+			var b [8]byte
+			if _, err := io.ReadFull(c.r, b[:]); err != nil {
+				return fmt.Errorf("number: %w", ErrCorruptColumnar)
+			}
+			vals[j] = int64(binary.BigEndian.Uint64(b[:]))
+		}
+		c.group[i] = vals
+	}
+	return nil
+}
+
+func (c *ColumnarReader) uvarint() (uint64, error) {
+	n, err := binary.ReadUvarint(c.r)
+	if err != nil {
+		return 0, fmt.Errorf("length: %w", ErrCorruptColumnar)
+	}
+	return n, nil
+}
+
+func (c *ColumnarReader) text() (string, error) {
+	n, err := c.uvarint()
+	if err != nil {
+		return "", err
+	}
+	if n > math.MaxInt32 {
+		return "", fmt.Errorf("text length %d: %w", n, ErrCorruptColumnar)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(c.r, b); err != nil {
+		return "", fmt.Errorf("text: %w", ErrCorruptColumnar)
+	}
+	return string(b), nil
+}
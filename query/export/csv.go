@@ -0,0 +1,76 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// csvWriter writes RFC 4180 CSV: lines end with CRLF, and fields holding a
+// comma, a quote or a line break are quoted. Null values are empty fields,
+// while empty texts are quoted, so that both can be told apart.
+type csvWriter struct {
+	w *bufio.Writer
+}
+
+func newCSV(w io.Writer, cols []Column, header bool) (*csvWriter, error) {
+	c := &csvWriter{
+		w: bufio.NewWriter(w),
+	}
+
+	if header {
+		row := make([]any, 0, len(cols))
+		for _, col := range cols {
+			row = append(row, col.Name)
+		}
+		if err := c.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *csvWriter) Write(row []any) error {
+	for i, v := range row {
+		if i > 0 {
+			c.w.WriteByte(',')
+		}
+		if v != nil {
+			c.field(fmt.Sprint(v))
+		}
+	}
+	_, err := c.w.WriteString("\r\n")
+	return err
+}
+
+func (c *csvWriter) field(f string) {
+	if !quoted(f) {
+		c.w.WriteString(f)
+		return
+	}
+
+	c.w.WriteByte('"')
+	for _, r := range f {
+		switch r {
+		case '"':
+			c.w.WriteString(`""`)
+		case '\n':
+			c.w.WriteString("\r\n")
+		case '\r':
+		default:
+			c.w.WriteRune(r)
+		}
+	}
+	c.w.WriteByte('"')
+}
+
+// quoted tells whether the field must be quoted, as encoding/csv does, and
+// when it is empty.
+func quoted(f string) bool {
+	return f == "" || f == `\.` || strings.ContainsAny(f, ",\"\r\n") || f[0] == ' ' || f[0] == '\t'
+}
+
+func (c *csvWriter) Close() error {
+	return c.w.Flush()
+}
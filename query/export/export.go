@@ -0,0 +1,66 @@
+// Package export writes query results to files, one row at a time.
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aliphe/filadb/db/schema"
+)
+
+type Format string
+
+const (
+	FormatCSV      Format = "csv"
+	FormatJSONL    Format = "jsonl"
+	FormatColumnar Format = "columnar"
+)
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Column describes a column of the exported rows.
+type Column struct {
+	Name string
+	Type schema.ColumnType
+}
+
+// Writer encodes rows to an underlying writer as they are written.
+type Writer interface {
+	// Write encodes a row, holding a value for each column. Nil values are null.
+	Write(row []any) error
+	// Close flushes the rows left buffered, without closing the underlying writer.
+	Close() error
+}
+
+type options struct {
+	header bool
+}
+
+type Option func(*options)
+
+// WithHeader starts CSV files with a line naming the columns.
+func WithHeader() Option {
+	return func(o *options) {
+		o.header = true
+	}
+}
+
+// New returns a Writer encoding rows of the given columns in format.
+func New(format Format, w io.Writer, cols []Column, opts ...Option) (Writer, error) {
+	var opt options
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	switch format {
+	case FormatCSV:
+		return newCSV(w, cols, opt.header)
+	case FormatJSONL:
+		return newJSONL(w, cols), nil
+	case FormatColumnar:
+		return newColumnar(w, cols)
+	default:
+		return nil, fmt.Errorf("%s: %w", format, ErrUnknownFormat)
+	}
+}
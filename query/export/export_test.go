@@ -0,0 +1,202 @@
+package export_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/aliphe/filadb/db/schema"
+	"github.com/aliphe/filadb/query/export"
+	"github.com/google/go-cmp/cmp"
+)
+
+var cols = []export.Column{
+	{Name: "id", Type: schema.ColumnTypeNumber},
+	{Name: "name", Type: schema.ColumnTypeText},
+}
+
+func Test_Writer(t *testing.T) {
+	tests := map[string]struct {
+		format export.Format
+		opts   []export.Option
+		rows   [][]any
+		want   string
+	}{
+		"csv": {
+			format: export.FormatCSV,
+			rows: [][]any{
+				{int32(1), "plain"},
+				{int32(2), "a,b"},
+				{int32(3), `say "hi"`},
+				{nil, "two\nlines"},
+				{int32(4), ""},
+				{int32(5), nil},
+			},
+			want: "1,plain\r\n2,\"a,b\"\r\n3,\"say \"\"hi\"\"\"\r\n,\"two\r\nlines\"\r\n4,\"\"\r\n5,\r\n",
+		},
+		"csv with header": {
+			format: export.FormatCSV,
+			opts:   []export.Option{export.WithHeader()},
+			rows:   [][]any{{int32(1), "a"}},
+			want:   "id,name\r\n1,a\r\n",
+		},
+		"jsonl": {
+			format: export.FormatJSONL,
+			rows: [][]any{
+				{int32(1), "a,b"},
+				{int32(2), nil},
+			},
+			want: "{\"id\":1,\"name\":\"a,b\"}\n{\"id\":2,\"name\":null}\n",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			w, err := export.New(tc.format, &buf, cols, tc.opts...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			for _, r := range tc.rows {
+				if err := w.Write(r); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			if diff := cmp.Diff(tc.want, buf.String()); diff != "" {
+				t.Errorf("mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
+
+func Test_Columnar(t *testing.T) {
+	tests := map[string]struct {
+		rows [][]any
+		want [][]any
+	}{
+		"empty": {},
+		"values and nulls": {
+			rows: [][]any{
+				{int32(1), "a"},
+				{nil, "b"},
+				{int32(-3), nil},
+			},
+			want: [][]any{
+				{int64(1), "a"},
+				{nil, "b"},
+				{int64(-3), nil},
+			},
+		},
+		"several groups": {
+			rows: rows(2500),
+			want: func() [][]any {
+				want := rows(2500)
+				for _, r := range want {
+					r[0] = int64(r[0].(int32))
+				}
+				return want
+			}(),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			w, err := export.New(export.FormatColumnar, &buf, cols)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			for _, r := range tc.rows {
+				if err := w.Write(r); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			r, err := export.NewColumnarReader(&buf)
+			if err != nil {
+				t.Fatalf("NewColumnarReader() error = %v", err)
+			}
+			if diff := cmp.Diff(cols, r.Columns()); diff != "" {
+				t.Errorf("columns mismatch (-want,+got): %s", diff)
+			}
+			var got [][]any
+			for {
+				row, err := r.Read()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Read() error = %v", err)
+				}
+				got = append(got, row)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
+
+func Test_Columnar_corrupt(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := export.New(export.FormatColumnar, &buf, cols)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := w.Write([]any{int32(1), "some text"}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	tests := map[string][]byte{
+		"bad magic": append([]byte("NOTACOL!"), buf.Bytes()[8:]...),
+		"truncated": buf.Bytes()[:buf.Len()-4],
+	}
+
+	for name, b := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r, err := export.NewColumnarReader(bytes.NewReader(b))
+			for err == nil {
+				_, err = r.Read()
+			}
+			if !errors.Is(err, export.ErrCorruptColumnar) {
+				t.Errorf("error = %v, want %v", err, export.ErrCorruptColumnar)
+			}
+		})
+	}
+}
+
+func Test_New_unknownFormat(t *testing.T) {
+	_, err := export.New("xml", io.Discard, cols)
+	if !errors.Is(err, export.ErrUnknownFormat) {
+		t.Errorf("error = %v, want %v", err, export.ErrUnknownFormat)
+	}
+}
+
+func rows(n int) [][]any {
+	rows := make([][]any, 0, n)
+	for i := range n {
+		var name any
+		if i%7 != 0 {
+			name = string(rune('a' + i%26))
+		}
+		rows = append(rows, []any{int32(i), name})
+	}
+	return rows
+}
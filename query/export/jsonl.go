@@ -0,0 +1,49 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonlWriter writes a JSON object per line, with keys in column order.
+type jsonlWriter struct {
+	w    *bufio.Writer
+	keys [][]byte
+}
+
+func newJSONL(w io.Writer, cols []Column) *jsonlWriter {
+	keys := make([][]byte, 0, len(cols))
+	for _, c := range cols {
+		// names of columns are plain strings, which always marshal.
+		k, _ := json.Marshal(c.Name)
+		keys = append(keys, k)
+	}
+	return &jsonlWriter{
+		w:    bufio.NewWriter(w),
+		keys: keys,
+	}
+}
+
+func (j *jsonlWriter) Write(row []any) error {
+	j.w.WriteByte('{')
+	for i, v := range row {
+		if i > 0 {
+			j.w.WriteByte(',')
+		}
+		val, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", j.keys[i], err)
+		}
+		j.w.Write(j.keys[i])
+		j.w.WriteByte(':')
+		j.w.Write(val)
+	}
+	j.w.WriteByte('}')
+	return j.w.WriteByte('\n')
+}
+
+func (j *jsonlWriter) Close() error {
+	return j.w.Flush()
+}
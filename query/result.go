@@ -0,0 +1,34 @@
+package query
+
+import "github.com/aliphe/filadb/db/schema"
+
+// Result is the outcome of a statement.
+type Result struct {
+	// Columns describes the rows the statement returned, nil when it returns none.
+	Columns []Column
+	Rows    [][]any
+	// Data holds the output of COPY TO STDOUT, unless it was streamed to the
+	// CopyOut of the context.
+	Data []byte
+	// Tag names the command, followed by the number of rows it affected if
+	// any, such as "INSERT 2".
+	Tag string
+	// RowCount is the number of rows the statement returned or affected.
+	RowCount int
+}
+
+type Column struct {
+	Name string
+	Type schema.ColumnType
+}
+
+// TxStatus tells whether a session is in a transaction block.
+type TxStatus byte
+
+const (
+	TxIdle   TxStatus = 'I'
+	TxActive TxStatus = 'T'
+	// TxFailed is a transaction block in which a statement failed, which
+	// rejects statements until it ends.
+	TxFailed TxStatus = 'E'
+)
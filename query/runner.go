@@ -2,8 +2,58 @@ package query
 
 import (
 	"context"
+
+	"github.com/aliphe/filadb/db/object"
+	"github.com/aliphe/filadb/db/schema"
+	"github.com/aliphe/filadb/net/scram"
 )
 
 type Runner interface {
-	Run(context.Context, string) ([]byte, error)
+	Run(context.Context, string) (*Result, error)
+}
+
+// SessionRunner opens sessions, which keep state such as an open transaction
+// between the queries they run.
+type SessionRunner interface {
+	// Session opens a session running queries with the privileges of the
+	// user, or with every privilege if the user is empty.
+	Session(user string) Session
+	// Credentials returns the credentials the user authenticates with,
+	// failing with system.ErrUnknownRole if there is no such user.
+	Credentials(ctx context.Context, user string) (scram.Credentials, error)
+}
+
+type Session interface {
+	Runner
+	// Prepare parses and validates expr, a statement which may hold
+	// placeholders, and keeps it as the prepared statement name until the
+	// session closes. The unnamed statement "" is replaced by each Prepare,
+	// while named ones must be deallocated first.
+	Prepare(ctx context.Context, name, expr string) (*Statement, error)
+	// Execute runs the prepared statement name, with the arguments bound to
+	// its placeholders in order.
+	Execute(ctx context.Context, name string, args ...any) (*Result, error)
+	// Deallocate drops the prepared statement name.
+	Deallocate(name string) error
+	Status() TxStatus
+	// Close releases the session, rolling back any transaction left open.
+	Close(context.Context) error
+}
+
+// Statement describes a prepared statement.
+type Statement struct {
+	// Params are the types of the parameters of the statement, empty for
+	// those whose type could not be told.
+	Params []schema.ColumnType
+	// Columns describes the rows the statement returns, nil if it returns
+	// none.
+	Columns []Column
+}
+
+// Catalog describes the tables of the database, as users may see them.
+type Catalog interface {
+	// Tables lists the tables the user may select from.
+	Tables(ctx context.Context, user string) ([]object.Table, error)
+	// Schema returns the schema of a table the user may select from.
+	Schema(ctx context.Context, user string, t object.Table) (*schema.Schema, error)
 }
@@ -0,0 +1,70 @@
+package query
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Assign copies a value of a row into the value dst points to, which is a
+// string, []byte, int, int32, int64, any or sql.Scanner value. Only any and
+// sql.Scanner destinations accept null values.
+func Assign(dst any, v any) error {
+	switch d := dst.(type) {
+	case *any:
+		*d = v
+		return nil
+	case sql.Scanner:
+		return d.Scan(v)
+	}
+	if v == nil {
+		return fmt.Errorf("cannot scan null into %T", dst)
+	}
+
+	switch d := dst.(type) {
+	case *string:
+		*d = fmt.Sprint(v)
+	case *[]byte:
+		*d = fmt.Append(nil, v)
+	case *int64:
+		n, err := toInt(v, math.MinInt64, math.MaxInt64)
+		*d = n
+		return err
+	case *int:
+		n, err := toInt(v, math.MinInt, math.MaxInt)
+		*d = int(n)
+		return err
+	case *int32:
+		n, err := toInt(v, math.MinInt32, math.MaxInt32)
+		*d = int32(n)
+		return err
+	default:
+		return fmt.Errorf("unsupported destination %T", dst)
+	}
+	return nil
+}
+
+// toInt returns v as a number between lo and hi.
+func toInt(v any, lo, hi int64) (int64, error) {
+	var n int64
+	switch v := v.(type) {
+	case int32:
+		n = int64(v)
+	case int:
+		n = int64(v)
+	case int64:
+		n = v
+	case string:
+		var err error
+		if n, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return 0, fmt.Errorf("cannot scan %q into a number", v)
+		}
+	default:
+		return 0, fmt.Errorf("cannot scan %T into a number", v)
+	}
+	if n < lo || n > hi {
+		return 0, fmt.Errorf("%d is out of range", n)
+	}
+	return n, nil
+}
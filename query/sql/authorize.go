@@ -0,0 +1,124 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aliphe/filadb/db/object"
+	"github.com/aliphe/filadb/db/system"
+	"github.com/aliphe/filadb/query/sql/parser"
+)
+
+// requirement is a privilege a query needs on a table.
+type requirement struct {
+	table     object.Table
+	privilege system.Privilege
+}
+
+// authorize checks that the user may run q. The empty user, of the sessions
+// opened in process, may run anything, as may superusers.
+func (r *Runner) authorize(ctx context.Context, user string, q *parser.SQLQuery) error {
+	if ok, err := r.superuser(ctx, user); err != nil || ok {
+		return err
+	}
+
+	if action := superuserOnly(user, q); action != "" {
+		return fmt.Errorf("%w: must be superuser to %s", ErrPermissionDenied, action)
+	}
+	for _, req := range requirements(q) {
+		if err := r.check(ctx, user, req.table, req.privilege); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// superuser tells whether the user may do anything, as superusers and the
+// empty user may.
+func (r *Runner) superuser(ctx context.Context, user string) (bool, error) {
+	if user == "" {
+		return true, nil
+	}
+	role, err := r.db.Role(ctx, user)
+	if err != nil {
+		return false, err
+	}
+	return role.Superuser, nil
+}
+
+// check fails with ErrPermissionDenied if the user, which is not a superuser,
+// does not have the privilege on the table.
+func (r *Runner) check(ctx context.Context, user string, t object.Table, p system.Privilege) error {
+	ok, err := r.db.HasPrivilege(ctx, user, t, p)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w for table %s", ErrPermissionDenied, t)
+	}
+	return nil
+}
+
+// superuserOnly describes what q does if only superusers may do it, and
+// returns an empty string otherwise.
+func superuserOnly(user string, q *parser.SQLQuery) string {
+	switch q.Type {
+	case parser.QueryTypeCreate:
+		switch q.Create.Type {
+		case parser.CreateTypeTable:
+			return "create tables"
+		case parser.CreateTypeRole:
+			return "create roles"
+		}
+	case parser.QueryTypeAlterRole:
+		// users may change their own password.
+		if q.AlterRole.Name != user || q.AlterRole.Superuser != nil {
+			return "alter roles"
+		}
+	case parser.QueryTypeGrant, parser.QueryTypeRevoke:
+		return "grant or revoke privileges"
+	case parser.QueryTypeAnalyze:
+		if q.Analyze.Table == "" {
+			return "analyze every table"
+		}
+	case parser.QueryTypeCopyFrom, parser.QueryTypeCopyTo:
+		if q.Copy.Path != "" {
+			return "copy to or from a file"
+		}
+	}
+	return ""
+}
+
+// requirements returns the privileges q needs.
+func requirements(q *parser.SQLQuery) []requirement {
+	var out []requirement
+	need := func(p system.Privilege, tables ...object.Table) {
+		for _, t := range tables {
+			out = append(out, requirement{table: t, privilege: p})
+		}
+	}
+
+	switch q.Type {
+	case parser.QueryTypeSelect:
+		need(system.PrivilegeSelect, q.Select.Tables()...)
+	case parser.QueryTypeInsert:
+		need(system.PrivilegeInsert, q.Insert.Table)
+	case parser.QueryTypeUpdate:
+		need(system.PrivilegeUpdate, q.Update.From)
+		// filtered updates read the rows they match.
+		if len(q.Update.Filters) > 0 {
+			need(system.PrivilegeSelect, q.Update.From)
+		}
+	case parser.QueryTypeCreate:
+		if q.Create.Type == parser.CreateTypeIndex {
+			need(system.PrivilegeCreate, q.Create.CreateIndex.Table)
+		}
+	case parser.QueryTypeAnalyze:
+		need(system.PrivilegeCreate, q.Analyze.Tables()...)
+	case parser.QueryTypeCopyFrom:
+		need(system.PrivilegeInsert, q.Copy.Table)
+	case parser.QueryTypeCopyTo:
+		need(system.PrivilegeSelect, q.Copy.Query.Tables()...)
+	}
+	return out
+}
@@ -0,0 +1,65 @@
+package sql
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aliphe/filadb/db/object"
+	"github.com/aliphe/filadb/db/schema"
+	"github.com/aliphe/filadb/db/system"
+)
+
+// Tables lists the tables the user may select from, failing with a
+// *query.Error.
+func (r *Runner) Tables(ctx context.Context, user string) ([]object.Table, error) {
+	var out []object.Table
+	err := r.view(ctx, func(ctx context.Context) error {
+		tables, err := r.db.Tables(ctx)
+		if err != nil {
+			return err
+		}
+		for _, t := range tables {
+			err := r.selectable(ctx, user, t)
+			if errors.Is(err, ErrPermissionDenied) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			out = append(out, t)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, newError(err)
+	}
+	return out, nil
+}
+
+// Schema returns the schema of the table, failing with a *query.Error if the
+// user may not select from it.
+func (r *Runner) Schema(ctx context.Context, user string, t object.Table) (*schema.Schema, error) {
+	var out *schema.Schema
+	err := r.view(ctx, func(ctx context.Context) error {
+		sch, err := r.db.GetSchema(ctx, t)
+		if err != nil {
+			return err
+		}
+		if err := r.selectable(ctx, user, t); err != nil {
+			return err
+		}
+		out = sch
+		return nil
+	})
+	if err != nil {
+		return nil, newError(err)
+	}
+	return out, nil
+}
+
+func (r *Runner) selectable(ctx context.Context, user string, t object.Table) error {
+	if ok, err := r.superuser(ctx, user); err != nil || ok {
+		return err
+	}
+	return r.check(ctx, user, t, system.PrivilegeSelect)
+}
@@ -0,0 +1,109 @@
+package sql
+
+import (
+	"errors"
+
+	"github.com/aliphe/filadb/db/schema"
+	"github.com/aliphe/filadb/db/storage"
+	"github.com/aliphe/filadb/db/system"
+	"github.com/aliphe/filadb/query"
+	"github.com/aliphe/filadb/query/sql/eval"
+	"github.com/aliphe/filadb/query/sql/lexer"
+	"github.com/aliphe/filadb/query/sql/validation"
+)
+
+var (
+	ErrNoTransaction         = errors.New("no transaction in progress")
+	ErrTransactionInProgress = errors.New("a transaction is already in progress")
+	ErrTransactionAborted    = errors.New("current transaction is aborted, commands ignored until end of transaction block")
+	ErrPermissionDenied      = errors.New("permission denied")
+	ErrUnknownStatement      = errors.New("prepared statement does not exist")
+	ErrStatementExists       = errors.New("prepared statement already exists")
+	ErrParameterCount        = errors.New("wrong number of parameters")
+	ErrNullParameter         = errors.New("null parameters are not supported")
+)
+
+// syntaxError marks the errors raised parsing a query.
+type syntaxError struct {
+	err error
+}
+
+func (s *syntaxError) Error() string {
+	return s.err.Error()
+}
+
+func (s *syntaxError) Unwrap() error {
+	return s.err
+}
+
+// newError classifies err.
+func newError(err error) *query.Error {
+	var qerr *query.Error
+	if errors.As(err, &qerr) {
+		return qerr
+	}
+
+	out := &query.Error{
+		Code: code(err),
+		Err:  err,
+	}
+
+	var lerr lexer.InvalidExpressionError
+	var perr interface{ Position() int }
+	if errors.As(err, &lerr) {
+		out.Position = lerr.Position + 1
+	} else if errors.As(err, &perr) {
+		out.Position = perr.Position() + 1
+	}
+
+	return out
+}
+
+func code(err error) query.Code {
+	var lerr lexer.InvalidExpressionError
+	var serr *syntaxError
+	switch {
+	case errors.As(err, &lerr), errors.As(err, &serr):
+		return query.CodeSyntaxError
+	case errors.Is(err, storage.ErrTableNotFound):
+		return query.CodeUndefinedTable
+	case errors.Is(err, validation.ErrReferenceNotFound):
+		return query.CodeUndefinedColumn
+	case errors.Is(err, validation.ErrAmbiguousReference):
+		return query.CodeAmbiguousColumn
+	case errors.Is(err, system.ErrReservedTable):
+		return query.CodeReservedName
+	case errors.Is(err, system.ErrRoleExists):
+		return query.CodeDuplicateObject
+	case errors.Is(err, system.ErrUnknownRole):
+		return query.CodeUndefinedObject
+	case errors.Is(err, system.ErrMembershipCycle):
+		return query.CodeInvalidGrantOperation
+	case errors.Is(err, ErrPermissionDenied):
+		return query.CodeInsufficientPrivilege
+	case errors.Is(err, ErrUnknownStatement):
+		return query.CodeInvalidStatementName
+	case errors.Is(err, ErrStatementExists):
+		return query.CodeDuplicatePreparedStatement
+	case errors.Is(err, ErrParameterCount):
+		return query.CodeSyntaxError
+	case errors.Is(err, ErrNullParameter):
+		return query.CodeFeatureNotSupported
+	case errors.Is(err, schema.ErrTypeMismatch):
+		return query.CodeDatatypeMismatch
+	case errors.Is(err, eval.ErrInvalidValue):
+		return query.CodeInvalidValue
+	case errors.Is(err, storage.ErrDuplicate):
+		return query.CodeUniqueViolation
+	case errors.Is(err, ErrTransactionInProgress):
+		return query.CodeActiveTransaction
+	case errors.Is(err, ErrNoTransaction):
+		return query.CodeNoActiveTransaction
+	case errors.Is(err, ErrTransactionAborted):
+		return query.CodeInFailedTransaction
+	case errors.Is(err, storage.ErrWriteConflict):
+		return query.CodeSerializationFailure
+	default:
+		return query.CodeInternal
+	}
+}
@@ -0,0 +1,298 @@
+package eval
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/aliphe/filadb/db/object"
+	"github.com/aliphe/filadb/db/schema"
+	"github.com/aliphe/filadb/query"
+	"github.com/aliphe/filadb/query/export"
+	"github.com/aliphe/filadb/query/sql/parser"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidValue = errors.New("invalid value")
+
+// copyResult counts the rows loaded and rejected by COPY.
+type copyResult struct {
+	loaded   int
+	rejected int
+}
+
+func (r copyResult) String() string {
+	return fmt.Sprintf("COPY %d REJECTED %d", r.loaded, r.rejected)
+}
+
+func (e *Evaluator) evalCopyFrom(ctx context.Context, cp parser.Copy) (copyResult, error) {
+	sch, err := e.client.GetSchema(ctx, cp.Table)
+	if err != nil {
+		return copyResult{}, err
+	}
+
+	f, err := os.Open(cp.Path)
+	if err != nil {
+		return copyResult{}, fmt.Errorf("open %s: %w", cp.Path, err)
+	}
+	defer f.Close()
+
+	var rows []object.Row
+	var rejected int
+	switch cp.Format {
+	case parser.CopyFormatJSONL:
+		rows, rejected, err = readJSONL(f, sch)
+	default:
+		rows, rejected, err = readCSV(f, sch, cp.Header)
+	}
+	if err != nil {
+		return copyResult{}, fmt.Errorf("read %s: %w", cp.Path, err)
+	}
+
+	for _, r := range rows {
+		if _, ok := r["id"]; !ok {
+			r["id"] = uuid.New().String()
+		}
+	}
+
+	res, err := e.client.BulkInsert(ctx, cp.Table, rows)
+	if err != nil {
+		return copyResult{}, err
+	}
+
+	return copyResult{
+		loaded:   res.Loaded,
+		rejected: rejected + len(res.Rejected),
+	}, nil
+}
+
+// readCSV reads the rows of a CSV file, whose columns are named by its header
+// if any, or follow the schema otherwise. Empty fields are null.
+// It returns the rows read, and how many lines were rejected.
+func readCSV(r io.Reader, sch *schema.Schema, header bool) ([]object.Row, int, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	cols := make([]string, 0, len(sch.Columns))
+	for _, c := range sch.Columns {
+		cols = append(cols, c.Name)
+	}
+	if header {
+		h, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil, 0, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		cols = h
+	}
+
+	var rows []object.Row
+	var rejected int
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			rejected++
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(rec) != len(cols) {
+			rejected++
+			continue
+		}
+
+		row, err := csvRow(sch, cols, rec)
+		if err != nil {
+			rejected++
+			continue
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, rejected, nil
+}
+
+func csvRow(sch *schema.Schema, cols []string, rec []string) (object.Row, error) {
+	row := make(object.Row, len(cols))
+	for i, c := range cols {
+		if rec[i] == "" {
+			continue
+		}
+		if columnType(sch, c) != schema.ColumnTypeNumber {
+			row[c] = rec[i]
+			continue
+		}
+		n, err := strconv.ParseInt(rec[i], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", c, ErrInvalidValue)
+		}
+		row[c] = int32(n)
+	}
+	return row, nil
+}
+
+// readJSONL reads the rows of a file holding a JSON object per line.
+// It returns the rows read, and how many lines were rejected.
+func readJSONL(r io.Reader, sch *schema.Schema) ([]object.Row, int, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+
+	var rows []object.Row
+	var rejected int
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var obj map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &obj); err != nil {
+			rejected++
+			continue
+		}
+		row, err := jsonRow(sch, obj)
+		if err != nil {
+			rejected++
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return rows, rejected, nil
+}
+
+func jsonRow(sch *schema.Schema, obj map[string]any) (object.Row, error) {
+	row := make(object.Row, len(obj))
+	for c, v := range obj {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			if columnType(sch, c) == schema.ColumnTypeNumber {
+				return nil, fmt.Errorf("column %s: %w", c, ErrInvalidValue)
+			}
+			row[c] = v
+		case float64:
+			if columnType(sch, c) == schema.ColumnTypeText || v != math.Trunc(v) || v < math.MinInt32 || v > math.MaxInt32 {
+				return nil, fmt.Errorf("column %s: %w", c, ErrInvalidValue)
+			}
+			row[c] = int32(v)
+		default:
+			return nil, fmt.Errorf("column %s: %w", c, ErrInvalidValue)
+		}
+	}
+	return row, nil
+}
+
+// columnType returns the type of the column, or an empty one if it is not in the schema.
+func columnType(sch *schema.Schema, col string) schema.ColumnType {
+	for _, c := range sch.Columns {
+		if c.Name == col {
+			return c.Type
+		}
+	}
+	return ""
+}
+
+// copyChunk is the size of the chunks COPY TO STDOUT streams its output in.
+const copyChunk = 64 << 10
+
+// evalCopyTo writes the rows of the query to the file at cp.Path as they are
+// scanned, or streams them to the CopyOut of the context when no path is given.
+// Without a CopyOut, they are returned instead.
+func (e *Evaluator) evalCopyTo(ctx context.Context, cp parser.Copy) (*query.Result, error) {
+	fields := e.outputCols(cp.Query.Fields)
+	cols := make([]export.Column, 0, len(fields))
+	for _, c := range e.describe(fields) {
+		cols = append(cols, export.Column{
+			Name: c.Name,
+			Type: c.Type,
+		})
+	}
+
+	var opts []export.Option
+	if cp.Header {
+		opts = append(opts, export.WithHeader())
+	}
+
+	var buf bytes.Buffer
+	var out io.Writer = &buf
+	dest := cp.Path
+	co, stream := query.CopyOutFromContext(ctx)
+	switch {
+	case cp.Path != "":
+		f, err := os.Create(cp.Path)
+		if err != nil {
+			return nil, fmt.Errorf("create %s: %w", cp.Path, err)
+		}
+		defer f.Close()
+		out = f
+	case stream:
+		dest = "STDOUT"
+		if err := co.Begin(); err != nil {
+			return nil, err
+		}
+		out = bufio.NewWriterSize(co, copyChunk)
+	}
+
+	w, err := export.New(export.Format(cp.Format), out, cols, opts...)
+	if err != nil {
+		return nil, err
+	}
+	record := make([]any, len(fields))
+	n := 0
+	err = e.eachRow(ctx, cp.Query, func(row object.Row) error {
+		for i, f := range fields {
+			record[i] = row[e.key(f.Table, f.Column)]
+		}
+		n++
+		return w.Write(record)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("write %s: %w", dest, err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("write %s: %w", dest, err)
+	}
+
+	res := count("COPY", n)
+	switch out := out.(type) {
+	case *os.File:
+		if err := out.Close(); err != nil {
+			return nil, fmt.Errorf("close %s: %w", cp.Path, err)
+		}
+	case *bufio.Writer:
+		if err := out.Flush(); err != nil {
+			return nil, err
+		}
+		if err := co.End(); err != nil {
+			return nil, err
+		}
+	default:
+		res.Data = buf.Bytes()
+	}
+	return res, nil
+}
+
+// columnType returns the type of the field, text when it is not in a schema.
+func (e *Evaluator) columnType(f parser.Field) schema.ColumnType {
+	if sch, ok := e.shape.Schemas[e.table(f)]; ok {
+		return columnType(sch, f.Column)
+	}
+	return schema.ColumnTypeText
+}
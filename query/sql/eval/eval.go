@@ -2,6 +2,7 @@ package eval
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"slices"
 	"strconv"
@@ -13,6 +14,8 @@ import (
 	"github.com/aliphe/filadb/db/object"
 	"github.com/aliphe/filadb/db/schema"
 	"github.com/aliphe/filadb/db/system"
+	"github.com/aliphe/filadb/net/scram"
+	"github.com/aliphe/filadb/query"
 	"github.com/aliphe/filadb/query/sql/parser"
 	"github.com/google/uuid"
 )
@@ -29,51 +32,81 @@ func New(client *db.Client, shape *system.DatabaseShape) *Evaluator {
 	}
 }
 
-func (e *Evaluator) EvalExpr(ctx context.Context, q *parser.SQLQuery) ([]byte, error) {
+func (e *Evaluator) EvalExpr(ctx context.Context, q *parser.SQLQuery) (*query.Result, error) {
 	switch q.Type {
 	case parser.QueryTypeInsert:
 		n, err := e.evalInsert(ctx, q.Insert)
 		if err != nil {
 			return nil, err
 		}
-		return []byte("INSERT " + strconv.Itoa(n)), nil
+		return count("INSERT", n), nil
 	case parser.QueryTypeSelect:
-		res, err := e.evalSelect(ctx, q.Select)
-		if err != nil {
-			return nil, err
-		}
-		return res, nil
+		return e.evalSelect(ctx, q.Select)
 	case parser.QueryTypeUpdate:
 		n, err := e.evalUpdate(ctx, q.Update)
 		if err != nil {
 			return nil, err
 		}
-		return []byte("UPDATE " + strconv.Itoa(n)), nil
+		return count("UPDATE", n), nil
 	case parser.QueryTypeCreate:
 		switch q.Create.Type {
 		case parser.CreateTypeIndex:
-			return []byte("CREATE INDEX"), e.evalCreateIndex(ctx, q.Create.CreateIndex)
+			return &query.Result{Tag: "CREATE INDEX"}, e.evalCreateIndex(ctx, q.Create.CreateIndex)
 		case parser.CreateTypeTable:
-			return []byte("CREATE TABLE"), e.evalCreateTable(ctx, q.Create.CreateTable)
+			return &query.Result{Tag: "CREATE TABLE"}, e.evalCreateTable(ctx, q.Create.CreateTable)
+		case parser.CreateTypeRole:
+			return &query.Result{Tag: "CREATE ROLE"}, e.evalCreateRole(ctx, q.Create.CreateRole)
 		default:
 			return nil, fmt.Errorf("unknown create type: %v", q.Create.Type)
 		}
+	case parser.QueryTypeCopyFrom:
+		res, err := e.evalCopyFrom(ctx, q.Copy)
+		if err != nil {
+			return nil, err
+		}
+		return &query.Result{Tag: res.String(), RowCount: res.loaded}, nil
+	case parser.QueryTypeCopyTo:
+		return e.evalCopyTo(ctx, q.Copy)
+	case parser.QueryTypeAnalyze:
+		return &query.Result{Tag: "ANALYZE"}, e.client.Analyze(ctx, q.Analyze.Tables()...)
+	case parser.QueryTypeAlterRole:
+		return &query.Result{Tag: "ALTER ROLE"}, e.evalAlterRole(ctx, q.AlterRole)
+	case parser.QueryTypeGrant, parser.QueryTypeRevoke:
+		return e.evalGrant(ctx, q.Type == parser.QueryTypeRevoke, q.Grant)
 	default:
 		return nil, fmt.Errorf("%s not implemented", q.Type)
 	}
 }
+
+// Describe returns the columns of the rows q returns, nil if it returns none.
+func (e *Evaluator) Describe(q *parser.SQLQuery) []query.Column {
+	if q.Type != parser.QueryTypeSelect {
+		return nil
+	}
+	return e.describe(e.outputCols(q.Select.Fields))
+}
+
+// count returns the result of a command affecting n rows.
+func count(cmd string, n int) *query.Result {
+	return &query.Result{
+		Tag:      cmd + " " + strconv.Itoa(n),
+		RowCount: n,
+	}
+}
+
 func (e *Evaluator) evalUpdate(ctx context.Context, update parser.Update) (int, error) {
-	rows, err := e.scan(ctx, update.From, update.Filters...)
+	// rows are written back whole.
+	rows, err := e.scan(ctx, update.From, nil, update.Filters...)
 	if err != nil {
 		return 0, fmt.Errorf("eval from: %w", err)
 	}
 
 	rows = unprefix(rows)
 
-	for i, r := range rows {
+	for _, r := range rows {
 		maps.Copy(r, update.Set.Update)
 		if err := e.client.UpdateRow(ctx, update.From, r); err != nil {
-			return i, fmt.Errorf("apply update for row %v: %w", r["id"], err)
+			return 0, fmt.Errorf("apply update for row %v: %w", r["id"], err)
 		}
 	}
 
@@ -102,25 +135,100 @@ func (e *Evaluator) evalCreateIndex(ctx context.Context, create parser.CreateInd
 	return e.client.CreateIndex(ctx, &idx)
 }
 
-func (e *Evaluator) joinScan(ctx context.Context, cache []object.Row, j parser.Join) ([]object.Row, error) {
+func (e *Evaluator) evalCreateRole(ctx context.Context, role parser.Role) error {
+	r := system.Role{Name: role.Name}
+	if err := setRole(&r, role); err != nil {
+		return err
+	}
+	return e.client.CreateRole(ctx, &r)
+}
+
+func (e *Evaluator) evalAlterRole(ctx context.Context, role parser.Role) error {
+	r, err := e.client.Role(ctx, role.Name)
+	if err != nil {
+		return err
+	}
+	if err := setRole(r, role); err != nil {
+		return err
+	}
+	return e.client.UpdateRole(ctx, r)
+}
+
+// setRole sets the options of the role which are set.
+func setRole(r *system.Role, role parser.Role) error {
+	if role.Password != nil {
+		creds, err := credentials(*role.Password)
+		if err != nil {
+			return err
+		}
+		r.Credentials = &creds
+	}
+	if role.Superuser != nil {
+		r.Superuser = *role.Superuser
+	}
+	return nil
+}
+
+func (e *Evaluator) evalGrant(ctx context.Context, revoke bool, grant parser.Grant) (*query.Result, error) {
+	tag := "GRANT"
+	if revoke {
+		tag = "REVOKE"
+	}
+	if grant.Role != "" {
+		tag += " ROLE"
+	}
+
+	for _, g := range grant.Grantees {
+		var err error
+		switch {
+		case grant.Role != "" && revoke:
+			err = e.client.RevokeRole(ctx, grant.Role, g)
+		case grant.Role != "":
+			err = e.client.GrantRole(ctx, grant.Role, g)
+		case revoke:
+			err = e.client.Revoke(ctx, g, grant.Table, grant.Privileges...)
+		default:
+			err = e.client.Grant(ctx, g, grant.Table, grant.Privileges...)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &query.Result{Tag: tag}, nil
+}
+
+// credentials returns the credentials of the password, or the password
+// itself if it holds credentials already, as dumps do.
+func credentials(password string) (scram.Credentials, error) {
+	if creds, err := scram.ParseCredentials(password); err == nil {
+		return creds, nil
+	}
+	if password == "" {
+		return scram.Credentials{}, fmt.Errorf("empty password: %w", ErrInvalidValue)
+	}
+	return scram.NewCredentials(password)
+}
+
+func (e *Evaluator) joinScan(ctx context.Context, cache []object.Row, j parser.Join, cols []string) ([]object.Row, error) {
 	filter := parser.Filter{
 		Left: parser.Value{
 			Type:      parser.ValueTypeReference,
 			Reference: j.On.Foreign,
 		},
 	}
-	cols := make([]any, 0, len(cache))
+	vals := make([]any, 0, len(cache))
 	for _, r := range cache {
-		cols = append(cols, r[object.Key(j.On.Local.Table, j.On.Local.Column)])
+		vals = append(vals, r[object.Key(j.On.Local.Table, j.On.Local.Column)])
 	}
 
 	filter.Op = db.OpInclude
 	filter.Right = parser.Value{
-		Value: cols,
+		Value: vals,
 		Type:  parser.ValueTypeList,
 	}
 
-	rows, err := e.scan(ctx, j.Table, filter)
+	rows, err := e.scan(ctx, j.Table, cols, filter)
 	if err != nil {
 		return nil, fmt.Errorf("join %s table: %w", j.Table, err)
 	}
@@ -128,8 +236,8 @@ func (e *Evaluator) joinScan(ctx context.Context, cache []object.Row, j parser.J
 	return rows, nil
 }
 
-func (e *Evaluator) evalJoin(ctx context.Context, cache []object.Row, j parser.Join) ([]object.Row, error) {
-	rows, err := e.joinScan(ctx, cache, j)
+func (e *Evaluator) evalJoin(ctx context.Context, cache []object.Row, j parser.Join, cols []string) ([]object.Row, error) {
+	rows, err := e.joinScan(ctx, cache, j, cols)
 	if err != nil {
 		return nil, err
 	}
@@ -185,39 +293,48 @@ func (e *Evaluator) outputCols(fields []parser.Field) []parser.Field {
 	return out
 }
 
-func (e *Evaluator) formatRows(rows []object.Row, fields []parser.Field) []byte {
-	fields = e.outputCols(fields)
-	var out string
-	for i, f := range fields {
-		out += f.Column
-		if i < len(fields)-1 {
-			out += ","
-		}
+func (e *Evaluator) evalSelect(ctx context.Context, sel parser.Select) (*query.Result, error) {
+	rows, err := e.selectRows(ctx, sel)
+	if err != nil {
+		return nil, err
 	}
-	out += "\n"
-	for i, row := range rows {
+
+	fields := e.outputCols(sel.Fields)
+	res := count("SELECT", len(rows))
+	res.Columns = e.describe(fields)
+	res.Rows = make([][]any, 0, len(rows))
+	for _, row := range rows {
+		vals := make([]any, len(fields))
 		for i, f := range fields {
-			out += fmt.Sprint(row[e.key(f.Table, f.Column)])
-			if i < len(fields)-1 {
-				out += ","
-			}
-		}
-		if i < len(rows)-1 {
-			out += "\n"
+			vals[i] = row[e.key(f.Table, f.Column)]
 		}
+		res.Rows = append(res.Rows, vals)
 	}
 
-	return []byte(out)
+	return res, nil
+}
+
+// describe returns the columns of the fields.
+func (e *Evaluator) describe(fields []parser.Field) []query.Column {
+	cols := make([]query.Column, 0, len(fields))
+	for _, f := range fields {
+		cols = append(cols, query.Column{
+			Name: f.Column,
+			Type: e.columnType(f),
+		})
+	}
+	return cols
 }
 
-func (e *Evaluator) evalSelect(ctx context.Context, sel parser.Select) ([]byte, error) {
-	from, err := e.scan(ctx, sel.From, sel.Filters...)
+// selectRows returns the rows matching sel, up to its limit.
+func (e *Evaluator) selectRows(ctx context.Context, sel parser.Select) ([]object.Row, error) {
+	from, err := e.scan(ctx, sel.From, e.columns(sel.From, sel), sel.Filters...)
 	if err != nil {
 		return nil, fmt.Errorf("eval from: %w", err)
 	}
 
 	for _, j := range sel.Joins {
-		res, err := e.evalJoin(ctx, from, j)
+		res, err := e.evalJoin(ctx, from, j, e.columns(j.Table, sel))
 		if err != nil {
 			return nil, err
 		}
@@ -228,7 +345,82 @@ func (e *Evaluator) evalSelect(ctx context.Context, sel parser.Select) ([]byte,
 	if l, hasLimit := sel.Limit.Get(); hasLimit && int(l) <= count {
 		count = int(l)
 	}
-	return e.formatRows(from[:count], sel.Fields), nil
+	return from[:count], nil
+}
+
+// errLimit stops a scan once it returned as many rows as a query asks for.
+var errLimit = errors.New("limit reached")
+
+// eachRow calls fn with the rows matching sel, up to its limit, as they are
+// scanned. Rows of joins are only passed on once they are all joined.
+func (e *Evaluator) eachRow(ctx context.Context, sel parser.Select, fn func(object.Row) error) error {
+	if len(sel.Joins) > 0 {
+		rows, err := e.selectRows(ctx, sel)
+		if err != nil {
+			return err
+		}
+		for _, r := range rows {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	limit, hasLimit := sel.Limit.Get()
+	n := 0
+	err := e.scanEach(ctx, sel.From, e.columns(sel.From, sel), sel.Filters, func(r object.Row) error {
+		if hasLimit && n >= int(limit) {
+			return errLimit
+		}
+		n++
+		return fn(r)
+	})
+	if err != nil && !errors.Is(err, errLimit) {
+		return fmt.Errorf("eval from: %w", err)
+	}
+	return nil
+}
+
+// columns returns the columns of table the query references, or nil when it
+// needs all of them.
+func (e *Evaluator) columns(table object.Table, sel parser.Select) []string {
+	refs := slices.Clone(sel.Fields)
+	for _, f := range sel.Filters {
+		for _, v := range []parser.Value{f.Left, f.Right} {
+			if v.Type == parser.ValueTypeReference {
+				refs = append(refs, v.Reference)
+			}
+		}
+	}
+	for _, j := range sel.Joins {
+		refs = append(refs, j.On.Local, j.On.Foreign)
+	}
+
+	var cols []string
+	for _, f := range refs {
+		if f.Column == "*" {
+			if f.Table == "" || f.Table == table {
+				return nil
+			}
+			continue
+		}
+		if e.table(f) == table && !slices.Contains(cols, f.Column) {
+			cols = append(cols, f.Column)
+		}
+	}
+	return cols
+}
+
+// table returns the table of the field, resolved from its column when unqualified.
+func (e *Evaluator) table(f parser.Field) object.Table {
+	if f.Table != "" {
+		return f.Table
+	}
+	if tables := e.shape.ColMappings[f.Column]; len(tables) > 0 {
+		return tables[0]
+	}
+	return ""
 }
 
 func (e *Evaluator) key(table object.Table, col string) string {
@@ -240,7 +432,7 @@ func (e *Evaluator) key(table object.Table, col string) string {
 }
 
 func (e *Evaluator) evalInsert(ctx context.Context, ins parser.Insert) (int, error) {
-	for i, r := range ins.Rows {
+	for _, r := range ins.Rows {
 		if _, ok := r["id"]; !ok {
 			// todo make this depend on shape
 			// or even better -> use constraints
@@ -249,16 +441,34 @@ func (e *Evaluator) evalInsert(ctx context.Context, ins parser.Insert) (int, err
 
 		err := e.client.InsertRow(ctx, ins.Table, r)
 		if err != nil {
-			return i, err
+			return 0, err
 		}
 	}
 	return len(ins.Rows), nil
 }
 
-func (e *Evaluator) scan(ctx context.Context, table object.Table, filters ...parser.Filter) ([]object.Row, error) {
+func (e *Evaluator) scan(ctx context.Context, table object.Table, cols []string, filters ...parser.Filter) ([]object.Row, error) {
+	var rows []object.Row
+	err := e.scanEach(ctx, table, cols, filters, func(r object.Row) error {
+		rows = append(rows, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// scanEach calls fn with each row of table matching filters, its columns
+// prefixed with the table, as they are scanned.
+func (e *Evaluator) scanEach(ctx context.Context, table object.Table, cols []string, filters []parser.Filter, fn func(object.Row) error) error {
 	f := make([]db.Filter, 0, len(filters))
 	for _, filter := range filters {
-		if filter.Left.Reference.Table == table {
+		if filter.Left.Type != parser.ValueTypeReference || filter.Right.Type == parser.ValueTypeReference {
+			continue
+		}
+		if e.table(filter.Left.Reference) == table {
 			f = append(f, db.Filter{
 				Col: filter.Left.Reference.Column,
 				Op:  filter.Op,
@@ -266,26 +476,22 @@ func (e *Evaluator) scan(ctx context.Context, table object.Table, filters ...par
 			})
 		}
 	}
-	var rows []object.Row
-	err := e.client.Scan(ctx, table, &rows, f...)
-	if err != nil {
-		return nil, err
-	}
-
-	return e.filter(prefix(table, rows), filters), nil
+	_, err := e.client.ScanEach(ctx, table, cols, func(r object.Row) error {
+		r = prefixRow(table, r)
+		if !e.matches(r, filters) {
+			return nil
+		}
+		return fn(r)
+	}, f...)
+	return err
 }
 
-// prefix adds table prefix to all columns in object
-func prefix(table object.Table, rows []object.Row) []object.Row {
-	out := make([]object.Row, 0, len(rows))
-	for _, r := range rows {
-		new := make(object.Row)
-		for k, v := range r {
-			new[object.Key(table, k)] = v
-		}
-		out = append(out, new)
+// prefixRow adds the table prefix to every column of the row.
+func prefixRow(table object.Table, r object.Row) object.Row {
+	out := make(object.Row, len(r))
+	for k, v := range r {
+		out[object.Key(table, k)] = v
 	}
-
 	return out
 }
 
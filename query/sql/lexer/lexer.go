@@ -1,49 +1,124 @@
 package lexer
 
 import (
-	"errors"
+	"fmt"
 	"strings"
 )
 
+// InvalidExpressionError reports input that no token matches.
+type InvalidExpressionError struct {
+	Position int
+}
+
+func (i InvalidExpressionError) Error() string {
+	return fmt.Sprintf("invalid expression at position %d", i.Position)
+}
+
 type Lexer struct {
 	input  string
 	cursor int
 }
 
+// Tokenize splits expr into tokens, dropping whitespace and comments. The ?
+// placeholders are numbered in order, and cannot be mixed with numbered ones.
 func Tokenize(expr string) ([]*Token, error) {
 	var tokens []*Token
 	s := strings.Clone(expr)
 	var pos int
-	matches := make([]*Token, 0, len(matchers))
+	// anonymous and numbered count the placeholders of each style.
+	var anonymous, numbered int
 
 	for pos < len(s) {
-		for _, match := range matchers {
-			ok, tok := match(s[pos:])
-			if ok {
-				matches = append(matches, tok)
+		match := next(s[pos:])
+		match.Position = pos
+		pos += match.Len
+		if match.Kind == KindPlaceholder {
+			if match.Value == 0 {
+				anonymous++
+				match.Value = anonymous
+			} else {
+				numbered++
 			}
-		}
-		if len(matches) > 0 {
-			match := biggest(matches)
-			match.Position = pos
-			pos += match.Len
-			if match.Kind != KindWhitespace {
-				tokens = append(tokens, match)
+			if anonymous > 0 && numbered > 0 {
+				return nil, InvalidExpressionError{Position: match.Position}
 			}
-		} else {
-			return nil, errors.New("invalid expression")
 		}
-		matches = matches[:0]
+		if match.Kind != KindWhitespace && match.Kind != KindComment {
+			tokens = append(tokens, match)
+		}
 	}
 	return tokens, nil
 }
 
-func biggest(tokens []*Token) *Token {
-	max := tokens[0]
-	for _, t := range tokens {
-		if t.Len > max.Len {
-			max = t
+// Statement is a statement of a query.
+type Statement struct {
+	SQL string
+	// Offset is the offset of the statement in the query.
+	Offset int
+	// Terminated tells whether the statement ends with a semicolon, rather
+	// than with the query.
+	Terminated bool
+}
+
+// Split splits a query on the semicolons out of string literals and
+// comments, skipping the statements made of whitespace and comments only.
+func Split(q string) []Statement {
+	var out []Statement
+	var start int
+	blank := true
+	for pos := 0; pos < len(q); {
+		tok := next(q[pos:])
+		switch tok.Kind {
+		case KindSemiColumn:
+			if !blank {
+				out = append(out, Statement{SQL: q[start:pos], Offset: start, Terminated: true})
+			}
+			start, blank = pos+tok.Len, true
+		case KindWhitespace, KindComment:
+		default:
+			blank = false
+		}
+		pos += tok.Len
+	}
+	if !blank {
+		out = append(out, Statement{SQL: q[start:], Offset: start})
+	}
+	return out
+}
+
+// Redact returns q with the literals following PASSWORD masked, so that it can
+// be logged. An unterminated password literal masks the rest of q.
+func Redact(q string) string {
+	var b strings.Builder
+	var password bool
+	for pos := 0; pos < len(q); {
+		tok := next(q[pos:])
+		switch {
+		case tok.Kind == KindWhitespace, tok.Kind == KindComment:
+			b.WriteString(q[pos : pos+tok.Len])
+		case password && tok.Kind == KindStringLiteral:
+			b.WriteString("'***'")
+			password = false
+		case password && tok.Kind == KindIllegal:
+			b.WriteString("***")
+			return b.String()
+		default:
+			b.WriteString(q[pos : pos+tok.Len])
+			password = tok.Kind == KindIdentifier && strings.EqualFold(tok.Value.(string), "PASSWORD")
+		}
+		pos += tok.Len
+	}
+	return b.String()
+}
+
+// next returns the longest token at the start of s, which is not empty.
+func next(s string) *Token {
+	var out *Token
+	for _, match := range matchers {
+		// the illegal matcher, last, matches any input.
+		if ok, tok := match(s); ok && (out == nil || tok.Len > out.Len) {
+			out = tok
 		}
 	}
-	return max
+	return out
 }
@@ -50,6 +50,51 @@ func Test_NextToken(t *testing.T) {
 				{Kind: KindSemiColumn, Value: ";"},
 			},
 		},
+		{
+			given: `VALUES ($1, $12), ('$1?')`,
+			want: []*Token{
+				{Kind: KindValues, Value: "VALUES"},
+				{Kind: KindOpenParen, Value: "("},
+				{Kind: KindPlaceholder, Value: 1},
+				{Kind: KindComma, Value: ","},
+				{Kind: KindPlaceholder, Value: 12},
+				{Kind: KindCloseParen, Value: ")"},
+				{Kind: KindComma, Value: ","},
+				{Kind: KindOpenParen, Value: "("},
+				{Kind: KindStringLiteral, Value: "$1?"},
+				{Kind: KindCloseParen, Value: ")"},
+			},
+		},
+		{
+			given: `id IN (?, ?)`,
+			want: []*Token{
+				{Kind: KindIdentifier, Value: "id"},
+				{Kind: KindIn, Value: "IN"},
+				{Kind: KindOpenParen, Value: "("},
+				{Kind: KindPlaceholder, Value: 1},
+				{Kind: KindComma, Value: ","},
+				{Kind: KindPlaceholder, Value: 2},
+				{Kind: KindCloseParen, Value: ")"},
+			},
+		},
+		{
+			given: `$65535, $65536, $9000000000000000000000`,
+			want: []*Token{
+				{Kind: KindPlaceholder, Value: 65535},
+				{Kind: KindComma, Value: ","},
+				{Kind: KindIllegal, Value: "$65536"},
+				{Kind: KindComma, Value: ","},
+				{Kind: KindIllegal, Value: "$9000000000000000000000"},
+			},
+		},
+		{
+			given: `'it''s', ''''`,
+			want: []*Token{
+				{Kind: KindStringLiteral, Value: "it's"},
+				{Kind: KindComma, Value: ","},
+				{Kind: KindStringLiteral, Value: "'"},
+			},
+		},
 	}
 
 	for _, tc := range tests {
@@ -65,3 +110,89 @@ func Test_NextToken(t *testing.T) {
 		})
 	}
 }
+
+func Test_Split(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		given string
+		want  []Statement
+	}{
+		"statements": {
+			given: "BEGIN; SELECT id FROM users;",
+			want: []Statement{
+				{SQL: "BEGIN", Offset: 0, Terminated: true},
+				{SQL: " SELECT id FROM users", Offset: 6, Terminated: true},
+			},
+		},
+		"semicolons in string literals": {
+			given: "INSERT INTO t (v) VALUES ('a;b'), ('it''s;')",
+			want: []Statement{
+				{SQL: "INSERT INTO t (v) VALUES ('a;b'), ('it''s;')", Offset: 0},
+			},
+		},
+		"semicolons in comments": {
+			given: "SELECT v -- a;b\nFROM t /* c;d */; SELECT w FROM t",
+			want: []Statement{
+				{SQL: "SELECT v -- a;b\nFROM t /* c;d */", Offset: 0, Terminated: true},
+				{SQL: " SELECT w FROM t", Offset: 33},
+			},
+		},
+		"blank statements": {
+			given: " ; -- nothing\n; /* still nothing */ ;",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if diff := cmp.Diff(tc.want, Split(tc.given)); diff != "" {
+				t.Errorf("Split() mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
+
+func Test_Tokenize_mixedPlaceholders(t *testing.T) {
+	t.Parallel()
+
+	_, err := Tokenize("SELECT id FROM users WHERE id = $1 AND email = ?")
+	if diff := cmp.Diff(InvalidExpressionError{Position: 47}, err); diff != "" {
+		t.Errorf("Tokenize() error mismatch (-want,+got): %s", diff)
+	}
+}
+
+func Test_Redact(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		given string
+		want  string
+	}{
+		"create user": {
+			given: "CREATE USER alice WITH PASSWORD 's3cr''et' SUPERUSER",
+			want:  "CREATE USER alice WITH PASSWORD '***' SUPERUSER",
+		},
+		"alter user": {
+			given: "alter user bob password /* new */ 'hunter2';",
+			want:  "alter user bob password /* new */ '***';",
+		},
+		"unterminated password": {
+			given: "CREATE USER alice PASSWORD 'hunter2",
+			want:  "CREATE USER alice PASSWORD ***",
+		},
+		"no password": {
+			given: "SELECT password FROM users WHERE email = 'a@b.com'",
+			want:  "SELECT password FROM users WHERE email = 'a@b.com'",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if diff := cmp.Diff(tc.want, Redact(tc.given)); diff != "" {
+				t.Errorf("Redact() mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
@@ -12,6 +12,7 @@ const (
 	KindAny        Kind = ""
 	KindIllegal    Kind = "ILLEGAL"
 	KindWhitespace      = "WHITESPACE"
+	KindComment    Kind = "COMMENT"
 
 	// SQL keywords
 	KindSelect Kind = "SELECT"
@@ -29,9 +30,26 @@ const (
 	KindIn     Kind = "IN"
 	KindLimit  Kind = "LIMIT"
 
+	// Transaction control
+	KindBegin    Kind = "BEGIN"
+	KindCommit   Kind = "COMMIT"
+	KindRollback Kind = "ROLLBACK"
+
+	// Maintenance
+	KindAnalyze Kind = "ANALYZE"
+	KindCopy    Kind = "COPY"
+	KindWith    Kind = "WITH"
+	KindTo      Kind = "TO"
+
 	// System objects
 	KindTable Kind = "TABLE"
 	KindIndex Kind = "INDEX"
+	KindUser  Kind = "USER"
+
+	// Access control
+	KindAlter  Kind = "ALTER"
+	KindGrant  Kind = "GRANT"
+	KindRevoke Kind = "REVOKE"
 
 	// SQL types
 	KindNumber Kind = "NUMBER"
@@ -41,6 +59,8 @@ const (
 	KindIdentifier    Kind = "IDENTIFIER"
 	KindStringLiteral Kind = "STRING_LITERAL"
 	KindNumberLiteral Kind = "NUMBER_LITERAL"
+	// $1, $2..., or ? numbered in order.
+	KindPlaceholder Kind = "PLACEHOLDER"
 
 	KindNewLine    Kind = "\n"
 	KindDot        Kind = "."
@@ -55,6 +75,9 @@ const (
 	KindBelow Kind = "<"
 )
 
+// maxPlaceholder is the highest placeholder number, as in PostgreSQL.
+const maxPlaceholder = 65535
+
 type Token struct {
 	Kind     Kind
 	Value    any
@@ -83,6 +106,38 @@ var matchers = []Matcher{
 		}
 		return false, nil
 	},
+	// Line comment, up to the end of the line
+	func(s string) (bool, *Token) {
+		if !strings.HasPrefix(s, "--") {
+			return false, nil
+		}
+		end := strings.IndexByte(s, '\n')
+		if end < 0 {
+			end = len(s)
+		}
+		return true, NewToken(KindComment, s[:end], end)
+	},
+	// Block comment, which may nest
+	func(s string) (bool, *Token) {
+		if !strings.HasPrefix(s, "/*") {
+			return false, nil
+		}
+		depth := 0
+		for i := 0; i+1 < len(s); i++ {
+			switch s[i : i+2] {
+			case "/*":
+				depth++
+				i++
+			case "*/":
+				depth--
+				i++
+				if depth == 0 {
+					return true, NewToken(KindComment, s[:i+1], i+1)
+				}
+			}
+		}
+		return false, nil
+	},
 	// String matchers
 	func(s string) (bool, *Token) {
 		for _, tok := range []Kind{
@@ -90,6 +145,8 @@ var matchers = []Matcher{
 			KindEqual, KindAbove, KindBelow, KindInto, KindOpenParen, KindCloseParen,
 			KindValues, KindCreate, KindText, KindNumber, KindUpdate, KindSet, KindOn,
 			KindTable, KindIndex, KindJoin, KindDot, KindIn, KindLimit,
+			KindBegin, KindCommit, KindRollback, KindAnalyze, KindCopy, KindWith, KindTo,
+			KindUser, KindAlter, KindGrant, KindRevoke,
 		} {
 			_, ok := strings.CutPrefix(strings.ToLower(s), strings.ToLower(string(tok)))
 			if ok {
@@ -120,14 +177,44 @@ var matchers = []Matcher{
 		if s[0] != '\'' {
 			return false, nil
 		}
+		// quotes are escaped by doubling them.
 		var i = 1
-		for ; i < len(s) && s[i] != '\''; i++ {
+		for ; i < len(s); i++ {
+			if s[i] != '\'' {
+				continue
+			}
+			if i+1 < len(s) && s[i+1] == '\'' {
+				i++
+				continue
+			}
+			break
 		}
 		if i == len(s) {
 			return false, nil
 		}
 
-		return true, NewToken(KindStringLiteral, s[1:i], i+1)
+		return true, NewToken(KindStringLiteral, strings.ReplaceAll(s[1:i], "''", "'"), i+1)
+	},
+	// Placeholder, $ followed by its number from 1, or ? numbered by Tokenize
+	func(s string) (bool, *Token) {
+		if s[0] == '?' {
+			return true, NewToken(KindPlaceholder, 0, 1)
+		}
+		if s[0] != '$' {
+			return false, nil
+		}
+		var i = 1
+		for ; i < len(s) && s[i] >= '0' && s[i] <= '9'; i++ {
+		}
+		if i == 1 {
+			return false, nil
+		}
+		// numbers out of range are illegal as a whole, rather than read as $ and a number.
+		n, err := strconv.Atoi(s[1:i])
+		if err != nil || n < 1 || n > maxPlaceholder {
+			return true, NewToken(KindIllegal, s[:i], i)
+		}
+		return true, NewToken(KindPlaceholder, n, i)
 	},
 	// Number literal
 	func(s string) (bool, *Token) {
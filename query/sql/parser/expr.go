@@ -2,6 +2,7 @@ package parser
 
 import (
 	"io"
+	"strings"
 
 	"github.com/aliphe/filadb/query/sql/lexer"
 )
@@ -64,6 +65,17 @@ func is(k lexer.Kind) assertion {
 	}
 }
 
+// isWord matches an identifier spelling the word, whatever its case, for the
+// words which are not keywords.
+func isWord(w string) assertion {
+	return func(t ...*lexer.Token) error {
+		if v, ok := t[0].Value.(string); t[0].Kind != lexer.KindIdentifier || !ok || !strings.EqualFold(v, w) {
+			return newUnexpectedTokenError(t[0])
+		}
+		return nil
+	}
+}
+
 func sequence(a ...assertion) assertion {
 	return func(t ...*lexer.Token) error {
 		for i, a := range a {
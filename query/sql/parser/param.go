@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"maps"
+
+	"github.com/aliphe/filadb/db/object"
+)
+
+// Param is a placeholder, standing for the value bound to the parameter
+// Index of the statement, from 1.
+type Param struct {
+	Index int
+}
+
+// Params returns the number of parameters of the query, the highest index of
+// its placeholders.
+func (s *SQLQuery) Params() int {
+	var n int
+	s.mapValues(func(v any) any {
+		if p, ok := v.(Param); ok {
+			n = max(n, p.Index)
+		}
+		return v
+	})
+	return n
+}
+
+// Bind returns a copy of the query, with its placeholders replaced by the
+// arguments, the first one standing for $1. Placeholders without arguments
+// are left as is.
+func (s *SQLQuery) Bind(args []any) *SQLQuery {
+	return s.mapValues(func(v any) any {
+		if p, ok := v.(Param); ok && p.Index <= len(args) {
+			return args[p.Index-1]
+		}
+		return v
+	})
+}
+
+// mapValues returns a copy of the query, with its literal values replaced by
+// fn.
+func (s *SQLQuery) mapValues(fn func(any) any) *SQLQuery {
+	out := *s
+	switch s.Type {
+	case QueryTypeSelect:
+		out.Select = s.Select.mapValues(fn)
+	case QueryTypeInsert:
+		out.Insert.Rows = make([]object.Row, 0, len(s.Insert.Rows))
+		for _, r := range s.Insert.Rows {
+			out.Insert.Rows = append(out.Insert.Rows, mapRow(r, fn))
+		}
+	case QueryTypeUpdate:
+		out.Update.Set.Update = mapRow(s.Update.Set.Update, fn)
+		out.Update.Filters = mapFilters(s.Update.Filters, fn)
+	case QueryTypeCopyTo:
+		out.Copy.Query = s.Copy.Query.mapValues(fn)
+	}
+	return &out
+}
+
+func (s Select) mapValues(fn func(any) any) Select {
+	s.Filters = mapFilters(s.Filters, fn)
+	return s
+}
+
+func mapRow(r object.Row, fn func(any) any) object.Row {
+	out := maps.Clone(r)
+	for k, v := range out {
+		out[k] = fn(v)
+	}
+	return out
+}
+
+func mapFilters(filters []Filter, fn func(any) any) []Filter {
+	if filters == nil {
+		return nil
+	}
+	out := make([]Filter, 0, len(filters))
+	for _, f := range filters {
+		f.Left = f.Left.mapValues(fn)
+		f.Right = f.Right.mapValues(fn)
+		out = append(out, f)
+	}
+	return out
+}
+
+func (v Value) mapValues(fn func(any) any) Value {
+	switch v.Type {
+	case ValueTypeLitteral:
+		v.Value = fn(v.Value)
+	case ValueTypeList:
+		list := v.Value.([]any)
+		out := make([]any, 0, len(list))
+		for _, e := range list {
+			out = append(out, fn(e))
+		}
+		v.Value = out
+	}
+	return v
+}
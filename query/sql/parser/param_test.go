@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/aliphe/filadb/db/object"
+	"github.com/aliphe/filadb/query/sql/lexer"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_SQLQuery_Bind(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		given      string
+		args       []any
+		wantParams int
+		want       string
+	}{
+		"insert": {
+			given:      "INSERT INTO users (id, email) VALUES ($1, $2), (3, $2)",
+			args:       []any{int32(1), "a@b.com"},
+			wantParams: 2,
+			want:       "INSERT INTO users (id, email) VALUES (1, 'a@b.com'), (3, 'a@b.com')",
+		},
+		"filters": {
+			given:      "SELECT id FROM users WHERE email = $2 AND id IN (1, $1)",
+			args:       []any{int32(2), "it's"},
+			wantParams: 2,
+			want:       "SELECT id FROM users WHERE email = 'it''s' AND id IN (1, 2)",
+		},
+		"copy": {
+			given:      "COPY (SELECT id FROM users WHERE id > ?) TO STDOUT",
+			args:       []any{int32(4)},
+			wantParams: 1,
+			want:       "COPY (SELECT id FROM users WHERE id > 4) TO STDOUT",
+		},
+		"none": {
+			given: "SELECT id FROM users",
+			want:  "SELECT id FROM users",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			q := parse(t, tc.given)
+			if got := q.Params(); got != tc.wantParams {
+				t.Errorf("Params() = %d, want %d", got, tc.wantParams)
+			}
+			if diff := cmp.Diff(parse(t, tc.want), q.Bind(tc.args)); diff != "" {
+				t.Errorf("Bind() mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
+
+func Test_SQLQuery_Bind_copies(t *testing.T) {
+	t.Parallel()
+
+	q := parse(t, "INSERT INTO users (id) VALUES ($1)")
+	q.Bind([]any{int32(1)})
+
+	if diff := cmp.Diff([]object.Row{{"id": Param{1}}}, q.Insert.Rows); diff != "" {
+		t.Errorf("bound query mismatch (-want,+got): %s", diff)
+	}
+}
+
+func parse(t *testing.T, q string) *SQLQuery {
+	t.Helper()
+
+	tokens, err := lexer.Tokenize(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Parse(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
@@ -4,10 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/aliphe/filadb/db"
 	"github.com/aliphe/filadb/db/object"
 	"github.com/aliphe/filadb/db/schema"
+	"github.com/aliphe/filadb/db/system"
 	"github.com/aliphe/filadb/query/sql/lexer"
 )
 
@@ -20,6 +22,11 @@ func newUnexpectedTokenError(token *lexer.Token, want ...lexer.Kind) UnexpectedT
 	return UnexpectedTokenError{token, want}
 }
 
+// Position is the offset of the token in the query.
+func (u UnexpectedTokenError) Position() int {
+	return u.token.Position
+}
+
 func (u UnexpectedTokenError) Error() string {
 	if len(u.want) > 0 {
 		return fmt.Sprintf("unexpected token \"%v\" at position %d, want one of %v", u.token.Value, u.token.Position, u.want)
@@ -34,6 +41,22 @@ const (
 	QueryTypeInsert QueryType = "insert"
 	QueryTypeUpdate QueryType = "update"
 	QueryTypeCreate QueryType = "create"
+
+	QueryTypeBegin    QueryType = "begin"
+	QueryTypeCommit   QueryType = "commit"
+	QueryTypeRollback QueryType = "rollback"
+
+	QueryTypeAnalyze  QueryType = "analyze"
+	QueryTypeCopyFrom QueryType = "copy from"
+	QueryTypeCopyTo   QueryType = "copy to"
+
+	QueryTypeAlterRole QueryType = "alter role"
+	QueryTypeGrant     QueryType = "grant"
+	QueryTypeRevoke    QueryType = "revoke"
+
+	QueryTypePrepare    QueryType = "prepare"
+	QueryTypeExecute    QueryType = "execute"
+	QueryTypeDeallocate QueryType = "deallocate"
 )
 
 type CreateType string
@@ -41,14 +64,22 @@ type CreateType string
 const (
 	CreateTypeTable CreateType = "create"
 	CreateTypeIndex CreateType = "index"
+	CreateTypeRole  CreateType = "role"
 )
 
 type SQLQuery struct {
-	Type   QueryType
-	Select Select
-	Insert Insert
-	Update Update
-	Create Create
+	Type       QueryType
+	Select     Select
+	Insert     Insert
+	Update     Update
+	Create     Create
+	Analyze    Analyze
+	Copy       Copy
+	AlterRole  Role
+	Grant      Grant
+	Prepare    Prepare
+	Execute    Execute
+	Deallocate Deallocate
 }
 
 func (s *SQLQuery) Tables() []object.Table {
@@ -59,15 +90,89 @@ func (s *SQLQuery) Tables() []object.Table {
 		return s.Insert.Tables()
 	case QueryTypeUpdate:
 		return s.Update.Tables()
+	case QueryTypeAnalyze:
+		return s.Analyze.Tables()
+	case QueryTypeCopyFrom:
+		return []object.Table{s.Copy.Table}
+	case QueryTypeCopyTo:
+		return s.Copy.Query.Tables()
 	default:
 		return nil
 	}
 }
 
+// Analyze collects the statistics of Table, or of every table when empty.
+type Analyze struct {
+	Table object.Table
+}
+
+func (a *Analyze) Tables() []object.Table {
+	if a.Table == "" {
+		return nil
+	}
+	return []object.Table{a.Table}
+}
+
+type CopyFormat string
+
+const (
+	CopyFormatCSV      CopyFormat = "csv"
+	CopyFormatJSONL    CopyFormat = "jsonl"
+	CopyFormatColumnar CopyFormat = "columnar"
+)
+
+// Copy loads the rows of the file at Path into Table, or writes the rows of
+// Query to it. An empty Path writes to the client instead.
+type Copy struct {
+	Table  object.Table
+	Query  Select
+	Path   string
+	Format CopyFormat
+	// Header tells whether the first line of a CSV file names the columns.
+	Header bool
+}
+
 type Create struct {
 	Type        CreateType
 	CreateTable CreateTable
 	CreateIndex CreateIndex
+	CreateRole  Role
+}
+
+// Role sets the options of a role, leaving those unset as they are. Passwords
+// already hashed as SCRAM credentials are kept as is.
+type Role struct {
+	Name      string
+	Password  *string
+	Superuser *bool
+}
+
+// Grant grants Privileges on Table to Grantees or, without privileges, makes
+// them members of Role. REVOKE reads the same, from the grantees instead.
+type Grant struct {
+	Privileges []system.Privilege
+	Table      object.Table
+	Role       string
+	Grantees   []string
+}
+
+// Prepare prepares Query as the statement Name, for EXECUTE to run it with
+// the values of its placeholders.
+type Prepare struct {
+	Name  string
+	Query *SQLQuery
+}
+
+// Execute runs the prepared statement Name, with Args bound to its
+// placeholders.
+type Execute struct {
+	Name string
+	Args []any
+}
+
+// Deallocate drops the prepared statement Name, or every one when empty.
+type Deallocate struct {
+	Name string
 }
 
 type CreateTable struct {
@@ -180,10 +285,28 @@ func Parse(tokens []*lexer.Token) (*SQLQuery, error) {
 		is(lexer.KindInsert),
 		is(lexer.KindCreate),
 		is(lexer.KindUpdate),
+		is(lexer.KindBegin),
+		is(lexer.KindCommit),
+		is(lexer.KindRollback),
+		is(lexer.KindAnalyze),
+		is(lexer.KindCopy),
+		is(lexer.KindAlter),
+		is(lexer.KindGrant),
+		is(lexer.KindRevoke),
+		isWord("PREPARE"),
+		isWord("EXECUTE"),
+		isWord("DEALLOCATE"),
 	))
 	if err != nil {
 		return nil, err
 	}
+	if cur[0].Kind == lexer.KindIdentifier && strings.EqualFold(cur[0].Value.(string), "PREPARE") {
+		prep, err := parsePrepare(expr)
+		if err != nil {
+			return nil, err
+		}
+		return &SQLQuery{Type: QueryTypePrepare, Prepare: prep}, nil
+	}
 	if cur[0].Kind == lexer.KindSelect {
 		sel, exp, err := parseSelect(expr)
 		if err != nil {
@@ -216,6 +339,70 @@ func Parse(tokens []*lexer.Token) (*SQLQuery, error) {
 		out.Create = create
 		out.Type = QueryTypeCreate
 		expr = exp
+	} else if cur[0].Kind == lexer.KindBegin {
+		out.Type = QueryTypeBegin
+	} else if cur[0].Kind == lexer.KindCommit {
+		out.Type = QueryTypeCommit
+	} else if cur[0].Kind == lexer.KindRollback {
+		out.Type = QueryTypeRollback
+	} else if cur[0].Kind == lexer.KindCopy {
+		cp, exp, err := parseCopy(expr)
+		if err != nil {
+			return nil, err
+		}
+		out.Copy = cp
+		out.Type = QueryTypeCopyFrom
+		if cp.Table == "" {
+			out.Type = QueryTypeCopyTo
+		}
+		expr = exp
+	} else if cur[0].Kind == lexer.KindAnalyze {
+		out.Analyze, expr = parseAnalyze(expr)
+		out.Type = QueryTypeAnalyze
+	} else if cur[0].Kind == lexer.KindAlter {
+		_, exp, err := expr.read(oneOf(is(lexer.KindUser), isWord("ROLE")))
+		if err != nil {
+			return nil, err
+		}
+		role, exp, err := parseRole(exp)
+		if err != nil {
+			return nil, err
+		}
+		out.AlterRole = role
+		out.Type = QueryTypeAlterRole
+		expr = exp
+	} else if cur[0].Kind == lexer.KindGrant {
+		grant, exp, err := parseGrant(expr, lexer.KindTo)
+		if err != nil {
+			return nil, err
+		}
+		out.Grant = grant
+		out.Type = QueryTypeGrant
+		expr = exp
+	} else if cur[0].Kind == lexer.KindRevoke {
+		grant, exp, err := parseGrant(expr, lexer.KindFrom)
+		if err != nil {
+			return nil, err
+		}
+		out.Grant = grant
+		out.Type = QueryTypeRevoke
+		expr = exp
+	} else if strings.EqualFold(cur[0].Value.(string), "EXECUTE") {
+		exec, exp, err := parseExecute(expr)
+		if err != nil {
+			return nil, err
+		}
+		out.Execute = exec
+		out.Type = QueryTypeExecute
+		expr = exp
+	} else if strings.EqualFold(cur[0].Value.(string), "DEALLOCATE") {
+		dealloc, exp, err := parseDeallocate(expr)
+		if err != nil {
+			return nil, err
+		}
+		out.Deallocate = dealloc
+		out.Type = QueryTypeDeallocate
+		expr = exp
 	} else {
 		return nil, newUnexpectedTokenError(cur[0], lexer.KindCreate, lexer.KindSelect, lexer.KindInsert, lexer.KindUpdate)
 	}
@@ -235,6 +422,201 @@ func Parse(tokens []*lexer.Token) (*SQLQuery, error) {
 	return &out, nil
 }
 
+// parsePrepare reads `name AS statement`, up to the end of the query. Only
+// SELECT, INSERT and UPDATE statements can be prepared.
+func parsePrepare(in *expr) (Prepare, error) {
+	cur, _, err := in.read(is(lexer.KindIdentifier), isWord("AS"), oneOf(
+		is(lexer.KindSelect),
+		is(lexer.KindInsert),
+		is(lexer.KindUpdate),
+	))
+	if err != nil {
+		return Prepare{}, err
+	}
+
+	q, err := Parse(in.tokens[2:])
+	if err != nil {
+		return Prepare{}, err
+	}
+	return Prepare{
+		Name:  cur[0].Value.(string),
+		Query: q,
+	}, nil
+}
+
+// parseExecute reads `name [(args)]`, where the arguments are literals.
+func parseExecute(in *expr) (Execute, *expr, error) {
+	cur, expr, err := in.read(is(lexer.KindIdentifier))
+	if err != nil {
+		return Execute{}, nil, err
+	}
+	out := Execute{Name: cur[0].Value.(string)}
+
+	_, exp, err := expr.read(is(lexer.KindOpenParen))
+	if err != nil {
+		return out, expr, nil
+	}
+	expr = exp
+	for {
+		lit, exp, err := parseLiteral(expr)
+		if err != nil {
+			return Execute{}, nil, err
+		}
+		out.Args = append(out.Args, lit)
+
+		cur, exp, err := exp.read(oneOf(is(lexer.KindComma), is(lexer.KindCloseParen)))
+		if err != nil {
+			return Execute{}, nil, err
+		}
+		expr = exp
+		if cur[0].Kind == lexer.KindCloseParen {
+			return out, expr, nil
+		}
+	}
+}
+
+// parseDeallocate reads `[PREPARE] name` or `[PREPARE] ALL`.
+func parseDeallocate(in *expr) (Deallocate, *expr, error) {
+	expr := in
+	if _, exp, err := expr.read(isWord("PREPARE")); err == nil {
+		expr = exp
+	}
+	cur, expr, err := expr.read(is(lexer.KindIdentifier))
+	if err != nil {
+		return Deallocate{}, nil, err
+	}
+	if strings.EqualFold(cur[0].Value.(string), "ALL") {
+		return Deallocate{}, expr, nil
+	}
+	return Deallocate{Name: cur[0].Value.(string)}, expr, nil
+}
+
+func parseCopy(in *expr) (Copy, *expr, error) {
+	out, expr, err := parseCopySource(in)
+	if err != nil {
+		return Copy{}, nil, err
+	}
+	out.Format = CopyFormatCSV
+
+	_, exp, err := expr.read(is(lexer.KindWith), is(lexer.KindOpenParen))
+	if err != nil {
+		return out, expr, nil
+	}
+	expr = exp
+	for {
+		cur, exp, err := expr.read(is(lexer.KindIdentifier))
+		if err != nil {
+			return Copy{}, nil, err
+		}
+		expr = exp
+
+		switch opt := strings.ToUpper(cur[0].Value.(string)); opt {
+		case "FORMAT":
+			cur, exp, err := expr.read(is(lexer.KindIdentifier))
+			if err != nil {
+				return Copy{}, nil, err
+			}
+			expr = exp
+			out.Format = CopyFormat(strings.ToLower(cur[0].Value.(string)))
+			switch out.Format {
+			case CopyFormatCSV, CopyFormatJSONL:
+			case CopyFormatColumnar:
+				if out.Table != "" {
+					return Copy{}, nil, fmt.Errorf("copy format %s is export only", out.Format)
+				}
+			default:
+				return Copy{}, nil, fmt.Errorf("unknown copy format %s", out.Format)
+			}
+		case "HEADER":
+			out.Header = true
+		default:
+			return Copy{}, nil, fmt.Errorf("unknown copy option %s", opt)
+		}
+
+		cur, exp, err = expr.read(oneOf(is(lexer.KindComma), is(lexer.KindCloseParen)))
+		if err != nil {
+			return Copy{}, nil, err
+		}
+		expr = exp
+		if cur[0].Kind == lexer.KindCloseParen {
+			return out, expr, nil
+		}
+	}
+}
+
+// parseCopySource reads either `table FROM 'path'`, or the rows to export and
+// their destination: `table TO` or `(SELECT ...) TO`, followed by a path or
+// STDOUT.
+func parseCopySource(in *expr) (Copy, *expr, error) {
+	cur, expr, err := in.read(oneOf(is(lexer.KindIdentifier), is(lexer.KindOpenParen)))
+	if err != nil {
+		return Copy{}, nil, err
+	}
+
+	var out Copy
+	if cur[0].Kind == lexer.KindOpenParen {
+		_, exp, err := expr.read(is(lexer.KindSelect))
+		if err != nil {
+			return Copy{}, nil, err
+		}
+		sel, exp, err := parseSelect(exp)
+		if err != nil {
+			return Copy{}, nil, err
+		}
+		_, exp, err = exp.read(is(lexer.KindCloseParen), is(lexer.KindTo))
+		if err != nil {
+			return Copy{}, nil, err
+		}
+		out.Query = sel
+		expr = exp
+	} else {
+		table := object.Table(cur[0].Value.(string))
+		cur, exp, err := expr.read(oneOf(is(lexer.KindFrom), is(lexer.KindTo)))
+		if err != nil {
+			return Copy{}, nil, err
+		}
+		expr = exp
+		if cur[0].Kind == lexer.KindFrom {
+			cur, exp, err := expr.read(is(lexer.KindStringLiteral))
+			if err != nil {
+				return Copy{}, nil, err
+			}
+			return Copy{
+				Table: table,
+				Path:  cur[0].Value.(string),
+			}, exp, nil
+		}
+		out.Query = Select{
+			Fields: []Field{{Column: "*"}},
+			From:   table,
+		}
+	}
+
+	cur, expr, err = expr.read(oneOf(is(lexer.KindStringLiteral), is(lexer.KindIdentifier)))
+	if err != nil {
+		return Copy{}, nil, err
+	}
+	if cur[0].Kind == lexer.KindIdentifier {
+		if !strings.EqualFold(cur[0].Value.(string), "stdout") {
+			return Copy{}, nil, newUnexpectedTokenError(cur[0], lexer.KindStringLiteral)
+		}
+		return out, expr, nil
+	}
+	out.Path = cur[0].Value.(string)
+	return out, expr, nil
+}
+
+func parseAnalyze(in *expr) (Analyze, *expr) {
+	cur, expr, err := in.read(is(lexer.KindIdentifier))
+	if err != nil {
+		return Analyze{}, in
+	}
+
+	return Analyze{
+		Table: object.Table(cur[0].Value.(string)),
+	}, expr
+}
+
 func parseUpdate(in *expr) (Update, *expr, error) {
 	cur, expr, err := in.read(
 		is(lexer.KindIdentifier),
@@ -288,12 +670,12 @@ func parseSetContent(in *expr) (object.Row, *expr, error) {
 		cur, exp, err := it.read(
 			is(lexer.KindIdentifier),
 			is(lexer.KindEqual),
-			oneOf(is(lexer.KindNumberLiteral), is(lexer.KindStringLiteral)),
+			oneOf(is(lexer.KindNumberLiteral), is(lexer.KindStringLiteral), is(lexer.KindPlaceholder)),
 		)
 		if err != nil {
 			return nil, nil, err
 		}
-		out[cur[0].Value.(string)] = cur[2].Value
+		out[cur[0].Value.(string)] = value(cur[2])
 		it = exp
 
 		cur, exp, err = it.r(1)
@@ -313,7 +695,7 @@ func parseSetContent(in *expr) (object.Row, *expr, error) {
 func parseCreate(in *expr) (Create, *expr, error) {
 	var out Create
 
-	cur, expr, err := in.read(oneOf(is(lexer.KindTable), is(lexer.KindIndex)))
+	cur, expr, err := in.read(oneOf(is(lexer.KindTable), is(lexer.KindIndex), is(lexer.KindUser), isWord("ROLE")))
 	if err != nil {
 		return out, nil, err
 	}
@@ -340,6 +722,146 @@ func parseCreate(in *expr) (Create, *expr, error) {
 			out.CreateIndex = ci
 			expr = exp
 		}
+	case lexer.KindUser, lexer.KindIdentifier:
+		{
+			cr, exp, err := parseRole(expr)
+			if err != nil {
+				return Create{}, nil, err
+			}
+			out.Type = CreateTypeRole
+			out.CreateRole = cr
+			expr = exp
+		}
+	}
+
+	return out, expr, nil
+}
+
+// parseRole reads `name [WITH] [SUPERUSER | NOSUPERUSER] [PASSWORD 'password']`.
+// The options are read as identifiers, so that columns can still be named so.
+func parseRole(in *expr) (Role, *expr, error) {
+	cur, expr, err := in.read(is(lexer.KindIdentifier))
+	if err != nil {
+		return Role{}, nil, err
+	}
+	out := Role{Name: cur[0].Value.(string)}
+
+	if _, exp, err := expr.read(is(lexer.KindWith)); err == nil {
+		expr = exp
+	}
+	for {
+		cur, exp, err := expr.read(is(lexer.KindIdentifier))
+		if err != nil {
+			break
+		}
+		switch opt := strings.ToUpper(cur[0].Value.(string)); opt {
+		case "PASSWORD":
+			cur, exp, err = exp.read(is(lexer.KindStringLiteral))
+			if err != nil {
+				return Role{}, nil, err
+			}
+			password := cur[0].Value.(string)
+			out.Password = &password
+		case "SUPERUSER", "NOSUPERUSER":
+			superuser := opt == "SUPERUSER"
+			out.Superuser = &superuser
+		default:
+			return Role{}, nil, fmt.Errorf("unknown role option %s", opt)
+		}
+		expr = exp
+	}
+
+	return out, expr, nil
+}
+
+// parseGrant reads `privileges ON [TABLE] table to grantees` or
+// `role to grantees`, where to is the keyword introducing the grantees.
+func parseGrant(in *expr, to lexer.Kind) (Grant, *expr, error) {
+	var out Grant
+
+	cur, expr, err := in.read(is(lexer.KindIdentifier), is(to))
+	if err == nil {
+		out.Role = cur[0].Value.(string)
+	} else {
+		out.Privileges, expr, err = parsePrivileges(in)
+		if err != nil {
+			return Grant{}, nil, err
+		}
+		_, expr, err = expr.read(is(lexer.KindOn))
+		if err != nil {
+			return Grant{}, nil, err
+		}
+		if _, exp, err := expr.read(is(lexer.KindTable)); err == nil {
+			expr = exp
+		}
+		cur, expr, err = expr.read(is(lexer.KindIdentifier), is(to))
+		if err != nil {
+			return Grant{}, nil, err
+		}
+		out.Table = object.Table(cur[0].Value.(string))
+	}
+
+	for {
+		cur, exp, err := expr.read(is(lexer.KindIdentifier))
+		if err != nil {
+			return Grant{}, nil, err
+		}
+		out.Grantees = append(out.Grantees, cur[0].Value.(string))
+		expr = exp
+
+		_, exp, err = expr.read(is(lexer.KindComma))
+		if err != nil {
+			break
+		}
+		expr = exp
+	}
+
+	return out, expr, nil
+}
+
+// parsePrivileges reads a list of privileges, or ALL [PRIVILEGES].
+func parsePrivileges(in *expr) ([]system.Privilege, *expr, error) {
+	var out []system.Privilege
+	expr := in
+	for {
+		cur, exp, err := expr.read(oneOf(
+			is(lexer.KindSelect),
+			is(lexer.KindInsert),
+			is(lexer.KindUpdate),
+			is(lexer.KindCreate),
+			isWord("DELETE"),
+			isWord("ALL"),
+		))
+		if err != nil {
+			return nil, nil, err
+		}
+		expr = exp
+
+		switch cur[0].Kind {
+		case lexer.KindSelect:
+			out = append(out, system.PrivilegeSelect)
+		case lexer.KindInsert:
+			out = append(out, system.PrivilegeInsert)
+		case lexer.KindUpdate:
+			out = append(out, system.PrivilegeUpdate)
+		case lexer.KindCreate:
+			out = append(out, system.PrivilegeCreate)
+		default:
+			if strings.ToUpper(cur[0].Value.(string)) == "DELETE" {
+				out = append(out, system.PrivilegeDelete)
+				break
+			}
+			out = append(out, system.Privileges...)
+			if _, exp, err := expr.read(isWord("PRIVILEGES")); err == nil {
+				expr = exp
+			}
+		}
+
+		_, exp, err = expr.read(is(lexer.KindComma))
+		if err != nil {
+			break
+		}
+		expr = exp
 	}
 
 	return out, expr, nil
@@ -441,14 +963,14 @@ func parseCSV(in *expr) ([]any, *expr, error) {
 	var row []any
 	for {
 		cur, exp, err := expr.read(
-			oneOf(is(lexer.KindNumberLiteral), is(lexer.KindStringLiteral), is(lexer.KindIdentifier)),
+			oneOf(is(lexer.KindNumberLiteral), is(lexer.KindStringLiteral), is(lexer.KindPlaceholder), is(lexer.KindIdentifier)),
 			oneOf(is(lexer.KindCloseParen), is(lexer.KindComma)),
 		)
 		if err != nil {
 			return nil, nil, err
 		}
 		expr = exp
-		row = append(row, cur[0].Value)
+		row = append(row, value(cur[0]))
 
 		if cur[1].Kind == lexer.KindCloseParen {
 			break
@@ -568,15 +1090,16 @@ func parseSelect(in *expr) (Select, *expr, error) {
 }
 
 func parseLimit(in *expr) (Limit, *expr, error) {
-	r, expr, err := in.read(is(lexer.KindLimit), is(lexer.KindNumberLiteral))
+	_, expr, err := in.read(is(lexer.KindLimit))
+	if err != nil {
+		return Limit{}, in, nil
+	}
+	r, expr, err := expr.read(is(lexer.KindNumberLiteral))
 	if err != nil {
-		if errors.Is(io.EOF, err) {
-			return Limit{}, in, nil
-		}
 		return Limit{}, nil, err
 	}
 
-	limit, ok := r[1].Value.(int32)
+	limit, ok := r[0].Value.(int32)
 	if !ok {
 		return Limit{}, in, errors.New("failed to parse limit")
 	}
@@ -637,12 +1160,21 @@ func parseLiteral(in *expr) (any, *expr, error) {
 	cur, expr, err := in.read(oneOf(
 		is(lexer.KindStringLiteral),
 		is(lexer.KindNumberLiteral),
+		is(lexer.KindPlaceholder),
 	))
 	if err != nil {
 		return nil, nil, err
 	}
 
-	return cur[0].Value, expr, err
+	return value(cur[0]), expr, err
+}
+
+// value returns the value of a literal token, or the Param of a placeholder.
+func value(t *lexer.Token) any {
+	if t.Kind == lexer.KindPlaceholder {
+		return Param{Index: t.Value.(int)}
+	}
+	return t.Value
 }
 
 func parseField(in *expr) (Field, *expr, error) {
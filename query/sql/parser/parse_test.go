@@ -5,6 +5,7 @@ import (
 
 	"github.com/aliphe/filadb/db"
 	"github.com/aliphe/filadb/db/object"
+	"github.com/aliphe/filadb/db/system"
 	"github.com/aliphe/filadb/query/sql/lexer"
 	"github.com/google/go-cmp/cmp"
 )
@@ -160,6 +161,249 @@ func Test_Parse(t *testing.T) {
 				},
 			},
 		},
+		{
+			given: "COPY users FROM 'users.jsonl' WITH (FORMAT jsonl)",
+			want: &SQLQuery{
+				Type: QueryTypeCopyFrom,
+				Copy: Copy{Table: "users", Path: "users.jsonl", Format: CopyFormatJSONL},
+			},
+		},
+		{
+			given: "COPY users FROM 'users.csv' WITH (HEADER, FORMAT CSV);",
+			want: &SQLQuery{
+				Type: QueryTypeCopyFrom,
+				Copy: Copy{Table: "users", Path: "users.csv", Format: CopyFormatCSV, Header: true},
+			},
+		},
+		{
+			given: "COPY users FROM 'users.csv'",
+			want: &SQLQuery{
+				Type: QueryTypeCopyFrom,
+				Copy: Copy{Table: "users", Path: "users.csv", Format: CopyFormatCSV},
+			},
+		},
+		{
+			given: "COPY (SELECT id, email FROM users WHERE id > 1) TO 'users.jsonl' WITH (FORMAT jsonl);",
+			want: &SQLQuery{
+				Type: QueryTypeCopyTo,
+				Copy: Copy{
+					Query: Select{
+						Fields: []Field{{Column: "id"}, {Column: "email"}},
+						From:   "users",
+						Filters: []Filter{
+							{
+								Left:  Value{Type: ValueTypeReference, Reference: Field{Column: "id"}},
+								Op:    db.OpMoreThan,
+								Right: Value{Type: ValueTypeLitteral, Value: int32(1)},
+							},
+						},
+					},
+					Path:   "users.jsonl",
+					Format: CopyFormatJSONL,
+				},
+			},
+		},
+		{
+			given: "COPY (SELECT * FROM users LIMIT 2) TO STDOUT WITH (FORMAT columnar)",
+			want: &SQLQuery{
+				Type: QueryTypeCopyTo,
+				Copy: Copy{
+					Query: Select{
+						Fields: []Field{{Column: "*"}},
+						From:   "users",
+						Limit:  Limit{Limit: ptr(int32(2))},
+					},
+					Format: CopyFormatColumnar,
+				},
+			},
+		},
+		{
+			given: "COPY users TO 'users.csv' WITH (HEADER)",
+			want: &SQLQuery{
+				Type: QueryTypeCopyTo,
+				Copy: Copy{
+					Query: Select{
+						Fields: []Field{{Column: "*"}},
+						From:   "users",
+					},
+					Path:   "users.csv",
+					Format: CopyFormatCSV,
+					Header: true,
+				},
+			},
+		},
+		{
+			given: "ANALYZE users;",
+			want: &SQLQuery{
+				Type:    QueryTypeAnalyze,
+				Analyze: Analyze{Table: "users"},
+			},
+		},
+		{
+			given: "ANALYZE",
+			want: &SQLQuery{
+				Type: QueryTypeAnalyze,
+			},
+		},
+		{
+			given: "BEGIN;",
+			want: &SQLQuery{
+				Type: QueryTypeBegin,
+			},
+		},
+		{
+			given: "ROLLBACK",
+			want: &SQLQuery{
+				Type: QueryTypeRollback,
+			},
+		},
+		{
+			given: "CREATE USER alice WITH PASSWORD 'it''s secret';",
+			want: &SQLQuery{
+				Type: QueryTypeCreate,
+				Create: Create{
+					Type:       CreateTypeRole,
+					CreateRole: Role{Name: "alice", Password: ptr("it's secret")},
+				},
+			},
+		},
+		{
+			given: "CREATE ROLE admin WITH SUPERUSER",
+			want: &SQLQuery{
+				Type: QueryTypeCreate,
+				Create: Create{
+					Type:       CreateTypeRole,
+					CreateRole: Role{Name: "admin", Superuser: ptr(true)},
+				},
+			},
+		},
+		{
+			given: "ALTER USER alice PASSWORD 'secret'",
+			want: &SQLQuery{
+				Type:      QueryTypeAlterRole,
+				AlterRole: Role{Name: "alice", Password: ptr("secret")},
+			},
+		},
+		{
+			given: "ALTER ROLE alice NOSUPERUSER",
+			want: &SQLQuery{
+				Type:      QueryTypeAlterRole,
+				AlterRole: Role{Name: "alice", Superuser: ptr(false)},
+			},
+		},
+		{
+			given: "GRANT SELECT, insert ON TABLE users TO alice, bob;",
+			want: &SQLQuery{
+				Type: QueryTypeGrant,
+				Grant: Grant{
+					Privileges: []system.Privilege{system.PrivilegeSelect, system.PrivilegeInsert},
+					Table:      "users",
+					Grantees:   []string{"alice", "bob"},
+				},
+			},
+		},
+		{
+			given: "GRANT ALL PRIVILEGES ON users TO alice",
+			want: &SQLQuery{
+				Type: QueryTypeGrant,
+				Grant: Grant{
+					Privileges: system.Privileges,
+					Table:      "users",
+					Grantees:   []string{"alice"},
+				},
+			},
+		},
+		{
+			given: "REVOKE UPDATE, DELETE ON users FROM alice",
+			want: &SQLQuery{
+				Type: QueryTypeRevoke,
+				Grant: Grant{
+					Privileges: []system.Privilege{system.PrivilegeUpdate, system.PrivilegeDelete},
+					Table:      "users",
+					Grantees:   []string{"alice"},
+				},
+			},
+		},
+		{
+			given: "GRANT readers TO alice",
+			want: &SQLQuery{
+				Type: QueryTypeGrant,
+				Grant: Grant{
+					Role:     "readers",
+					Grantees: []string{"alice"},
+				},
+			},
+		},
+		{
+			given: "REVOKE readers FROM alice;",
+			want: &SQLQuery{
+				Type: QueryTypeRevoke,
+				Grant: Grant{
+					Role:     "readers",
+					Grantees: []string{"alice"},
+				},
+			},
+		},
+		{
+			given: "SELECT email FROM users WHERE id IN (?, ?)",
+			want: &SQLQuery{
+				Type: QueryTypeSelect,
+				Select: Select{
+					Fields: []Field{{Column: "email"}},
+					From:   "users",
+					Filters: []Filter{
+						{
+							Left:  Value{Type: ValueTypeReference, Reference: Field{Column: "id"}},
+							Op:    db.OpInclude,
+							Right: Value{Type: ValueTypeList, Value: []any{Param{1}, Param{2}}},
+						},
+					},
+				},
+			},
+		},
+		{
+			given: "PREPARE by_id AS UPDATE users SET email = $2 WHERE id = $1;",
+			want: &SQLQuery{
+				Type: QueryTypePrepare,
+				Prepare: Prepare{
+					Name: "by_id",
+					Query: &SQLQuery{
+						Type: QueryTypeUpdate,
+						Update: Update{
+							From: "users",
+							Set:  Set{Update: object.Row{"email": Param{2}}},
+							Filters: []Filter{
+								{
+									Left:  Value{Type: ValueTypeReference, Reference: Field{Column: "id"}},
+									Op:    db.OpEqual,
+									Right: Value{Type: ValueTypeLitteral, Value: Param{1}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			given: "EXECUTE by_id(1, 'a@b.com')",
+			want: &SQLQuery{
+				Type:    QueryTypeExecute,
+				Execute: Execute{Name: "by_id", Args: []any{int32(1), "a@b.com"}},
+			},
+		},
+		{
+			given: "DEALLOCATE PREPARE by_id",
+			want: &SQLQuery{
+				Type:       QueryTypeDeallocate,
+				Deallocate: Deallocate{Name: "by_id"},
+			},
+		},
+		{
+			given: "DEALLOCATE ALL",
+			want: &SQLQuery{
+				Type: QueryTypeDeallocate,
+			},
+		},
 	}
 
 	for _, tc := range tests {
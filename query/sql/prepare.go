@@ -0,0 +1,151 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/aliphe/filadb/db/schema"
+	"github.com/aliphe/filadb/query"
+	"github.com/aliphe/filadb/query/sql/eval"
+	"github.com/aliphe/filadb/query/sql/parser"
+)
+
+// statement is a statement prepared in a session, parsed once. Executing it
+// validates it against the current schema and checks the privileges of the
+// user again, as the tables it reads may have changed and the privileges been
+// revoked since.
+type statement struct {
+	q    *parser.SQLQuery
+	desc *query.Statement
+}
+
+// Prepare prepares expr as the statement name, failing with a *query.Error.
+func (s *Session) Prepare(ctx context.Context, name, expr string) (*query.Statement, error) {
+	if name == "" {
+		delete(s.statements, name)
+	}
+
+	q, err := parse(expr)
+	if err != nil {
+		return nil, s.fail(err)
+	}
+	stmt, err := s.prepare(ctx, name, q)
+	if err != nil {
+		return nil, s.fail(err)
+	}
+	return stmt, nil
+}
+
+// Execute runs the statement name with the arguments bound to its
+// placeholders, failing with a *query.Error.
+func (s *Session) Execute(ctx context.Context, name string, args ...any) (*query.Result, error) {
+	res, err := s.execute(ctx, name, args)
+	if err != nil {
+		return nil, s.fail(err)
+	}
+	return res, nil
+}
+
+// Deallocate drops the statement name, failing with a *query.Error.
+func (s *Session) Deallocate(name string) error {
+	if err := s.deallocate(name); err != nil {
+		return newError(err)
+	}
+	return nil
+}
+
+func (s *Session) prepare(ctx context.Context, name string, q *parser.SQLQuery) (*query.Statement, error) {
+	if _, ok := s.statements[name]; ok && name != "" {
+		return nil, fmt.Errorf("%s: %w", name, ErrStatementExists)
+	}
+
+	var desc *query.Statement
+	err := s.view(ctx, func(ctx context.Context) error {
+		var err error
+		desc, err = s.r.prepare(ctx, s.user, q)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// EXECUTE returns the rows of the statement it runs.
+	if target, ok := s.statements[q.Execute.Name]; ok && q.Type == parser.QueryTypeExecute {
+		desc.Columns = target.desc.Columns
+	}
+
+	s.statements[name] = &statement{q: q, desc: desc}
+	return desc, nil
+}
+
+func (s *Session) execute(ctx context.Context, name string, args []any) (*query.Result, error) {
+	stmt, ok := s.statements[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, ErrUnknownStatement)
+	}
+
+	args, err := bindArgs(stmt.desc.Params, args)
+	if err != nil {
+		return nil, err
+	}
+	// the bound query is run as any other, against the schema it sees now.
+	return s.exec(ctx, stmt.q.Bind(args))
+}
+
+func (s *Session) deallocate(name string) error {
+	if _, ok := s.statements[name]; !ok {
+		return fmt.Errorf("%s: %w", name, ErrUnknownStatement)
+	}
+	delete(s.statements, name)
+	return nil
+}
+
+// bindArgs checks the arguments against the types of the parameters, and
+// returns them as the parser reads literals: numbers as int32, and text as
+// strings. Parameters of unknown types take either.
+func bindArgs(types []schema.ColumnType, args []any) ([]any, error) {
+	if len(args) != len(types) {
+		return nil, fmt.Errorf("%d arguments for %d parameters: %w", len(args), len(types), ErrParameterCount)
+	}
+
+	out := make([]any, 0, len(args))
+	for i, a := range args {
+		v, err := bindArg(types[i], a)
+		if err != nil {
+			return nil, fmt.Errorf("parameter $%d: %w", i+1, err)
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func bindArg(t schema.ColumnType, v any) (any, error) {
+	if v == nil {
+		return nil, ErrNullParameter
+	}
+
+	var n int64
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		if t == schema.ColumnTypeNumber {
+			return nil, fmt.Errorf("%T in %s column: %w", v, t, schema.ErrTypeMismatch)
+		}
+		return rv.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = int64(min(rv.Uint(), math.MaxInt64))
+	default:
+		return nil, fmt.Errorf("%T: %w", v, schema.ErrTypeMismatch)
+	}
+
+	if t == schema.ColumnTypeText {
+		return nil, fmt.Errorf("%T in %s column: %w", v, t, schema.ErrTypeMismatch)
+	}
+	if n < math.MinInt32 || n > math.MaxInt32 {
+		return nil, fmt.Errorf("%d out of range: %w", n, eval.ErrInvalidValue)
+	}
+	return int32(n), nil
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 
 	"github.com/aliphe/filadb/db"
+	"github.com/aliphe/filadb/db/storage"
+	"github.com/aliphe/filadb/net/scram"
+	"github.com/aliphe/filadb/query"
 	"github.com/aliphe/filadb/query/sql/eval"
-	"github.com/aliphe/filadb/query/sql/lexer"
 	"github.com/aliphe/filadb/query/sql/parser"
 	"github.com/aliphe/filadb/query/sql/validation"
 )
@@ -21,17 +23,46 @@ func NewRunner(db *db.Client) *Runner {
 	}
 }
 
-func (r *Runner) Run(ctx context.Context, expr string) ([]byte, error) {
-	tokens, err := lexer.Tokenize(expr)
-	if err != nil {
-		return nil, err
+// Run runs expr in a session of its own.
+func (r *Runner) Run(ctx context.Context, expr string) (*query.Result, error) {
+	s := r.Session("")
+	defer s.Close(ctx)
+
+	return s.Run(ctx, expr)
+}
+
+// Session opens a session running queries as the user, or with every
+// privilege if the user is empty.
+func (r *Runner) Session(user string) query.Session {
+	return &Session{
+		r:          r,
+		user:       user,
+		statements: make(map[string]*statement),
 	}
+}
+
+func (r *Runner) Credentials(ctx context.Context, user string) (scram.Credentials, error) {
+	var out scram.Credentials
+	err := r.view(ctx, func(ctx context.Context) error {
+		var err error
+		out, err = r.db.Credentials(ctx, user)
+		return err
+	})
+	return out, err
+}
 
-	q, err := parser.Parse(tokens)
+// view runs fn in a transaction, which is rolled back once it returns.
+func (r *Runner) view(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, err := r.db.Begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("parsing expression: %w", err)
+		return fmt.Errorf("begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
+
+	return fn(storage.WithTx(ctx, tx))
+}
 
+func (r *Runner) run(ctx context.Context, user string, q *parser.SQLQuery) (*query.Result, error) {
 	shape, err := r.db.Shape(ctx, q.Tables())
 	if err != nil {
 		return nil, err
@@ -43,6 +74,10 @@ func (r *Runner) Run(ctx context.Context, expr string) ([]byte, error) {
 		return nil, err
 	}
 
+	if err := r.authorize(ctx, user, q); err != nil {
+		return nil, err
+	}
+
 	eval := eval.New(r.db, shape)
 	out, err := eval.EvalExpr(ctx, q)
 	if err != nil {
@@ -51,3 +86,25 @@ func (r *Runner) Run(ctx context.Context, expr string) ([]byte, error) {
 
 	return out, nil
 }
+
+// prepare validates q, and describes its parameters and the rows it returns.
+func (r *Runner) prepare(ctx context.Context, user string, q *parser.SQLQuery) (*query.Statement, error) {
+	shape, err := r.db.Shape(ctx, q.Tables())
+	if err != nil {
+		return nil, err
+	}
+
+	sc := validation.NewSanityChecker(shape)
+	if err := sc.Check(q); err != nil {
+		return nil, err
+	}
+
+	if err := r.authorize(ctx, user, q); err != nil {
+		return nil, err
+	}
+
+	return &query.Statement{
+		Params:  sc.Params(q),
+		Columns: eval.New(r.db, shape).Describe(q),
+	}, nil
+}
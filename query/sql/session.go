@@ -0,0 +1,197 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aliphe/filadb/db/storage"
+	"github.com/aliphe/filadb/query"
+	"github.com/aliphe/filadb/query/sql/lexer"
+	"github.com/aliphe/filadb/query/sql/parser"
+)
+
+// Session runs queries for a single client.
+//
+// Outside of a transaction block, each statement runs in a transaction of its
+// own, so it is applied entirely or not at all. BEGIN opens a transaction
+// block, which lasts until COMMIT or ROLLBACK. Once a statement fails within a
+// block, even to parse, the following ones are rejected until the block ends.
+type Session struct {
+	r      *Runner
+	user   string
+	tx     storage.Tx
+	failed bool
+	// statements are the statements prepared in the session, by name.
+	statements map[string]*statement
+}
+
+// Run runs expr, failing with a *query.Error.
+func (s *Session) Run(ctx context.Context, expr string) (*query.Result, error) {
+	res, err := s.run(ctx, expr)
+	if err != nil {
+		return nil, s.fail(err)
+	}
+	return res, nil
+}
+
+// fail classifies the error of a statement, which fails the transaction
+// block if one is open.
+func (s *Session) fail(err error) *query.Error {
+	if s.tx != nil {
+		s.failed = true
+	}
+	return newError(err)
+}
+
+func (s *Session) run(ctx context.Context, expr string) (*query.Result, error) {
+	q, err := parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	if n := q.Params(); n > 0 {
+		return nil, fmt.Errorf("0 arguments for %d parameters: %w", n, ErrParameterCount)
+	}
+
+	return s.exec(ctx, q)
+}
+
+// exec runs q, in the transaction block if one is open.
+func (s *Session) exec(ctx context.Context, q *parser.SQLQuery) (*query.Result, error) {
+	switch q.Type {
+	case parser.QueryTypeBegin:
+		return &query.Result{Tag: "BEGIN"}, s.begin(ctx)
+	case parser.QueryTypeCommit:
+		return &query.Result{Tag: "COMMIT"}, s.commit(ctx)
+	case parser.QueryTypeRollback:
+		return &query.Result{Tag: "ROLLBACK"}, s.rollback(ctx)
+	}
+
+	if s.failed {
+		return nil, ErrTransactionAborted
+	}
+
+	switch q.Type {
+	case parser.QueryTypePrepare:
+		_, err := s.prepare(ctx, q.Prepare.Name, q.Prepare.Query)
+		return &query.Result{Tag: "PREPARE"}, err
+	case parser.QueryTypeExecute:
+		return s.execute(ctx, q.Execute.Name, q.Execute.Args)
+	case parser.QueryTypeDeallocate:
+		if q.Deallocate.Name == "" {
+			clear(s.statements)
+			return &query.Result{Tag: "DEALLOCATE ALL"}, nil
+		}
+		return &query.Result{Tag: "DEALLOCATE"}, s.deallocate(q.Deallocate.Name)
+	}
+
+	if s.tx == nil {
+		return s.runAutocommit(ctx, q)
+	}
+	return s.r.run(storage.WithTx(ctx, s.tx), s.user, q)
+}
+
+// view runs fn in the open transaction, or in a transaction of its own
+// rolled back once it returns.
+func (s *Session) view(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s.tx != nil {
+		return fn(storage.WithTx(ctx, s.tx))
+	}
+	return s.r.view(ctx, fn)
+}
+
+func parse(expr string) (*parser.SQLQuery, error) {
+	tokens, err := lexer.Tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := parser.Parse(tokens)
+	if err != nil {
+		return nil, fmt.Errorf("parsing expression: %w", &syntaxError{err})
+	}
+	return q, nil
+}
+
+func (s *Session) runAutocommit(ctx context.Context, q *parser.SQLQuery) (*query.Result, error) {
+	tx, err := s.r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+
+	out, err := s.r.run(storage.WithTx(ctx, tx), s.user, q)
+	if err != nil {
+		return nil, errors.Join(err, tx.Rollback(ctx))
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return out, nil
+}
+
+func (s *Session) begin(ctx context.Context) error {
+	if s.tx != nil {
+		return ErrTransactionInProgress
+	}
+
+	tx, err := s.r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	s.tx = tx
+
+	return nil
+}
+
+// commit commits the open transaction. A failed transaction is rolled back instead.
+func (s *Session) commit(ctx context.Context) error {
+	if s.tx == nil {
+		return ErrNoTransaction
+	}
+	if s.failed {
+		return errors.Join(ErrTransactionAborted, s.rollback(ctx))
+	}
+
+	tx := s.tx
+	s.tx = nil
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Session) rollback(ctx context.Context) error {
+	if s.tx == nil {
+		return ErrNoTransaction
+	}
+
+	tx := s.tx
+	s.tx = nil
+	s.failed = false
+	if err := tx.Rollback(ctx); err != nil {
+		return fmt.Errorf("rollback transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Session) Status() query.TxStatus {
+	switch {
+	case s.tx == nil:
+		return query.TxIdle
+	case s.failed:
+		return query.TxFailed
+	default:
+		return query.TxActive
+	}
+}
+
+func (s *Session) Close(ctx context.Context) error {
+	if s.tx == nil {
+		return nil
+	}
+	return s.rollback(ctx)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/aliphe/filadb/db/object"
+	"github.com/aliphe/filadb/db/schema"
 	"github.com/aliphe/filadb/db/system"
 	"github.com/aliphe/filadb/query/sql/parser"
 )
@@ -24,6 +25,10 @@ func (sc *SanityChecker) Check(q *parser.SQLQuery) error {
 		{
 			return sc.checkSelect(&q.Select)
 		}
+	case parser.QueryTypeCopyTo:
+		{
+			return sc.checkSelect(&q.Copy.Query)
+		}
 	}
 
 	return nil
@@ -58,3 +63,78 @@ func (sc *SanityChecker) checkFields(fields []parser.Field) error {
 
 	return nil
 }
+
+// Params returns the types of the parameters of q, those of the columns their
+// placeholders are assigned to or compared with. The types of the parameters
+// used otherwise are left empty.
+func (sc *SanityChecker) Params(q *parser.SQLQuery) []schema.ColumnType {
+	out := make([]schema.ColumnType, q.Params())
+	set := func(v any, t schema.ColumnType) {
+		if p, ok := v.(parser.Param); ok && out[p.Index-1] == "" {
+			out[p.Index-1] = t
+		}
+	}
+	filters := func(filters []parser.Filter, from object.Table) {
+		for _, f := range filters {
+			for _, side := range [][2]parser.Value{{f.Left, f.Right}, {f.Right, f.Left}} {
+				v, other := side[0], side[1]
+				if other.Type != parser.ValueTypeReference {
+					continue
+				}
+				t := sc.referenceType(other.Reference, from)
+				switch v.Type {
+				case parser.ValueTypeLitteral:
+					set(v.Value, t)
+				case parser.ValueTypeList:
+					for _, e := range v.Value.([]any) {
+						set(e, t)
+					}
+				}
+			}
+		}
+	}
+
+	switch q.Type {
+	case parser.QueryTypeSelect:
+		filters(q.Select.Filters, q.Select.From)
+	case parser.QueryTypeCopyTo:
+		filters(q.Copy.Query.Filters, q.Copy.Query.From)
+	case parser.QueryTypeInsert:
+		for _, r := range q.Insert.Rows {
+			for col, v := range r {
+				set(v, sc.columnType(q.Insert.Table, col))
+			}
+		}
+	case parser.QueryTypeUpdate:
+		for col, v := range q.Update.Set.Update {
+			set(v, sc.columnType(q.Update.From, col))
+		}
+		filters(q.Update.Filters, q.Update.From)
+	}
+	return out
+}
+
+// referenceType returns the type of the referenced column, empty if unknown.
+// Unqualified columns are looked up in every table, then in from.
+func (sc *SanityChecker) referenceType(f parser.Field, from object.Table) schema.ColumnType {
+	if f.Table != "" {
+		return sc.columnType(f.Table, f.Column)
+	}
+	if tables := sc.shape.ColMappings[f.Column]; len(tables) == 1 {
+		return sc.columnType(tables[0], f.Column)
+	}
+	return sc.columnType(from, f.Column)
+}
+
+func (sc *SanityChecker) columnType(t object.Table, col string) schema.ColumnType {
+	sch, ok := sc.shape.Schemas[t]
+	if !ok {
+		return ""
+	}
+	for _, c := range sch.Columns {
+		if c.Name == col {
+			return c.Type
+		}
+	}
+	return ""
+}
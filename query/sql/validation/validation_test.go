@@ -8,6 +8,7 @@ import (
 	"github.com/aliphe/filadb/db/system"
 	"github.com/aliphe/filadb/query/sql/lexer"
 	"github.com/aliphe/filadb/query/sql/parser"
+	"github.com/google/go-cmp/cmp"
 )
 
 func Test_Check(t *testing.T) {
@@ -147,3 +148,70 @@ func Test_Check(t *testing.T) {
 		})
 	}
 }
+
+func Test_Params(t *testing.T) {
+	t.Parallel()
+
+	shape := system.NewDatabaseShape([]*schema.Schema{
+		{
+			Table: "users",
+			Columns: []schema.Column{
+				{Name: "id", Type: schema.ColumnTypeNumber},
+				{Name: "email", Type: schema.ColumnTypeText},
+			},
+		},
+		{
+			Table: "posts",
+			Columns: []schema.Column{
+				{Name: "id", Type: schema.ColumnTypeNumber},
+				{Name: "title", Type: schema.ColumnTypeText},
+			},
+		},
+	})
+
+	tests := map[string]struct {
+		given string
+		want  []schema.ColumnType
+	}{
+		"insert": {
+			given: "INSERT INTO users (id, email) VALUES ($1, $2)",
+			want:  []schema.ColumnType{schema.ColumnTypeNumber, schema.ColumnTypeText},
+		},
+		"update": {
+			given: "UPDATE posts SET title = ? WHERE id = ?",
+			want:  []schema.ColumnType{schema.ColumnTypeText, schema.ColumnTypeNumber},
+		},
+		"filters": {
+			given: "SELECT title FROM posts WHERE $2 = title AND posts.id IN ($1, 2)",
+			want:  []schema.ColumnType{schema.ColumnTypeNumber, schema.ColumnTypeText},
+		},
+		"unknown": {
+			given: "SELECT id FROM users WHERE $1 = $2",
+			want:  []schema.ColumnType{"", ""},
+		},
+		"none": {
+			given: "SELECT id FROM users",
+			want:  []schema.ColumnType{},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tokens, err := lexer.Tokenize(tc.given)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q, err := parser.Parse(tokens)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := NewSanityChecker(shape).Params(q)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Params() mismatch (-want,+got): %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package filadb
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aliphe/filadb/query"
+)
+
+// Rows iterates over the rows returned by a statement.
+type Rows struct {
+	res *query.Result
+	// next is the index of the next row.
+	next int
+	row  []any
+}
+
+// Columns returns the names of the columns of the rows.
+func (r *Rows) Columns() []string {
+	out := make([]string, 0, len(r.res.Columns))
+	for _, c := range r.res.Columns {
+		out = append(out, c.Name)
+	}
+	return out
+}
+
+// Next moves to the next row, returning false once every row was read.
+func (r *Rows) Next() bool {
+	if r.next >= len(r.res.Rows) {
+		r.row = nil
+		return false
+	}
+	r.row = r.res.Rows[r.next]
+	r.next++
+	return true
+}
+
+// Scan copies the values of the current row into dest, as query.Assign
+// does.
+func (r *Rows) Scan(dest ...any) error {
+	if r.row == nil {
+		return errors.New("scan called without a row")
+	}
+	if len(dest) != len(r.row) {
+		return fmt.Errorf("%d destinations for %d columns", len(dest), len(r.row))
+	}
+	for i, d := range dest {
+		if err := query.Assign(d, r.row[i]); err != nil {
+			return fmt.Errorf("column %s: %w", r.res.Columns[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// Close releases the rows. The rows are read in full by the statement, so
+// it never fails.
+func (r *Rows) Close() error {
+	r.next, r.row = len(r.res.Rows), nil
+	return nil
+}
+
+// Row is a single row of the rows returned by a statement.
+type Row struct {
+	rows *Rows
+	err  error
+}
+
+// Scan copies the values of the row into dest as Rows.Scan does, returning
+// ErrNoRows if the statement returned none.
+func (r *Row) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	if !r.rows.Next() {
+		return ErrNoRows
+	}
+	return r.rows.Scan(dest...)
+}
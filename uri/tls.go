@@ -0,0 +1,61 @@
+package uri
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSConfig returns the configuration of the TLS connections to the server,
+// nil if they are not secured.
+func (u *URI) TLSConfig() (*tls.Config, error) {
+	if u.SSLMode == SSLModeDisable || u.SSLMode == "" {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		ServerName: u.Host,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if u.SSLRootCert != "" {
+		pem, err := os.ReadFile(u.SSLRootCert)
+		if err != nil {
+			return nil, fmt.Errorf("read sslrootcert: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", u.SSLRootCert)
+		}
+	}
+
+	if u.SSLCert != "" {
+		cert, err := tls.LoadX509KeyPair(u.SSLCert, u.SSLKey)
+		if err != nil {
+			return nil, fmt.Errorf("load sslcert: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	switch {
+	case u.SSLMode == SSLModeRequire && u.SSLRootCert == "":
+		cfg.InsecureSkipVerify = true
+	case u.SSLMode != SSLModeVerifyFull:
+		// the chain is verified below, without the host name.
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			opts := x509.VerifyOptions{
+				Roots:         cfg.RootCAs,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, c := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(c)
+			}
+			_, err := cs.PeerCertificates[0].Verify(opts)
+			return err
+		}
+	}
+
+	return cfg, nil
+}
@@ -9,16 +9,45 @@ import (
 
 const Scheme = "filadb"
 
+// DefaultPort is the port of URIs naming none.
+const DefaultPort = "5432"
+
 type User struct {
 	Username string
 	Password string
 }
 
+// SSLMode tells whether connections are secured with TLS, and how the
+// server is verified, as the sslmode parameter of libpq does.
+type SSLMode string
+
+const (
+	SSLModeDisable SSLMode = "disable"
+	// SSLModeRequire does not verify the server, unless given the
+	// certificate authorities to verify it with, like SSLModeVerifyCA.
+	SSLModeRequire SSLMode = "require"
+	// SSLModeVerifyCA verifies that the certificate of the server is signed
+	// by a trusted authority, whatever host it names.
+	SSLModeVerifyCA   SSLMode = "verify-ca"
+	SSLModeVerifyFull SSLMode = "verify-full"
+)
+
+var ErrInvalidParameter = errors.New("invalid parameter")
+
 // URI represents a filadb instance URI
 type URI struct {
 	User *User
 	Host string
 	Port string
+
+	SSLMode SSLMode
+	// SSLRootCert is the PEM file of the certificate authorities verifying
+	// the server, the system ones if empty.
+	SSLRootCert string
+	// SSLCert and SSLKey are the PEM files of the certificate of the client,
+	// for servers requiring one.
+	SSLCert string
+	SSLKey  string
 }
 
 func Parse(uri string) (*URI, error) {
@@ -43,16 +72,31 @@ func Parse(uri string) (*URI, error) {
 	}
 	out.Host = url.Hostname()
 	out.Port = url.Port()
+
+	params := url.Query()
+	out.SSLMode = SSLMode(params.Get("sslmode"))
+	out.SSLRootCert = params.Get("sslrootcert")
+	out.SSLCert = params.Get("sslcert")
+	out.SSLKey = params.Get("sslkey")
+	switch out.SSLMode {
+	case "":
+		out.SSLMode = SSLModeDisable
+	case SSLModeDisable, SSLModeRequire, SSLModeVerifyCA, SSLModeVerifyFull:
+	default:
+		return nil, fmt.Errorf("sslmode %s: %w", out.SSLMode, ErrInvalidParameter)
+	}
+	if (out.SSLCert == "") != (out.SSLKey == "") {
+		return nil, fmt.Errorf("sslcert and sslkey go together: %w", ErrInvalidParameter)
+	}
+
 	return &out, nil
 }
 
-func (u *URI) Address() string {
-	addr := net.JoinHostPort(u.Host, u.Port)
-	if u.User != nil && u.User.Username != "" {
-		if u.User.Password != "" {
-			return fmt.Sprintf("%s:%s@%s", u.User.Username, u.User.Password, addr)
-		}
-		return fmt.Sprintf("%s@%s", u.User.Username, addr)
+// HostPort returns the address to dial, without the credentials.
+func (u *URI) HostPort() string {
+	port := u.Port
+	if port == "" {
+		port = DefaultPort
 	}
-	return addr
+	return net.JoinHostPort(u.Host, port)
 }